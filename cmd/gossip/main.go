@@ -0,0 +1,138 @@
+// Command gossip runs an agent from the shell. Piped input is sent along with the prompt,
+// so agents compose with other commands:
+//
+//	cat notes.txt | gossip -m anthropic:claude-3-7-sonnet-latest -p "summarize"
+//	git diff | gossip -p "write a commit message" --json | jq -r .text
+//
+// The answer streams to stdout as it is generated, --json prints it once complete. The model
+// defaults to $GOSSIP_MODEL and the provider key is read from its usual environment variable,
+// e.g. ANTHROPIC_API_KEY.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	provider "go.bgeen.com/gossip/providers"
+)
+
+// output is what --json prints.
+type output struct {
+	Model           string   `json:"model"`
+	Text            string   `json:"text"`
+	Reasoning       string   `json:"reasoning,omitempty"`
+	Refused         bool     `json:"refused,omitempty"`
+	InputTokens     int      `json:"input_tokens"`
+	OutputTokens    int      `json:"output_tokens"`
+	ReasoningTokens int      `json:"reasoning_tokens,omitempty"`
+	CostUSD         float64  `json:"cost_usd"`
+	LatencyMs       int64    `json:"latency_ms"`
+	RequestIDs      []string `json:"request_ids,omitempty"`
+}
+
+func main() {
+	model := flag.String("m", os.Getenv("GOSSIP_MODEL"), "model, e.g. openai:gpt-4o-mini")
+	prompt := flag.String("p", "", "prompt; piped input is appended to it")
+	system := flag.String("s", "", "system prompt")
+	asJSON := flag.Bool("json", false, "print the answer and usage as JSON")
+	flag.Parse()
+	log.SetFlags(0)
+	log.SetPrefix("gossip: ")
+
+	if *model == "" {
+		log.Fatal("no model, pass -m or set GOSSIP_MODEL")
+	}
+	input, err := readInput()
+	if err != nil {
+		log.Fatal(err)
+	}
+	text := strings.TrimSpace(strings.Join(append([]string{*prompt}, flag.Args()...), " "))
+	if input != "" {
+		if text == "" {
+			text = input
+		} else {
+			text += "\n\n<input>\n" + input + "\n</input>"
+		}
+	}
+	if text == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var opts []provider.AgentOption
+	if *system != "" {
+		opts = append(opts, provider.WithSystemPrompt(*system))
+	}
+	agent, err := provider.NewAgent(*model, opts...)
+	if err != nil {
+		log.Fatalf("%s: %v", *model, err)
+	}
+	if !*asJSON {
+		if err := stream(agent, text); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	result, err := agent.Run(text)
+	if err != nil {
+		log.Fatal(err)
+	}
+	out := output{Model: *model, Text: result.Text, Reasoning: result.Reasoning, Refused: result.Refused(), CostUSD: result.Cost(), LatencyMs: result.Latency().Milliseconds(), RequestIDs: result.RequestIDs}
+	for _, stats := range result.RoundTrips {
+		out.InputTokens += stats.InputTokens
+		out.OutputTokens += stats.OutputTokens
+		out.ReasoningTokens += stats.ReasoningTokens
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(out); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// stream prints the answer to prompt as it comes in.
+func stream(agent provider.Agent, prompt string) error {
+	streamed := false
+	for event := range agent.RunStream(context.Background(), prompt) {
+		switch event.Type {
+		case provider.StreamText:
+			fmt.Print(event.Text)
+			streamed = true
+		case provider.StreamRestart:
+			// what was printed can't be taken back, the answer starts over on a new line
+			fmt.Println()
+			log.Print("stream stalled, answering again")
+		case provider.StreamDone:
+			if event.Err != nil {
+				if streamed {
+					fmt.Println()
+				}
+				return event.Err
+			}
+			if !streamed {
+				fmt.Print(event.Result.Text) // nothing was streamed, e.g. a cached answer
+			}
+		}
+	}
+	fmt.Println()
+	return nil
+}
+
+// readInput reads stdin when it is a pipe or a file rather than a terminal.
+func readInput() (string, error) {
+	info, err := os.Stdin.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice != 0 {
+		return "", nil
+	}
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
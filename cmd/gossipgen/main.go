@@ -0,0 +1,313 @@
+// Command gossipgen generates static tool schemas and typed dispatchers for tool
+// parameter structs, so agents registering those tools skip per-call reflection.
+//
+// Add a directive next to the tool definitions and run go generate:
+//
+//	//go:generate go run go.bgeen.com/gossip/cmd/gossipgen -type ParamsFindCityTemp
+//
+// Every package level function taking exactly one of the listed types gets a dispatcher.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const importPath = "go.bgeen.com/gossip/providers"
+
+func main() {
+	typeNames := flag.String("type", "", "comma separated list of tool parameter struct names")
+	output := flag.String("output", "gossip_gen.go", "output file name, relative to the package directory")
+	flag.Parse()
+	log.SetFlags(0)
+	log.SetPrefix("gossipgen: ")
+
+	if *typeNames == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	dir := "."
+	if flag.NArg() > 0 {
+		dir = flag.Arg(0)
+	}
+
+	pkg, err := loadPackage(dir, *output)
+	if err != nil {
+		log.Fatal(err)
+	}
+	source, err := pkg.generate(strings.Split(*typeNames, ","))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, *output), source, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+type packageInfo struct {
+	name  string
+	types map[string]ast.Expr // type name -> type expression
+	funcs []*ast.FuncDecl
+}
+
+func loadPackage(dir string, output string) (*packageInfo, error) {
+	fset := token.NewFileSet()
+	skip := func(info os.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go") && info.Name() != output
+	}
+	pkgs, err := parser.ParseDir(fset, dir, skip, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, err
+	}
+	if len(pkgs) != 1 {
+		return nil, fmt.Errorf("expected one package in %s, found %d", dir, len(pkgs))
+	}
+
+	pkg := &packageInfo{types: make(map[string]ast.Expr)}
+	for name, astPkg := range pkgs {
+		pkg.name = name
+		fileNames := make([]string, 0, len(astPkg.Files))
+		for fileName := range astPkg.Files {
+			fileNames = append(fileNames, fileName)
+		}
+		sort.Strings(fileNames)
+		for _, fileName := range fileNames {
+			for _, decl := range astPkg.Files[fileName].Decls {
+				switch decl := decl.(type) {
+				case *ast.GenDecl:
+					for _, spec := range decl.Specs {
+						if typeSpec, ok := spec.(*ast.TypeSpec); ok {
+							pkg.types[typeSpec.Name.Name] = typeSpec.Type
+						}
+					}
+				case *ast.FuncDecl:
+					if decl.Recv == nil {
+						pkg.funcs = append(pkg.funcs, decl)
+					}
+				}
+			}
+		}
+	}
+	return pkg, nil
+}
+
+func (pkg *packageInfo) generate(typeNames []string) ([]byte, error) {
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by gossipgen; DO NOT EDIT.\n\npackage %s\n\n", pkg.name)
+
+	var body bytes.Buffer
+	usesJson := false
+	for _, typeName := range typeNames {
+		typeName = strings.TrimSpace(typeName)
+		structType, exists := pkg.types[typeName].(*ast.StructType)
+		if !exists {
+			return nil, fmt.Errorf("struct type %s not found", typeName)
+		}
+
+		fmt.Fprintf(&body, "\tprovider.RegisterSchema(reflect.TypeOf(%s{}), provider.Properties{\n", typeName)
+		var required []string
+		for _, field := range structType.Fields.List {
+			names, optional := fieldNames(field)
+			for _, name := range names {
+				fmt.Fprintf(&body, "\t\t%q: %s,\n", name, pkg.property(field, 0))
+				if !optional {
+					required = append(required, strconv.Quote(name))
+				}
+			}
+		}
+		fmt.Fprintf(&body, "\t}, []string{%s})\n", strings.Join(required, ", "))
+
+		validated := pkg.hasValidateTags(structType, 0)
+		for _, fn := range pkg.funcs {
+			if !takesOnly(fn, typeName) || fn.Type.Results.NumFields() == 0 {
+				continue
+			}
+			usesJson = true
+			results := make([]string, fn.Type.Results.NumFields())
+			results[0] = "output"
+			for i := 1; i < len(results); i++ {
+				results[i] = "_"
+			}
+			fmt.Fprintf(&body, "\tprovider.RegisterDispatcher(%s, func(arguments string) (any, error) {\n", fn.Name.Name)
+			fmt.Fprintf(&body, "\t\tvar params %s\n", typeName)
+			fmt.Fprintf(&body, "\t\tif err := json.Unmarshal([]byte(arguments), &params); err != nil {\n\t\t\treturn nil, err\n\t\t}\n")
+			if validated {
+				fmt.Fprintf(&body, "\t\tif err := provider.ValidateStruct(&params); err != nil {\n\t\t\treturn nil, err\n\t\t}\n")
+			}
+			fmt.Fprintf(&body, "\t\t%s := %s(params)\n\t\treturn output, nil\n\t})\n", strings.Join(results, ", "), fn.Name.Name)
+		}
+	}
+
+	out.WriteString("import (\n")
+	if usesJson {
+		out.WriteString("\t\"encoding/json\"\n")
+	}
+	fmt.Fprintf(&out, "\t\"reflect\"\n\n\tprovider %q\n)\n\nfunc init() {\n", importPath)
+	out.Write(body.Bytes())
+	out.WriteString("}\n")
+
+	source, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated code: %w\n%s", err, out.Bytes())
+	}
+	return source, nil
+}
+
+// fieldNames mirrors ConvertToProperties: the name of the json tag, else the lowercased field name.
+// Unexported fields and fields tagged json:"-" have none, fields tagged omitempty are optional.
+func fieldNames(field *ast.Field) (names []string, optional bool) {
+	tagName, options, _ := strings.Cut(tagValue(field, "json"), ",")
+	if tagName == "-" {
+		return nil, false
+	}
+	optional = slices.Contains(strings.Split(options, ","), "omitempty")
+	goNames := []string{typeIdent(field.Type)} // embedded field
+	if len(field.Names) > 0 {
+		goNames = goNames[:0]
+		for _, name := range field.Names {
+			goNames = append(goNames, name.Name)
+		}
+	}
+	for _, goName := range goNames {
+		if !ast.IsExported(goName) {
+			continue
+		}
+		name := tagName
+		if name == "" {
+			name = strings.ToLower(goName)
+		}
+		names = append(names, name)
+	}
+	return names, optional
+}
+
+func tagValue(field *ast.Field, key string) string {
+	if field.Tag == nil {
+		return ""
+	}
+	tag, err := strconv.Unquote(field.Tag.Value)
+	if err != nil {
+		return ""
+	}
+	return reflect.StructTag(tag).Get(key)
+}
+
+func typeIdent(expr ast.Expr) string {
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		return expr.Name
+	case *ast.StarExpr:
+		return typeIdent(expr.X)
+	case *ast.SelectorExpr:
+		return expr.Sel.Name
+	}
+	return ""
+}
+
+// property renders the provider.Property literal of a field, following processField.
+func (pkg *packageInfo) property(field *ast.Field, depth int) string {
+	literal := fmt.Sprintf("{Type: %q", pkg.kind(field.Type))
+	if description := tagValue(field, "description"); description != "" {
+		literal += fmt.Sprintf(", Description: %q", description)
+	}
+	switch fieldType := pkg.resolve(field.Type).(type) {
+	case *ast.ArrayType:
+		literal += fmt.Sprintf(", Items: &provider.Property{Type: %q}", pkg.basicKind(fieldType.Elt))
+	default:
+		if structType := pkg.structOf(field.Type); structType != nil && depth < 16 {
+			literal += ", Properties: map[string]provider.Property{"
+			for _, nested := range structType.Fields.List {
+				names, _ := fieldNames(nested)
+				for _, name := range names {
+					literal += fmt.Sprintf("%q: %s, ", name, pkg.property(nested, depth+1))
+				}
+			}
+			literal += "}"
+		}
+	}
+	return literal + "}"
+}
+
+// resolve follows named types declared in the package to their underlying type, as reflection would.
+func (pkg *packageInfo) resolve(expr ast.Expr) ast.Expr {
+	for range 16 {
+		ident, ok := expr.(*ast.Ident)
+		if !ok {
+			return expr
+		}
+		underlying, exists := pkg.types[ident.Name]
+		if !exists {
+			return expr
+		}
+		expr = underlying
+	}
+	return expr
+}
+
+func (pkg *packageInfo) structOf(expr ast.Expr) *ast.StructType {
+	structType, _ := pkg.resolve(expr).(*ast.StructType)
+	return structType
+}
+
+func (pkg *packageInfo) kind(expr ast.Expr) string {
+	if _, isArray := pkg.resolve(expr).(*ast.ArrayType); isArray {
+		return "array"
+	}
+	return pkg.basicKind(expr)
+}
+
+// basicKind mirrors getBasicType for a type expression.
+func (pkg *packageInfo) basicKind(expr ast.Expr) string {
+	switch expr := pkg.resolve(expr).(type) {
+	case *ast.Ident:
+		switch expr.Name {
+		case "string":
+			return "string"
+		case "int", "int8", "int16", "int32", "int64":
+			return "integer"
+		case "float32", "float64":
+			return "number"
+		case "bool":
+			return "boolean"
+		case "any":
+			return "any"
+		}
+	case *ast.InterfaceType:
+		return "any"
+	}
+	return "object"
+}
+
+func (pkg *packageInfo) hasValidateTags(structType *ast.StructType, depth int) bool {
+	for _, field := range structType.Fields.List {
+		if tagValue(field, "validate") != "" {
+			return true
+		}
+		if nested := pkg.structOf(field.Type); nested != nil && depth < 16 && pkg.hasValidateTags(nested, depth+1) {
+			return true
+		}
+	}
+	return false
+}
+
+func takesOnly(fn *ast.FuncDecl, typeName string) bool {
+	params := fn.Type.Params.List
+	if len(params) != 1 || len(params[0].Names) > 1 {
+		return false
+	}
+	ident, ok := params[0].Type.(*ast.Ident)
+	return ok && ident.Name == typeName
+}
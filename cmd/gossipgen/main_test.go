@@ -0,0 +1,136 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+
+	provider "go.bgeen.com/gossip/providers"
+)
+
+// weatherParams is declared twice: here for ConvertToProperties and in weatherSource for gossipgen.
+type weatherParams struct {
+	City     string   `json:"city,omitempty" description:"the city"`
+	Country  string   `json:"country" validate:"len=2"`
+	Days     int      `json:",omitempty"`
+	Units    []string `json:"units"`
+	Internal string   `json:"-"`
+	cached   bool
+	Location struct {
+		Lat    float64 `json:"lat"`
+		Hidden string  `json:"-"`
+		note   string
+	} `json:"location"`
+}
+
+const weatherSource = `package weather
+
+type weatherParams struct {
+	City     string   ` + "`json:\"city,omitempty\" description:\"the city\"`" + `
+	Country  string   ` + "`json:\"country\" validate:\"len=2\"`" + `
+	Days     int      ` + "`json:\",omitempty\"`" + `
+	Units    []string ` + "`json:\"units\"`" + `
+	Internal string   ` + "`json:\"-\"`" + `
+	cached   bool
+	Location struct {
+		Lat    float64 ` + "`json:\"lat\"`" + `
+		Hidden string  ` + "`json:\"-\"`" + `
+		note   string
+	} ` + "`json:\"location\"`" + `
+}
+
+func Forecast(params weatherParams) string { return "sunny" }
+`
+
+func TestGeneratedSchemaMatchesReflection(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "weather.go"), []byte(weatherSource), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	pkg, err := loadPackage(dir, "gossip_gen.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	source, err := pkg.generate([]string{"weatherParams"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := parser.ParseFile(token.NewFileSet(), "gossip_gen.go", source, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var call *ast.CallExpr
+	ast.Inspect(file, func(node ast.Node) bool {
+		if expr, ok := node.(*ast.CallExpr); ok {
+			if selector, ok := expr.Fun.(*ast.SelectorExpr); ok && selector.Sel.Name == "RegisterSchema" {
+				call = expr
+			}
+		}
+		return call == nil
+	})
+	if call == nil {
+		t.Fatalf("no RegisterSchema call in\n%s", source)
+	}
+	properties := make(provider.Properties)
+	for _, element := range call.Args[1].(*ast.CompositeLit).Elts {
+		entry := element.(*ast.KeyValueExpr)
+		properties[stringLit(t, entry.Key)] = evalProperty(t, entry.Value)
+	}
+	var required []string
+	for _, element := range call.Args[2].(*ast.CompositeLit).Elts {
+		required = append(required, stringLit(t, element))
+	}
+
+	wantProperties, wantRequired := provider.ConvertToProperties(weatherParams{})
+	if !reflect.DeepEqual(properties, wantProperties) {
+		t.Errorf("generated properties %+v, reflection gives %+v", properties, wantProperties)
+	}
+	if !reflect.DeepEqual(required, wantRequired) {
+		t.Errorf("generated required %q, reflection gives %q", required, wantRequired)
+	}
+}
+
+// evalProperty evaluates a generated provider.Property literal.
+func evalProperty(t *testing.T, expr ast.Expr) provider.Property {
+	t.Helper()
+	if unary, ok := expr.(*ast.UnaryExpr); ok {
+		expr = unary.X
+	}
+	var property provider.Property
+	for _, element := range expr.(*ast.CompositeLit).Elts {
+		field := element.(*ast.KeyValueExpr)
+		switch name := field.Key.(*ast.Ident).Name; name {
+		case "Type":
+			property.Type = stringLit(t, field.Value)
+		case "Description":
+			property.Description = stringLit(t, field.Value)
+		case "Items":
+			items := evalProperty(t, field.Value)
+			property.Items = &items
+		case "Properties":
+			property.Properties = make(map[string]provider.Property)
+			for _, nested := range field.Value.(*ast.CompositeLit).Elts {
+				entry := nested.(*ast.KeyValueExpr)
+				property.Properties[stringLit(t, entry.Key)] = evalProperty(t, entry.Value)
+			}
+		default:
+			t.Fatalf("unexpected property field %s", name)
+		}
+	}
+	return property
+}
+
+func stringLit(t *testing.T, expr ast.Expr) string {
+	t.Helper()
+	value, err := strconv.Unquote(expr.(*ast.BasicLit).Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
@@ -0,0 +1,109 @@
+package eval
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	provider "go.bgeen.com/gossip/providers"
+)
+
+// DatasetCase is the serialized form of a Case:
+//
+//	{"name": "kolkata weather", "input": "whats the temperature in kolkata?",
+//	 "expect": {"contains": ["26"], "tool_called": ["FindCityTemp"], "json": {"city": "kolkata"}}}
+type DatasetCase struct {
+	Name      string             `json:"name"`
+	Input     string             `json:"input"`
+	History   []provider.Message `json:"history,omitempty"`
+	Expect    DatasetExpectation `json:"expect"`
+	Reference string             `json:"reference,omitempty"` // known good answer for a judge
+}
+
+type DatasetExpectation struct {
+	Contains      []string       `json:"contains,omitempty"`
+	NotContains   []string       `json:"not_contains,omitempty"`
+	Regex         []string       `json:"regex,omitempty"`
+	JSON          map[string]any `json:"json,omitempty"` // path -> expected value
+	ToolCalled    []string       `json:"tool_called,omitempty"`
+	ToolNotCalled []string       `json:"tool_not_called,omitempty"`
+}
+
+// LoadDataset reads cases from a JSON array or a JSON lines file.
+func LoadDataset(path string) ([]Case, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var datasetCases []DatasetCase
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &datasetCases); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+		for line := 1; scanner.Scan(); line++ {
+			if strings.TrimSpace(scanner.Text()) == "" {
+				continue
+			}
+			var datasetCase DatasetCase
+			if err := json.Unmarshal(scanner.Bytes(), &datasetCase); err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+			}
+			datasetCases = append(datasetCases, datasetCase)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	cases := make([]Case, 0, len(datasetCases))
+	for i, datasetCase := range datasetCases {
+		if datasetCase.Name == "" {
+			datasetCase.Name = fmt.Sprintf("case %d", i+1)
+		}
+		cases = append(cases, datasetCase.toCase())
+	}
+	return cases, nil
+}
+
+func (datasetCase DatasetCase) toCase() Case {
+	expect := datasetCase.Expect
+	var matchers []Matcher
+	for _, substr := range expect.Contains {
+		matchers = append(matchers, Contains(substr))
+	}
+	for _, substr := range expect.NotContains {
+		matchers = append(matchers, NotContains(substr))
+	}
+	for _, pattern := range expect.Regex {
+		matchers = append(matchers, Regex(pattern))
+	}
+	paths := make([]string, 0, len(expect.JSON))
+	for path := range expect.JSON {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		matchers = append(matchers, JSONFieldEquals(path, expect.JSON[path]))
+	}
+	for _, name := range expect.ToolCalled {
+		matchers = append(matchers, ToolCalled(name))
+	}
+	for _, name := range expect.ToolNotCalled {
+		matchers = append(matchers, ToolNotCalled(name))
+	}
+	return Case{
+		Name:      datasetCase.Name,
+		Input:     datasetCase.Input,
+		History:   datasetCase.History,
+		Expect:    matchers,
+		Reference: datasetCase.Reference,
+	}
+}
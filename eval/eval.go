@@ -0,0 +1,200 @@
+// Package eval runs test cases against agents and reports which expectations hold.
+//
+//	cases := []eval.Case{{
+//		Name:   "kolkata weather",
+//		Input:  "whats the current temperature in kolkata?",
+//		Expect: []eval.Matcher{eval.ToolCalled("FindCityTemp"), eval.Contains("26")},
+//	}}
+//	report := eval.Run(cases, eval.Target{Name: "sonnet", Agent: agent})
+//	fmt.Println(report)
+package eval
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	provider "go.bgeen.com/gossip/providers"
+)
+
+type Case struct {
+	Name    string
+	Input   string
+	History []provider.Message
+	Expect  []Matcher
+
+	// Judge optionally grades the answer; the case fails when any score is below MinScore.
+	Judge     *Judge
+	MinScore  float64
+	Reference string // known good answer shown to the judge
+}
+
+// Target is an agent under evaluation.
+type Target struct {
+	Name  string
+	Agent provider.Agent
+}
+
+type CaseResult struct {
+	Case     string
+	Target   string
+	Passed   bool
+	Failures []string
+	Err      error
+	Latency  time.Duration
+	Scores   []Score
+	Result   *provider.AgentResult
+}
+
+type TargetStats struct {
+	Target      string
+	Passed      int
+	Failed      int
+	Errors      int
+	MeanLatency time.Duration
+	P95Latency  time.Duration
+	MaxLatency  time.Duration
+	MeanScores  map[string]float64 // criterion -> mean judge score
+}
+
+type Report struct {
+	Results []CaseResult
+	Stats   []TargetStats // one entry per target, in target order
+}
+
+// Run executes every case against every target, sequentially.
+func Run(cases []Case, targets ...Target) *Report {
+	report := &Report{}
+	for _, target := range targets {
+		var latencies []time.Duration
+		stats := TargetStats{Target: target.Name}
+		scoreTotals := make(map[string]float64)
+		scoreCounts := make(map[string]int)
+		for _, c := range cases {
+			caseResult := runCase(c, target)
+			report.Results = append(report.Results, caseResult)
+			latencies = append(latencies, caseResult.Latency)
+			for _, score := range caseResult.Scores {
+				scoreTotals[score.Criterion] += score.Score
+				scoreCounts[score.Criterion]++
+			}
+			switch {
+			case caseResult.Err != nil:
+				stats.Errors++
+			case caseResult.Passed:
+				stats.Passed++
+			default:
+				stats.Failed++
+			}
+		}
+		stats.MeanLatency, stats.P95Latency, stats.MaxLatency = latencyStats(latencies)
+		if len(scoreTotals) > 0 {
+			stats.MeanScores = make(map[string]float64)
+			for criterion, total := range scoreTotals {
+				stats.MeanScores[criterion] = total / float64(scoreCounts[criterion])
+			}
+		}
+		report.Stats = append(report.Stats, stats)
+	}
+	return report
+}
+
+func runCase(c Case, target Target) CaseResult {
+	caseResult := CaseResult{Case: c.Name, Target: target.Name}
+	var history [][]provider.Message
+	if len(c.History) > 0 {
+		history = append(history, c.History)
+	}
+
+	start := time.Now()
+	result, err := target.Agent.Run(c.Input, history...)
+	caseResult.Latency = time.Since(start)
+	caseResult.Result = result
+	if err != nil {
+		caseResult.Err = err
+		return caseResult
+	}
+
+	for _, matcher := range c.Expect {
+		if failure := matcher(result); failure != nil {
+			caseResult.Failures = append(caseResult.Failures, failure.Error())
+		}
+	}
+	if c.Judge != nil {
+		scores, err := c.Judge.Grade(c.Input, result.Text, c.Reference)
+		if err != nil {
+			caseResult.Err = err
+			return caseResult
+		}
+		caseResult.Scores = scores
+		for _, score := range scores {
+			if score.Score < c.MinScore {
+				caseResult.Failures = append(caseResult.Failures, fmt.Sprintf("%s scored %g, below %g: %s", score.Criterion, score.Score, c.MinScore, score.Rationale))
+			}
+		}
+	}
+	caseResult.Passed = len(caseResult.Failures) == 0
+	return caseResult
+}
+
+func latencyStats(latencies []time.Duration) (mean time.Duration, p95 time.Duration, max time.Duration) {
+	if len(latencies) == 0 {
+		return 0, 0, 0
+	}
+	sorted := append([]time.Duration(nil), latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	var total time.Duration
+	for _, latency := range sorted {
+		total += latency
+	}
+	index := (len(sorted)*95+99)/100 - 1
+	return total / time.Duration(len(sorted)), sorted[index], sorted[len(sorted)-1]
+}
+
+// Passed reports whether every case passed on every target.
+func (report *Report) Passed() bool {
+	for _, result := range report.Results {
+		if !result.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+func (report *Report) String() string {
+	var out strings.Builder
+	for _, result := range report.Results {
+		status := "PASS"
+		switch {
+		case result.Err != nil:
+			status = "ERROR"
+		case !result.Passed:
+			status = "FAIL"
+		}
+		fmt.Fprintf(&out, "%-5s %s / %s (%s)\n", status, result.Target, result.Case, result.Latency.Round(time.Millisecond))
+		if result.Err != nil {
+			fmt.Fprintf(&out, "      %v\n", result.Err)
+		}
+		for _, failure := range result.Failures {
+			fmt.Fprintf(&out, "      %s\n", failure)
+		}
+		for _, score := range result.Scores {
+			fmt.Fprintf(&out, "      %s %g: %s\n", score.Criterion, score.Score, score.Rationale)
+		}
+	}
+	for _, stats := range report.Stats {
+		fmt.Fprintf(&out, "%s: %d passed, %d failed, %d errors, latency mean %s p95 %s max %s\n",
+			stats.Target, stats.Passed, stats.Failed, stats.Errors,
+			stats.MeanLatency.Round(time.Millisecond), stats.P95Latency.Round(time.Millisecond), stats.MaxLatency.Round(time.Millisecond))
+		criteria := make([]string, 0, len(stats.MeanScores))
+		for criterion := range stats.MeanScores {
+			criteria = append(criteria, criterion)
+		}
+		sort.Strings(criteria)
+		for _, criterion := range criteria {
+			fmt.Fprintf(&out, "  mean %s %.2f\n", criterion, stats.MeanScores[criterion])
+		}
+	}
+	return out.String()
+}
@@ -0,0 +1,102 @@
+package eval
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	provider "go.bgeen.com/gossip/providers"
+)
+
+// Criterion is one dimension a judge grades an answer on.
+type Criterion struct {
+	Name        string
+	Description string
+}
+
+var (
+	Correctness = Criterion{"correctness", "Is the answer factually correct, consistent with the reference answer when one is given, and complete?"}
+	Relevance   = Criterion{"relevance", "Does the answer address the question that was asked, without unrelated content?"}
+	Tone        = Criterion{"tone", "Is the answer polite, clear and appropriately concise for the question?"}
+)
+
+// Score is a judge's grade for one criterion, from 1 to the judge's scale.
+type Score struct {
+	Criterion string  `json:"criterion"`
+	Score     float64 `json:"score"`
+	Rationale string  `json:"rationale"`
+}
+
+// Judge grades agent answers with a second model.
+type Judge struct {
+	Agent    provider.Agent
+	Criteria []Criterion
+	Scale    int // highest possible score, 5 when unset
+}
+
+const judgeSystemPrompt = "You are a strict, impartial grader of AI assistant answers. Grade only what is asked and answer with JSON only."
+
+// NewJudge creates a judge backed by modelName, e.g. "openai:gpt-4o-mini".
+// Without criteria it grades Correctness and Relevance.
+func NewJudge(modelName string, criteria ...Criterion) (*Judge, error) {
+	agent, err := provider.NewAgent(modelName, provider.WithSystemPrompt(judgeSystemPrompt))
+	if err != nil {
+		return nil, err
+	}
+	if len(criteria) == 0 {
+		criteria = []Criterion{Correctness, Relevance}
+	}
+	return &Judge{Agent: agent, Criteria: criteria}, nil
+}
+
+func (judge *Judge) scale() int {
+	if judge.Scale <= 0 {
+		return 5
+	}
+	return judge.Scale
+}
+
+// Grade scores output as an answer to input. reference is an optional known good answer.
+func (judge *Judge) Grade(input string, output string, reference string) ([]Score, error) {
+	var prompt strings.Builder
+	fmt.Fprintf(&prompt, "Grade the answer below on each criterion with an integer from 1 (worst) to %d (best).\n\nCriteria:\n", judge.scale())
+	for _, criterion := range judge.Criteria {
+		fmt.Fprintf(&prompt, "- %s: %s\n", criterion.Name, criterion.Description)
+	}
+	fmt.Fprintf(&prompt, "\n<question>\n%s\n</question>\n", input)
+	if reference != "" {
+		fmt.Fprintf(&prompt, "\n<reference_answer>\n%s\n</reference_answer>\n", reference)
+	}
+	fmt.Fprintf(&prompt, "\n<answer>\n%s\n</answer>\n", output)
+	prompt.WriteString(`
+Respond with JSON only, in this shape:
+{"scores": [{"criterion": "<name>", "score": <integer>, "rationale": "<one or two sentences>"}]}`)
+
+	result, err := judge.Agent.Run(prompt.String())
+	if err != nil {
+		return nil, fmt.Errorf("judge: %w", err)
+	}
+	var graded struct {
+		Scores []Score `json:"scores"`
+	}
+	if err := json.Unmarshal([]byte(stripCodeFence(result.Text)), &graded); err != nil {
+		return nil, fmt.Errorf("judge returned invalid json: %w", err)
+	}
+
+	scores := make([]Score, 0, len(judge.Criteria))
+	for _, criterion := range judge.Criteria {
+		found := false
+		for _, score := range graded.Scores {
+			if strings.EqualFold(score.Criterion, criterion.Name) {
+				score.Criterion = criterion.Name
+				scores = append(scores, score)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("judge did not grade %s", criterion.Name)
+		}
+	}
+	return scores, nil
+}
@@ -0,0 +1,137 @@
+package eval
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	provider "go.bgeen.com/gossip/providers"
+)
+
+// Matcher checks one expected property of an agent result and returns a description of the mismatch, or nil.
+type Matcher func(result *provider.AgentResult) error
+
+// Contains expects the final text to contain substr, ignoring case.
+func Contains(substr string) Matcher {
+	return func(result *provider.AgentResult) error {
+		if !strings.Contains(strings.ToLower(result.Text), strings.ToLower(substr)) {
+			return fmt.Errorf("text does not contain %q", substr)
+		}
+		return nil
+	}
+}
+
+// NotContains expects the final text not to contain substr, ignoring case.
+func NotContains(substr string) Matcher {
+	return func(result *provider.AgentResult) error {
+		if strings.Contains(strings.ToLower(result.Text), strings.ToLower(substr)) {
+			return fmt.Errorf("text contains %q", substr)
+		}
+		return nil
+	}
+}
+
+// Regex expects the final text to match pattern.
+func Regex(pattern string) Matcher {
+	re, err := regexp.Compile(pattern)
+	return func(result *provider.AgentResult) error {
+		if err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		if !re.MatchString(result.Text) {
+			return fmt.Errorf("text does not match /%s/", pattern)
+		}
+		return nil
+	}
+}
+
+// JSONFieldEquals parses the final text as JSON and expects the value at path
+// (dot separated, with numeric segments indexing arrays, e.g. "items.0.name") to equal expected.
+func JSONFieldEquals(path string, expected any) Matcher {
+	return func(result *provider.AgentResult) error {
+		var document any
+		if err := json.Unmarshal([]byte(stripCodeFence(result.Text)), &document); err != nil {
+			return fmt.Errorf("text is not valid json: %w", err)
+		}
+		actual, err := lookupPath(document, path)
+		if err != nil {
+			return err
+		}
+		// normalize expected to the types encoding/json produces
+		encoded, err := json.Marshal(expected)
+		if err != nil {
+			return err
+		}
+		var want any
+		if err := json.Unmarshal(encoded, &want); err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(actual, want) {
+			return fmt.Errorf("json field %s is %v, expected %v", path, actual, want)
+		}
+		return nil
+	}
+}
+
+// ToolCalled expects the agent to have called the named tool during the run.
+func ToolCalled(name string) Matcher {
+	return func(result *provider.AgentResult) error {
+		for _, msg := range result.NewMessages {
+			if msg.ToolIntent != nil && msg.ToolIntent.Name == name {
+				return nil
+			}
+		}
+		return fmt.Errorf("tool %s was not called", name)
+	}
+}
+
+// ToolNotCalled expects the agent not to have called the named tool.
+func ToolNotCalled(name string) Matcher {
+	return func(result *provider.AgentResult) error {
+		if ToolCalled(name)(result) == nil {
+			return fmt.Errorf("tool %s was called", name)
+		}
+		return nil
+	}
+}
+
+func stripCodeFence(text string) string {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "```") {
+		return text
+	}
+	text = strings.TrimPrefix(text, "```")
+	if newline := strings.IndexByte(text, '\n'); newline >= 0 {
+		text = text[newline+1:] // drop the language tag
+	}
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(text), "```"))
+}
+
+func lookupPath(document any, path string) (any, error) {
+	current := document
+	if path == "" {
+		return current, nil
+	}
+	for _, segment := range strings.Split(path, ".") {
+		switch node := current.(type) {
+		case map[string]any:
+			value, exists := node[segment]
+			if !exists {
+				return nil, fmt.Errorf("json field %s not found", path)
+			}
+			current = value
+		case []any:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil, fmt.Errorf("json field %s not found", path)
+			}
+			current = node[index]
+		default:
+			return nil, fmt.Errorf("json field %s not found", path)
+		}
+	}
+	return current, nil
+}
@@ -0,0 +1,151 @@
+package eval
+
+import (
+	"fmt"
+	"strings"
+
+	provider "go.bgeen.com/gossip/providers"
+)
+
+// Scenario scripts a simulated user for a multi-turn conversation.
+type Scenario struct {
+	Name     string
+	Persona  string // who the user is, e.g. "an impatient customer who writes in short sentences"
+	Goal     string // what the user is trying to get done
+	Opening  string // first user message; the simulated user writes one when empty
+	MaxTurns int    // user turns before giving up, 6 when unset
+
+	// Expect is checked against the agent's last result once the conversation ends.
+	Expect []Matcher
+}
+
+// SimulatedUser plays the user side of a scenario with a second model.
+type SimulatedUser struct {
+	Agent provider.Agent
+}
+
+// simulationDone is what the simulated user answers once the goal is reached.
+const simulationDone = "[DONE]"
+
+const simulatedUserSystemPrompt = `You are role-playing a human user talking to an AI assistant, to test the assistant.
+Stay in character, write only the user's next message and never reveal that you are simulating.
+When your goal has been fully achieved, answer with ` + simulationDone + ` and nothing else.`
+
+// NewSimulatedUser creates a simulated user backed by modelName, usually a cheap one like "openai:gpt-4o-mini".
+func NewSimulatedUser(modelName string) (*SimulatedUser, error) {
+	agent, err := provider.NewAgent(modelName, provider.WithSystemPrompt(simulatedUserSystemPrompt))
+	if err != nil {
+		return nil, err
+	}
+	return &SimulatedUser{Agent: agent}, nil
+}
+
+// Simulation is the outcome of one simulated conversation.
+type Simulation struct {
+	Scenario  string
+	Messages  []provider.Message // full conversation as the agent saw it
+	Turns     int                // user turns taken
+	Completed bool               // the simulated user reached its goal within MaxTurns
+	Passed    bool
+	Failures  []string
+	Err       error
+	Result    *provider.AgentResult // the agent's last result
+}
+
+// Simulate drives agent through scenario, alternating simulated user turns and agent runs,
+// until the user reports its goal reached or MaxTurns is exhausted.
+func (user *SimulatedUser) Simulate(scenario Scenario, agent provider.Agent) *Simulation {
+	simulation := &Simulation{Scenario: scenario.Name}
+	maxTurns := scenario.MaxTurns
+	if maxTurns <= 0 {
+		maxTurns = 6
+	}
+
+	message := scenario.Opening
+	for simulation.Turns < maxTurns {
+		if message == "" || simulation.Turns > 0 {
+			next, err := user.nextMessage(scenario, simulation.Messages)
+			if err != nil {
+				simulation.Err = err
+				return simulation
+			}
+			if next == simulationDone {
+				simulation.Completed = true
+				break
+			}
+			message = next
+		}
+
+		var history [][]provider.Message
+		if len(simulation.Messages) > 0 {
+			history = append(history, simulation.Messages)
+		}
+		result, err := agent.Run(message, history...)
+		simulation.Turns++
+		if err != nil {
+			simulation.Err = fmt.Errorf("turn %d: %w", simulation.Turns, err)
+			return simulation
+		}
+		simulation.Result = result
+		simulation.Messages = result.AllMessages
+	}
+
+	if !simulation.Completed {
+		simulation.Failures = append(simulation.Failures, fmt.Sprintf("goal not reached within %d turns", maxTurns))
+	}
+	if simulation.Result != nil {
+		for _, matcher := range scenario.Expect {
+			if failure := matcher(simulation.Result); failure != nil {
+				simulation.Failures = append(simulation.Failures, failure.Error())
+			}
+		}
+	}
+	simulation.Passed = len(simulation.Failures) == 0
+	return simulation
+}
+
+func (user *SimulatedUser) nextMessage(scenario Scenario, messages []provider.Message) (string, error) {
+	var prompt strings.Builder
+	fmt.Fprintf(&prompt, "<persona>\n%s\n</persona>\n\n<goal>\n%s\n</goal>\n\n", scenario.Persona, scenario.Goal)
+	if len(messages) == 0 {
+		prompt.WriteString("Write your first message to the assistant.")
+	} else {
+		prompt.WriteString("<conversation>\n")
+		for _, msg := range messages {
+			if msg.ToolIntent != nil || msg.ToolResult != nil || msg.Text == "" {
+				continue // the user does not see tool traffic
+			}
+			role := "you"
+			if msg.Role == "assistant" {
+				role = "assistant"
+			}
+			fmt.Fprintf(&prompt, "%s: %s\n", role, msg.Text)
+		}
+		fmt.Fprintf(&prompt, "</conversation>\n\nWrite your next message, or %s if your goal has been achieved.", simulationDone)
+	}
+
+	result, err := user.Agent.Run(prompt.String())
+	if err != nil {
+		return "", fmt.Errorf("simulated user: %w", err)
+	}
+	return strings.TrimSpace(result.Text), nil
+}
+
+func (simulation *Simulation) String() string {
+	var out strings.Builder
+	status := "PASS"
+	switch {
+	case simulation.Err != nil:
+		status = "ERROR"
+	case !simulation.Passed:
+		status = "FAIL"
+	}
+	fmt.Fprintf(&out, "%-5s %s (%d turns)\n", status, simulation.Scenario, simulation.Turns)
+	if simulation.Err != nil {
+		fmt.Fprintf(&out, "      %v\n", simulation.Err)
+	}
+	for _, failure := range simulation.Failures {
+		fmt.Fprintf(&out, "      %s\n", failure)
+	}
+	return out.String()
+}
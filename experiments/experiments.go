@@ -0,0 +1,226 @@
+// Package experiments splits traffic between agent variants and compares their quality, cost and latency.
+//
+//	exp, _ := experiments.New("support-model-upgrade",
+//		experiments.Variant{Name: "control", Model: "openai:gpt-4o-mini", Weight: 90},
+//		experiments.Variant{Name: "sonnet", Model: "anthropic:claude-3-7-sonnet-latest", Weight: 10},
+//	)
+//	run, err := exp.RunContext(ctx, userID, prompt)
+//	...
+//	exp.RecordQuality(run.Variant, thumbsUp) // e.g. 1 or 0 from user feedback
+//	fmt.Println(exp)
+//
+// Units (users, conversations) stick to a variant, so they get a consistent experience.
+package experiments
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	provider "go.bgeen.com/gossip/providers"
+)
+
+// Variant is one arm of an experiment.
+type Variant struct {
+	Name         string
+	Model        string
+	SystemPrompt string
+	Temperature  float32
+	Weight       int // share of the traffic relative to the other variants, 1 when unset
+	Options      []provider.AgentOption
+}
+
+// Run is a run made by an experiment.
+type Run struct {
+	Variant string
+	Result  *provider.AgentResult
+}
+
+// VariantStats aggregates the runs of a variant.
+type VariantStats struct {
+	Variant      string
+	Runs         int
+	Errors       int
+	MeanLatency  time.Duration
+	P95Latency   time.Duration
+	InputTokens  int
+	OutputTokens int
+	CostUSD      float64 // needs Experiment.Price
+	Quality      float64 // mean of the recorded quality scores
+	QualityCount int
+}
+
+// Experiment routes runs to its variants' agents.
+type Experiment struct {
+	Name  string
+	Price provider.PriceFunc // prices round trips for the cost metrics, optional
+
+	variants []Variant
+	agents   []provider.Agent
+	total    int
+
+	mu        sync.Mutex
+	latencies [][]time.Duration
+	stats     []VariantStats
+}
+
+// New creates an agent per variant, tagged "experiment:<name>" and "variant:<variant name>"
+// so the usage report breaks costs down by variant too.
+func New(name string, variants ...Variant) (*Experiment, error) {
+	if len(variants) == 0 {
+		return nil, fmt.Errorf("experiment %s has no variants", name)
+	}
+	exp := &Experiment{Name: name, latencies: make([][]time.Duration, len(variants)), stats: make([]VariantStats, len(variants))}
+	seen := make(map[string]bool)
+	for i, variant := range variants {
+		if variant.Name == "" || seen[variant.Name] {
+			return nil, fmt.Errorf("experiment %s: variants need distinct names", name)
+		}
+		seen[variant.Name] = true
+		if variant.Weight <= 0 {
+			variant.Weight = 1
+		}
+		opts := []provider.AgentOption{provider.WithTags("experiment:"+name, "variant:"+variant.Name)}
+		if variant.SystemPrompt != "" {
+			opts = append(opts, provider.WithSystemPrompt(variant.SystemPrompt))
+		}
+		if variant.Temperature != 0 {
+			opts = append(opts, provider.WithTemperature(variant.Temperature))
+		}
+		agent, err := provider.NewAgent(variant.Model, append(opts, variant.Options...)...)
+		if err != nil {
+			return nil, fmt.Errorf("experiment %s, variant %s: %w", name, variant.Name, err)
+		}
+		exp.variants = append(exp.variants, variant)
+		exp.agents = append(exp.agents, agent)
+		exp.stats[i].Variant = variant.Name
+		exp.total += variant.Weight
+	}
+	return exp, nil
+}
+
+// RegisterTool registers a tool on the agent of every variant.
+func (exp *Experiment) RegisterTool(fn any, paramType any, description string) error {
+	for i, agent := range exp.agents {
+		if err := agent.RegisterTool(fn, paramType, description); err != nil {
+			return fmt.Errorf("variant %s: %w", exp.variants[i].Name, err)
+		}
+	}
+	return nil
+}
+
+// AddTool adds a tool to the agent of every variant.
+func (exp *Experiment) AddTool(tool provider.Tool) error {
+	for i, agent := range exp.agents {
+		if err := agent.AddTool(tool); err != nil {
+			return fmt.Errorf("variant %s: %w", exp.variants[i].Name, err)
+		}
+	}
+	return nil
+}
+
+// Assign returns the variant of unitID. The same unit always gets the same variant.
+func (exp *Experiment) Assign(unitID string) string {
+	return exp.variants[exp.assign(unitID)].Name
+}
+
+func (exp *Experiment) assign(unitID string) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(exp.Name + "\x00" + unitID))
+	point := int(hash.Sum32() % uint32(exp.total))
+	for i, variant := range exp.variants {
+		if point < variant.Weight {
+			return i
+		}
+		point -= variant.Weight
+	}
+	return len(exp.variants) - 1
+}
+
+// Run runs prompt on the variant of unitID.
+func (exp *Experiment) Run(unitID string, prompt string, history ...[]provider.Message) (*Run, error) {
+	return exp.RunContext(context.Background(), unitID, prompt, history...)
+}
+
+func (exp *Experiment) RunContext(ctx context.Context, unitID string, prompt string, history ...[]provider.Message) (*Run, error) {
+	i := exp.assign(unitID)
+	start := time.Now()
+	result, err := exp.agents[i].RunContext(ctx, prompt, history...)
+	latency := time.Since(start)
+
+	exp.mu.Lock()
+	defer exp.mu.Unlock()
+	stats := &exp.stats[i]
+	stats.Runs++
+	if err != nil {
+		stats.Errors++
+		return &Run{Variant: stats.Variant, Result: result}, err
+	}
+	exp.latencies[i] = append(exp.latencies[i], latency)
+	for _, roundTrip := range result.RoundTrips {
+		stats.InputTokens += roundTrip.InputTokens
+		stats.OutputTokens += roundTrip.OutputTokens
+		if exp.Price != nil && !roundTrip.Cached {
+			stats.CostUSD += exp.Price(roundTrip.Model, roundTrip.InputTokens, roundTrip.OutputTokens)
+		}
+	}
+	return &Run{Variant: stats.Variant, Result: result}, nil
+}
+
+// RecordQuality adds a quality score for variant, e.g. user feedback or an eval judge's grade.
+func (exp *Experiment) RecordQuality(variant string, score float64) error {
+	exp.mu.Lock()
+	defer exp.mu.Unlock()
+	for i := range exp.stats {
+		if exp.stats[i].Variant == variant {
+			stats := &exp.stats[i]
+			stats.Quality = (stats.Quality*float64(stats.QualityCount) + score) / float64(stats.QualityCount+1)
+			stats.QualityCount++
+			return nil
+		}
+	}
+	return fmt.Errorf("experiment %s has no variant %s", exp.Name, variant)
+}
+
+// Stats returns the metrics of every variant, in variant order.
+func (exp *Experiment) Stats() []VariantStats {
+	exp.mu.Lock()
+	defer exp.mu.Unlock()
+	stats := append([]VariantStats(nil), exp.stats...)
+	for i := range stats {
+		stats[i].MeanLatency, stats[i].P95Latency = latencyStats(exp.latencies[i])
+	}
+	return stats
+}
+
+func latencyStats(latencies []time.Duration) (mean time.Duration, p95 time.Duration) {
+	if len(latencies) == 0 {
+		return 0, 0
+	}
+	sorted := append([]time.Duration(nil), latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	var total time.Duration
+	for _, latency := range sorted {
+		total += latency
+	}
+	return total / time.Duration(len(sorted)), sorted[(len(sorted)*95+99)/100-1]
+}
+
+func (exp *Experiment) String() string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "experiment %s\n", exp.Name)
+	for _, stats := range exp.Stats() {
+		fmt.Fprintf(&out, "  %s: %d runs, %d errors, latency mean %s p95 %s, %d in / %d out tokens, $%.4f",
+			stats.Variant, stats.Runs, stats.Errors, stats.MeanLatency.Round(time.Millisecond), stats.P95Latency.Round(time.Millisecond),
+			stats.InputTokens, stats.OutputTokens, stats.CostUSD)
+		if stats.QualityCount > 0 {
+			fmt.Fprintf(&out, ", quality %.2f (%d)", stats.Quality, stats.QualityCount)
+		}
+		out.WriteString("\n")
+	}
+	return out.String()
+}
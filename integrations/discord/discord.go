@@ -0,0 +1,366 @@
+// Package discord connects agents to Discord through slash commands on the interactions endpoint.
+//
+// Every channel or thread is a gossip session. Server managers pick the model and system prompt
+// of their server with /configure; everyone talks to the agent with /ask.
+//
+//	bot, _ := discord.New(os.Getenv("DISCORD_APPLICATION_ID"), os.Getenv("DISCORD_PUBLIC_KEY"), "openai:gpt-4o", store)
+//	bot.RegisterCommands(os.Getenv("DISCORD_BOT_TOKEN")) // once per deployment
+//	http.Handle("/discord/interactions", bot.Handler())
+//
+// The gateway (reacting to plain messages) is not supported, it needs a websocket client.
+package discord
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	provider "go.bgeen.com/gossip/providers"
+)
+
+const apiURL = "https://discord.com/api/v10"
+
+// maxMessageLength is Discord's limit on message content, in characters.
+const maxMessageLength = 2000
+
+// permissionManageGuild is the permission required to run /configure.
+const permissionManageGuild = 1 << 5
+
+// GuildConfig is the agent configuration of a server.
+type GuildConfig struct {
+	Model        string `json:"model"`
+	SystemPrompt string `json:"system_prompt"`
+}
+
+// ConfigStore persists server configurations. Load returns nil, nil for unconfigured servers.
+type ConfigStore interface {
+	Load(guildID string) (*GuildConfig, error)
+	Save(guildID string, config *GuildConfig) error
+}
+
+// MemoryConfigStore keeps server configurations in process memory.
+type MemoryConfigStore struct {
+	mu      sync.Mutex
+	configs map[string]GuildConfig
+}
+
+func NewMemoryConfigStore() *MemoryConfigStore {
+	return &MemoryConfigStore{configs: make(map[string]GuildConfig)}
+}
+
+func (store *MemoryConfigStore) Load(guildID string) (*GuildConfig, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	config, exists := store.configs[guildID]
+	if !exists {
+		return nil, nil
+	}
+	return &config, nil
+}
+
+func (store *MemoryConfigStore) Save(guildID string, config *GuildConfig) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.configs[guildID] = *config
+	return nil
+}
+
+// Bot answers Discord slash commands with agents.
+type Bot struct {
+	Defaults GuildConfig               // used by servers that did not run /configure
+	Options  []provider.AgentOption    // applied to every agent, e.g. tools policies or caches
+	Tools    []provider.ToolDefinition // registered on every agent
+	Configs  ConfigStore
+	Store    provider.SessionStore
+
+	applicationID string
+	publicKey     ed25519.PublicKey
+	client        *http.Client
+
+	channels [64]sync.Mutex // striped by channel id, one reply at a time per channel
+	mu       sync.Mutex
+	agents   map[GuildConfig]provider.Agent
+}
+
+func New(applicationID string, publicKey string, defaultModel string, store provider.SessionStore) (*Bot, error) {
+	key, err := hex.DecodeString(publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key")
+	}
+	return &Bot{
+		Defaults:      GuildConfig{Model: defaultModel},
+		Configs:       NewMemoryConfigStore(),
+		Store:         store,
+		applicationID: applicationID,
+		publicKey:     key,
+		client:        &http.Client{Timeout: 30 * time.Second},
+		agents:        make(map[GuildConfig]provider.Agent),
+	}, nil
+}
+
+// RegisterCommands installs the /ask and /configure commands for the application.
+func (bot *Bot) RegisterCommands(botToken string) error {
+	commands := []any{
+		map[string]any{
+			"name": "ask", "description": "Ask the agent, with the history of this channel",
+			"options": []any{map[string]any{"type": 3, "name": "prompt", "description": "Your message", "required": true}},
+		},
+		map[string]any{
+			"name": "configure", "description": "Set the model and system prompt of this server",
+			"default_member_permissions": strconv.Itoa(permissionManageGuild),
+			"dm_permission":              false,
+			"options": []any{
+				map[string]any{"type": 3, "name": "model", "description": "e.g. anthropic:claude-3-7-sonnet-latest"},
+				map[string]any{"type": 3, "name": "system_prompt", "description": "Instructions for the agent"},
+			},
+		},
+	}
+	body, err := json.Marshal(commands)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("PUT", fmt.Sprintf("%s/applications/%s/commands", apiURL, bot.applicationID), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bot "+botToken)
+	return bot.do(req)
+}
+
+type interaction struct {
+	Type      int    `json:"type"`
+	Token     string `json:"token"`
+	GuildID   string `json:"guild_id"`
+	ChannelID string `json:"channel_id"`
+	Member    *struct {
+		Permissions string `json:"permissions"`
+		User        user   `json:"user"`
+	} `json:"member"`
+	User *user `json:"user"` // set instead of Member in direct messages
+	Data struct {
+		Name    string `json:"name"`
+		Options []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"options"`
+	} `json:"data"`
+}
+
+type user struct {
+	ID string `json:"id"`
+}
+
+// userID is the id of the user who sent the interaction.
+func (i *interaction) userID() string {
+	if i.Member != nil {
+		return i.Member.User.ID
+	}
+	if i.User != nil {
+		return i.User.ID
+	}
+	return ""
+}
+
+func (i *interaction) option(name string) string {
+	for _, option := range i.Data.Options {
+		if option.Name == name {
+			return option.Value
+		}
+	}
+	return ""
+}
+
+const (
+	interactionPing    = 1
+	interactionCommand = 2
+
+	responsePong            = 1
+	responseMessage         = 4
+	responseDeferredMessage = 5
+	messageFlagEphemeral    = 1 << 6
+)
+
+// Handler serves the interactions endpoint URL.
+func (bot *Bot) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+		if err != nil {
+			http.Error(w, "reading body failed", http.StatusBadRequest)
+			return
+		}
+		signature, err := hex.DecodeString(r.Header.Get("X-Signature-Ed25519"))
+		message := append([]byte(r.Header.Get("X-Signature-Timestamp")), body...)
+		if err != nil || !ed25519.Verify(bot.publicKey, message, signature) {
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+		var i interaction
+		if err := json.Unmarshal(body, &i); err != nil {
+			http.Error(w, "invalid payload", http.StatusBadRequest)
+			return
+		}
+
+		switch {
+		case i.Type == interactionPing:
+			respond(w, map[string]any{"type": responsePong})
+		case i.Type == interactionCommand && i.Data.Name == "ask":
+			// answering takes longer than the 3 seconds Discord waits, so acknowledge and edit the reply later
+			respond(w, map[string]any{"type": responseDeferredMessage})
+			go bot.ask(&i)
+		case i.Type == interactionCommand && i.Data.Name == "configure":
+			respond(w, map[string]any{"type": responseMessage, "data": map[string]any{
+				"content": bot.configure(&i),
+				"flags":   messageFlagEphemeral,
+			}})
+		default:
+			http.Error(w, "unknown interaction", http.StatusBadRequest)
+		}
+	})
+}
+
+func respond(w http.ResponseWriter, response any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (bot *Bot) configure(i *interaction) string {
+	if i.GuildID == "" || i.Member == nil {
+		return "Configuration only works in servers."
+	}
+	permissions, _ := strconv.ParseUint(i.Member.Permissions, 10, 64)
+	if permissions&permissionManageGuild == 0 {
+		return "You need the Manage Server permission to configure the agent."
+	}
+	config, err := bot.guildConfig(i.GuildID)
+	if err != nil {
+		log.Printf("discord: loading config of %s failed: %v\n", i.GuildID, err)
+		return "Loading the configuration failed."
+	}
+	if model := i.option("model"); model != "" {
+		if !provider.ModelAvailable(model) {
+			return fmt.Sprintf("Model %s is not available.", model)
+		}
+		config.Model = model
+	}
+	if systemPrompt := i.option("system_prompt"); systemPrompt != "" {
+		config.SystemPrompt = systemPrompt
+	}
+	if err := bot.Configs.Save(i.GuildID, &config); err != nil {
+		log.Printf("discord: saving config of %s failed: %v\n", i.GuildID, err)
+		return "Saving the configuration failed."
+	}
+	return fmt.Sprintf("Using %s from now on.", config.Model)
+}
+
+func (bot *Bot) guildConfig(guildID string) (GuildConfig, error) {
+	if guildID == "" {
+		return bot.Defaults, nil
+	}
+	config, err := bot.Configs.Load(guildID)
+	if err != nil || config == nil {
+		return bot.Defaults, err
+	}
+	return *config, nil
+}
+
+// agent returns the agent of a configuration, creating it on first use.
+func (bot *Bot) agent(config GuildConfig) (provider.Agent, error) {
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	if agent, exists := bot.agents[config]; exists {
+		return agent, nil
+	}
+	opts := append([]provider.AgentOption{provider.WithName("discord")}, bot.Options...)
+	if config.SystemPrompt != "" {
+		opts = append(opts, provider.WithSystemPrompt(config.SystemPrompt))
+	}
+	agent, err := provider.NewAgent(config.Model, opts...)
+	if err != nil {
+		return nil, err
+	}
+	for _, tool := range bot.Tools {
+		if err := agent.RegisterTool(tool.Function, tool.Params, tool.Description); err != nil {
+			return nil, err
+		}
+	}
+	bot.agents[config] = agent
+	return agent, nil
+}
+
+func (bot *Bot) ask(i *interaction) {
+	hash := fnv.New32a()
+	hash.Write([]byte(i.ChannelID))
+	lock := &bot.channels[hash.Sum32()%uint32(len(bot.channels))]
+	lock.Lock()
+	defer lock.Unlock()
+
+	reply, err := bot.answer(i)
+	if err != nil {
+		log.Printf("discord: answering in %s failed: %v\n", i.ChannelID, err)
+		reply = "Sorry, something went wrong while answering."
+	}
+	if runes := []rune(reply); len(runes) > maxMessageLength {
+		reply = string(runes[:maxMessageLength-1]) + "…"
+	}
+	if err := bot.editReply(i.Token, reply); err != nil {
+		log.Printf("discord: sending reply in %s failed: %v\n", i.ChannelID, err)
+	}
+}
+
+func (bot *Bot) answer(i *interaction) (string, error) {
+	config, err := bot.guildConfig(i.GuildID)
+	if err != nil {
+		return "", err
+	}
+	agent, err := bot.agent(config)
+	if err != nil {
+		return "", err
+	}
+	session, err := provider.NewSession("discord-"+i.ChannelID, agent, bot.Store, provider.WithSessionUser(i.userID()))
+	if err != nil {
+		return "", err
+	}
+	result, err := session.RunContext(context.Background(), i.option("prompt"))
+	if err != nil {
+		return "", err
+	}
+	return result.Text, nil
+}
+
+// editReply replaces the deferred response of an interaction with content.
+func (bot *Bot) editReply(token string, content string) error {
+	body, err := json.Marshal(map[string]any{"content": content})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("PATCH", fmt.Sprintf("%s/webhooks/%s/%s/messages/@original", apiURL, bot.applicationID, token), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return bot.do(req)
+}
+
+func (bot *Bot) do(req *http.Request) error {
+	resp, err := bot.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("discord api returned %s: %s", resp.Status, body)
+	}
+	return nil
+}
@@ -0,0 +1,373 @@
+// Package email lets an agent answer a mailbox: new mails are fetched over IMAP, fed to the
+// agent with their attachments, and answered over SMTP in the same thread.
+//
+// Every email thread is a gossip session per sender, so follow-up mails carry the conversation so far
+// and nobody else replying to the thread sees it.
+//
+//	bot := email.New(email.Account{
+//		IMAPAddr: "imap.example.com:993", SMTPAddr: "smtp.example.com:587",
+//		Username: "support@example.com", Password: os.Getenv("MAIL_PASSWORD"),
+//	}, agent, store)
+//	bot.Poll(ctx)
+//
+// Image attachments reach the model as images, text attachments (plain text, CSV, JSON, XML,
+// markdown) as documents inlined in the prompt; other attachments are listed by name only.
+// IMAP needs implicit TLS (port 993); SMTP uses STARTTLS when the server offers it.
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"regexp"
+	"strings"
+	"time"
+
+	provider "go.bgeen.com/gossip/providers"
+)
+
+// Account holds the mailbox credentials, shared by IMAP and SMTP.
+type Account struct {
+	IMAPAddr string // host:port, implicit TLS
+	SMTPAddr string // host:port
+	Username string
+	Password string
+	From     string // address replies are sent from, Username by default
+	Mailbox  string // mailbox to watch, INBOX by default
+}
+
+// Bot answers the mails of an account with an agent.
+type Bot struct {
+	Agent        provider.Agent
+	Store        provider.SessionStore
+	PollInterval time.Duration // wait between mailbox checks, 1 minute by default
+	Timeout      time.Duration // per IMAP command, 30 seconds by default
+	MaxDocument  int           // bytes of a text attachment inlined in the prompt, 100 KB by default
+
+	account Account
+}
+
+func New(account Account, agent provider.Agent, store provider.SessionStore) *Bot {
+	if account.From == "" {
+		account.From = account.Username
+	}
+	if account.Mailbox == "" {
+		account.Mailbox = "INBOX"
+	}
+	return &Bot{
+		Agent:        agent,
+		Store:        store,
+		PollInterval: time.Minute,
+		Timeout:      30 * time.Second,
+		MaxDocument:  100 << 10,
+		account:      account,
+	}
+}
+
+// Poll checks the mailbox until ctx ends, answering unseen mails one after the other.
+// A mail is marked seen once answered, so a mail whose answer failed is tried again on the next check.
+func (bot *Bot) Poll(ctx context.Context) error {
+	for {
+		if err := bot.Check(ctx); err != nil {
+			log.Printf("email: checking %s failed: %v\n", bot.account.Username, err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(bot.PollInterval):
+		}
+	}
+}
+
+// Check answers the unseen mails of the mailbox once.
+func (bot *Bot) Check(ctx context.Context) error {
+	conn, err := dialIMAP(bot.account.IMAPAddr, bot.Timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.logout(bot.Timeout)
+	if err := conn.login(bot.account.Username, bot.account.Password, bot.Timeout); err != nil {
+		return err
+	}
+	if err := conn.selectMailbox(bot.account.Mailbox, bot.Timeout); err != nil {
+		return err
+	}
+	uids, err := conn.unseen(bot.Timeout)
+	if err != nil {
+		return err
+	}
+	for _, uid := range uids {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		raw, err := conn.fetch(uid, bot.Timeout)
+		if err != nil {
+			return err
+		}
+		if err := bot.handle(ctx, raw); err != nil {
+			log.Printf("email: answering message %d failed: %v\n", uid, err)
+			continue
+		}
+		if err := conn.markSeen(uid, bot.Timeout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// incoming is a parsed mail.
+type incoming struct {
+	From       string
+	Subject    string
+	MessageID  string
+	References []string
+	Text       string
+	Images     []provider.Image
+	Documents  []document
+	Skipped    []string // attachments that could not be passed on
+	fromHTML   bool     // Text was rendered from an HTML part, a plain text part replaces it
+}
+
+type document struct {
+	Name string
+	Text string
+}
+
+func (bot *Bot) handle(ctx context.Context, raw []byte) error {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+	if automated(msg.Header) {
+		return nil
+	}
+	in, err := bot.parse(msg)
+	if err != nil {
+		return err
+	}
+	address, err := mail.ParseAddress(in.From)
+	if err != nil || strings.EqualFold(address.Address, bot.fromAddress()) {
+		return nil
+	}
+
+	// the first message of a thread and the sender name the session, hashed to stay a valid store
+	// id: message ids travel in every reply, so whoever learns one must not join the conversation
+	root := in.MessageID
+	if len(in.References) > 0 {
+		root = in.References[0]
+	}
+	sender := strings.ToLower(address.Address)
+	sum := sha256.Sum256([]byte(root + "\x00" + sender))
+	session, err := provider.NewSession("email-"+hex.EncodeToString(sum[:12]), bot.Agent, bot.Store, provider.WithSessionUser(sender))
+	if err != nil {
+		return err
+	}
+	prompt, attached := in.prompt()
+	result, err := session.RunWithMessages(ctx, prompt, attached)
+	if err != nil {
+		return err
+	}
+	return bot.send(in, result.Text)
+}
+
+// automated reports mails that must not be answered, like auto-replies and mailing lists.
+func automated(header mail.Header) bool {
+	if auto := header.Get("Auto-Submitted"); auto != "" && !strings.EqualFold(auto, "no") {
+		return true
+	}
+	switch strings.ToLower(header.Get("Precedence")) {
+	case "bulk", "list", "junk":
+		return true
+	}
+	return header.Get("List-Id") != "" || header.Get("X-Autoreply") != ""
+}
+
+func (bot *Bot) parse(msg *mail.Message) (*incoming, error) {
+	decoder := new(mime.WordDecoder)
+	subject, err := decoder.DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		subject = msg.Header.Get("Subject")
+	}
+	in := &incoming{
+		From:       msg.Header.Get("Reply-To"),
+		Subject:    subject,
+		MessageID:  strings.TrimSpace(msg.Header.Get("Message-Id")),
+		References: strings.Fields(msg.Header.Get("References")),
+	}
+	if in.From == "" {
+		in.From = msg.Header.Get("From")
+	}
+	err = bot.walk(in, msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), "", msg.Body)
+	return in, err
+}
+
+// walk collects the text and attachments of a MIME part and its children.
+func (bot *Bot) walk(in *incoming, contentType string, encoding string, disposition string, body io.Reader) error {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "text/plain"
+	}
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			err = bot.walk(in, part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part.Header.Get("Content-Disposition"), part)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	data, err := io.ReadAll(decode(body, encoding))
+	if err != nil {
+		return err
+	}
+	dispositionType, dispositionParams, _ := mime.ParseMediaType(disposition)
+	name := dispositionParams["filename"]
+	if name == "" {
+		name = params["name"]
+	}
+	attached := dispositionType == "attachment" || name != ""
+
+	switch {
+	case !attached && mediaType == "text/plain":
+		if in.Text == "" || in.fromHTML {
+			in.Text, in.fromHTML = string(data), false
+		}
+	case !attached && mediaType == "text/html":
+		if in.Text == "" {
+			in.Text, in.fromHTML = htmlText(string(data)), true
+		}
+	case strings.HasPrefix(mediaType, "image/"):
+		in.Images = append(in.Images, provider.Image{Data: base64.StdEncoding.EncodeToString(data), MediaType: mediaType})
+	case isText(mediaType) && len(data) <= bot.MaxDocument:
+		in.Documents = append(in.Documents, document{Name: name, Text: string(data)})
+	default:
+		in.Skipped = append(in.Skipped, name)
+	}
+	return nil
+}
+
+func decode(body io.Reader, encoding string) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	}
+	return body
+}
+
+func isText(mediaType string) bool {
+	switch mediaType {
+	case "application/json", "application/xml", "application/csv", "application/x-yaml":
+		return true
+	}
+	return strings.HasPrefix(mediaType, "text/")
+}
+
+var (
+	htmlBlock = regexp.MustCompile(`(?is)<(script|style)[^>]*>.*?</(script|style)>`)
+	htmlBreak = regexp.MustCompile(`(?i)<(br|/p|/div|/li|/tr)[^>]*>`)
+	htmlTag   = regexp.MustCompile(`<[^>]*>`)
+	blankRuns = regexp.MustCompile(`\n{3,}`)
+)
+
+// htmlText is a rough plain text rendering of an HTML body, for mails without a text part.
+func htmlText(html string) string {
+	text := htmlBlock.ReplaceAllString(html, "")
+	text = htmlBreak.ReplaceAllString(text, "\n")
+	text = htmlTag.ReplaceAllString(text, "")
+	text = strings.NewReplacer("&nbsp;", " ", "&amp;", "&", "&lt;", "<", "&gt;", ">", "&quot;", `"`, "&#39;", "'").Replace(text)
+	return strings.TrimSpace(blankRuns.ReplaceAllString(text, "\n\n"))
+}
+
+// prompt renders the mail for the agent; images go in a user message of their own.
+func (in *incoming) prompt() (string, []provider.Message) {
+	var prompt strings.Builder
+	fmt.Fprintf(&prompt, "Email from %s\nSubject: %s\n\n%s", in.From, in.Subject, strings.TrimSpace(in.Text))
+	for _, doc := range in.Documents {
+		fmt.Fprintf(&prompt, "\n\n<document name=%q>\n%s\n</document>", doc.Name, doc.Text)
+	}
+	if len(in.Skipped) > 0 {
+		fmt.Fprintf(&prompt, "\n\n(Attachments that could not be read: %s)", strings.Join(in.Skipped, ", "))
+	}
+	var attached []provider.Message
+	if len(in.Images) > 0 {
+		attached = append(attached, provider.Message{Role: "user", Text: "Images attached to the email:", Images: in.Images})
+	}
+	return prompt.String(), attached
+}
+
+func (bot *Bot) send(in *incoming, answer string) error {
+	to, err := mail.ParseAddress(in.From)
+	if err != nil {
+		return err
+	}
+	subject := in.Subject
+	if !strings.HasPrefix(strings.ToLower(subject), "re:") {
+		subject = "Re: " + subject
+	}
+	references := strings.Join(append(in.References, in.MessageID), " ")
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", bot.account.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", to.String())
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Message-ID: %s\r\n", bot.messageID())
+	if in.MessageID != "" {
+		fmt.Fprintf(&msg, "In-Reply-To: %s\r\n", in.MessageID)
+		fmt.Fprintf(&msg, "References: %s\r\n", references)
+	}
+	fmt.Fprintf(&msg, "Auto-Submitted: auto-replied\r\n")
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=utf-8\r\n")
+	fmt.Fprintf(&msg, "Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	body := quotedprintable.NewWriter(&msg)
+	io.WriteString(body, answer)
+	body.Close()
+
+	host, _, err := net.SplitHostPort(bot.account.SMTPAddr)
+	if err != nil {
+		return err
+	}
+	auth := smtp.PlainAuth("", bot.account.Username, bot.account.Password, host)
+	return smtp.SendMail(bot.account.SMTPAddr, auth, bot.fromAddress(), []string{to.Address}, msg.Bytes())
+}
+
+// fromAddress is the bare address of Account.From, which may carry a display name.
+func (bot *Bot) fromAddress() string {
+	if address, err := mail.ParseAddress(bot.account.From); err == nil {
+		return address.Address
+	}
+	return bot.account.From
+}
+
+func (bot *Bot) messageID() string {
+	var id [12]byte
+	rand.Read(id[:])
+	domain := "gossip.local"
+	if _, d, found := strings.Cut(bot.fromAddress(), "@"); found {
+		domain = d
+	}
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(id[:]), domain)
+}
@@ -0,0 +1,162 @@
+package email
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// imapConn is the small part of IMAP4rev1 the adapter needs: login, select, search, fetch and store.
+type imapConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	tag    int
+}
+
+// imapResponse is an untagged response line, with the literals it carried.
+type imapResponse struct {
+	Line     string
+	Literals [][]byte
+}
+
+func dialIMAP(addr string, timeout time.Duration) (*imapConn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", addr, &tls.Config{ServerName: host})
+	if err != nil {
+		return nil, err
+	}
+	c := &imapConn{conn: conn, reader: bufio.NewReader(conn)}
+	conn.SetDeadline(time.Now().Add(timeout))
+	greeting, err := c.reader.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !strings.HasPrefix(greeting, "* OK") {
+		conn.Close()
+		return nil, fmt.Errorf("imap: unexpected greeting %q", strings.TrimSpace(greeting))
+	}
+	return c, nil
+}
+
+// command sends a command and returns its untagged responses once it completed with OK.
+func (c *imapConn) command(timeout time.Duration, format string, args ...any) ([]imapResponse, error) {
+	c.tag++
+	tag := "g" + strconv.Itoa(c.tag)
+	c.conn.SetDeadline(time.Now().Add(timeout))
+	if _, err := fmt.Fprintf(c.conn, "%s %s\r\n", tag, fmt.Sprintf(format, args...)); err != nil {
+		return nil, err
+	}
+
+	var responses []imapResponse
+	for {
+		response, err := c.readResponse()
+		if err != nil {
+			return nil, err
+		}
+		if status, found := strings.CutPrefix(response.Line, tag+" "); found {
+			if !strings.HasPrefix(status, "OK") {
+				return nil, fmt.Errorf("imap: %s", status)
+			}
+			return responses, nil
+		}
+		if strings.HasPrefix(response.Line, "* ") {
+			responses = append(responses, response)
+		}
+	}
+}
+
+// readResponse reads a response line, following the {n} literals it announces.
+func (c *imapConn) readResponse() (imapResponse, error) {
+	var response imapResponse
+	for {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			return response, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		response.Line += line
+		if !strings.HasSuffix(line, "}") {
+			return response, nil
+		}
+		start := strings.LastIndexByte(line, '{')
+		size, err := strconv.Atoi(strings.TrimSuffix(line[start+1:], "}"))
+		if start < 0 || err != nil {
+			return response, nil
+		}
+		literal := make([]byte, size)
+		if _, err := io.ReadFull(c.reader, literal); err != nil {
+			return response, err
+		}
+		response.Literals = append(response.Literals, literal)
+	}
+}
+
+func (c *imapConn) login(username string, password string, timeout time.Duration) error {
+	_, err := c.command(timeout, "LOGIN %s %s", quote(username), quote(password))
+	return err
+}
+
+func (c *imapConn) selectMailbox(mailbox string, timeout time.Duration) error {
+	_, err := c.command(timeout, "SELECT %s", quote(mailbox))
+	return err
+}
+
+// unseen returns the uids of messages without the \Seen flag.
+func (c *imapConn) unseen(timeout time.Duration) ([]uint32, error) {
+	responses, err := c.command(timeout, "UID SEARCH UNSEEN")
+	if err != nil {
+		return nil, err
+	}
+	var uids []uint32
+	for _, response := range responses {
+		fields, found := strings.CutPrefix(response.Line, "* SEARCH")
+		if !found {
+			continue
+		}
+		for _, field := range strings.Fields(fields) {
+			uid, err := strconv.ParseUint(field, 10, 32)
+			if err == nil {
+				uids = append(uids, uint32(uid))
+			}
+		}
+	}
+	return uids, nil
+}
+
+// fetch returns the raw message uid without marking it seen.
+func (c *imapConn) fetch(uid uint32, timeout time.Duration) ([]byte, error) {
+	responses, err := c.command(timeout, "UID FETCH %d BODY.PEEK[]", uid)
+	if err != nil {
+		return nil, err
+	}
+	for _, response := range responses {
+		if strings.Contains(response.Line, "FETCH") && len(response.Literals) > 0 {
+			return response.Literals[0], nil
+		}
+	}
+	return nil, fmt.Errorf("imap: message %d not found", uid)
+}
+
+func (c *imapConn) markSeen(uid uint32, timeout time.Duration) error {
+	_, err := c.command(timeout, `UID STORE %d +FLAGS.SILENT (\Seen)`, uid)
+	return err
+}
+
+func (c *imapConn) logout(timeout time.Duration) error {
+	c.command(timeout, "LOGOUT")
+	return c.conn.Close()
+}
+
+// quote renders s as an IMAP quoted string.
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
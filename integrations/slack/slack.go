@@ -0,0 +1,468 @@
+// Package slack connects an agent to Slack through the Events API.
+//
+// Every thread is a gossip session: replies keep the thread's history in the session store.
+// The messages of a thread are answered one at a time, in the order they arrived.
+// Replies stream into a placeholder message, edited as the answer comes in.
+// The bot answers mentions in channels and every direct message.
+//
+//	bot := slack.New(os.Getenv("SLACK_BOT_TOKEN"), os.Getenv("SLACK_SIGNING_SECRET"), store)
+//	bot.Agent, _ = provider.NewAgent("anthropic:claude-3-7-sonnet-latest",
+//		provider.WithToolPolicy(bot.ApprovalPolicy("RefundOrder")))
+//	http.Handle("/slack/events", bot.EventsHandler())
+//	http.Handle("/slack/interactions", bot.InteractionsHandler())
+//
+// Socket Mode is not supported, it needs a websocket client.
+package slack
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	provider "go.bgeen.com/gossip/providers"
+)
+
+var apiURL = "https://slack.com/api/"
+
+// Bot answers Slack messages with an agent.
+type Bot struct {
+	Agent           provider.Agent
+	Store           provider.SessionStore
+	ApprovalTimeout time.Duration // how long a tool approval waits for a click, 10 minutes by default
+	Placeholder     string        // posted right away and edited into the reply, "Thinking…" by default
+	UpdateInterval  time.Duration // the least time between two edits of a streaming reply, 1 second by default
+	Approvers       []string      // ids of the users who may approve any call, besides the user who asked
+
+	token         string
+	signingSecret string
+	client        *http.Client
+
+	mu        sync.Mutex
+	threads   map[string][]queuedMessage // messages waiting for a reply by session id, see enqueue
+	approvals map[string]*approval
+}
+
+// queuedMessage is a message waiting for the reply to an earlier one in its thread.
+type queuedMessage struct {
+	thread thread
+	text   string
+}
+
+// approval is a tool call waiting for a click.
+type approval struct {
+	decision  chan bool
+	requester string // the user whose message the run answers
+}
+
+func New(token string, signingSecret string, store provider.SessionStore) *Bot {
+	return &Bot{
+		Store:           store,
+		ApprovalTimeout: 10 * time.Minute,
+		Placeholder:     "Thinking…",
+		UpdateInterval:  time.Second,
+		token:           token,
+		signingSecret:   signingSecret,
+		client:          &http.Client{Timeout: 30 * time.Second},
+		threads:         make(map[string][]queuedMessage),
+		approvals:       make(map[string]*approval),
+	}
+}
+
+type thread struct {
+	Channel string
+	TS      string
+	User    string // who asked
+}
+
+// sessionID is the gossip session of the thread.
+func (t thread) sessionID() string {
+	return "slack-" + t.Channel + "-" + t.TS
+}
+
+type threadKey struct{}
+
+// ThreadFromContext returns the Slack thread a run answers, for tools that want to post to it.
+func ThreadFromContext(ctx context.Context) (channel string, threadTS string, ok bool) {
+	t, ok := ctx.Value(threadKey{}).(thread)
+	return t.Channel, t.TS, ok
+}
+
+type envelope struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Event     struct {
+		Type        string `json:"type"`
+		Subtype     string `json:"subtype"`
+		BotID       string `json:"bot_id"`
+		User        string `json:"user"`
+		Text        string `json:"text"`
+		Channel     string `json:"channel"`
+		ChannelType string `json:"channel_type"`
+		TS          string `json:"ts"`
+		ThreadTS    string `json:"thread_ts"`
+	} `json:"event"`
+}
+
+// EventsHandler serves the Events API request URL.
+func (bot *Bot) EventsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := bot.verify(w, r)
+		if !ok {
+			return
+		}
+		var event envelope
+		if err := json.Unmarshal(body, &event); err != nil {
+			http.Error(w, "invalid payload", http.StatusBadRequest)
+			return
+		}
+		if event.Type == "url_verification" {
+			w.Header().Set("Content-Type", "text/plain")
+			io.WriteString(w, event.Challenge)
+			return
+		}
+		// Slack retries events that were not acknowledged within 3 seconds; the first delivery is being handled
+		if r.Header.Get("X-Slack-Retry-Num") != "" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+
+		e := event.Event
+		if e.BotID != "" || e.Subtype != "" {
+			return
+		}
+		if e.Type == "app_mention" || (e.Type == "message" && e.ChannelType == "im") {
+			threadTS := e.ThreadTS
+			if threadTS == "" {
+				threadTS = e.TS
+			}
+			bot.enqueue(thread{Channel: e.Channel, TS: threadTS, User: e.User}, e.Text)
+		}
+	})
+}
+
+var mention = regexp.MustCompile(`<@[A-Z0-9]+>\s*`)
+
+// enqueue queues text for a reply in its thread. Threads are answered one message at a time, in
+// the order the messages arrived: the first message of an idle thread starts a goroutine replying
+// to the thread's queue until it is empty.
+func (bot *Bot) enqueue(t thread, text string) {
+	sessionID := t.sessionID()
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	queue, busy := bot.threads[sessionID]
+	bot.threads[sessionID] = append(queue, queuedMessage{thread: t, text: text})
+	if !busy {
+		go bot.drain(sessionID)
+	}
+}
+
+// drain replies to the queued messages of a thread until none are left.
+func (bot *Bot) drain(sessionID string) {
+	for {
+		bot.mu.Lock()
+		queue := bot.threads[sessionID]
+		if len(queue) == 0 {
+			delete(bot.threads, sessionID)
+			bot.mu.Unlock()
+			return
+		}
+		next := queue[0]
+		bot.threads[sessionID] = queue[1:]
+		bot.mu.Unlock()
+		bot.reply(next.thread, next.text)
+	}
+}
+
+func (bot *Bot) reply(t thread, text string) {
+	sessionID := t.sessionID()
+	placeholderTS, err := bot.post(t, bot.Placeholder, nil)
+	if err != nil {
+		log.Printf("slack: posting to %s failed: %v\n", t.Channel, err)
+		return
+	}
+	edit := func(text string) {
+		if err := bot.update(t.Channel, placeholderTS, text, nil); err != nil {
+			log.Printf("slack: updating reply in %s failed: %v\n", t.Channel, err)
+		}
+	}
+	answer, err := bot.answer(t, sessionID, strings.TrimSpace(mention.ReplaceAllString(text, "")), edit)
+	if err != nil {
+		log.Printf("slack: session %s failed: %v\n", sessionID, err)
+		answer = "Sorry, something went wrong while answering."
+	}
+	edit(answer)
+}
+
+// answer streams the reply to prompt, passing the text so far to edit at most every UpdateInterval.
+func (bot *Bot) answer(t thread, sessionID string, prompt string, edit func(text string)) (string, error) {
+	session, err := provider.NewSession(sessionID, bot.Agent, bot.Store, provider.WithSessionUser(t.User))
+	if err != nil {
+		return "", err
+	}
+	ctx := context.WithValue(context.Background(), threadKey{}, t)
+	var text strings.Builder
+	var roundTrip string // the text of the current round trip, dropped when its stream restarts
+	var lastEdit time.Time
+	for event := range session.RunStream(ctx, prompt) {
+		switch event.Type {
+		case provider.StreamText:
+			roundTrip += event.Text
+			if time.Since(lastEdit) >= bot.UpdateInterval && strings.TrimSpace(text.String()+roundTrip) != "" {
+				edit(text.String() + roundTrip + " …")
+				lastEdit = time.Now()
+			}
+		case provider.StreamRestart:
+			roundTrip = ""
+		case provider.StreamUsage:
+			if strings.TrimSpace(roundTrip) != "" {
+				if text.Len() > 0 {
+					text.WriteString("\n\n")
+				}
+				text.WriteString(strings.TrimSpace(roundTrip))
+			}
+			roundTrip = ""
+		case provider.StreamDone:
+			if event.Err != nil {
+				return "", event.Err
+			}
+			if text.Len() == 0 && roundTrip == "" {
+				return event.Result.Text, nil // nothing was streamed, e.g. a cached answer
+			}
+		}
+	}
+	if strings.TrimSpace(roundTrip) != "" {
+		if text.Len() > 0 {
+			text.WriteString("\n\n")
+		}
+		text.WriteString(strings.TrimSpace(roundTrip))
+	}
+	return text.String(), nil
+}
+
+// ApprovalPolicy asks in the thread before the named tools run, with Approve and Deny buttons.
+// Only the user whose message the run answers and the Approvers can click them. A call is denied
+// when nobody answers within ApprovalTimeout or the run is not a Slack thread.
+func (bot *Bot) ApprovalPolicy(toolNames ...string) provider.Policy {
+	guarded := make(map[string]bool, len(toolNames))
+	for _, name := range toolNames {
+		guarded[name] = true
+	}
+	return provider.PolicyFunc(func(ctx context.Context, toolName string, arguments string) (bool, string) {
+		if !guarded[toolName] {
+			return true, ""
+		}
+		t, ok := ctx.Value(threadKey{}).(thread)
+		if !ok {
+			return false, fmt.Sprintf("tool %s needs approval in Slack", toolName)
+		}
+		return bot.askApproval(ctx, t, toolName, arguments)
+	})
+}
+
+func (bot *Bot) askApproval(ctx context.Context, t thread, toolName string, arguments string) (bool, string) {
+	// the id is all a click carries, it must not be guessable
+	var random [16]byte
+	if _, err := rand.Read(random[:]); err != nil {
+		return false, fmt.Sprintf("asking for approval failed: %v", err)
+	}
+	id := hex.EncodeToString(random[:])
+	decision := make(chan bool, 1)
+	bot.mu.Lock()
+	bot.approvals[id] = &approval{decision: decision, requester: t.User}
+	bot.mu.Unlock()
+	defer func() {
+		bot.mu.Lock()
+		delete(bot.approvals, id)
+		bot.mu.Unlock()
+	}()
+
+	question := fmt.Sprintf("The agent wants to call *%s* with `%s`. Allow it?", toolName, arguments)
+	blocks := []any{
+		map[string]any{"type": "section", "text": map[string]any{"type": "mrkdwn", "text": question}},
+		map[string]any{"type": "actions", "elements": []any{
+			button("Approve", "primary", id+":approve"),
+			button("Deny", "danger", id+":deny"),
+		}},
+	}
+	if _, err := bot.post(t, question, blocks); err != nil {
+		return false, fmt.Sprintf("asking for approval failed: %v", err)
+	}
+
+	select {
+	case approved := <-decision:
+		if !approved {
+			return false, "the user denied the call"
+		}
+		return true, ""
+	case <-time.After(bot.ApprovalTimeout):
+		return false, "nobody approved the call in time"
+	case <-ctx.Done():
+		return false, ctx.Err().Error()
+	}
+}
+
+func button(text string, style string, value string) map[string]any {
+	return map[string]any{
+		"type":      "button",
+		"text":      map[string]any{"type": "plain_text", "text": text},
+		"style":     style,
+		"value":     value,
+		"action_id": "gossip_approval_" + strings.ToLower(text),
+	}
+}
+
+type interaction struct {
+	Type    string              `json:"type"`
+	User    struct{ ID string } `json:"user"`
+	Channel struct{ ID string } `json:"channel"`
+	Message struct {
+		TS string `json:"ts"`
+	} `json:"message"`
+	Actions []struct {
+		Value string `json:"value"`
+	} `json:"actions"`
+}
+
+// InteractionsHandler serves the interactivity request URL, receiving approval clicks.
+func (bot *Bot) InteractionsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := bot.verify(w, r)
+		if !ok {
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		var payload interaction
+		if err := json.Unmarshal([]byte(r.PostFormValue("payload")), &payload); err != nil {
+			http.Error(w, "invalid payload", http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		if payload.Type != "block_actions" || len(payload.Actions) == 0 {
+			return
+		}
+		id, action, _ := strings.Cut(payload.Actions[0].Value, ":")
+		bot.mu.Lock()
+		pending, found := bot.approvals[id]
+		bot.mu.Unlock()
+		if !found {
+			return
+		}
+		if !bot.mayApprove(pending, payload.User.ID) {
+			log.Printf("slack: %s may not decide on approval %s\n", payload.User.ID, id)
+			return
+		}
+		select {
+		case pending.decision <- action == "approve":
+		default: // already decided
+			return
+		}
+		verdict := "Approved"
+		if action != "approve" {
+			verdict = "Denied"
+		}
+		if err := bot.update(payload.Channel.ID, payload.Message.TS, fmt.Sprintf("%s by <@%s>.", verdict, payload.User.ID), []any{}); err != nil {
+			log.Printf("slack: updating approval in %s failed: %v\n", payload.Channel.ID, err)
+		}
+	})
+}
+
+// mayApprove reports whether user may decide on a pending approval.
+func (bot *Bot) mayApprove(pending *approval, user string) bool {
+	if user == "" {
+		return false
+	}
+	if user == pending.requester {
+		return true
+	}
+	for _, approver := range bot.Approvers {
+		if user == approver {
+			return true
+		}
+	}
+	return false
+}
+
+// verify reads the body of a Slack request and checks its signature and age.
+func (bot *Bot) verify(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "reading body failed", http.StatusBadRequest)
+		return nil, false
+	}
+	timestamp := r.Header.Get("X-Slack-Request-Timestamp")
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || time.Since(time.Unix(seconds, 0)).Abs() > 5*time.Minute {
+		http.Error(w, "stale request", http.StatusUnauthorized)
+		return nil, false
+	}
+	mac := hmac.New(sha256.New, []byte(bot.signingSecret))
+	fmt.Fprintf(mac, "v0:%s:%s", timestamp, body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(r.Header.Get("X-Slack-Signature"))) {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return nil, false
+	}
+	return body, true
+}
+
+func (bot *Bot) post(t thread, text string, blocks []any) (string, error) {
+	message := map[string]any{"channel": t.Channel, "thread_ts": t.TS, "text": text}
+	if blocks != nil {
+		message["blocks"] = blocks
+	}
+	return bot.call("chat.postMessage", message)
+}
+
+func (bot *Bot) update(channel string, ts string, text string, blocks []any) error {
+	message := map[string]any{"channel": channel, "ts": ts, "text": text}
+	if blocks != nil {
+		message["blocks"] = blocks
+	}
+	_, err := bot.call("chat.update", message)
+	return err
+}
+
+// call invokes a Web API method and returns the ts of the affected message.
+func (bot *Bot) call(method string, payload any) (string, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest("POST", apiURL+method, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Authorization", "Bearer "+bot.token)
+	resp, err := bot.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var response struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+		TS    string `json:"ts"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return "", fmt.Errorf("%s: %w", method, err)
+	}
+	if !response.OK {
+		return "", fmt.Errorf("%s: %s", method, response.Error)
+	}
+	return response.TS, nil
+}
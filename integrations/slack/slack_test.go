@@ -0,0 +1,189 @@
+package slack
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	provider "go.bgeen.com/gossip/providers"
+)
+
+// streamingAgent streams its answer in pieces.
+type streamingAgent struct {
+	provider.Agent
+	pieces []string
+}
+
+func (agent streamingAgent) RunStream(ctx context.Context, prompt string, history ...[]provider.Message) <-chan provider.StreamEvent {
+	events := make(chan provider.StreamEvent, len(agent.pieces)+2)
+	text := strings.Join(agent.pieces, "")
+	for _, piece := range agent.pieces {
+		events <- provider.StreamEvent{Type: provider.StreamText, Text: piece}
+	}
+	events <- provider.StreamEvent{Type: provider.StreamUsage, Usage: &provider.RoundTripStats{}}
+	messages := []provider.Message{{Role: "user", Text: prompt}, {Role: "assistant", Text: text}}
+	events <- provider.StreamEvent{Type: provider.StreamDone, Result: &provider.AgentResult{Text: text, NewMessages: messages, AllMessages: messages}}
+	close(events)
+	return events
+}
+
+// fakeSlack records the Web API calls of a bot.
+type fakeSlack struct {
+	mu    sync.Mutex
+	calls []map[string]any
+}
+
+func newFakeSlack(t *testing.T) *fakeSlack {
+	slack := &fakeSlack{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var call map[string]any
+		json.NewDecoder(r.Body).Decode(&call)
+		call["method"] = strings.TrimPrefix(r.URL.Path, "/")
+		slack.mu.Lock()
+		slack.calls = append(slack.calls, call)
+		slack.mu.Unlock()
+		fmt.Fprint(w, `{"ok":true,"ts":"1700000000.000100"}`)
+	}))
+	t.Cleanup(server.Close)
+	previous := apiURL
+	apiURL = server.URL + "/"
+	t.Cleanup(func() { apiURL = previous })
+	return slack
+}
+
+func (slack *fakeSlack) texts(method string) []string {
+	slack.mu.Lock()
+	defer slack.mu.Unlock()
+	var texts []string
+	for _, call := range slack.calls {
+		if call["method"] == method {
+			texts = append(texts, call["text"].(string))
+		}
+	}
+	return texts
+}
+
+func TestReplyStreamsEdits(t *testing.T) {
+	slack := newFakeSlack(t)
+	bot := New("xoxb-test", "secret", provider.NewMemorySessionStore())
+	bot.Agent = streamingAgent{pieces: []string{"Hello", ", ", "world"}}
+	bot.UpdateInterval = 0
+
+	bot.reply(thread{Channel: "C1", TS: "1.0", User: "U1"}, "<@UBOT> hi")
+
+	if posts := slack.texts("chat.postMessage"); len(posts) != 1 || posts[0] != "Thinking…" {
+		t.Errorf("posts %q, want the placeholder", posts)
+	}
+	updates := slack.texts("chat.update")
+	if len(updates) != 4 || updates[0] != "Hello …" || updates[2] != "Hello, world …" || updates[3] != "Hello, world" {
+		t.Errorf("updates %q, want the answer growing, then the answer", updates)
+	}
+}
+
+// recordingAgent records the prompts it answers, the first one only once release is closed.
+type recordingAgent struct {
+	provider.Agent
+	mu      sync.Mutex
+	prompts []string
+	release chan struct{}
+}
+
+func (agent *recordingAgent) RunStream(ctx context.Context, prompt string, history ...[]provider.Message) <-chan provider.StreamEvent {
+	agent.mu.Lock()
+	first := len(agent.prompts) == 0
+	agent.prompts = append(agent.prompts, prompt)
+	agent.mu.Unlock()
+	if first {
+		<-agent.release
+	}
+	return streamingAgent{pieces: []string{"ok"}}.RunStream(ctx, prompt, history...)
+}
+
+func TestThreadRepliesInOrder(t *testing.T) {
+	newFakeSlack(t)
+	bot := New("xoxb-test", "secret", provider.NewMemorySessionStore())
+	agent := &recordingAgent{release: make(chan struct{})}
+	bot.Agent = agent
+
+	for _, text := range []string{"one", "two", "three", "four"} {
+		bot.enqueue(thread{Channel: "C1", TS: "1.0", User: "U1"}, text)
+	}
+	close(agent.release)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		bot.mu.Lock()
+		idle := len(bot.threads) == 0
+		bot.mu.Unlock()
+		if idle {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("thread still busy")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got := strings.Join(agent.prompts, " "); got != "one two three four" {
+		t.Errorf("answered %q, want the messages in the order they arrived", got)
+	}
+}
+
+func TestApprovalOnlyByRequester(t *testing.T) {
+	newFakeSlack(t)
+	bot := New("xoxb-test", "secret", provider.NewMemorySessionStore())
+	bot.Approvers = []string{"UADMIN"}
+	handler := bot.InteractionsHandler()
+	click := func(user string, value string) {
+		payload, _ := json.Marshal(map[string]any{
+			"type":    "block_actions",
+			"user":    map[string]string{"id": user},
+			"channel": map[string]string{"id": "C1"},
+			"actions": []map[string]string{{"value": value}},
+		})
+		body := url.Values{"payload": {string(payload)}}.Encode()
+		request := httptest.NewRequest("POST", "/slack/interactions", strings.NewReader(body))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		mac := hmac.New(sha256.New, []byte("secret"))
+		fmt.Fprintf(mac, "v0:%s:%s", timestamp, body)
+		request.Header.Set("X-Slack-Request-Timestamp", timestamp)
+		request.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+		handler.ServeHTTP(httptest.NewRecorder(), request)
+	}
+	pending := func(requester string) (string, chan bool) {
+		decision := make(chan bool, 1)
+		id := requester + "-call"
+		bot.mu.Lock()
+		bot.approvals[id] = &approval{decision: decision, requester: requester}
+		bot.mu.Unlock()
+		return id, decision
+	}
+
+	id, decision := pending("U1")
+	click("U2", id+":approve")
+	select {
+	case <-decision:
+		t.Fatal("another channel member approved the call")
+	default:
+	}
+	click("U1", id+":approve")
+	if approved := <-decision; !approved {
+		t.Error("requester's approval not taken")
+	}
+
+	id, decision = pending("U3")
+	click("UADMIN", id+":deny")
+	if approved := <-decision; approved {
+		t.Error("approver's denial taken as an approval")
+	}
+}
@@ -0,0 +1,282 @@
+// Package telegram connects an agent to a Telegram bot, with long polling or a webhook.
+//
+// Every chat is a gossip session whose history lives in the session store. /reset starts the
+// chat's conversation over. The messages of a chat are answered one at a time, in the order they arrived.
+//
+//	bot := telegram.New(os.Getenv("TELEGRAM_BOT_TOKEN"), agent, store)
+//	bot.Poll(ctx) // or: bot.SetWebhook(url, secret); http.Handle("/telegram", bot.WebhookHandler(secret))
+//
+// In groups Telegram only delivers commands and replies to the bot unless its privacy mode is
+// disabled with BotFather; the bot answers every message it receives.
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	provider "go.bgeen.com/gossip/providers"
+)
+
+const apiURL = "https://api.telegram.org/bot"
+
+// maxMessageLength is Telegram's limit on message text, in characters.
+const maxMessageLength = 4096
+
+// Bot answers Telegram messages with an agent.
+type Bot struct {
+	Agent       provider.Agent
+	Store       provider.SessionStore
+	PollTimeout time.Duration // how long a getUpdates call waits for messages, 30 seconds by default
+	Greeting    string        // reply to /start
+
+	token  string
+	client *http.Client
+
+	mu    sync.Mutex
+	chats map[int64][]*message // messages waiting for a reply by chat id, see handle
+}
+
+func New(token string, agent provider.Agent, store provider.SessionStore) *Bot {
+	return &Bot{
+		Agent:       agent,
+		Store:       store,
+		PollTimeout: 30 * time.Second,
+		Greeting:    "Hi! Send me a message to start a conversation, /reset to start over.",
+		token:       token,
+		client:      &http.Client{Timeout: 30 * time.Second},
+		chats:       make(map[int64][]*message),
+	}
+}
+
+type update struct {
+	UpdateID int64    `json:"update_id"`
+	Message  *message `json:"message"`
+}
+
+type message struct {
+	MessageID int64 `json:"message_id"`
+	Chat      struct {
+		ID int64 `json:"id"`
+	} `json:"chat"`
+	From *struct {
+		ID    int64 `json:"id"`
+		IsBot bool  `json:"is_bot"`
+	} `json:"from"`
+	Text string `json:"text"`
+}
+
+// Poll fetches updates with long polling until ctx ends. It fails when a webhook is set.
+func (bot *Bot) Poll(ctx context.Context) error {
+	if err := bot.call(ctx, "deleteWebhook", map[string]any{}, nil); err != nil {
+		return err
+	}
+	var offset int64
+	for ctx.Err() == nil {
+		var updates []update
+		err := bot.call(ctx, "getUpdates", map[string]any{
+			"offset":          offset,
+			"timeout":         int(bot.PollTimeout.Seconds()),
+			"allowed_updates": []string{"message"},
+		}, &updates)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			log.Printf("telegram: getUpdates failed: %v\n", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(5 * time.Second):
+			}
+			continue
+		}
+		for _, u := range updates {
+			offset = u.UpdateID + 1
+			bot.handle(u)
+		}
+	}
+	return ctx.Err()
+}
+
+// SetWebhook asks Telegram to deliver updates to url, signed with secret.
+func (bot *Bot) SetWebhook(url string, secret string) error {
+	return bot.call(context.Background(), "setWebhook", map[string]any{
+		"url":             url,
+		"secret_token":    secret,
+		"allowed_updates": []string{"message"},
+	}, nil)
+}
+
+// WebhookHandler serves the webhook url, accepting requests that carry secret.
+func (bot *Bot) WebhookHandler(secret string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Telegram-Bot-Api-Secret-Token")), []byte(secret)) != 1 {
+			http.Error(w, "invalid secret", http.StatusUnauthorized)
+			return
+		}
+		var u update
+		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&u); err != nil {
+			http.Error(w, "invalid payload", http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		bot.handle(u)
+	})
+}
+
+func (bot *Bot) handle(u update) {
+	m := u.Message
+	if m == nil || strings.TrimSpace(m.Text) == "" || (m.From != nil && m.From.IsBot) {
+		return
+	}
+	// chats are answered one message at a time, in the order they arrived: the first message of an
+	// idle chat starts a goroutine replying to the chat's queue until it is empty
+	bot.mu.Lock()
+	defer bot.mu.Unlock()
+	queue, busy := bot.chats[m.Chat.ID]
+	bot.chats[m.Chat.ID] = append(queue, m)
+	if !busy {
+		go bot.drain(m.Chat.ID)
+	}
+}
+
+// drain replies to the queued messages of a chat until none are left.
+func (bot *Bot) drain(chatID int64) {
+	for {
+		bot.mu.Lock()
+		queue := bot.chats[chatID]
+		if len(queue) == 0 {
+			delete(bot.chats, chatID)
+			bot.mu.Unlock()
+			return
+		}
+		next := queue[0]
+		bot.chats[chatID] = queue[1:]
+		bot.mu.Unlock()
+		bot.reply(next)
+	}
+}
+
+func (bot *Bot) reply(m *message) {
+	sessionID := "telegram-" + strconv.FormatInt(m.Chat.ID, 10)
+
+	var command string
+	if fields := strings.Fields(m.Text); len(fields) > 0 {
+		command, _, _ = strings.Cut(fields[0], "@")
+	}
+	var answer string
+	switch command {
+	case "/start":
+		answer = bot.Greeting
+	case "/reset":
+		answer = "Conversation cleared."
+		if err := bot.reset(sessionID); err != nil {
+			log.Printf("telegram: resetting session %s failed: %v\n", sessionID, err)
+			answer = "Sorry, clearing the conversation failed."
+		}
+	default:
+		bot.call(context.Background(), "sendChatAction", map[string]any{"chat_id": m.Chat.ID, "action": "typing"}, nil)
+		var err error
+		answer, err = bot.answer(sessionID, m)
+		if err != nil {
+			log.Printf("telegram: session %s failed: %v\n", sessionID, err)
+			answer = "Sorry, something went wrong while answering."
+		}
+	}
+
+	if runes := []rune(answer); len(runes) > maxMessageLength {
+		answer = string(runes[:maxMessageLength-1]) + "…"
+	}
+	err := bot.call(context.Background(), "sendMessage", map[string]any{
+		"chat_id":          m.Chat.ID,
+		"text":             answer,
+		"reply_parameters": map[string]any{"message_id": m.MessageID, "allow_sending_without_reply": true},
+	}, nil)
+	if err != nil {
+		log.Printf("telegram: replying in chat %d failed: %v\n", m.Chat.ID, err)
+	}
+}
+
+func (bot *Bot) answer(sessionID string, m *message) (string, error) {
+	var opts []provider.SessionOption
+	if m.From != nil {
+		opts = append(opts, provider.WithSessionUser(strconv.FormatInt(m.From.ID, 10)))
+	}
+	session, err := provider.NewSession(sessionID, bot.Agent, bot.Store, opts...)
+	if err != nil {
+		return "", err
+	}
+	result, err := session.RunContext(context.Background(), m.Text)
+	if err != nil {
+		return "", err
+	}
+	return result.Text, nil
+}
+
+// reset drops the history of a session, keeping its token budget.
+func (bot *Bot) reset(sessionID string) error {
+	state, err := bot.Store.Load(sessionID)
+	if err != nil || state == nil {
+		return err
+	}
+	state.Messages = nil
+	return bot.Store.Save(sessionID, state)
+}
+
+// call invokes a Bot API method and decodes its result into result when not nil.
+func (bot *Bot) call(ctx context.Context, method string, payload any, result any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", apiURL+bot.token+"/"+method, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := bot.client
+	if method == "getUpdates" {
+		// long polls outlive the default timeout
+		client = &http.Client{Transport: bot.client.Transport, Timeout: bot.PollTimeout + 10*time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		// the url holds the token, keep it out of logs
+		return fmt.Errorf("%s: %w", method, unwrapURLError(err))
+	}
+	defer resp.Body.Close()
+	var response struct {
+		OK          bool            `json:"ok"`
+		Description string          `json:"description"`
+		Result      json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	if !response.OK {
+		return fmt.Errorf("%s: %s", method, response.Description)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(response.Result, result)
+}
+
+func unwrapURLError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	return err
+}
@@ -0,0 +1,215 @@
+// Package jobs runs agents in the background: runs are enqueued as jobs, executed by workers
+// with retries, and their results fetched by job id.
+//
+//	runner := jobs.NewRunner(jobs.NewMemoryQueue(), map[string]provider.Agent{"research": agent})
+//	go runner.Run(ctx)
+//	id, _ := runner.Submit("research", "compare the three vendors in the attached notes")
+//	job, _ := runner.Wait(ctx, id)
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	provider "go.bgeen.com/gossip/providers"
+)
+
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+)
+
+// Job is an agent run and its outcome.
+type Job struct {
+	ID         string                `json:"id"`
+	Agent      string                `json:"agent"` // name the agent was given to the runner
+	Prompt     string                `json:"prompt"`
+	History    []provider.Message    `json:"history,omitempty"`
+	Status     Status                `json:"status"`
+	Attempts   int                   `json:"attempts"`
+	Lease      string                `json:"lease,omitempty"` // the claim of the worker running the job, see Queue
+	Result     *provider.AgentResult `json:"result,omitempty"`
+	Error      string                `json:"error,omitempty"`
+	EnqueuedAt time.Time             `json:"enqueued_at"`
+	UpdatedAt  time.Time             `json:"updated_at"`
+}
+
+// Done reports whether the job succeeded or failed for good.
+func (job *Job) Done() bool {
+	return job.Status == StatusSucceeded || job.Status == StatusFailed
+}
+
+// Runner executes the jobs of a queue with a pool of workers.
+type Runner struct {
+	Queue  Queue
+	Agents map[string]provider.Agent
+
+	Workers      int           // concurrent jobs, 4 by default
+	MaxAttempts  int           // attempts per job before it fails, 3 by default
+	Visibility   time.Duration // how long a claimed job stays hidden and may run, 10 minutes by default; set it above the longest run
+	RetryBackoff time.Duration // delay before the first retry, doubling per attempt, 5 seconds by default
+	PollInterval time.Duration // wait between polls of an empty queue, 1 second by default
+}
+
+func NewRunner(queue Queue, agents map[string]provider.Agent) *Runner {
+	return &Runner{
+		Queue:        queue,
+		Agents:       agents,
+		Workers:      4,
+		MaxAttempts:  3,
+		Visibility:   10 * time.Minute,
+		RetryBackoff: 5 * time.Second,
+		PollInterval: time.Second,
+	}
+}
+
+// Submit enqueues a run of the named agent and returns the job id.
+func (runner *Runner) Submit(agentName string, prompt string, history ...[]provider.Message) (string, error) {
+	if _, exists := runner.Agents[agentName]; !exists {
+		return "", fmt.Errorf("unknown agent %q", agentName)
+	}
+	id, err := newJobID()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	job := &Job{ID: id, Agent: agentName, Prompt: prompt, Status: StatusQueued, EnqueuedAt: now, UpdatedAt: now}
+	if len(history) > 0 {
+		job.History = history[0]
+	}
+	return id, runner.Queue.Enqueue(job)
+}
+
+// Get returns the current state of a job.
+func (runner *Runner) Get(id string) (*Job, error) {
+	job, err := runner.Queue.Get(id)
+	if err == nil && job == nil {
+		err = fmt.Errorf("job %s not found", id)
+	}
+	return job, err
+}
+
+// Wait polls a job until it is done or ctx ends.
+func (runner *Runner) Wait(ctx context.Context, id string) (*Job, error) {
+	ticker := time.NewTicker(runner.PollInterval)
+	defer ticker.Stop()
+	for {
+		job, err := runner.Get(id)
+		if err != nil || job.Done() {
+			return job, err
+		}
+		select {
+		case <-ctx.Done():
+			return job, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Run executes jobs until ctx ends, then waits for the running jobs to finish.
+func (runner *Runner) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for range runner.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runner.work(ctx)
+		}()
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+func (runner *Runner) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		job, err := runner.Queue.Dequeue(runner.Visibility)
+		if err != nil {
+			log.Printf("jobs: dequeue failed: %v\n", err)
+		}
+		if job == nil {
+			select {
+			case <-ctx.Done():
+			case <-time.After(runner.PollInterval):
+			}
+			continue
+		}
+		// the attempts before ended without a verdict: the worker died or the run outlived its visibility
+		if job.Attempts > runner.MaxAttempts {
+			runner.finish(job, nil, fmt.Errorf("job abandoned after %d attempts", job.Attempts-1))
+			continue
+		}
+		runner.execute(job)
+	}
+}
+
+func (runner *Runner) execute(job *Job) {
+	agent, exists := runner.Agents[job.Agent]
+	if !exists {
+		runner.finish(job, nil, fmt.Errorf("unknown agent %q", job.Agent))
+		return
+	}
+
+	// the run ends before the job becomes visible again, which would have another worker run it
+	// too, and runs of agents with checkpoints pick up where a failed attempt stopped
+	ctx, cancel := context.WithTimeout(context.Background(), runner.Visibility)
+	defer cancel()
+	ctx = provider.ContextWithRunID(ctx, job.ID)
+	var result *provider.AgentResult
+	var err error
+	if job.Attempts > 1 {
+		result, err = provider.Resume(ctx, agent, job.ID)
+	}
+	if job.Attempts == 1 || errors.Is(err, provider.ErrNoCheckpoint) {
+		var history [][]provider.Message
+		if len(job.History) > 0 {
+			history = append(history, job.History)
+		}
+		result, err = agent.RunContext(ctx, job.Prompt, history...)
+	}
+
+	if err != nil && ctx.Err() != nil {
+		err = fmt.Errorf("run outlived the job visibility of %s: %w", runner.Visibility, err)
+	}
+	retryable := err != nil && (provider.IsRetryable(err) || ctx.Err() != nil)
+	if retryable && job.Attempts < runner.MaxAttempts {
+		delay := runner.RetryBackoff << (job.Attempts - 1)
+		log.Printf("jobs: job %s attempt %d failed, retrying in %s: %v\n", job.ID, job.Attempts, delay, err)
+		job.Error = err.Error()
+		if err := runner.Queue.Release(job, delay); err != nil {
+			log.Printf("jobs: releasing job %s failed: %v\n", job.ID, err)
+		}
+		return
+	}
+	runner.finish(job, result, err)
+}
+
+func (runner *Runner) finish(job *Job, result *provider.AgentResult, err error) {
+	job.Result = result
+	job.Status = StatusSucceeded
+	job.Error = ""
+	if err != nil {
+		job.Status = StatusFailed
+		job.Error = err.Error()
+	}
+	if err := runner.Queue.Complete(job); err != nil {
+		log.Printf("jobs: completing job %s failed: %v\n", job.ID, err)
+	}
+}
+
+func newJobID() (string, error) {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id[:]), nil
+}
@@ -0,0 +1,180 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	provider "go.bgeen.com/gossip/providers"
+)
+
+// scriptedAgent answers runs with run, counting them.
+type scriptedAgent struct {
+	provider.Agent
+	mu   sync.Mutex
+	runs int
+	run  func(ctx context.Context, attempt int) (*provider.AgentResult, error)
+}
+
+func (agent *scriptedAgent) RunContext(ctx context.Context, prompt string, history ...[]provider.Message) (*provider.AgentResult, error) {
+	agent.mu.Lock()
+	agent.runs++
+	attempt := agent.runs
+	agent.mu.Unlock()
+	return agent.run(ctx, attempt)
+}
+
+func testRunner(agent provider.Agent) *Runner {
+	runner := NewRunner(NewMemoryQueue(), map[string]provider.Agent{"test": agent})
+	runner.Workers = 1
+	runner.RetryBackoff = time.Millisecond
+	runner.PollInterval = time.Millisecond
+	return runner
+}
+
+// runJob submits a job, runs the runner until the job is done and returns it.
+func runJob(t *testing.T, runner *Runner) *Job {
+	t.Helper()
+	id, err := runner.Submit("test", "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		runner.Run(ctx)
+		close(done)
+	}()
+	job, err := runner.Wait(ctx, id)
+	cancel()
+	<-done
+	if err != nil {
+		t.Fatal(err)
+	}
+	return job
+}
+
+func TestRunnerRetries(t *testing.T) {
+	overloaded := &provider.APIError{Provider: "test", StatusCode: http.StatusServiceUnavailable, Message: "overloaded"}
+	invalid := &provider.APIError{Provider: "test", StatusCode: http.StatusBadRequest, Message: "invalid"}
+	tests := []struct {
+		name     string
+		failures []error // errors of the first runs, the run after them succeeds
+		status   Status
+		attempts int
+	}{
+		{name: "success", status: StatusSucceeded, attempts: 1},
+		{name: "retryable error", failures: []error{overloaded, overloaded}, status: StatusSucceeded, attempts: 3},
+		{name: "attempts exhausted", failures: []error{overloaded, overloaded, overloaded}, status: StatusFailed, attempts: 3},
+		{name: "permanent error", failures: []error{invalid}, status: StatusFailed, attempts: 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			agent := &scriptedAgent{run: func(ctx context.Context, attempt int) (*provider.AgentResult, error) {
+				if attempt <= len(test.failures) {
+					return nil, test.failures[attempt-1]
+				}
+				return &provider.AgentResult{Text: "done"}, nil
+			}}
+			job := runJob(t, testRunner(agent))
+			if job.Status != test.status || job.Attempts != test.attempts {
+				t.Errorf("got %s after %d attempts, want %s after %d", job.Status, job.Attempts, test.status, test.attempts)
+			}
+			if test.status == StatusSucceeded && (job.Result == nil || job.Result.Text != "done" || job.Error != "") {
+				t.Errorf("succeeded job has result %+v and error %q", job.Result, job.Error)
+			}
+			if test.status == StatusFailed && job.Error == "" {
+				t.Error("failed job has no error")
+			}
+		})
+	}
+}
+
+func TestRunnerBoundsRunsByVisibility(t *testing.T) {
+	agent := &scriptedAgent{run: func(ctx context.Context, attempt int) (*provider.AgentResult, error) {
+		if attempt == 1 {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return &provider.AgentResult{Text: "done"}, nil
+	}}
+	runner := testRunner(agent)
+	runner.Visibility = 50 * time.Millisecond
+	job := runJob(t, runner)
+	if job.Status != StatusSucceeded || job.Attempts != 2 {
+		t.Errorf("got %s after %d attempts, want the run outliving its visibility retried once", job.Status, job.Attempts)
+	}
+}
+
+func TestRunnerFailsAbandonedJobs(t *testing.T) {
+	agent := &scriptedAgent{run: func(ctx context.Context, attempt int) (*provider.AgentResult, error) {
+		return &provider.AgentResult{Text: "done"}, nil
+	}}
+	runner := testRunner(agent)
+	id, err := runner.Submit("test", "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// workers that died mid run never release their claims
+	for range runner.MaxAttempts {
+		if job, err := runner.Queue.Dequeue(0); err != nil || job == nil {
+			t.Fatalf("dequeue returned %v, %v", job, err)
+		}
+	}
+
+	job := runJob(t, runner)
+	if job.ID == id {
+		t.Fatal("runJob submitted the abandoned job again")
+	}
+	abandoned, err := runner.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if abandoned.Status != StatusFailed || abandoned.Error == "" {
+		t.Errorf("abandoned job is %s with error %q, want it failed", abandoned.Status, abandoned.Error)
+	}
+	if agent.runs != 1 {
+		t.Errorf("agent ran %d times, want only the second job run", agent.runs)
+	}
+}
+
+func TestMemoryQueueLease(t *testing.T) {
+	queue := NewMemoryQueue()
+	if err := queue.Enqueue(&Job{ID: "job", Status: StatusQueued}); err != nil {
+		t.Fatal(err)
+	}
+	stale, err := queue.Dequeue(0)
+	if err != nil || stale == nil {
+		t.Fatalf("dequeue returned %v, %v", stale, err)
+	}
+	current, err := queue.Dequeue(time.Minute)
+	if err != nil || current == nil {
+		t.Fatalf("dequeue of the expired claim returned %v, %v", current, err)
+	}
+	if current.Lease == stale.Lease {
+		t.Fatal("claims share a lease")
+	}
+
+	stale.Status = StatusSucceeded
+	if err := queue.Complete(stale); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("stale complete returned %v, want ErrLeaseLost", err)
+	}
+	if err := queue.Release(stale, 0); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("stale release returned %v, want ErrLeaseLost", err)
+	}
+	current.Status = StatusFailed
+	if err := queue.Complete(current); err != nil {
+		t.Fatal(err)
+	}
+	job, err := queue.Get("job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != StatusFailed || job.Attempts != 2 {
+		t.Errorf("got %s after %d attempts, want the current worker's verdict", job.Status, job.Attempts)
+	}
+}
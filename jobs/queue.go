@@ -0,0 +1,167 @@
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrLeaseLost is returned by Release and Complete when the job was claimed again since the
+// worker dequeued it, because the worker held it longer than its visibility.
+var ErrLeaseLost = errors.New("job lease lost")
+
+// Queue stores jobs for workers. Implementations backed by Redis or SQS map Dequeue to a
+// receive with visibility timeout, Release to changing the visibility and Complete to a delete
+// plus storing the finished job.
+type Queue interface {
+	Enqueue(job *Job) error
+	// Dequeue claims the next visible job, hiding it from other workers for visibility, and
+	// counts the attempt. A claimed job that is neither completed nor released becomes visible
+	// again, so a job whose worker died is retried. Every claim gets a new Lease. It returns
+	// nil, nil when no job is available.
+	Dequeue(visibility time.Duration) (*Job, error)
+	// Release makes a claimed job visible again after delay, for a retry. It fails with
+	// ErrLeaseLost unless the job's Lease is still the current claim.
+	Release(job *Job, delay time.Duration) error
+	// Complete records a job that succeeded or failed for good and removes it from the queue.
+	// It fails with ErrLeaseLost unless the job's Lease is still the current claim.
+	Complete(job *Job) error
+	// Get returns the current state of a job, or nil, nil when it is unknown.
+	Get(id string) (*Job, error)
+}
+
+// MemoryQueue is a Queue in process memory. Jobs do not survive a restart.
+type MemoryQueue struct {
+	mu        sync.Mutex
+	jobs      map[string][]byte // id -> encoded job
+	pending   []string          // ids of queued and claimed jobs, in enqueue order
+	visibleAt map[string]time.Time
+}
+
+func NewMemoryQueue() *MemoryQueue {
+	return &MemoryQueue{jobs: make(map[string][]byte), visibleAt: make(map[string]time.Time)}
+}
+
+func (queue *MemoryQueue) Enqueue(job *Job) error {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+	if _, exists := queue.jobs[job.ID]; exists {
+		return fmt.Errorf("job %s already exists", job.ID)
+	}
+	if err := queue.store(job); err != nil {
+		return err
+	}
+	queue.pending = append(queue.pending, job.ID)
+	queue.visibleAt[job.ID] = time.Now()
+	return nil
+}
+
+func (queue *MemoryQueue) Dequeue(visibility time.Duration) (*Job, error) {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+	now := time.Now()
+	for _, id := range queue.pending {
+		if queue.visibleAt[id].After(now) {
+			continue
+		}
+		job, err := queue.load(id)
+		if err != nil {
+			return nil, err
+		}
+		lease, err := newJobID()
+		if err != nil {
+			return nil, err
+		}
+		job.Status = StatusRunning
+		job.Attempts++
+		job.Lease = lease
+		job.UpdatedAt = now
+		if err := queue.store(job); err != nil {
+			return nil, err
+		}
+		queue.visibleAt[id] = now.Add(visibility)
+		return job, nil
+	}
+	return nil, nil
+}
+
+func (queue *MemoryQueue) Release(job *Job, delay time.Duration) error {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+	if err := queue.checkLease(job); err != nil {
+		return err
+	}
+	job.Status = StatusQueued
+	job.Lease = ""
+	job.UpdatedAt = time.Now()
+	if err := queue.store(job); err != nil {
+		return err
+	}
+	queue.visibleAt[job.ID] = time.Now().Add(delay)
+	return nil
+}
+
+func (queue *MemoryQueue) Complete(job *Job) error {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+	if err := queue.checkLease(job); err != nil {
+		return err
+	}
+	job.Lease = ""
+	job.UpdatedAt = time.Now()
+	if err := queue.store(job); err != nil {
+		return err
+	}
+	for i, id := range queue.pending {
+		if id == job.ID {
+			queue.pending = append(queue.pending[:i], queue.pending[i+1:]...)
+			break
+		}
+	}
+	delete(queue.visibleAt, job.ID)
+	return nil
+}
+
+func (queue *MemoryQueue) Get(id string) (*Job, error) {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+	if _, exists := queue.jobs[id]; !exists {
+		return nil, nil
+	}
+	return queue.load(id)
+}
+
+// checkLease fails when job is not the current claim of the job it stands for.
+func (queue *MemoryQueue) checkLease(job *Job) error {
+	if _, exists := queue.jobs[job.ID]; !exists {
+		return fmt.Errorf("job %s not found", job.ID)
+	}
+	current, err := queue.load(job.ID)
+	if err != nil {
+		return err
+	}
+	if current.Lease == "" || current.Lease != job.Lease {
+		return fmt.Errorf("job %s: %w", job.ID, ErrLeaseLost)
+	}
+	return nil
+}
+
+// store keeps jobs encoded, like a remote backend would, so callers never share state with the queue.
+func (queue *MemoryQueue) store(job *Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	queue.jobs[job.ID] = data
+	return nil
+}
+
+func (queue *MemoryQueue) load(id string) (*Job, error) {
+	var job Job
+	if err := json.Unmarshal(queue.jobs[id], &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
@@ -0,0 +1,51 @@
+// Package presets bundles system prompts, options and tools into ready to use agents.
+// Options passed to a preset are applied after the preset's own, so any of them can be overridden:
+//
+//	summarizer, _ := presets.Summarizer("openai:gpt-4o-mini")
+//	terse, _ := presets.Summarizer("openai:gpt-4o-mini", provider.WithSystemPrompt("Summarize in one sentence."))
+package presets
+
+import (
+	"encoding/json"
+	"fmt"
+
+	provider "go.bgeen.com/gossip/providers"
+)
+
+const summarizerPrompt = `You summarize text. Keep every fact, figure, name and decision that matters and drop the rest.
+Write plain prose unless the text is a list of items, do not add information that is not in the text,
+and never mention that you are summarizing.`
+
+// Summarizer creates an agent that summarizes the text it is given.
+func Summarizer(modelName string, opts ...provider.AgentOption) (provider.Agent, error) {
+	return provider.NewAgent(modelName, append([]provider.AgentOption{
+		provider.WithName("summarizer"),
+		provider.WithSystemPrompt(summarizerPrompt),
+		provider.WithTemperature(0.2),
+	}, opts...)...)
+}
+
+const extractorPrompt = `You extract structured data from text. Answer with a single JSON object matching this JSON schema
+and nothing else, no prose and no code fences. Use null for values the text does not contain; never guess.
+
+%s`
+
+// Extractor creates an agent that answers with a JSON object shaped like schema, a struct
+// (or pointer to one) described with json and description tags. Decode the answer with
+// json.Unmarshal into the same type.
+func Extractor(modelName string, schema any, opts ...provider.AgentOption) (provider.Agent, error) {
+	properties, required := provider.ConvertToProperties(schema)
+	encoded, err := json.MarshalIndent(provider.Parameters{
+		Type:       "object",
+		Required:   required,
+		Properties: properties,
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return provider.NewAgent(modelName, append([]provider.AgentOption{
+		provider.WithName("extractor"),
+		provider.WithSystemPrompt(fmt.Sprintf(extractorPrompt, encoded)),
+		provider.WithTemperature(0.1),
+	}, opts...)...)
+}
@@ -0,0 +1,104 @@
+package presets
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	provider "go.bgeen.com/gossip/providers"
+)
+
+// maxQueryRows caps the rows returned to the model per query.
+const maxQueryRows = 100
+
+const sqlAnalystPrompt = `You are a data analyst answering questions about a SQL database with the RunQuery tool.
+Explore the schema first (information_schema, or sqlite_master for SQLite) instead of guessing table and column names.
+Only read data: write a single SELECT or WITH query per call, aggregate in SQL rather than fetching raw rows,
+and at most 100 rows are returned. Answer with the numbers you found and the query that produced them.`
+
+type ParamsRunQuery struct {
+	Query string `json:"query" description:"a single read-only SELECT or WITH statement"`
+}
+
+type sqlAnalyst struct {
+	db *sql.DB
+}
+
+// RunQuery runs a read-only query and renders the result as tab separated rows.
+func (analyst *sqlAnalyst) RunQuery(ctx context.Context, params ParamsRunQuery) string {
+	query := strings.TrimSuffix(strings.TrimSpace(params.Query), ";")
+	var keyword string
+	if fields := strings.Fields(query); len(fields) > 0 {
+		keyword = strings.ToUpper(fields[0])
+	}
+	if (keyword != "SELECT" && keyword != "WITH") || strings.Contains(query, ";") {
+		return "error: only a single SELECT or WITH statement is allowed"
+	}
+
+	tx, err := analyst.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return fmt.Sprintf("error: %v", err)
+	}
+	defer tx.Rollback()
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return fmt.Sprintf("error: %v", err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return fmt.Sprintf("error: %v", err)
+	}
+	var out strings.Builder
+	out.WriteString(strings.Join(columns, "\t"))
+	values := make([]any, len(columns))
+	pointers := make([]any, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	count := 0
+	for rows.Next() {
+		if count == maxQueryRows {
+			fmt.Fprintf(&out, "\n(truncated to %d rows)", maxQueryRows)
+			break
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return fmt.Sprintf("error: %v", err)
+		}
+		out.WriteByte('\n')
+		for i, value := range values {
+			if i > 0 {
+				out.WriteByte('\t')
+			}
+			if raw, ok := value.([]byte); ok {
+				value = string(raw)
+			}
+			fmt.Fprint(&out, value)
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Sprintf("error: %v", err)
+	}
+	return out.String()
+}
+
+// SQLAnalyst creates an agent that answers questions by querying db. Queries run in read-only
+// transactions and only SELECT or WITH statements are accepted, but connect it with a read-only
+// database user as well: not every driver enforces read-only transactions.
+func SQLAnalyst(modelName string, db *sql.DB, opts ...provider.AgentOption) (provider.Agent, error) {
+	agent, err := provider.NewAgent(modelName, append([]provider.AgentOption{
+		provider.WithName("sql-analyst"),
+		provider.WithSystemPrompt(sqlAnalystPrompt),
+	}, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+	analyst := &sqlAnalyst{db: db}
+	if err := agent.RegisterTool(analyst.RunQuery, ParamsRunQuery{}, "Run a read-only SQL query and return the rows as tab separated values"); err != nil {
+		return nil, err
+	}
+	return agent, nil
+}
@@ -0,0 +1,110 @@
+// Package pricing maps models to their token prices to estimate what runs cost.
+// Prices change more often than gossip is released: Load a pricing file to correct or extend
+// the built-in table.
+//
+//	table, err := pricing.Load("prices.json")
+//	agent, err := provider.NewAgent("openai:gpt-4o", provider.WithPricing(pricing.Default.Merge(table)))
+package pricing
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Price is what a model charges, in USD per million tokens.
+type Price struct {
+	Input       float64 `json:"input"`
+	Output      float64 `json:"output"`
+	CachedInput float64 `json:"cached_input,omitempty"` // input tokens read from the prompt cache, Input when 0
+}
+
+// Table prices models by "provider:model" name. A name ending in ":" or "-" prices every model it
+// is a prefix of, e.g. "ollama:" or "anthropic:claude-3-7-sonnet-" for the dated releases of a model.
+type Table map[string]Price
+
+// Default holds the list prices of the models gossip knows, see Load to update them.
+var Default = Table{
+	"openai:gpt-4o":       {Input: 2.5, Output: 10, CachedInput: 1.25},
+	"openai:gpt-4o-":      {Input: 2.5, Output: 10, CachedInput: 1.25},
+	"openai:gpt-4o-mini":  {Input: 0.15, Output: 0.6, CachedInput: 0.075},
+	"openai:gpt-4o-mini-": {Input: 0.15, Output: 0.6, CachedInput: 0.075},
+	"openai:o1-mini":      {Input: 1.1, Output: 4.4, CachedInput: 0.55},
+
+	"anthropic:claude-3-5-sonnet-": {Input: 3, Output: 15, CachedInput: 0.3},
+	"anthropic:claude-3-7-sonnet-": {Input: 3, Output: 15, CachedInput: 0.3},
+
+	"bedrock:anthropic.claude-3-5-sonnet-": {Input: 3, Output: 15, CachedInput: 0.3},
+	"bedrock:anthropic.claude-3-7-sonnet-": {Input: 3, Output: 15, CachedInput: 0.3},
+
+	"groq:llama-3.3-70b-versatile":                   {Input: 0.59, Output: 0.79},
+	"groq:llama-3.2-11b-vision-preview":              {Input: 0.18, Output: 0.18},
+	"groq:llama-3.2-90b-vision-preview":              {Input: 0.9, Output: 0.9},
+	"groq:meta-llama/llama-4-scout-17b-16e-instruct": {Input: 0.11, Output: 0.34},
+
+	"deepseek:deepseek-chat":     {Input: 0.27, Output: 1.1, CachedInput: 0.07},
+	"deepseek:deepseek-reasoner": {Input: 0.55, Output: 2.19, CachedInput: 0.14},
+
+	"ollama:": {}, // runs locally
+}
+
+// Load reads a pricing file, a JSON object of prices by model name:
+//
+//	{"openai:gpt-4o": {"input": 2.5, "output": 10, "cached_input": 1.25}}
+func Load(path string) (Table, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var table Table
+	if err := json.Unmarshal(data, &table); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return table, nil
+}
+
+// Merge returns a table with the prices of both, those of other winning.
+func (table Table) Merge(other Table) Table {
+	merged := make(Table, len(table)+len(other))
+	for name, price := range table {
+		merged[name] = price
+	}
+	for name, price := range other {
+		merged[name] = price
+	}
+	return merged
+}
+
+// Lookup returns the price of model, a "provider:model" name: its own or else that of the longest
+// prefix entry matching it.
+func (table Table) Lookup(model string) (Price, bool) {
+	if price, found := table[model]; found {
+		return price, true
+	}
+	var best string
+	for name := range table {
+		if (strings.HasSuffix(name, ":") || strings.HasSuffix(name, "-")) && strings.HasPrefix(model, name) && len(name) > len(best) {
+			best = name
+		}
+	}
+	if best == "" {
+		return Price{}, false
+	}
+	return table[best], true
+}
+
+// Cost returns the USD cost of a request to model. cachedTokens are the part of inputTokens read
+// from the prompt cache. It reports false for models the table doesn't price.
+func (table Table) Cost(model string, inputTokens int, cachedTokens int, outputTokens int) (float64, bool) {
+	price, found := table.Lookup(model)
+	if !found {
+		return 0, false
+	}
+	cachedPrice := price.CachedInput
+	if cachedPrice == 0 {
+		cachedPrice = price.Input
+	}
+	cost := float64(inputTokens-cachedTokens)*price.Input + float64(cachedTokens)*cachedPrice + float64(outputTokens)*price.Output
+	return cost / 1e6, true
+}
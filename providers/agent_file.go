@@ -0,0 +1,141 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// AgentDefinition is the declarative form of an agent, as read by LoadAgents.
+type AgentDefinition struct {
+	Model           string            `json:"model"`
+	SystemPrompt    string            `json:"system_prompt,omitempty"`
+	Temperature     float32           `json:"temperature,omitempty"`
+	MaxTokens       int               `json:"max_tokens,omitempty"`
+	ReasoningEffort string            `json:"reasoning_effort,omitempty"`
+	CheaperModel    string            `json:"cheaper_model,omitempty"`
+	Tools           []string          `json:"tools,omitempty"` // names of tools passed to LoadAgents
+	Budget          *BudgetDefinition `json:"budget,omitempty"`
+}
+
+// BudgetDefinition is the declarative form of WithBudget.
+type BudgetDefinition struct {
+	MaxTokens  int     `json:"max_tokens,omitempty"`
+	MaxCostUSD float64 `json:"max_cost_usd,omitempty"`
+}
+
+type AgentFile struct {
+	Agents map[string]AgentDefinition `json:"agents"`
+}
+
+// ToolDefinition bundles the arguments of RegisterTool so tools can be referenced by name from config files.
+// The name is the function name, as with RegisterTool.
+type ToolDefinition struct {
+	Function    any
+	Params      any
+	Description string
+}
+
+// LoadAgents builds the named agents declared in a .json, .yaml or .yml file:
+//
+//	agents:
+//	  support:
+//	    model: openai:gpt-4o-mini
+//	    system_prompt: You answer customer questions.
+//	    temperature: 0.2
+//	    tools: [FindOrder]
+//	    budget:
+//	      max_cost_usd: 0.50
+//
+// Tools listed by an agent must be among the provided tool definitions. Unknown fields are
+// errors, so a misspelled setting doesn't go unnoticed.
+func LoadAgents(path string, tools ...ToolDefinition) (map[string]Agent, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		document, err := parseYAML(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if data, err = json.Marshal(document); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	case ".json":
+	default:
+		return nil, fmt.Errorf("%s: unsupported agent file format", path)
+	}
+
+	var file AgentFile
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("%s: unexpected data after the agents", path)
+	}
+
+	toolsByName := make(map[string]ToolDefinition)
+	for _, tool := range tools {
+		name, err := getToolName(tool.Function)
+		if err != nil {
+			return nil, err
+		}
+		toolsByName[name] = tool
+	}
+
+	agents := make(map[string]Agent)
+	for name, definition := range file.Agents {
+		agent, err := NewAgentFromDefinition(definition, toolsByName, WithName(name))
+		if err != nil {
+			return nil, fmt.Errorf("agent %q: %w", name, err)
+		}
+		agents[name] = agent
+	}
+	return agents, nil
+}
+
+// NewAgentFromDefinition creates an agent from its declarative form, layering opts on top.
+func NewAgentFromDefinition(definition AgentDefinition, tools map[string]ToolDefinition, opts ...AgentOption) (Agent, error) {
+	var definitionOpts []AgentOption
+	if definition.SystemPrompt != "" {
+		definitionOpts = append(definitionOpts, WithSystemPrompt(definition.SystemPrompt))
+	}
+	if definition.Temperature != 0 {
+		definitionOpts = append(definitionOpts, WithTemperature(definition.Temperature))
+	}
+	if definition.MaxTokens != 0 {
+		definitionOpts = append(definitionOpts, WithMaxTokens(definition.MaxTokens))
+	}
+	if definition.ReasoningEffort != "" {
+		definitionOpts = append(definitionOpts, WithReasoningEffort(definition.ReasoningEffort))
+	}
+	if definition.CheaperModel != "" {
+		definitionOpts = append(definitionOpts, WithCheaperModel(definition.CheaperModel))
+	}
+	if definition.Budget != nil {
+		definitionOpts = append(definitionOpts, WithBudget(definition.Budget.MaxTokens, definition.Budget.MaxCostUSD))
+	}
+
+	agent, err := NewAgent(definition.Model, append(definitionOpts, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+	for _, toolName := range definition.Tools {
+		tool, exists := tools[toolName]
+		if !exists {
+			return nil, fmt.Errorf("tool %s not provided", toolName)
+		}
+		if err := agent.RegisterTool(tool.Function, tool.Params, tool.Description); err != nil {
+			return nil, err
+		}
+	}
+	return agent, nil
+}
@@ -0,0 +1,80 @@
+package provider
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadAgents(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		budget  *RunBudget
+		err     string
+	}{
+		{
+			name: "yaml",
+			file: "agents.yaml",
+			content: `agents:
+  support:
+    model: ollama:llama3
+    system_prompt: You answer customer questions.
+    budget:
+      max_tokens: 5000
+`,
+			budget: &RunBudget{MaxTokens: 5000},
+		},
+		{
+			name:    "json",
+			file:    "agents.json",
+			content: `{"agents": {"support": {"model": "ollama:llama3", "budget": {"max_tokens": 5000, "max_cost_usd": 0.5}}}}`,
+			budget:  &RunBudget{MaxTokens: 5000, MaxCostUSD: 0.5},
+		},
+		{
+			name:    "no budget",
+			file:    "agents.json",
+			content: `{"agents": {"support": {"model": "ollama:llama3"}}}`,
+		},
+		{
+			name: "unknown yaml field",
+			file: "agents.yml",
+			content: `agents:
+  support:
+    model: ollama:llama3
+    temprature: 0.2
+`,
+			err: "temprature",
+		},
+		{
+			name:    "unknown json field",
+			file:    "agents.json",
+			content: `{"agents": {"support": {"model": "ollama:llama3", "budget": {"max_cost": 1}}}}`,
+			err:     "max_cost",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), test.file)
+			if err := os.WriteFile(path, []byte(test.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			agents, err := LoadAgents(path)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got error %v, want one mentioning %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			budget := agents["support"].(configured).agentConfig().Budget
+			if (budget == nil) != (test.budget == nil) || budget != nil && *budget != *test.budget {
+				t.Errorf("got budget %+v, want %+v", budget, test.budget)
+			}
+		})
+	}
+}
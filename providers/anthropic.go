@@ -1,13 +1,12 @@
 package provider
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"log"
-	"net/http"
-	"reflect"
+	"strings"
+	"unicode"
 )
 
 const AnthropicEndpoint = "https://api.anthropic.com/v1/messages"
@@ -24,6 +23,9 @@ type AnthropicRequest struct {
 	System      string             `json:"system,omitempty"`
 	Messages    []AnthropicMessage `json:"messages"`
 	Tools       []AnthropicTool    `json:"tools,omitempty"`
+	Stream      bool               `json:"stream,omitempty"`
+
+	StopSequences []string `json:"stop_sequences,omitempty"`
 }
 
 type AnthropicMessage struct {
@@ -35,6 +37,12 @@ type AnthropicTool struct {
 	Name        string     `json:"name"`
 	Description string     `json:"description"`
 	Parameters  Parameters `json:"input_schema"`
+
+	// server tools run by anthropic, like web_search
+	Type           string   `json:"type,omitempty"`
+	MaxUses        int      `json:"max_uses,omitempty"`
+	AllowedDomains []string `json:"allowed_domains,omitempty"`
+	BlockedDomains []string `json:"blocked_domains,omitempty"`
 }
 
 type AnthropicImageSource struct {
@@ -44,19 +52,36 @@ type AnthropicImageSource struct {
 }
 
 type AnthropicContent struct {
-	Type      string         `json:"type"` // text, tool_use, tool_result
-	Text      string         `json:"text,omitempty"`
-	Id        string         `json:"id,omitempty"`          // 'tool_use' id
-	Name      string         `json:"name,omitempty"`        // function name
-	Input     map[string]any `json:"input,omitempty"`       // json object containing parameters returned by tool_use
-	ToolUseId string         `json:"tool_use_id,omitempty"` // tool_use_id is used to return tool call result. value is same as 'id' in type 'tool_use'
-	Content   string         `json:"content,omitempty"`     //	tool result value
+	Type      string          `json:"type"` // text, tool_use, tool_result
+	Text      string          `json:"text,omitempty"`
+	Id        string          `json:"id,omitempty"`          // 'tool_use' id
+	Name      string          `json:"name,omitempty"`        // function name
+	Input     json.RawMessage `json:"input,omitempty"`       // json object containing parameters returned by tool_use
+	ToolUseId string          `json:"tool_use_id,omitempty"` // tool_use_id is used to return tool call result. value is same as 'id' in type 'tool_use'
+	Content   string          `json:"content,omitempty"`     //	tool result value
 	// Source    AnthropicImageSource `json:"source,omitempty"`
+	Citations []AnthropicCitation `json:"citations,omitempty"` // sources of a text block
+	Thinking  string              `json:"thinking,omitempty"`  // thinking block
+
+	SearchResults []AnthropicSearchResult `json:"-"` // content of a web_search_tool_result block
+	ErrorCode     string                  `json:"-"` // content of a failed web_search_tool_result block
+	Raw           json.RawMessage         `json:"-"` // the block as received
 }
 
 type AnthropicUsage struct {
-	InputTokens  int `json:"input_tokens"`
-	OutputTokens int `json:"output_tokens"`
+	InputTokens              int    `json:"input_tokens"` // without the cache reads and writes below
+	OutputTokens             int    `json:"output_tokens"`
+	CacheCreationInputTokens int    `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int    `json:"cache_read_input_tokens"`
+	ServiceTier              string `json:"service_tier"`
+	ServerToolUse            struct {
+		WebSearchRequests int `json:"web_search_requests"`
+	} `json:"server_tool_use"`
+}
+
+// totalInputTokens counts every input token like the other providers do, cached ones included.
+func (usage AnthropicUsage) totalInputTokens() int {
+	return usage.InputTokens + usage.CacheCreationInputTokens + usage.CacheReadInputTokens
 }
 
 type AnthropicResponse struct {
@@ -69,11 +94,37 @@ type AnthropicResponse struct {
 	Usage        AnthropicUsage     `json:"usage"`
 }
 
+type AnthropicErrorResponse struct {
+	Type  string `json:"type"` // "error"
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+	RequestId string `json:"request_id,omitempty"`
+}
+
+func parseAnthropicError(apiErr *APIError, body []byte) {
+	var response AnthropicErrorResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return
+	}
+	apiErr.Message = response.Error.Message
+	apiErr.Type = response.Error.Type
+	if apiErr.RequestID == "" {
+		apiErr.RequestID = response.RequestId
+	}
+}
+
 func (provider Anthropic) FormatMessages(messages []Message) ([]AnthropicMessage, error) {
-	var anthropicMessages []AnthropicMessage
+	anthropicMessages := make([]AnthropicMessage, 0, len(messages))
+	// every message holds a single content block, carved out of one allocation
+	contents := make([]AnthropicContent, len(messages))
 
-	for _, msg := range messages {
-		var content AnthropicContent
+	for i, msg := range messages {
+		if msg.local() {
+			continue
+		}
+		content := &contents[i]
 		var role string
 
 		if msg.ToolIntent != nil {
@@ -82,10 +133,9 @@ func (provider Anthropic) FormatMessages(messages []Message) ([]AnthropicMessage
 			content.Id = msg.ToolIntent.Id
 			content.Name = msg.ToolIntent.Name
 			if msg.ToolIntent.Arguments != "" {
-				var input map[string]any
-				err := json.Unmarshal([]byte(msg.ToolIntent.Arguments), &input)
-				if err != nil {
-					return nil, fmt.Errorf("(anthropic.go, FormatMessages) failed to unmarshal arguments string to map[string]any")
+				input := json.RawMessage(msg.ToolIntent.Arguments)
+				if !json.Valid(input) {
+					return nil, fmt.Errorf("(anthropic.go, FormatMessages) tool arguments are not valid json")
 				}
 				content.Input = input
 			}
@@ -95,6 +145,11 @@ func (provider Anthropic) FormatMessages(messages []Message) ([]AnthropicMessage
 			content.ToolUseId = msg.ToolResult.Id
 			content.Content = msg.ToolResult.Output
 
+		} else if msg.Incomplete {
+			// an answer cut short, resumed when it is the last message (see Continue)
+			role = "assistant"
+			content.Type = "text"
+			content.Text = strings.TrimRightFunc(msg.Text, unicode.IsSpace)
 		} else {
 			role = "user"
 			content.Type = "text"
@@ -103,14 +158,51 @@ func (provider Anthropic) FormatMessages(messages []Message) ([]AnthropicMessage
 
 		anthropicMessages = append(anthropicMessages, AnthropicMessage{
 			Role:    role,
-			Content: []AnthropicContent{content},
+			Content: contents[i : i+1 : i+1],
 		})
 	}
 	return anthropicMessages, nil
 }
 
 func (provider Anthropic) Run(prompt string, messageHistory ...[]Message) (*AgentResult, error) {
-	log.Println("Provider anthropic called")
+	return provider.RunContext(context.Background(), prompt, messageHistory...)
+}
+
+// RunStream runs prompt like RunContext, streaming the response: the returned channel carries
+// the pieces of the answer as they are generated and closes with a StreamDone event holding the result.
+func (provider Anthropic) RunStream(ctx context.Context, prompt string, messageHistory ...[]Message) <-chan StreamEvent {
+	return runStream(ctx, &provider.AgentConfig, func(ctx context.Context) (*AgentResult, error) {
+		return provider.RunContext(ctx, prompt, messageHistory...)
+	})
+}
+
+// RunContext is Run with a context that bounds the provider requests and is passed to tool policies.
+func (provider Anthropic) RunContext(ctx context.Context, prompt string, messageHistory ...[]Message) (*AgentResult, error) {
+	providerName := provider.providerName()
+	provider.logf("Provider %s called\n", providerName)
+	ctx, endRun, err := provider.beginRun(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer endRun()
+	ctx, err = provider.beginBudget(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ctx, checkpointed := provider.beginCheckpoint(ctx)
+	ctx, logged := provider.beginConversationLog(ctx)
+	ctx, guarded := provider.beginGuardrails(ctx)
+	messageHistory = ownHistory(messageHistory)
+	cached, promptEmbedding := provider.semanticLookup(ctx, providerName, prompt, messageHistory)
+	if cached != nil {
+		if checkpointed {
+			provider.completeCheckpoint(ctx, cached)
+		}
+		if logged {
+			provider.logConversation(ctx, cached)
+		}
+		return cached, nil
+	}
 	apiKey := provider.ApiKey
 	var finalPrompt []AnthropicMessage
 	if len(messageHistory) > 0 {
@@ -134,9 +226,10 @@ func (provider Anthropic) Run(prompt string, messageHistory ...[]Message) (*Agen
 		finalPrompt = append(finalPrompt, newMessage)
 	}
 
+	model, route := provider.routeModel(ctx, prompt, messageHistory)
 	reqBody := AnthropicRequest{
-		Model:     provider.ModelName,
-		MaxTokens: 1024,
+		Model:     model,
+		MaxTokens: DefaultAnthropicMaxTokens,
 		Messages:  finalPrompt,
 	}
 
@@ -147,13 +240,17 @@ func (provider Anthropic) Run(prompt string, messageHistory ...[]Message) (*Agen
 	if provider.Temperature != 0 {
 		reqBody.Temperature = provider.Temperature
 	}
+	if provider.MaxTokens > 0 {
+		reqBody.MaxTokens = provider.MaxTokens
+	}
+	reqBody.StopSequences = provider.StopSequences
 
 	var tools []AnthropicTool
 
 	if len(provider.ToolStore.functions) > 0 {
-		for fn, _ := range provider.ToolStore.functions {
+		for _, fn := range provider.exposedTools(prompt, messageHistory) {
 			fnName := fn
-			properties, required := ConvertToProperties(reflect.New(provider.ToolStore.paramTypes[fnName]).Interface())
+			properties, required := schemaFor(provider.ToolStore.paramTypes[fnName])
 			tool := AnthropicTool{
 				Name:        fnName,
 				Description: provider.ToolStore.descriptions[fnName],
@@ -167,49 +264,72 @@ func (provider Anthropic) Run(prompt string, messageHistory ...[]Message) (*Agen
 		}
 		reqBody.Tools = tools
 	}
-
-	// Convert request body to JSON
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return nil, err
+	if provider.WebSearch != nil {
+		reqBody.Tools = append(reqBody.Tools, provider.WebSearch.anthropicTool())
 	}
-
-	// Create HTTP request
-	req, err := http.NewRequest("POST", AnthropicEndpoint, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return nil, err
+	reqBody.Stream = provider.Stream != nil
+	var prefilled bool
+	if format := provider.responseFormat(ctx); format != nil {
+		reqBody.System = strings.TrimSpace(reqBody.System + "\n\n" + format.instruction())
+		prefilled = reqBody.prefillJSON()
 	}
 
-	// Add headers
-	req.Header.Set("x-api-key", apiKey)
-	req.Header.Set("anthropic-version", "2023-06-01")
-	req.Header.Set("content-type", "application/json")
-
-	// Send request
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
+	if err := provider.checkCapabilities(reqBody.Model, messageHistory); err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	// Read response
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+	if provider.DryRun {
+		endpoint := AnthropicEndpoint
+		if providerName == "bedrock" {
+			endpoint = provider.bedrockEndpoint(reqBody.Model)
+		}
+		return provider.dryRunResult(providerName, endpoint, reqBody, prompt, messageHistory)
 	}
 
-	// Parse JSON response
+	headers := map[string]string{
+		"x-api-key":         apiKey,
+		"anthropic-version": "2023-06-01",
+		"content-type":      "application/json",
+	}
+	if reqBody.Stream && len(provider.ToolStore.functions) > 0 {
+		// stream tool arguments as they are generated rather than in buffered chunks
+		headers["anthropic-beta"] = "fine-grained-tool-streaming-2025-05-14"
+	}
 	var response AnthropicResponse
-	err = json.Unmarshal(body, &response)
+	var meta responseMeta
+	if providerName == "bedrock" {
+		meta, err = provider.invokeBedrock(ctx, reqBody, &response)
+	} else if reqBody.Stream {
+		meta, err = provider.stream(ctx, headers, reqBody, &response)
+	} else {
+		meta, err = provider.post(ctx, "anthropic", AnthropicEndpoint, headers, reqBody, &response)
+	}
 	if err != nil {
+		provider.observeFailedRoundTrip(providerName, reqBody.Model, route, meta, err)
+		if ctx, trimmed, retry := provider.recoverContext(ctx, err, messageHistory); retry {
+			return provider.RunContext(ctx, prompt, trimmed)
+		}
+		if provider.offlineFallback(err) {
+			return provider.answerOffline(ctx, prompt, messageHistory)
+		}
 		return nil, err
 	}
 
+	if prefilled {
+		response.completePrefill()
+	}
+
 	var msgHistory []Message
 	var newMessages []Message
 	var finalText string
 	var toolIntent ToolIntent
+	var requestIDs []string
+	if meta.RequestID != "" {
+		requestIDs = append(requestIDs, meta.RequestID)
+	}
+	roundTrips := []RoundTripStats{provider.observeRoundTrip(providerName, reqBody.Model, route, meta, response.Usage.totalInputTokens(), response.Usage.OutputTokens, thinkingTokens(response.Content), response.Usage.CacheReadInputTokens)}
+	extensions := response.extensions()
+	finishReason := normalizeFinishReason(response.StopReason)
+	var refusal string
 
 	if len(messageHistory) > 0 {
 		msgHistory = messageHistory[0]
@@ -218,22 +338,44 @@ func (provider Anthropic) Run(prompt string, messageHistory ...[]Message) (*Agen
 		newMessages = append(newMessages, Message{Role: "user", Text: prompt})
 	}
 
-	for _, item := range response.Content { // assuming there will be only one element in response.content list
+	// pause_turn: a long turn of server tool use was paused, Continue resumes it
+	incomplete := response.StopReason == "max_tokens" || response.StopReason == "pause_turn" || response.StopReason == stopInterrupted
+	var searched []SearchResult
+	for _, item := range response.Content {
 		switch item.Type {
 		case "text":
+			// answers citing sources come in one block per cited passage, stitched back together here
+			if last := len(newMessages) - 1; last >= 0 && newMessages[last].isText() {
+				newMessages[last].Text += item.Text
+				newMessages[last].Citations = append(newMessages[last].Citations, citations(item)...)
+				finalText = newMessages[last].Text
+				continue
+			}
 			responseMessage := Message{
-				Role: response.Role,
-				Text: item.Text,
+				Role:      response.Role,
+				Text:      item.Text,
+				Citations: citations(item),
 			}
 			newMessages = append(newMessages, responseMessage)
 			finalText = item.Text
+		case "server_tool_use":
+			provider.logf("Server tool called: %s %s\n", item.Name, item.Input)
+		case "web_search_tool_result":
+			results, err := searchResults(item)
+			if err != nil {
+				provider.logf("%v\n", err)
+			}
+			searched = append(searched, results...)
 		case "tool_use":
+			if incomplete {
+				continue // its arguments may be cut short
+			}
 			argumentsString, err := json.Marshal(item.Input)
 			if err != nil {
-				return nil, fmt.Errorf("failed to convert arguments json object to string")
+				return partialResult(msgHistory, newMessages, toolIntent, requestIDs, roundTrips, nil), fmt.Errorf("failed to convert arguments json object to string")
 			}
 			toolIntent = ToolIntent{
-				Id:        item.Id,
+				Id:        provider.toolCallID(item.Id),
 				Name:      item.Name,
 				Arguments: string(argumentsString),
 			}
@@ -242,33 +384,252 @@ func (provider Anthropic) Run(prompt string, messageHistory ...[]Message) (*Agen
 				ToolIntent: &toolIntent,
 			})
 		default:
-			return nil, fmt.Errorf("Unexpected message type")
+			unknown, err := provider.unknownItem(providerName, item.Type, item.Raw)
+			if err != nil {
+				return partialResult(msgHistory, newMessages, toolIntent, requestIDs, roundTrips, nil), err
+			}
+			newMessages = append(newMessages, unknown)
 		}
 	}
+	if last := len(newMessages) - 1; len(searched) > 0 && last >= 0 && newMessages[last].isText() {
+		newMessages[last].SearchResults = searched
+	}
+	if incomplete {
+		markIncomplete(newMessages)
+	}
+	if finishReason == FinishRefusal {
+		refusal = finalText // whatever the model said before it stopped, often nothing
+	}
 
+	overBudget := provider.spend(ctx, roundTrips[0])
+	provider.checkpoint(ctx, msgHistory, newMessages, toolIntent, &roundTrips[0])
 	if toolIntent.Id != "" {
-		toolResult, err := provider.ExecuteToolIntent(toolIntent)
+		if overBudget != nil {
+			return partialResult(msgHistory, newMessages, toolIntent, requestIDs, roundTrips, nil), overBudget
+		}
+		toolResult, err := provider.executeTool(ctx, append(msgHistory, newMessages...), toolIntent)
 		if err != nil {
-			return nil, err
+			return partialResult(msgHistory, newMessages, toolIntent, requestIDs, roundTrips, nil), err
 		}
 		newMessages = append(newMessages, Message{ToolResult: toolResult})
-		internalAgentResult, err := provider.Run("", append(msgHistory, newMessages...))
+		provider.checkpoint(ctx, msgHistory, newMessages, ToolIntent{}, nil)
+		internalAgentResult, err := provider.RunContext(ctx, "", append(msgHistory, newMessages...))
 		if err != nil {
-			return nil, err
+			return partialResult(msgHistory, newMessages, toolIntent, requestIDs, roundTrips, internalAgentResult), err
 		}
 		newMessages = append(newMessages, internalAgentResult.NewMessages...)
+		requestIDs = append(requestIDs, internalAgentResult.RequestIDs...)
+		roundTrips = append(roundTrips, internalAgentResult.RoundTrips...)
+		incomplete = internalAgentResult.Incomplete
+		extensions = internalAgentResult.Extensions
+		finishReason = internalAgentResult.FinishReason
+		refusal = internalAgentResult.Refusal
 	}
 
-	return &AgentResult{
+	result := &AgentResult{
 		AllMessages:   append(msgHistory, newMessages...),
 		NewMessages:   newMessages,
 		ToolIntent:    &toolIntent,
 		Text:          finalText,
 		ToolArguments: toolIntent.Arguments,
-	}, nil
+		RequestIDs:    requestIDs,
+		RoundTrips:    roundTrips,
+		Incomplete:    incomplete,
+		Extensions:    extensions,
+		FinishReason:  finishReason,
+		Refusal:       refusal,
+	}
+	if guarded {
+		var err error
+		result, err = provider.enforceOutput(ctx, result, func(ctx context.Context, history []Message) (*AgentResult, error) {
+			return provider.RunContext(ctx, "", history)
+		})
+		if err != nil {
+			return result, err
+		}
+	}
+	if checkpointed {
+		provider.completeCheckpoint(ctx, result)
+	}
+	if logged {
+		provider.logConversation(ctx, result)
+	}
+	provider.semanticStore(ctx, providerName, promptEmbedding, result)
+	return result, nil
+}
+
+// anthropicStreamEvent is any of the events of a streamed message.
+type anthropicStreamEvent struct {
+	Type         string            `json:"type"`
+	Index        int               `json:"index"`
+	Message      AnthropicResponse `json:"message"`       // message_start
+	ContentBlock AnthropicContent  `json:"content_block"` // content_block_start
+	Delta        struct {
+		Type         string            `json:"type"` // text_delta, input_json_delta
+		Text         string            `json:"text"`
+		PartialJson  string            `json:"partial_json"`
+		Citation     AnthropicCitation `json:"citation"`    // citations_delta
+		Thinking     string            `json:"thinking"`    // thinking_delta
+		StopReason   string            `json:"stop_reason"` // message_delta
+		StopSequence any               `json:"stop_sequence"`
+	} `json:"delta"`
+	Usage AnthropicUsage `json:"usage"` // message_delta, cumulative
+}
+
+// stream sends reqBody as a streamed request and assembles the events into response.
+// A stalled stream is sent again with the text received so far as the start of the
+// assistant's answer, so the model carries on where the connection died.
+func (provider Anthropic) stream(ctx context.Context, headers map[string]string, reqBody AnthropicRequest, response *AnthropicResponse) (responseMeta, error) {
+	emitter := provider.newStreamEmitter()
+	defer emitter.close(ctx)
+	messages := reqBody.Messages
+	var prefix string
+	for attempt := 0; ; attempt++ {
+		*response = AnthropicResponse{}
+		var inputs []strings.Builder
+		done := false
+		meta, err := provider.postStream(ctx, "anthropic", AnthropicEndpoint, headers, reqBody, func(sse serverEvent) error {
+			var event anthropicStreamEvent
+			if err := json.Unmarshal(sse.Data, &event); err != nil {
+				return err
+			}
+			switch event.Type {
+			case "message_start":
+				*response = event.Message
+			case "content_block_start":
+				block := event.ContentBlock
+				if block.Type == "tool_use" || block.Type == "server_tool_use" {
+					block.Input = nil // streamed as input_json_delta
+				}
+				if block.Type == "tool_use" {
+					emitter.emit(StreamEvent{Type: StreamToolCallStart, ToolCall: &ToolIntent{Id: block.Id, Name: block.Name}})
+				}
+				response.Content = append(response.Content, block)
+				inputs = append(inputs, strings.Builder{})
+			case "content_block_delta":
+				if event.Index >= len(response.Content) {
+					return fmt.Errorf("(anthropic.go, stream) delta for unknown content block %d", event.Index)
+				}
+				switch event.Delta.Type {
+				case "text_delta":
+					response.Content[event.Index].Text += event.Delta.Text
+					emitter.emit(StreamEvent{Type: StreamText, Text: event.Delta.Text})
+				case "input_json_delta":
+					inputs[event.Index].WriteString(event.Delta.PartialJson)
+					if block := response.Content[event.Index]; block.Type == "tool_use" && event.Delta.PartialJson != "" {
+						emitter.emit(StreamEvent{Type: StreamToolCallDelta, ToolCall: &ToolIntent{Id: block.Id, Arguments: event.Delta.PartialJson}})
+					}
+				case "thinking_delta":
+					response.Content[event.Index].Thinking += event.Delta.Thinking
+				case "citations_delta":
+					response.Content[event.Index].Citations = append(response.Content[event.Index].Citations, event.Delta.Citation)
+				}
+			case "content_block_stop":
+				if event.Index >= len(response.Content) {
+					return nil
+				}
+				if blockType := response.Content[event.Index].Type; blockType == "tool_use" || blockType == "server_tool_use" {
+					// with fine-grained streaming, arguments cut short by max_tokens are not valid json;
+					// incomplete responses drop their tool calls
+					input := inputs[event.Index].String()
+					if input == "" {
+						input = "{}"
+					}
+					response.Content[event.Index].Input = json.RawMessage(input)
+				}
+			case "message_delta":
+				response.StopReason = event.Delta.StopReason
+				response.StopSequence = event.Delta.StopSequence
+				response.Usage.OutputTokens = event.Usage.OutputTokens
+				if event.Usage.ServerToolUse.WebSearchRequests > 0 {
+					response.Usage.ServerToolUse = event.Usage.ServerToolUse
+				}
+			case "message_stop":
+				done = true
+			case "error":
+				return streamError("anthropic", sse.Data)
+			}
+			return nil
+		})
+		if errors.Is(err, ErrInterrupted) {
+			// keep the text, a tool call cut short cannot be made
+			text := response.Content[:0]
+			for _, block := range response.Content {
+				if block.Type == "text" {
+					text = append(text, block)
+				}
+			}
+			response.Content = text
+			response.StopReason = stopInterrupted
+			err = nil
+		} else if err == nil && !done {
+			err = errStreamIncomplete
+		}
+		if errors.Is(err, ErrStreamStalled) && attempt < maxStallRetries {
+			provider.logf("Stream stalled, requesting it again\n")
+			if text, ok := streamedText(response.Content); ok {
+				prefix = strings.TrimRightFunc(prefix+text, unicode.IsSpace)
+			} else {
+				prefix = ""
+				emitter.restart()
+			}
+			reqBody.Messages = messages
+			if prefix != "" {
+				prefill := AnthropicMessage{Role: "assistant", Content: []AnthropicContent{{Type: "text", Text: prefix}}}
+				reqBody.Messages = append(messages[:len(messages):len(messages)], prefill)
+			}
+			continue
+		}
+		if err != nil {
+			return meta, err
+		}
+		if prefix != "" {
+			if len(response.Content) > 0 && response.Content[0].Type == "text" {
+				response.Content[0].Text = prefix + response.Content[0].Text
+			} else {
+				response.Content = append([]AnthropicContent{{Type: "text", Text: prefix}}, response.Content...)
+			}
+		}
+		return emitter.finish(meta), nil
+	}
+}
+
+// thinkingTokens estimates the tokens spent on thinking blocks, which anthropic bills as output
+// tokens without counting them apart. Redacted thinking is not counted.
+func thinkingTokens(content []AnthropicContent) int {
+	var tokens int
+	for _, block := range content {
+		if block.Type == "thinking" {
+			tokens += EstimateTokens(block.Thinking)
+		}
+	}
+	return tokens
+}
+
+// streamedText returns the text of content when it holds nothing but text, which can be resumed.
+func streamedText(content []AnthropicContent) (string, bool) {
+	var text strings.Builder
+	for _, block := range content {
+		if block.Type != "text" {
+			return "", false
+		}
+		text.WriteString(block.Text)
+	}
+	return text.String(), true
+}
+
+// providerName tells Anthropic agents from those running Anthropic models on Bedrock.
+func (provider Anthropic) providerName() string {
+	if provider.provider == "bedrock" {
+		return "bedrock"
+	}
+	return "anthropic"
 }
 
 func (provider *Anthropic) RegisterTool(fn any, paramType any, desctiption string) error {
-	provider.AgentConfig.RegisterTool(fn, paramType, desctiption)
-	return nil
+	return provider.AgentConfig.RegisterTool(fn, paramType, desctiption)
+}
+
+func (provider *Anthropic) AddTool(tool Tool) error {
+	return provider.AgentConfig.AddTool(tool)
 }
@@ -0,0 +1,178 @@
+package provider
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AWSCredentials authenticate requests to AWS Bedrock, see WithAWSCredentials.
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string // temporary credentials only
+	Region          string // e.g. "us-east-1"
+}
+
+// WithAWSCredentials sets the credentials of bedrock agents, which otherwise come from the
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN and AWS_REGION variables.
+//
+// Bedrock agents run Anthropic models through AWS, e.g. NewAgent("bedrock:anthropic.claude-3-5-sonnet-20241022-v2:0"),
+// and behave like Anthropic agents, except that streamed answers arrive in one piece and web search is not available.
+func WithAWSCredentials(credentials AWSCredentials) AgentOption {
+	return func(a *AgentConfig) {
+		a.AWS = &credentials
+	}
+}
+
+// awsCredentialsFromEnv fills in what credentials lack from the environment.
+func awsCredentialsFromEnv(credentials *AWSCredentials) *AWSCredentials {
+	if credentials == nil {
+		credentials = &AWSCredentials{}
+	}
+	filled := *credentials
+	if filled.AccessKeyID == "" {
+		filled.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+		filled.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		filled.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	}
+	if filled.Region == "" {
+		filled.Region = os.Getenv("AWS_REGION")
+	}
+	if filled.Region == "" {
+		filled.Region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	return &filled
+}
+
+// bedrockEndpoint is the InvokeModel endpoint of model. Colons in model ids are escaped, as AWS expects.
+func (config *AgentConfig) bedrockEndpoint(model string) string {
+	return fmt.Sprintf("https://bedrock-runtime.%s.amazonaws.com/model/%s/invoke", config.AWS.Region, strings.ReplaceAll(model, ":", "%3A"))
+}
+
+// bedrockRequest is an AnthropicRequest as InvokeModel takes it: the model is in the url and the
+// api version in the body. Streams use another endpoint and are not requested.
+type bedrockRequest struct {
+	AnthropicVersion string `json:"anthropic_version"`
+	AnthropicRequest
+	Model  string `json:"model,omitempty"`
+	Stream bool   `json:"stream,omitempty"`
+}
+
+// invokeBedrock sends reqBody to Bedrock. Stream handlers get the answer in one piece.
+func (provider Anthropic) invokeBedrock(ctx context.Context, reqBody AnthropicRequest, response *AnthropicResponse) (responseMeta, error) {
+	headers := map[string]string{
+		"content-type": "application/json",
+		"accept":       "application/json",
+	}
+	payload := bedrockRequest{AnthropicVersion: "bedrock-2023-05-31", AnthropicRequest: reqBody}
+	meta, err := provider.post(ctx, "bedrock", provider.bedrockEndpoint(reqBody.Model), headers, payload, response)
+	if err != nil || provider.Stream == nil {
+		return meta, err
+	}
+	emitter := provider.newStreamEmitter()
+	defer emitter.close(ctx)
+	for _, item := range response.Content {
+		switch item.Type {
+		case "text":
+			emitter.emit(StreamEvent{Type: StreamText, Text: item.Text})
+		case "tool_use":
+			emitter.emit(StreamEvent{Type: StreamToolCallStart, ToolCall: &ToolIntent{Id: item.Id, Name: item.Name}})
+			emitter.emit(StreamEvent{Type: StreamToolCallDelta, ToolCall: &ToolIntent{Id: item.Id, Arguments: string(item.Input)}})
+		}
+	}
+	return meta, nil
+}
+
+func parseBedrockError(apiErr *APIError, resp *http.Response, body []byte) {
+	var response struct {
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &response); err == nil {
+		apiErr.Message = response.Message
+	}
+	// e.g. "ThrottlingException:http://internal.amazon.com/coral/com.amazonaws.bedrock/"
+	apiErr.Type, _, _ = strings.Cut(resp.Header.Get("x-amzn-ErrorType"), ":")
+}
+
+// signAWS signs req, whose body is body, with AWS Signature Version 4.
+func signAWS(req *http.Request, body []byte, credentials *AWSCredentials, service string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+	req.Header.Set("x-amz-date", amzDate)
+	if credentials.SessionToken != "" {
+		req.Header.Set("x-amz-security-token", credentials.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for key, values := range req.Header {
+		key = strings.ToLower(key)
+		if key == "content-type" || strings.HasPrefix(key, "x-amz-") {
+			headers[key] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		awsURIEncode(req.URL.EscapedPath()), // encoded twice, as services other than S3 expect
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + credentials.Region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := []byte("AWS4" + credentials.SecretAccessKey)
+	for _, part := range []string{date, credentials.Region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		credentials.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// awsURIEncode percent-encodes every byte of path but unreserved characters and slashes.
+func awsURIEncode(path string) string {
+	var encoded strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~/", c) >= 0 {
+			encoded.WriteByte(c)
+		} else {
+			fmt.Fprintf(&encoded, "%%%02X", c)
+		}
+	}
+	return encoded.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,62 @@
+package provider
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// The vectors are from AWS's Signature Version 4 documentation and test suite.
+func TestSignAWS(t *testing.T) {
+	credentials := &AWSCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", Region: "us-east-1"}
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	tests := []struct {
+		name          string
+		url           string
+		service       string
+		contentType   string
+		authorization string
+	}{
+		{
+			name:          "get vanilla",
+			url:           "https://example.amazonaws.com/",
+			service:       "service",
+			authorization: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			name:          "iam list users",
+			url:           "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08",
+			service:       "iam",
+			contentType:   "application/x-www-form-urlencoded; charset=utf-8",
+			authorization: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, SignedHeaders=content-type;host;x-amz-date, Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, test.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.contentType != "" {
+				req.Header.Set("Content-Type", test.contentType)
+			}
+			signAWS(req, nil, credentials, test.service, now)
+			if got := req.Header.Get("Authorization"); got != test.authorization {
+				t.Errorf("signed with\n%s\nwant\n%s", got, test.authorization)
+			}
+			if got := req.Header.Get("x-amz-date"); got != "20150830T123600Z" {
+				t.Errorf("dated %s", got)
+			}
+		})
+	}
+}
+
+func TestBedrockContextLengthError(t *testing.T) {
+	resp := &http.Response{StatusCode: http.StatusBadRequest, Header: http.Header{}}
+	resp.Header.Set("x-amzn-ErrorType", "ValidationException:http://internal.amazon.com/coral/com.amazon.bedrock/")
+	apiErr := &APIError{StatusCode: resp.StatusCode}
+	parseBedrockError(apiErr, resp, []byte(`{"message":"Input is too long for requested model."}`))
+	if err := classifyAPIError(apiErr, time.Time{}); !IsContextLengthError(err) {
+		t.Errorf("got %v, want a context length error", err)
+	}
+}
@@ -0,0 +1,100 @@
+package provider
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+type benchmarkParams struct {
+	CityName string   `json:"city_name" description:"name of the city"`
+	Days     int      `json:"days" validate:"min=1,max=14"`
+	Units    string   `json:"units" validate:"oneof=metric imperial"`
+	Tags     []string `json:"tags"`
+	Location struct {
+		Lat float64 `json:"lat"`
+		Lon float64 `json:"lon"`
+	} `json:"location"`
+}
+
+// benchmarkHistory builds a tool-heavy history of n messages, the shape long agent loops produce.
+func benchmarkHistory(n int) []Message {
+	messages := make([]Message, 0, n)
+	for i := 0; len(messages) < n; i++ {
+		id := fmt.Sprintf("call_%d", i)
+		messages = append(messages,
+			Message{Role: "user", Text: "what is the weather like in kolkata over the next few days?"},
+			Message{Type: "tool_intent", ToolIntent: &ToolIntent{Id: id, Name: "FindCityTemp", Arguments: `{"city_name":"kolkata","days":3}`}},
+			Message{ToolResult: &ToolResult{Id: id, Output: "26 degree, humid, light rain in the evening"}},
+			Message{Role: "assistant", Text: "It will be around 26 degrees with light evening rain."},
+		)
+	}
+	return messages[:n]
+}
+
+func BenchmarkAnthropicFormatMessages(b *testing.B) {
+	history := benchmarkHistory(200)
+	b.ReportAllocs()
+	for range b.N {
+		if _, err := (Anthropic{}).FormatMessages(history); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkOpenaiFormatMessages(b *testing.B) {
+	history := benchmarkHistory(200)
+	b.ReportAllocs()
+	for range b.N {
+		(Openai{}).FormatMessages(history)
+	}
+}
+
+func BenchmarkGroqFormatMessages(b *testing.B) {
+	history := benchmarkHistory(200)
+	b.ReportAllocs()
+	for range b.N {
+		(Groq{}).FormatMessages(history)
+	}
+}
+
+func BenchmarkConvertToProperties(b *testing.B) {
+	b.ReportAllocs()
+	for range b.N {
+		ConvertToProperties(benchmarkParams{})
+	}
+}
+
+func BenchmarkSchemaFor(b *testing.B) {
+	paramType := reflect.TypeOf(benchmarkParams{})
+	b.ReportAllocs()
+	for range b.N {
+		schemaFor(paramType)
+	}
+}
+
+func BenchmarkEncodeRequest(b *testing.B) {
+	messages, err := (Anthropic{}).FormatMessages(benchmarkHistory(200))
+	if err != nil {
+		b.Fatal(err)
+	}
+	properties, required := schemaFor(reflect.TypeOf(benchmarkParams{}))
+	request := AnthropicRequest{
+		Model:     "claude-3-7-sonnet-latest",
+		MaxTokens: 1024,
+		Messages:  messages,
+		Tools: []AnthropicTool{{
+			Name:        "FindCityTemp",
+			Description: "find the weather temperature of the provided city name",
+			Parameters:  Parameters{Type: "object", Required: required, Properties: properties},
+		}},
+	}
+	b.ReportAllocs()
+	for range b.N {
+		buffer, err := encodeJSON(request)
+		if err != nil {
+			b.Fatal(err)
+		}
+		releaseBuffer(buffer)
+	}
+}
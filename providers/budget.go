@@ -0,0 +1,86 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrBudgetExceeded is returned when a run stops on the limits set by WithBudget.
+var ErrBudgetExceeded = errors.New("run budget exceeded")
+
+// RunBudget is set by WithBudget. A limit of 0 is no limit.
+type RunBudget struct {
+	MaxTokens  int
+	MaxCostUSD float64
+}
+
+// WithBudget limits what a single run may consume over all its round trips: the input and output
+// tokens and their cost in USD, as priced by the agent's pricing table (see WithPricing). Once a round
+// trip crosses a limit, the run stops before executing the tool it asked for and returns
+// ErrBudgetExceeded along with the messages so far. An answer is still returned as is, the budget
+// only prevents further spending. Responses from the response cache are free. A cost limit needs
+// the price of the model: NewAgent fails without it, and so do runs routed to a model without one.
+// Pass 0 to leave a limit unset, e.g.
+//
+//	provider.WithBudget(0, 0.50)
+func WithBudget(maxTokens int, maxCostUSD float64) AgentOption {
+	return func(a *AgentConfig) {
+		a.Budget = &RunBudget{MaxTokens: maxTokens, MaxCostUSD: maxCostUSD}
+	}
+}
+
+// budgetKey holds the spending of a run against budget. Agents running as tools of another agent
+// keep their own budget.
+type budgetKey struct{ budget *RunBudget }
+
+type budgetSpend struct {
+	sync.Mutex
+	tokens int
+	cost   float64
+}
+
+// beginBudget starts counting the spending of a run, unless ctx is that of a run already counting,
+// the tool loop or a guardrail retry, in which case it fails if the budget is exhausted.
+func (config *AgentConfig) beginBudget(ctx context.Context) (context.Context, error) {
+	if config.Budget == nil {
+		return ctx, nil
+	}
+	if spend, ok := ctx.Value(budgetKey{config.Budget}).(*budgetSpend); ok {
+		spend.Lock()
+		defer spend.Unlock()
+		return ctx, config.Budget.check(spend)
+	}
+	return context.WithValue(ctx, budgetKey{config.Budget}, &budgetSpend{}), nil
+}
+
+// spend counts a round trip against the budget, and fails once it is exhausted.
+func (config *AgentConfig) spend(ctx context.Context, stats RoundTripStats) error {
+	spend, ok := ctx.Value(budgetKey{config.Budget}).(*budgetSpend)
+	if config.Budget == nil || !ok || stats.Cached {
+		return nil
+	}
+	if config.Budget.MaxCostUSD > 0 && !config.priced(stats.Provider, stats.Model) {
+		return fmt.Errorf("%w: no price for %s:%s to count against the cost limit, see WithPricing", ErrBudgetExceeded, stats.Provider, stats.Model)
+	}
+	spend.Lock()
+	defer spend.Unlock()
+	spend.tokens += stats.InputTokens + stats.OutputTokens
+	spend.cost += stats.CostUSD
+	err := config.Budget.check(spend)
+	if err != nil {
+		config.logf("%v\n", err)
+	}
+	return err
+}
+
+func (budget *RunBudget) check(spend *budgetSpend) error {
+	switch {
+	case budget.MaxTokens > 0 && spend.tokens >= budget.MaxTokens:
+		return fmt.Errorf("%w: %d of %d tokens used", ErrBudgetExceeded, spend.tokens, budget.MaxTokens)
+	case budget.MaxCostUSD > 0 && spend.cost >= budget.MaxCostUSD:
+		return fmt.Errorf("%w: $%.4f of $%.4f spent", ErrBudgetExceeded, spend.cost, budget.MaxCostUSD)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.bgeen.com/gossip/pricing"
+)
+
+func TestBudget(t *testing.T) {
+	// every reply of the chat server uses 100 input and 20 output tokens
+	prices := WithPricing(pricing.Table{"custom:test-model": {Input: 1000, Output: 1000}}) // $0.12 per round trip
+	tests := []struct {
+		name      string
+		option    AgentOption
+		wantCalls int
+		wantErr   error
+	}{
+		{"within limits", WithBudget(1000, 1), 2, nil},
+		{"token limit", WithBudget(200, 0), 1, ErrBudgetExceeded},
+		{"cost limit", WithBudget(0, 0.20), 1, ErrBudgetExceeded},
+		{"no limits", WithBudget(0, 0), 2, nil},
+	}
+	for _, test := range tests {
+		server := newChatServer(t,
+			toolReply("call_1", "Lookup", `{"query":"a"}`),
+			toolReply("call_2", "Lookup", `{"query":"b"}`),
+			textReply("done"))
+		agent := server.agent(t, prices, test.option)
+		calls := 0
+		lookup := NewTool("Lookup", "look something up", func(params lookupParams) string {
+			calls++
+			return "found"
+		})
+		if err := agent.AddTool(lookup); err != nil {
+			t.Fatal(err)
+		}
+		result, err := agent.RunContext(context.Background(), "look up a and b")
+		if !errors.Is(err, test.wantErr) || (err == nil) != (test.wantErr == nil) {
+			t.Errorf("%s: error %v, want %v", test.name, err, test.wantErr)
+		}
+		if calls != test.wantCalls {
+			t.Errorf("%s: %d tool calls, want %d", test.name, calls, test.wantCalls)
+		}
+		if result == nil || result.AllMessages[0].Text != "look up a and b" {
+			t.Errorf("%s: no partial result", test.name)
+		}
+	}
+}
+
+func TestBudgetNeedsPrices(t *testing.T) {
+	if _, err := NewAgent("custom:unpriced-model", WithBaseURL("http://localhost"), WithBudget(0, 0.50)); err == nil {
+		t.Error("cost budget accepted for a model without a price")
+	}
+	if _, err := NewAgent("custom:unpriced-model", WithBaseURL("http://localhost"), WithBudget(1000, 0)); err != nil {
+		t.Errorf("token budget rejected: %v", err)
+	}
+
+	// a model priced when the agent was made, but not the one answering
+	server := newChatServer(t, toolReply("call_1", "Lookup", `{"query":"a"}`), textReply("done"))
+	agent := server.agent(t, WithPricing(pricing.Table{"custom:test-model": {Input: 1, Output: 1}}), WithBudget(0, 1),
+		WithRoutes(Route{Model: "custom:other-model", Match: func(RoutingRequest) bool { return true }}))
+	if err := agent.AddTool(NewTool("Lookup", "look something up", func(params lookupParams) string { return "found" })); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := agent.RunContext(context.Background(), "cheap question"); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("unpriced round trip: %v, want ErrBudgetExceeded", err)
+	}
+}
@@ -0,0 +1,257 @@
+package provider
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Cache stores raw provider responses keyed on the request that produced them.
+// A ttl of zero means the entry never expires.
+type Cache interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte, ttl time.Duration)
+}
+
+// CacheKeyFunc derives the cache key for a request body sent to a provider.
+type CacheKeyFunc func(providerName string, body []byte) string
+
+// WithCache short-circuits identical requests (same model, messages and params) using cache.
+func WithCache(cache Cache, ttl time.Duration) AgentOption {
+	return func(a *AgentConfig) {
+		a.Cache = cache
+		a.CacheTTL = ttl
+	}
+}
+
+// WithCacheKey replaces the default sha256 based cache key.
+func WithCacheKey(keyFunc CacheKeyFunc) AgentOption {
+	return func(a *AgentConfig) {
+		a.CacheKey = keyFunc
+	}
+}
+
+func DefaultCacheKey(providerName string, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(providerName))
+	hash.Write([]byte{'\n'})
+	hash.Write(body)
+	return "gossip:" + hex.EncodeToString(hash.Sum(nil))
+}
+
+func (config *AgentConfig) cacheKey(providerName string, body []byte) string {
+	if config.CacheKey != nil {
+		return config.CacheKey(providerName, body)
+	}
+	return DefaultCacheKey(providerName, body)
+}
+
+type memoryCacheEntry struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+// MemoryCache is an in-process Cache safe for concurrent use.
+type MemoryCache struct {
+	// Clock times the expiry of entries instead of the system clock, e.g. the ManualClock
+	// given to the agents with WithClock.
+	Clock Clock
+
+	mu      sync.Mutex
+	entries map[string]memoryCacheEntry
+}
+
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{entries: make(map[string]memoryCacheEntry)}
+}
+
+func (cache *MemoryCache) Get(key string) ([]byte, bool) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	entry, exists := cache.entries[key]
+	if !exists {
+		return nil, false
+	}
+	if !entry.expiresAt.IsZero() && cache.now().After(entry.expiresAt) {
+		delete(cache.entries, key)
+		return nil, false
+	}
+	return entry.value, true
+}
+
+func (cache *MemoryCache) Set(key string, value []byte, ttl time.Duration) {
+	entry := memoryCacheEntry{value: value}
+	if ttl > 0 {
+		entry.expiresAt = cache.now().Add(ttl)
+	}
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.entries[key] = entry
+}
+
+func (cache *MemoryCache) now() time.Time {
+	if cache.Clock == nil {
+		return time.Now()
+	}
+	return cache.Clock.Now()
+}
+
+// RedisCache is a Cache backed by a Redis server, spoken to over a single RESP connection.
+// Redis failures are logged and treated as cache misses so they never fail a run.
+type RedisCache struct {
+	Addr     string
+	Password string
+	DB       int
+
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func NewRedisCache(addr string, password string, db int) *RedisCache {
+	return &RedisCache{Addr: addr, Password: password, DB: db}
+}
+
+func (cache *RedisCache) Get(key string) ([]byte, bool) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	reply, err := cache.do("GET", key)
+	if err != nil {
+		log.Printf("redis cache get failed: %v\n", err)
+		return nil, false
+	}
+	value, ok := reply.([]byte)
+	return value, ok
+}
+
+func (cache *RedisCache) Set(key string, value []byte, ttl time.Duration) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	args := []string{"SET", key, string(value)}
+	if ttl > 0 {
+		// rounded up, PX 0 is an error and a shorter ttl would keep the entry too briefly
+		milliseconds := (ttl + time.Millisecond - 1) / time.Millisecond
+		args = append(args, "PX", strconv.FormatInt(int64(milliseconds), 10))
+	}
+	if _, err := cache.do(args...); err != nil {
+		log.Printf("redis cache set failed: %v\n", err)
+	}
+}
+
+func (cache *RedisCache) Close() error {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if cache.conn == nil {
+		return nil
+	}
+	err := cache.conn.Close()
+	cache.conn = nil
+	return err
+}
+
+func (cache *RedisCache) connect() error {
+	conn, err := net.DialTimeout("tcp", cache.Addr, 5*time.Second)
+	if err != nil {
+		return err
+	}
+	cache.conn = conn
+	cache.reader = bufio.NewReader(conn)
+	if cache.Password != "" {
+		if _, err := cache.command("AUTH", cache.Password); err != nil {
+			cache.dropConn()
+			return err
+		}
+	}
+	if cache.DB != 0 {
+		if _, err := cache.command("SELECT", strconv.Itoa(cache.DB)); err != nil {
+			cache.dropConn()
+			return err
+		}
+	}
+	return nil
+}
+
+func (cache *RedisCache) dropConn() {
+	cache.conn.Close()
+	cache.conn = nil
+}
+
+// do runs a command, (re)connecting first if needed. Caller must hold mu.
+func (cache *RedisCache) do(args ...string) (any, error) {
+	if cache.conn == nil {
+		if err := cache.connect(); err != nil {
+			return nil, err
+		}
+	}
+	reply, err := cache.command(args...)
+	if _, isRedisErr := err.(redisError); err != nil && !isRedisErr {
+		cache.dropConn()
+	}
+	return reply, err
+}
+
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+func (cache *RedisCache) command(args ...string) (any, error) {
+	cache.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	writer := bufio.NewWriter(cache.conn)
+	fmt.Fprintf(writer, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(writer, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if err := writer.Flush(); err != nil {
+		return nil, err
+	}
+	return readRedisReply(cache.reader)
+}
+
+func readRedisReply(reader *bufio.Reader) (any, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 {
+		return nil, fmt.Errorf("redis: malformed reply %q", line)
+	}
+	line = line[:len(line)-2]
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 {
+			return nil, err
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, err
+		}
+		return data[:size], nil
+	case '*':
+		count, err := strconv.Atoi(line[1:])
+		if err != nil || count < 0 {
+			return nil, err
+		}
+		items := make([]any, count)
+		for i := range items {
+			if items[i], err = readRedisReply(reader); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
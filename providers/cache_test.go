@@ -0,0 +1,60 @@
+package provider
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRedisCacheSetTTL(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	commands := make(chan string, 10)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			count, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+			args := make([]string, count)
+			for i := range args {
+				reader.ReadString('\n') // the length
+				arg, _ := reader.ReadString('\n')
+				args[i] = strings.TrimSpace(arg)
+			}
+			commands <- strings.Join(args, " ")
+			conn.Write([]byte("+OK\r\n"))
+		}
+	}()
+
+	cache := NewRedisCache(listener.Addr().String(), "", 0)
+	defer cache.Close()
+	tests := []struct {
+		ttl  time.Duration
+		want string
+	}{
+		{0, "SET key value"},
+		{time.Microsecond, "SET key value PX 1"},
+		{1500 * time.Microsecond, "SET key value PX 2"},
+		{time.Minute, "SET key value PX 60000"},
+	}
+	for _, test := range tests {
+		cache.Set("key", []byte("value"), test.ttl)
+		if got := <-commands; got != test.want {
+			t.Errorf("ttl %s sent %q, want %q", test.ttl, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package provider
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// chatServer is a fake chat completions server answering each request with the next scripted reply.
+type chatServer struct {
+	*httptest.Server
+	t        *testing.T
+	mu       sync.Mutex
+	replies  []GroqMessage
+	requests []GroqRequest
+}
+
+func newChatServer(t *testing.T, replies ...GroqMessage) *chatServer {
+	t.Helper()
+	server := &chatServer{t: t, replies: replies}
+	server.Server = httptest.NewServer(http.HandlerFunc(server.serve))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (server *chatServer) serve(w http.ResponseWriter, r *http.Request) {
+	var request GroqRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		server.t.Errorf("decoding request: %v", err)
+	}
+	server.mu.Lock()
+	server.requests = append(server.requests, request)
+	if len(server.replies) == 0 {
+		server.mu.Unlock()
+		server.t.Errorf("unexpected request %d", len(server.requests))
+		http.Error(w, `{"error":{"message":"no reply scripted"}}`, http.StatusInternalServerError)
+		return
+	}
+	reply := server.replies[0]
+	server.replies = server.replies[1:]
+	server.mu.Unlock()
+
+	finishReason := "stop"
+	if len(reply.ToolCalls) > 0 {
+		finishReason = "tool_calls"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"id":      "chatcmpl-test",
+		"model":   request.Model,
+		"choices": []map[string]any{{"index": 0, "message": reply, "finish_reason": finishReason}},
+		"usage":   map[string]any{"prompt_tokens": 100, "completion_tokens": 20, "total_tokens": 120},
+	})
+}
+
+// received returns the requests served so far.
+func (server *chatServer) received() []GroqRequest {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	return append([]GroqRequest(nil), server.requests...)
+}
+
+// agent builds a custom agent talking to the server.
+func (server *chatServer) agent(t *testing.T, opts ...AgentOption) Agent {
+	t.Helper()
+	agent, err := NewAgent("custom:test-model", append([]AgentOption{WithBaseURL(server.URL)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return agent
+}
+
+func textReply(text string) GroqMessage {
+	return GroqMessage{Role: "assistant", Content: text}
+}
+
+func toolReply(id string, name string, arguments string) GroqMessage {
+	return GroqMessage{Role: "assistant", ToolCalls: []GroqToolCall{{Type: "function", Id: id, Function: GroqFunctionResp{Name: name, Arguments: arguments}}}}
+}
+
+type lookupParams struct {
+	Query string `json:"query"`
+}
@@ -0,0 +1,253 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoCheckpoint is returned by Resume when there is nothing to resume from.
+var ErrNoCheckpoint = errors.New("no checkpoint")
+
+// Checkpoint is the state of an agent run between two steps of its tool loop.
+type Checkpoint struct {
+	RunID      string           `json:"run_id"`
+	UserID     string           `json:"user_id,omitempty"` // the Identity subject of the run, see DeleteUserCheckpoints
+	Messages   []Message        `json:"messages"`
+	Pending    *ToolIntent      `json:"pending,omitempty"` // tool call received but not executed yet
+	Iteration  int              `json:"iteration"`         // model responses so far
+	RoundTrips []RoundTripStats `json:"round_trips"`       // accumulated latency and usage
+	Done       bool             `json:"done"`
+	Text       string           `json:"text,omitempty"` // final answer once done
+	UpdatedAt  time.Time        `json:"updated_at"`
+}
+
+// CheckpointStore persists checkpoints by run id. Load returns nil, nil for unknown runs.
+type CheckpointStore interface {
+	Load(runID string) (*Checkpoint, error)
+	Save(checkpoint *Checkpoint) error
+	Delete(runID string) error
+}
+
+// WithCheckpoints saves a checkpoint to store after every step of runs that carry
+// a run id (see ContextWithRunID), so they can be continued with Resume after a crash.
+func WithCheckpoints(store CheckpointStore) AgentOption {
+	return func(a *AgentConfig) {
+		a.Checkpoints = store
+	}
+}
+
+type runIDKey struct{}
+
+// ContextWithRunID names the run made with ctx for checkpointing. Ids must be unique per run.
+// Agents run by the tools of a checkpointed run need run ids of their own to be checkpointed.
+func ContextWithRunID(ctx context.Context, runID string) context.Context {
+	return context.WithValue(ctx, runIDKey{}, runID)
+}
+
+// runState follows a checkpointed run through the recursive tool loop.
+type runState struct {
+	checkpoint Checkpoint
+}
+
+// runStateKey holds the run state of an agent, agents run by its tools keep their own.
+type runStateKey struct{ agent *agentID }
+
+// beginCheckpoint attaches the run state to ctx. It reports true for the call that
+// starts the run, which is the one that completes it.
+func (config *AgentConfig) beginCheckpoint(ctx context.Context) (context.Context, bool) {
+	if config.Checkpoints == nil || ctx.Value(runStateKey{config.id}) != nil {
+		return ctx, false
+	}
+	runID, _ := ctx.Value(runIDKey{}).(string)
+	if runID == "" {
+		return ctx, false
+	}
+	// the id is taken: agents run by the tools don't checkpoint over the run
+	ctx = ContextWithRunID(ctx, "")
+	state := &runState{checkpoint: Checkpoint{RunID: runID}}
+	if identity, ok := IdentityFromContext(ctx); ok {
+		state.checkpoint.UserID = identity.Subject
+	}
+	return context.WithValue(ctx, runStateKey{config.id}, state), true
+}
+
+// checkpoint saves the run after a model response (stats set) or a tool execution.
+// A failed save is logged; the run goes on without it.
+func (config *AgentConfig) checkpoint(ctx context.Context, history []Message, newMessages []Message, pending ToolIntent, stats *RoundTripStats) {
+	state, ok := ctx.Value(runStateKey{config.id}).(*runState)
+	if !ok || config.Checkpoints == nil {
+		return
+	}
+	checkpoint := &state.checkpoint
+	checkpoint.Messages = append(append(make([]Message, 0, len(history)+len(newMessages)), history...), newMessages...)
+	checkpoint.Pending = nil
+	if pending.Id != "" {
+		checkpoint.Pending = &pending
+	}
+	if stats != nil {
+		checkpoint.Iteration++
+		checkpoint.RoundTrips = append(checkpoint.RoundTrips, *stats)
+	}
+	checkpoint.UpdatedAt = config.now()
+	if err := config.Checkpoints.Save(checkpoint); err != nil {
+		config.logf("saving checkpoint %s failed: %v\n", checkpoint.RunID, err)
+	}
+}
+
+func (config *AgentConfig) completeCheckpoint(ctx context.Context, result *AgentResult) {
+	state, ok := ctx.Value(runStateKey{config.id}).(*runState)
+	if !ok || config.Checkpoints == nil {
+		return
+	}
+	checkpoint := &state.checkpoint
+	checkpoint.Messages = result.AllMessages
+	checkpoint.Pending = nil
+	checkpoint.Done = true
+	checkpoint.Text = result.Text
+	checkpoint.UpdatedAt = config.now()
+	if err := config.Checkpoints.Save(checkpoint); err != nil {
+		config.logf("saving checkpoint %s failed: %v\n", checkpoint.RunID, err)
+	}
+}
+
+// configured gives access to the configuration of the built-in agents.
+type configured interface {
+	agentConfig() *AgentConfig
+}
+
+func (config *AgentConfig) agentConfig() *AgentConfig {
+	return config
+}
+
+// Resume continues run runID of agent from its last checkpoint. A pending tool call is executed
+// first, so a tool may run twice when the process died right after calling it. Completed runs are
+// returned as they were. The result's NewMessages only hold the messages of the resumed part.
+func Resume(ctx context.Context, agent Agent, runID string) (*AgentResult, error) {
+	c, ok := agent.(configured)
+	if !ok || c.agentConfig().Checkpoints == nil {
+		return nil, fmt.Errorf("%w: agent has no checkpoint store", ErrNoCheckpoint)
+	}
+	config := c.agentConfig()
+	checkpoint, err := config.Checkpoints.Load(runID)
+	if err != nil {
+		return nil, err
+	}
+	if checkpoint == nil {
+		return nil, fmt.Errorf("%w for run %s", ErrNoCheckpoint, runID)
+	}
+	if checkpoint.Done {
+		return &AgentResult{AllMessages: checkpoint.Messages, Text: checkpoint.Text, RoundTrips: checkpoint.RoundTrips}, nil
+	}
+
+	state := &runState{checkpoint: *checkpoint}
+	ctx = context.WithValue(ContextWithRunID(ctx, ""), runStateKey{config.id}, state)
+	messages := checkpoint.Messages
+	var resumed []Message
+	if checkpoint.Pending != nil {
+		toolResult, err := config.executeTool(ctx, messages, *checkpoint.Pending)
+		if err != nil {
+			return nil, err
+		}
+		resumed = append(resumed, Message{ToolResult: toolResult})
+		config.checkpoint(ctx, messages, resumed, ToolIntent{}, nil)
+	}
+
+	result, err := agent.RunContext(ctx, "", append(messages, resumed...))
+	if err != nil {
+		return result, err
+	}
+	result.NewMessages = append(resumed, result.NewMessages...)
+	result.RoundTrips = append(append([]RoundTripStats(nil), checkpoint.RoundTrips...), result.RoundTrips...)
+	config.completeCheckpoint(ctx, result)
+	return result, nil
+}
+
+// MemoryCheckpointStore keeps checkpoints in process memory, mostly for tests.
+type MemoryCheckpointStore struct {
+	mu          sync.Mutex
+	checkpoints map[string][]byte
+}
+
+func NewMemoryCheckpointStore() *MemoryCheckpointStore {
+	return &MemoryCheckpointStore{checkpoints: make(map[string][]byte)}
+}
+
+func (store *MemoryCheckpointStore) Load(runID string) (*Checkpoint, error) {
+	store.mu.Lock()
+	data, exists := store.checkpoints[runID]
+	store.mu.Unlock()
+	if !exists {
+		return nil, nil
+	}
+	var checkpoint Checkpoint
+	return &checkpoint, json.Unmarshal(data, &checkpoint)
+}
+
+func (store *MemoryCheckpointStore) Save(checkpoint *Checkpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	store.mu.Lock()
+	store.checkpoints[checkpoint.RunID] = data
+	store.mu.Unlock()
+	return nil
+}
+
+func (store *MemoryCheckpointStore) Delete(runID string) error {
+	store.mu.Lock()
+	delete(store.checkpoints, runID)
+	store.mu.Unlock()
+	return nil
+}
+
+// FileCheckpointStore keeps one JSON file per run in a directory.
+type FileCheckpointStore struct {
+	Dir string
+}
+
+func NewFileCheckpointStore(dir string) (*FileCheckpointStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &FileCheckpointStore{Dir: dir}, nil
+}
+
+func (store *FileCheckpointStore) Load(runID string) (*Checkpoint, error) {
+	var checkpoint Checkpoint
+	found, err := readJSONFile(store.Dir, runID, &checkpoint)
+	if !found || err != nil {
+		return nil, err
+	}
+	return &checkpoint, nil
+}
+
+func (store *FileCheckpointStore) Save(checkpoint *Checkpoint) error {
+	return writeJSONFile(store.Dir, checkpoint.RunID, checkpoint)
+}
+
+func (store *FileCheckpointStore) Delete(runID string) error {
+	path, err := jsonFilePath(store.Dir, runID)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// jsonFilePath is the file of id in dir, rejecting ids that would escape it.
+func jsonFilePath(dir string, id string) (string, error) {
+	if id == "" || id == "." || id == ".." || strings.ContainsAny(id, `/\`) {
+		return "", fmt.Errorf("invalid id %q", id)
+	}
+	return filepath.Join(dir, id+".json"), nil
+}
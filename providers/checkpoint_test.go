@@ -0,0 +1,101 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestCheckpointNestedAgent(t *testing.T) {
+	for _, childStore := range []bool{false, true} {
+		store := NewMemoryCheckpointStore()
+		childServer := newChatServer(t, textReply("child answer"))
+		var childOpts []AgentOption
+		if childStore {
+			childOpts = append(childOpts, WithCheckpoints(store))
+		}
+		child := childServer.agent(t, childOpts...)
+
+		server := newChatServer(t, toolReply("call_1", "Ask", `{"query":"q"}`), textReply("parent answer"))
+		parent := server.agent(t, WithCheckpoints(store))
+		ask := NewTool("Ask", "ask the child agent", func(ctx context.Context, params lookupParams) (string, error) {
+			result, err := child.RunContext(ctx, params.Query)
+			if err != nil {
+				return "", err
+			}
+			return result.Text, nil
+		})
+		if err := parent.AddTool(ask); err != nil {
+			t.Fatal(err)
+		}
+
+		result, err := parent.RunContext(ContextWithRunID(context.Background(), "run-1"), "hello")
+		if err != nil {
+			t.Fatalf("child store %v: %v", childStore, err)
+		}
+		checkpoint, err := store.Load("run-1")
+		if err != nil || checkpoint == nil {
+			t.Fatalf("child store %v: checkpoint %v, %v", childStore, checkpoint, err)
+		}
+		last := checkpoint.Messages[len(checkpoint.Messages)-1]
+		if !checkpoint.Done || checkpoint.Messages[0].Text != "hello" || last.Text != "parent answer" {
+			t.Errorf("child store %v: checkpoint overwritten: done %v, messages %q to %q", childStore, checkpoint.Done, checkpoint.Messages[0].Text, last.Text)
+		}
+		if len(checkpoint.Messages) != len(result.AllMessages) {
+			t.Errorf("child store %v: checkpoint has %d messages, run %d", childStore, len(checkpoint.Messages), len(result.AllMessages))
+		}
+	}
+}
+
+func TestResume(t *testing.T) {
+	store := NewMemoryCheckpointStore()
+	history := []Message{
+		{Role: "user", Text: "look it up"},
+		{Type: "tool_intent", ToolIntent: &ToolIntent{Id: "call_1", Name: "Lookup", Arguments: `{"query":"gossip"}`}},
+	}
+	store.Save(&Checkpoint{
+		RunID:      "run-1",
+		Messages:   history,
+		Pending:    history[1].ToolIntent,
+		Iteration:  1,
+		RoundTrips: []RoundTripStats{{InputTokens: 100, OutputTokens: 20}},
+	})
+	server := newChatServer(t, textReply("found it"))
+	agent := server.agent(t, WithCheckpoints(store))
+	var calls []string
+	lookup := NewTool("Lookup", "look something up", func(params lookupParams) string {
+		calls = append(calls, params.Query)
+		return "a go library"
+	})
+	if err := agent.AddTool(lookup); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Resume(context.Background(), agent, "run-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 1 || calls[0] != "gossip" {
+		t.Errorf("pending tool calls %v, want [gossip]", calls)
+	}
+	if result.Text != "found it" || len(result.RoundTrips) != 2 {
+		t.Errorf("result text %q with %d round trips, want found it with 2", result.Text, len(result.RoundTrips))
+	}
+	requests := server.received()
+	if len(requests) != 1 || len(requests[0].Messages) != 3 {
+		t.Fatalf("requests %+v, want one continuing the checkpointed history", requests)
+	}
+	checkpoint, _ := store.Load("run-1")
+	if !checkpoint.Done || checkpoint.Text != "found it" || len(checkpoint.Messages) != 4 {
+		t.Errorf("checkpoint done %v, text %q, %d messages", checkpoint.Done, checkpoint.Text, len(checkpoint.Messages))
+	}
+
+	// a completed run is returned as it was, without asking the model again
+	again, err := Resume(context.Background(), agent, "run-1")
+	if err != nil || again.Text != "found it" || len(server.received()) != 1 {
+		t.Errorf("resuming a completed run: %v, %q, %d requests", err, again.Text, len(server.received()))
+	}
+	if _, err := Resume(context.Background(), agent, "unknown"); !errors.Is(err, ErrNoCheckpoint) {
+		t.Errorf("resuming an unknown run: %v, want ErrNoCheckpoint", err)
+	}
+}
@@ -0,0 +1,80 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Classification is the label Classify chose for a text.
+type Classification struct {
+	Label      string       `json:"label"`
+	Confidence float64      `json:"confidence"` // between 0 and 1, as estimated by the model
+	Result     *AgentResult `json:"-"`
+}
+
+// classifyAttempts bounds how often the model is asked again after answering with a label it was not given.
+const classifyAttempts = 2
+
+// Classify has agent sort text into exactly one of labels. The answer is checked against the labels,
+// matched regardless of case, and the model is corrected once when it made one up.
+func Classify(ctx context.Context, agent Agent, text string, labels []string) (*Classification, error) {
+	if len(labels) == 0 {
+		return nil, fmt.Errorf("classify: no labels")
+	}
+	schema, err := json.Marshal(Parameters{
+		Type:     "object",
+		Required: []string{"label", "confidence"},
+		Properties: Properties{
+			"label":      {Type: "string", Enum: labels},
+			"confidence": {Type: "number", Description: "how sure you are of the label, from 0 to 1"},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var prompt strings.Builder
+	fmt.Fprintf(&prompt, "Classify the text below with exactly one of these labels: %s.\n", strings.Join(labels, ", "))
+	fmt.Fprintf(&prompt, "\n<text>\n%s\n</text>\n", text)
+	fmt.Fprintf(&prompt, "\nRespond with JSON only, matching this JSON schema:\n%s", schema)
+
+	var history []Message
+	for attempt := 1; ; attempt++ {
+		result, err := agent.RunContext(ctx, prompt.String(), history)
+		if err != nil {
+			return nil, fmt.Errorf("classify: %w", err)
+		}
+		var answer Classification
+		if err := json.Unmarshal([]byte(stripCodeFence(result.Text)), &answer); err != nil {
+			return nil, fmt.Errorf("classify: model returned invalid json: %w", err)
+		}
+		for _, label := range labels {
+			if strings.EqualFold(strings.TrimSpace(answer.Label), label) {
+				answer.Label = label
+				answer.Confidence = min(max(answer.Confidence, 0), 1)
+				answer.Result = result
+				return &answer, nil
+			}
+		}
+		if attempt == classifyAttempts {
+			return nil, fmt.Errorf("classify: model answered %q, which is not one of the labels", answer.Label)
+		}
+		history = result.AllMessages
+		prompt.Reset()
+		fmt.Fprintf(&prompt, "%q is not one of the labels. Answer again with one of: %s.", answer.Label, strings.Join(labels, ", "))
+	}
+}
+
+// stripCodeFence removes the markdown code fence models like to wrap JSON answers in.
+func stripCodeFence(text string) string {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "```") {
+		return text
+	}
+	text = strings.TrimPrefix(text, "```")
+	if newline := strings.IndexByte(text, '\n'); newline >= 0 {
+		text = text[newline+1:] // drop the language tag
+	}
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(text), "```"))
+}
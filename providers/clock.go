@@ -0,0 +1,120 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Clock tells agents the time: checkpoint and transcript timestamps, latencies and tool durations.
+// Tests pass a ManualClock with WithClock so all of them come out the same on every run.
+type Clock interface {
+	Now() time.Time
+}
+
+// IDGenerator hands out the ids gossip assigns, kind saying what for, e.g. "tool_call".
+type IDGenerator interface {
+	NewID(kind string) string
+}
+
+// WithClock has the agent read the time from clock instead of the system clock, down to the
+// expiry of semantic cache entries, rate limits and failover cooldowns. Sessions of the agent
+// stamp their updates with it too. Timeouts, retries and request signing keep using the system
+// clock, and so does a MemoryCache without a Clock of its own.
+func WithClock(clock Clock) AgentOption {
+	return func(a *AgentConfig) {
+		a.Clock = clock
+	}
+}
+
+// WithIDGenerator has the agent number the tool calls of its answers with ids, replacing those the
+// provider assigned, so histories and fixtures don't change from one recording to the next.
+// Stream events still carry the provider's ids.
+func WithIDGenerator(ids IDGenerator) AgentOption {
+	return func(a *AgentConfig) {
+		a.IDs = ids
+	}
+}
+
+// systemClock is the Clock of time.Now.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (config *AgentConfig) now() time.Time {
+	if config.Clock == nil {
+		return time.Now()
+	}
+	return config.Clock.Now()
+}
+
+// clockKey holds the clock of the agent consulting a policy, for policies that keep time.
+type clockKey struct{}
+
+// clockNow is the time of the clock in ctx, the system clock without one.
+func clockNow(ctx context.Context) time.Time {
+	if clock, ok := ctx.Value(clockKey{}).(Clock); ok {
+		return clock.Now()
+	}
+	return time.Now()
+}
+
+func (config *AgentConfig) since(start time.Time) time.Duration {
+	return config.now().Sub(start)
+}
+
+// toolCallID returns the id of a tool call the provider named id.
+func (config *AgentConfig) toolCallID(id string) string {
+	if config.IDs == nil {
+		return id
+	}
+	return config.IDs.NewID("tool_call")
+}
+
+// ManualClock is a Clock that only moves when told to, for tests.
+type ManualClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{now: now}
+}
+
+func (clock *ManualClock) Now() time.Time {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	return clock.now
+}
+
+// Advance moves the clock forward by d.
+func (clock *ManualClock) Advance(d time.Duration) {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	clock.now = clock.now.Add(d)
+}
+
+// Set moves the clock to now, backwards too.
+func (clock *ManualClock) Set(now time.Time) {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	clock.now = now
+}
+
+// SequentialIDs is an IDGenerator counting per kind, "tool_call_1", "tool_call_2" and so on, for tests.
+type SequentialIDs struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func NewSequentialIDs() *SequentialIDs {
+	return &SequentialIDs{counts: make(map[string]int)}
+}
+
+func (ids *SequentialIDs) NewID(kind string) string {
+	ids.mu.Lock()
+	defer ids.mu.Unlock()
+	ids.counts[kind]++
+	return fmt.Sprintf("%s_%d", kind, ids.counts[kind])
+}
@@ -0,0 +1,76 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWithClock(t *testing.T) {
+	clock := NewManualClock(time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC))
+	cache := NewSemanticCache(wordEmbedder{}, 0.9)
+	cache.TTL = time.Hour
+	server := newChatServer(t, textReply("Paris"), textReply("Paris still"))
+	agent := server.agent(t, WithClock(clock), WithSemanticCache(cache))
+
+	session, err := NewSession("clocked", agent, NewMemorySessionStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := session.Run("What is the capital of France?"); err != nil {
+		t.Fatal(err)
+	}
+	if !session.state.UpdatedAt.Equal(clock.Now()) {
+		t.Errorf("session updated at %s, want the agent's time %s", session.state.UpdatedAt, clock.Now())
+	}
+
+	// the cached answer expires by the agent's clock, not by the system clock
+	if _, err := agent.Run("capital of France?"); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(2 * time.Hour)
+	result, err := agent.Run("capital of France?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(server.received()) != 2 || result.RoundTrips[0].Cached {
+		t.Errorf("%d requests after the cache entry expired, want it asked again", len(server.received()))
+	}
+}
+
+func TestWithClockRateLimits(t *testing.T) {
+	clock := NewManualClock(time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC))
+	ctx := context.WithValue(context.Background(), clockKey{}, Clock(clock))
+	policy := RateLimitTool("lookup", 1, time.Minute)
+	if allowed, _ := policy.Allow(ctx, "lookup", "{}"); !allowed {
+		t.Fatal("first call denied")
+	}
+	if allowed, _ := policy.Allow(ctx, "lookup", "{}"); allowed {
+		t.Error("second call within the minute allowed")
+	}
+	clock.Advance(time.Minute)
+	if allowed, _ := policy.Allow(ctx, "lookup", "{}"); !allowed {
+		t.Error("call a minute later denied")
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		http.Error(w, `{"error":{"message":"slow down"}}`, http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+	agent, err := NewAgent("custom:test-model", WithBaseURL(server.URL), WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = agent.Run("hello")
+	var rateLimitErr *RateLimitError
+	if !errors.As(err, &rateLimitErr) {
+		t.Fatalf("got %v, want a rate limit error", err)
+	}
+	if want := clock.Now().Add(30 * time.Second); !rateLimitErr.Reset.Equal(want) {
+		t.Errorf("rate limit resets at %s, want %s by the agent's clock", rateLimitErr.Reset, want)
+	}
+}
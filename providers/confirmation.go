@@ -0,0 +1,114 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// ActionProposal is what the model calls the proposal of a tool added WithConfirmation with.
+type ActionProposal struct {
+	Summary string `json:"summary" description:"what the action will do and to what, in plain words for the user to confirm"`
+}
+
+// WithToolConfirmer asks confirmer to confirm the actions proposed for tools added WithConfirmation,
+// e.g. by showing the summary to a person. Its Allow gets the name of the tool and the summary as
+// arguments; a rejection reason is returned to the model.
+func WithToolConfirmer(confirmer Policy) AgentOption {
+	return func(a *AgentConfig) {
+		a.ToolConfirmer = confirmer
+	}
+}
+
+// proposalName is the name of the tool proposing a call of the tool name.
+func proposalName(name string) string {
+	return "propose_" + name
+}
+
+// addProposal registers the proposal tool of tool, or removes it when tool no longer needs a confirmation.
+func (store *ToolStore) addProposal(tool Tool) {
+	name := proposalName(tool.Name)
+	if store.proposals == nil {
+		store.proposals = make(map[string]string)
+	}
+	if !tool.confirmationRequired {
+		if _, found := store.proposals[name]; found {
+			delete(store.proposals, name)
+			delete(store.functions, name)
+			delete(store.paramTypes, name)
+			delete(store.descriptions, name)
+		}
+		return
+	}
+	store.proposals[name] = tool.Name
+	store.functions[name] = nil // proposals are answered by the confirmer, see executeTool
+	store.paramTypes[name] = reflect.TypeOf(ActionProposal{})
+	store.descriptions[name] = fmt.Sprintf("Propose to call %s: %s. The action needs the user's confirmation: describe what "+
+		"you intend to do and, once confirmed, %s will be offered with its parameters.", tool.Name, tool.Description, tool.Name)
+}
+
+// confirmationStage replaces in names the tools needing a confirmation by their proposal, unless the
+// current turn of history has a confirmed proposal not acted on yet.
+func (config *AgentConfig) confirmationStage(names []string, prompt string, history []Message) []string {
+	if len(config.ToolStore.proposals) == 0 {
+		return names
+	}
+	var confirmed map[string]bool
+	if prompt == "" {
+		confirmed = config.confirmedTools(history)
+	}
+	var staged []string
+	for _, name := range names {
+		if tool, isProposal := config.ToolStore.proposals[name]; isProposal && confirmed[tool] {
+			continue
+		}
+		if config.ToolStore.tools[name].confirmationRequired && !confirmed[name] {
+			continue
+		}
+		staged = append(staged, name)
+	}
+	return staged
+}
+
+// confirmedTools returns the tools whose proposal was confirmed in the current turn of history and
+// that were not called since, a call counting once it has a result.
+func (config *AgentConfig) confirmedTools(history []Message) map[string]bool {
+	start := len(history)
+	for start > 0 && !isTurnStart(history[start-1]) {
+		start--
+	}
+	confirmed := make(map[string]bool)
+	called := make(map[string]string) // tool name by call id
+	for _, msg := range history[start:] {
+		switch {
+		case msg.ToolIntent != nil:
+			called[msg.ToolIntent.Id] = msg.ToolIntent.Name
+		case msg.ToolResult != nil:
+			name := called[msg.ToolResult.Id]
+			if tool, isProposal := config.ToolStore.proposals[name]; isProposal {
+				confirmed[tool] = msg.ToolResult.Error == ""
+			} else {
+				confirmed[name] = false
+			}
+		}
+	}
+	return confirmed
+}
+
+// confirm answers the proposal of an action by asking the confirmer about it.
+func (config *AgentConfig) confirm(ctx context.Context, toolIntent ToolIntent, toolName string) *ToolResult {
+	var proposal ActionProposal
+	if err := json.Unmarshal([]byte(toolIntent.Arguments), &proposal); err != nil || proposal.Summary == "" {
+		return failedToolResult(toolIntent.Id, "proposal not confirmed: summarize the action in the summary parameter")
+	}
+	confirmed, reason := false, fmt.Sprintf("tool %s requires a confirmation and there is no confirmer", toolName)
+	if config.ToolConfirmer != nil {
+		confirmed, reason = config.ToolConfirmer.Allow(ctx, toolName, proposal.Summary)
+	}
+	if !confirmed {
+		config.logf("Proposal for %s not confirmed: %s\n", toolName, reason)
+		return failedToolResult(toolIntent.Id, "proposal not confirmed: "+reason)
+	}
+	return newToolResult(toolIntent.Id, fmt.Sprintf("confirmed, call %s with its parameters to carry out: %s", toolName, proposal.Summary))
+}
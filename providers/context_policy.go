@@ -0,0 +1,98 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// ContextPolicy shrinks a message history that no longer fits the model's context window.
+// It is applied once when a provider rejects a request with a context length error.
+type ContextPolicy func(messages []Message) ([]Message, error)
+
+func WithContextPolicy(policy ContextPolicy) AgentOption {
+	return func(a *AgentConfig) {
+		a.ContextPolicy = policy
+	}
+}
+
+// TruncateOldest keeps at most the last keep messages. The kept history always starts
+// on a user turn so a tool result is never separated from the tool call it answers.
+func TruncateOldest(keep int) ContextPolicy {
+	return func(messages []Message) ([]Message, error) {
+		start := historyCut(messages, len(messages)-keep)
+		return append([]Message(nil), messages[start:]...), nil
+	}
+}
+
+// SummarizeOldest replaces everything but the last keep messages with a summary written by summarizer.
+func SummarizeOldest(summarizer Agent, keep int) ContextPolicy {
+	return func(messages []Message) ([]Message, error) {
+		start := historyCut(messages, len(messages)-keep)
+		if start == 0 {
+			return messages, nil
+		}
+		prompt := "Summarize the following conversation concisely, keeping every fact, decision and open question needed to continue it:\n\n" + renderTranscript(messages[:start])
+		result, err := summarizer.Run(prompt)
+		if err != nil {
+			return nil, fmt.Errorf("summarizing history: %w", err)
+		}
+		summary := Message{Role: "user", Text: "Summary of the earlier conversation: " + result.Text}
+		return append([]Message{summary}, messages[start:]...), nil
+	}
+}
+
+// historyCut moves start forward until it lands on a user turn that is not part of a tool exchange.
+func historyCut(messages []Message, start int) int {
+	if start < 0 {
+		start = 0
+	}
+	if start == 0 {
+		return 0
+	}
+	for start < len(messages) {
+		if isTurnStart(messages[start]) {
+			break
+		}
+		start++
+	}
+	return start
+}
+
+func renderTranscript(messages []Message) string {
+	var transcript strings.Builder
+	for _, msg := range messages {
+		switch {
+		case msg.ToolIntent != nil:
+			fmt.Fprintf(&transcript, "assistant called tool %s(%s)\n", msg.ToolIntent.Name, msg.ToolIntent.Arguments)
+		case msg.ToolResult != nil:
+			fmt.Fprintf(&transcript, "tool returned: %s\n", msg.ToolResult.Output)
+		default:
+			role := msg.Role
+			if role == "" {
+				role = "user"
+			}
+			fmt.Fprintf(&transcript, "%s: %s\n", role, msg.Text)
+		}
+	}
+	return transcript.String()
+}
+
+// contextRecoveredKey marks a run whose history the context policy already trimmed,
+// agents run by its tools trim their own.
+type contextRecoveredKey struct{ agent *agentID }
+
+// recoverContext applies the context policy after a context length error, and returns the ctx
+// to retry the run with. It reports false when the run should fail instead of being retried.
+func (config *AgentConfig) recoverContext(ctx context.Context, err error, messageHistory [][]Message) (context.Context, []Message, bool) {
+	if config.ContextPolicy == nil || ctx.Value(contextRecoveredKey{config.id}) != nil || len(messageHistory) == 0 || !IsContextLengthError(err) {
+		return ctx, nil, false
+	}
+	trimmed, policyErr := config.ContextPolicy(messageHistory[0])
+	if policyErr != nil {
+		config.logf("context policy failed: %v\n", policyErr)
+		return ctx, nil, false
+	}
+	config.logf("context length exceeded, retrying with %d of %d messages\n", len(trimmed), len(messageHistory[0]))
+	return context.WithValue(ctx, contextRecoveredKey{config.id}, true), trimmed, true
+}
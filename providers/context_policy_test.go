@@ -0,0 +1,62 @@
+package provider
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestContextPolicyRetriesEveryRun(t *testing.T) {
+	var mu sync.Mutex
+	var sent []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request GroqRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("decoding request: %v", err)
+		}
+		mu.Lock()
+		sent = append(sent, len(request.Messages))
+		mu.Unlock()
+		if len(request.Messages) > 3 {
+			http.Error(w, `{"error":{"message":"too long","code":"context_length_exceeded"}}`, http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"choices": []map[string]any{{"message": textReply("Paris"), "finish_reason": "stop"}},
+		})
+	}))
+	defer server.Close()
+	agent, err := NewAgent("custom:test-model", WithBaseURL(server.URL), WithContextPolicy(TruncateOldest(2)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	history := []Message{
+		{Role: "user", Text: "hi"}, {Role: "assistant", Text: "hello"},
+		{Role: "user", Text: "where is Paris?"}, {Role: "assistant", Text: "in France"},
+	}
+
+	// the policy applies once per run, a recovered run doesn't keep the next ones from recovering
+	for run := 0; run < 2; run++ {
+		if _, err := agent.Run("capital of France?", history); err != nil {
+			t.Fatalf("run %d: %v", run, err)
+		}
+	}
+	if len(sent) != 4 || sent[0] != 5 || sent[1] != 3 || sent[2] != 5 || sent[3] != 3 {
+		t.Errorf("sent %v messages, want each run retried with the trimmed history", sent)
+	}
+
+	// a history still too long after trimming fails instead of trimming again
+	agent, err = NewAgent("custom:test-model", WithBaseURL(server.URL), WithContextPolicy(TruncateOldest(4)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent = nil
+	if _, err := agent.Run("capital of France?", history); !IsContextLengthError(err) {
+		t.Errorf("got %v, want the context length error", err)
+	}
+	if len(sent) != 2 {
+		t.Errorf("sent %d requests, want a single retry", len(sent))
+	}
+}
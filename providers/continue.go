@@ -0,0 +1,105 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"unicode"
+)
+
+// ErrInterrupted is returned by requests interrupted before anything could be kept of their answer.
+var ErrInterrupted = errors.New("generation interrupted")
+
+type interruptKey struct{}
+
+// stopInterrupted is the stop reason of responses assembled from an interrupted stream.
+const stopInterrupted = "interrupted"
+
+// ContextWithInterrupt returns a context whose runs stop generating when interrupt is called, e.g.
+// when the user presses a stop button. A streamed answer (see WithStreaming) ends where it was
+// interrupted and the run returns it as an incomplete result; requests that are not streamed
+// have nothing to return and fail with ErrInterrupted. Use a new context for the next generation.
+func ContextWithInterrupt(ctx context.Context) (context.Context, func()) {
+	interrupted, interrupt := context.WithCancel(context.Background())
+	return context.WithValue(ctx, interruptKey{}, interrupted), interrupt
+}
+
+// interruptible derives the context of a request, canceled with ErrInterrupted when the run is interrupted.
+func interruptible(ctx context.Context) (context.Context, context.CancelCauseFunc) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	interrupted, ok := ctx.Value(interruptKey{}).(context.Context)
+	if !ok {
+		return ctx, cancel
+	}
+	stop := context.AfterFunc(interrupted, func() { cancel(ErrInterrupted) })
+	return ctx, func(cause error) {
+		stop()
+		cancel(cause)
+	}
+}
+
+// interruption returns ErrInterrupted for a request that failed with err because the run was interrupted.
+func interruption(ctx context.Context, err error) error {
+	if errors.Is(context.Cause(ctx), ErrInterrupted) {
+		return ErrInterrupted
+	}
+	return err
+}
+
+// continueInstruction asks models that cannot resume a message of theirs to carry on instead.
+const continueInstruction = "Your previous message was cut off. Continue it exactly where it stops, without repeating anything."
+
+// Continue asks for the rest of an incomplete result, cut short by the token limit or an interrupt,
+// and stitches it onto the incomplete message: the returned result reads as if the answer had been
+// generated in one go. Anthropic and Groq resume the message itself, OpenAI is asked to continue it.
+func Continue(ctx context.Context, agent Agent, result *AgentResult) (*AgentResult, error) {
+	if !result.Incomplete {
+		return result, nil
+	}
+	history := append([]Message(nil), result.AllMessages...)
+	newMessages := append([]Message(nil), result.NewMessages...)
+	var partial *Message
+	if last := len(history) - 1; last >= 0 && history[last].Incomplete {
+		// trailing whitespace cannot be resumed from, the continuation brings its own
+		history[last].Text = strings.TrimRightFunc(history[last].Text, unicode.IsSpace)
+		partial = &history[last]
+	}
+
+	next, err := agent.RunContext(ctx, "", history)
+	if err != nil {
+		return next, err
+	}
+
+	continuation := next.NewMessages
+	if partial != nil && len(continuation) > 0 && continuation[0].isText() {
+		merged := *partial
+		merged.Text += continuation[0].Text
+		merged.Incomplete = continuation[0].Incomplete
+		continuation = append([]Message{merged}, continuation[1:]...)
+		history = history[:len(history)-1]
+		if n := len(newMessages); n > 0 && newMessages[n-1].Incomplete {
+			newMessages = newMessages[:n-1]
+		}
+	}
+	stitched := *next
+	stitched.AllMessages = append(history, continuation...)
+	stitched.NewMessages = append(newMessages, continuation...)
+	if len(continuation) > 0 && continuation[len(continuation)-1].isText() {
+		stitched.Text = continuation[len(continuation)-1].Text
+	}
+	stitched.RequestIDs = append(append([]string(nil), result.RequestIDs...), next.RequestIDs...)
+	stitched.RoundTrips = append(append([]RoundTripStats(nil), result.RoundTrips...), next.RoundTrips...)
+	return &stitched, nil
+}
+
+// isText reports whether msg is an answer of the model in plain text.
+func (msg Message) isText() bool {
+	return msg.Role == "assistant" && msg.Type == "" && msg.ToolIntent == nil && msg.ToolResult == nil
+}
+
+// markIncomplete flags the answer closing newMessages as cut short.
+func markIncomplete(newMessages []Message) {
+	if last := len(newMessages) - 1; last >= 0 && newMessages[last].isText() {
+		newMessages[last].Incomplete = true
+	}
+}
@@ -0,0 +1,120 @@
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ConversationBuilder builds a history message by message, checking as it goes what providers
+// require of it: tool calls are answered before the conversation moves on, tool results answer
+// a call made earlier and tool arguments are JSON.
+//
+//	history, err := provider.Conversation().
+//		System("You are a support agent.").
+//		User("Where is my order?").
+//		ToolCall("call_1", "FindOrder", `{"customer":"c-42"}`).
+//		ToolResult("call_1", `{"status":"shipped"}`).
+//		Assistant("It shipped yesterday.").
+//		Messages()
+//
+// The first mistake is reported by Messages, the calls after it are ignored.
+type ConversationBuilder struct {
+	messages []Message
+	pending  []string // ids of the tool calls awaiting a result
+	err      error
+}
+
+// Conversation starts an empty history.
+func Conversation() *ConversationBuilder {
+	return &ConversationBuilder{}
+}
+
+// System adds a developer message, which has to come first.
+func (b *ConversationBuilder) System(text string) *ConversationBuilder {
+	if b.check(len(b.messages) == 0, "the system message has to come first") {
+		b.messages = append(b.messages, Message{Role: "developer", Text: text})
+	}
+	return b
+}
+
+// User adds a user message with optional images.
+func (b *ConversationBuilder) User(text string, images ...Image) *ConversationBuilder {
+	if b.answered() && b.check(text != "" || len(images) > 0, "empty user message") {
+		b.messages = append(b.messages, Message{Role: "user", Text: text, Images: images})
+	}
+	return b
+}
+
+// Assistant adds an answer of the model.
+func (b *ConversationBuilder) Assistant(text string) *ConversationBuilder {
+	if b.answered() && b.check(text != "", "empty assistant message") {
+		b.messages = append(b.messages, Message{Role: "assistant", Text: text})
+	}
+	return b
+}
+
+// ToolCall adds a call of the model to tool name with JSON arguments, empty for none.
+// Every call needs a ToolResult before the next user or assistant message.
+func (b *ConversationBuilder) ToolCall(id string, name string, arguments string) *ConversationBuilder {
+	if arguments == "" {
+		arguments = "{}"
+	}
+	if !b.check(id != "" && name != "", "tool calls need an id and a name") ||
+		!b.check(json.Valid([]byte(arguments)), "arguments of tool call %s are not valid json", id) ||
+		!b.check(!b.called(id), "tool call id %s is used twice", id) {
+		return b
+	}
+	b.messages = append(b.messages, Message{Type: "tool_intent", ToolIntent: &ToolIntent{Id: id, Name: name, Arguments: arguments}})
+	b.pending = append(b.pending, id)
+	return b
+}
+
+// ToolResult adds the output of the pending tool call id.
+func (b *ConversationBuilder) ToolResult(id string, output string) *ConversationBuilder {
+	for i, pending := range b.pending {
+		if pending == id {
+			b.pending = append(b.pending[:i], b.pending[i+1:]...)
+			b.messages = append(b.messages, Message{ToolResult: &ToolResult{Id: id, Output: output}})
+			return b
+		}
+	}
+	b.check(false, "tool result %s does not answer a pending tool call", id)
+	return b
+}
+
+// Messages returns the history, or the first mistake made building it.
+func (b *ConversationBuilder) Messages() ([]Message, error) {
+	b.answered()
+	if b.err != nil {
+		return nil, b.err
+	}
+	return append([]Message(nil), b.messages...), nil
+}
+
+// check records the error described by format unless ok, and reports whether building goes on.
+func (b *ConversationBuilder) check(ok bool, format string, args ...any) bool {
+	if b.err != nil {
+		return false
+	}
+	if !ok {
+		b.err = fmt.Errorf("conversation, message %d: "+format, append([]any{len(b.messages)}, args...)...)
+	}
+	return ok
+}
+
+// answered checks that no tool call is waiting for its result.
+func (b *ConversationBuilder) answered() bool {
+	if len(b.pending) == 0 {
+		return b.err == nil
+	}
+	return b.check(false, "tool call %s has no result", b.pending[0])
+}
+
+func (b *ConversationBuilder) called(id string) bool {
+	for _, msg := range b.messages {
+		if msg.ToolIntent != nil && msg.ToolIntent.Id == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,194 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// Transcript is a completed run as written to a conversation log.
+type Transcript struct {
+	Agent      string    `json:"agent,omitempty"`
+	Tags       []string  `json:"tags,omitempty"`
+	Model      string    `json:"model"`
+	UserID     string    `json:"user_id,omitempty"` // the Identity subject of the run
+	Time       time.Time `json:"time"`
+	Messages   []Message `json:"messages"`
+	Text       string    `json:"text"`
+	RequestIDs []string  `json:"request_ids,omitempty"`
+}
+
+// ConversationLog stores transcripts, e.g. for QA review.
+type ConversationLog interface {
+	Write(transcript *Transcript) error
+}
+
+// ConversationLogFunc adapts a function to a ConversationLog.
+type ConversationLogFunc func(transcript *Transcript) error
+
+func (fn ConversationLogFunc) Write(transcript *Transcript) error {
+	return fn(transcript)
+}
+
+// Redactor removes secrets from transcripts before they are written.
+type Redactor struct {
+	Replacement string // "[REDACTED]" by default
+
+	mu       sync.Mutex
+	patterns []*regexp.Regexp
+}
+
+// DefaultSecretPatterns match the common shapes of API keys and bearer tokens.
+var DefaultSecretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`sk-(ant-)?[A-Za-z0-9_-]{20,}`),
+	regexp.MustCompile(`gsk_[A-Za-z0-9]{20,}`),
+	regexp.MustCompile(`AKIA[0-9A-Z]{16}`),
+	regexp.MustCompile(`(?i)bearer [A-Za-z0-9._~+/-]{16,}=*`),
+	regexp.MustCompile(`xox[abprs]-[A-Za-z0-9-]{10,}`),
+}
+
+// NewRedactor returns a Redactor matching DefaultSecretPatterns and patterns.
+func NewRedactor(patterns ...*regexp.Regexp) *Redactor {
+	return &Redactor{
+		Replacement: "[REDACTED]",
+		patterns:    append(append([]*regexp.Regexp(nil), DefaultSecretPatterns...), patterns...),
+	}
+}
+
+// AddSecret registers literal values to redact, like credentials a tool received.
+func (redactor *Redactor) AddSecret(secrets ...string) {
+	redactor.mu.Lock()
+	defer redactor.mu.Unlock()
+	for _, secret := range secrets {
+		if secret != "" {
+			redactor.patterns = append(redactor.patterns, regexp.MustCompile(regexp.QuoteMeta(secret)))
+		}
+	}
+}
+
+// with returns a copy of the redactor that also redacts secrets.
+func (redactor *Redactor) with(secrets ...string) *Redactor {
+	redactor.mu.Lock()
+	extended := &Redactor{Replacement: redactor.Replacement, patterns: append([]*regexp.Regexp(nil), redactor.patterns...)}
+	redactor.mu.Unlock()
+	extended.AddSecret(secrets...)
+	return extended
+}
+
+// Redact returns a copy of messages with every secret replaced.
+func (redactor *Redactor) Redact(messages []Message) []Message {
+	redactor.mu.Lock()
+	patterns := redactor.patterns
+	redactor.mu.Unlock()
+	for _, pattern := range patterns {
+		messages = RedactText(messages, pattern, redactor.Replacement)
+	}
+	return messages
+}
+
+// WithConversationLog writes the transcript of every completed run to log, redacted by redactor
+// (NewRedactor() when nil). The agent's API key is always redacted.
+func WithConversationLog(log ConversationLog, redactor *Redactor) AgentOption {
+	return func(a *AgentConfig) {
+		if redactor == nil {
+			redactor = NewRedactor()
+		}
+		a.ConversationLog = log
+		a.Redactor = redactor
+	}
+}
+
+// runSecretsKey holds the innermost logged run, conversationLogKey the run of each logging agent.
+type runSecretsKey struct{}
+
+type conversationLogKey struct{ agent *agentID }
+
+// runSecrets are the secrets registered by the tools of a run.
+type runSecrets struct {
+	mu      sync.Mutex
+	secrets []string
+	parent  *runSecrets // the logged run whose tool runs this one, if any
+}
+
+// RedactSecret marks a value seen during the run of ctx, like a token a tool fetched, for
+// redaction in the run's transcript and those of the runs it is part of. It does nothing when
+// the run is not logged.
+func RedactSecret(ctx context.Context, secrets ...string) {
+	run, _ := ctx.Value(runSecretsKey{}).(*runSecrets)
+	for ; run != nil; run = run.parent {
+		run.mu.Lock()
+		run.secrets = append(run.secrets, secrets...)
+		run.mu.Unlock()
+	}
+}
+
+// beginConversationLog prepares ctx for logging. It reports true for the call that starts
+// the run, which is the one that writes the transcript. Agents run by the tools write their own.
+func (config *AgentConfig) beginConversationLog(ctx context.Context) (context.Context, bool) {
+	if config.ConversationLog == nil || ctx.Value(conversationLogKey{config.id}) != nil {
+		return ctx, false
+	}
+	parent, _ := ctx.Value(runSecretsKey{}).(*runSecrets)
+	run := &runSecrets{parent: parent}
+	return context.WithValue(context.WithValue(ctx, runSecretsKey{}, run), conversationLogKey{config.id}, run), true
+}
+
+// logConversation writes the redacted transcript of result. A failed write is logged.
+func (config *AgentConfig) logConversation(ctx context.Context, result *AgentResult) {
+	secrets := []string{config.ApiKey}
+	if run, ok := ctx.Value(conversationLogKey{config.id}).(*runSecrets); ok {
+		run.mu.Lock()
+		secrets = append(secrets, run.secrets...)
+		run.mu.Unlock()
+	}
+	redactor := config.Redactor.with(secrets...)
+
+	messages := redactor.Redact(append(append([]Message(nil), result.AllMessages...), Message{Text: result.Text}))
+	transcript := &Transcript{
+		Agent:      config.Name,
+		Tags:       config.Tags,
+		Model:      config.ModelName,
+		Time:       config.now(),
+		Messages:   messages[:len(messages)-1],
+		Text:       messages[len(messages)-1].Text,
+		RequestIDs: result.RequestIDs,
+	}
+	if identity, ok := IdentityFromContext(ctx); ok {
+		transcript.UserID = identity.Subject
+	}
+	if err := config.ConversationLog.Write(transcript); err != nil {
+		config.logf("writing conversation log failed: %v\n", err)
+	}
+}
+
+// FileConversationLog appends transcripts to a file as JSON lines.
+type FileConversationLog struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func NewFileConversationLog(path string) (*FileConversationLog, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileConversationLog{file: file}, nil
+}
+
+func (log *FileConversationLog) Write(transcript *Transcript) error {
+	data, err := json.Marshal(transcript)
+	if err != nil {
+		return err
+	}
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	_, err = log.file.Write(append(data, '\n'))
+	return err
+}
+
+func (log *FileConversationLog) Close() error {
+	return log.file.Close()
+}
@@ -0,0 +1,50 @@
+package provider
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestConversationLogNestedAgent(t *testing.T) {
+	transcripts := make(map[string][]*Transcript)
+	log := ConversationLogFunc(func(transcript *Transcript) error {
+		transcripts[transcript.Agent] = append(transcripts[transcript.Agent], transcript)
+		return nil
+	})
+	childServer := newChatServer(t, toolReply("call_1", "Token", `{"query":"q"}`), textReply("done"))
+	child := childServer.agent(t, WithName("child"), WithConversationLog(log, nil))
+	token := NewTool("Token", "fetch a token", func(ctx context.Context, params lookupParams) string {
+		RedactSecret(ctx, "tok-123456")
+		return "tok-123456"
+	})
+	if err := child.AddTool(token); err != nil {
+		t.Fatal(err)
+	}
+	server := newChatServer(t, toolReply("call_1", "Ask", `{"query":"q"}`), textReply("parent done"))
+	parent := server.agent(t, WithName("parent"), WithConversationLog(log, nil))
+	ask := NewTool("Ask", "ask the child agent", func(ctx context.Context, params lookupParams) (string, error) {
+		result, err := child.RunContext(ctx, params.Query)
+		if err != nil {
+			return "", err
+		}
+		return "child used " + result.NewMessages[2].ToolResult.Output, nil
+	})
+	if err := parent.AddTool(ask); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parent.RunContext(context.Background(), "hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(transcripts["child"]) != 1 || len(transcripts["parent"]) != 1 {
+		t.Fatalf("transcripts: %d of the child, %d of the parent, want one each", len(transcripts["child"]), len(transcripts["parent"]))
+	}
+	for agent, logged := range transcripts {
+		for _, msg := range logged[0].Messages {
+			if msg.ToolResult != nil && strings.Contains(msg.ToolResult.Output, "tok-123456") {
+				t.Errorf("%s transcript holds the secret: %q", agent, msg.ToolResult.Output)
+			}
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package provider
+
+import "strings"
+
+// WithBaseURL sets the address of the server of custom agents, which speak the OpenAI chat completions
+// api like vLLM, LM Studio, llama.cpp and LiteLLM do, e.g. NewAgent("custom:my-model",
+// WithBaseURL("http://localhost:8000/v1")); requests go to the chat/completions path below it.
+// The api key is optional and read from CUSTOM_API_KEY. Custom agents behave like Groq agents.
+// For Ollama agents it is the same as WithOllamaHost.
+func WithBaseURL(url string) AgentOption {
+	return func(a *AgentConfig) {
+		a.BaseURL = url
+	}
+}
+
+// customEndpoint is the chat completions endpoint of the server of custom agents.
+func (config *AgentConfig) customEndpoint() string {
+	return strings.TrimSuffix(config.BaseURL, "/") + "/chat/completions"
+}
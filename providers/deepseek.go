@@ -0,0 +1,8 @@
+package provider
+
+// DeepSeekEndpoint is the chat completions api of DeepSeek, which DeepSeek agents call.
+//
+// DeepSeek agents, e.g. NewAgent("deepseek:deepseek-reasoner"), take their key from DEEPSEEK_API_KEY
+// and behave like Groq agents. The chain of thought of deepseek-reasoner comes back in
+// AgentResult.Reasoning, apart from the answer, and is not sent back with the history.
+const DeepSeekEndpoint = "https://api.deepseek.com/chat/completions"
@@ -0,0 +1,151 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// TurnDiff is a turn that differs between two histories, numbered as by Turns.
+type TurnDiff struct {
+	Turn    int       `json:"turn"`
+	Prompt  string    `json:"prompt,omitempty"`
+	Before  []Message `json:"before"` // the turn in the first history, or as recorded
+	After   []Message `json:"after"`  // the turn in the second history, or as replayed
+	Changes []string  `json:"changes"`
+}
+
+// DiffHistories compares two histories turn by turn, e.g. the same conversation before and after a
+// prompt change, and returns the turns whose prompt, tool calls or final answer differ.
+func DiffHistories(before []Message, after []Message) []TurnDiff {
+	beforeTurns, afterTurns := Turns(before), Turns(after)
+	var diffs []TurnDiff
+	for i := 0; i < len(beforeTurns) || i < len(afterTurns); i++ {
+		var beforeTurn, afterTurn []Message
+		if i < len(beforeTurns) {
+			beforeTurn = beforeTurns[i]
+		}
+		if i < len(afterTurns) {
+			afterTurn = afterTurns[i]
+		}
+		if changes := diffTurn(beforeTurn, afterTurn); len(changes) > 0 {
+			diffs = append(diffs, TurnDiff{Turn: i, Prompt: turnPrompt(beforeTurn, afterTurn), Before: beforeTurn, After: afterTurn, Changes: changes})
+		}
+	}
+	return diffs
+}
+
+func diffTurn(before []Message, after []Message) []string {
+	switch {
+	case len(before) == 0:
+		return []string{"turn only in the second history"}
+	case len(after) == 0:
+		return []string{"turn only in the first history"}
+	}
+	var changes []string
+	if isTurnStart(before[0]) && isTurnStart(after[0]) && before[0].Text != after[0].Text {
+		changes = append(changes, "prompt differs")
+	}
+	return append(changes, diffReplies(before, after)...)
+}
+
+// diffReplies compares the tool calls and final answers of two runs answering the same prompt.
+func diffReplies(before []Message, after []Message) []string {
+	var changes []string
+	beforeCalls, afterCalls := turnToolCalls(before), turnToolCalls(after)
+	if names, otherNames := toolNames(beforeCalls), toolNames(afterCalls); names != otherNames {
+		changes = append(changes, fmt.Sprintf("tool calls differ: [%s] vs [%s]", names, otherNames))
+	} else {
+		for i := range beforeCalls {
+			if !jsonEqual([]byte(beforeCalls[i].Arguments), []byte(afterCalls[i].Arguments)) {
+				changes = append(changes, fmt.Sprintf("arguments of tool call %d (%s) differ: %s vs %s", i+1, beforeCalls[i].Name, beforeCalls[i].Arguments, afterCalls[i].Arguments))
+			}
+		}
+	}
+	if strings.TrimSpace(finalAnswer(before)) != strings.TrimSpace(finalAnswer(after)) {
+		changes = append(changes, "answer differs")
+	}
+	return changes
+}
+
+func turnPrompt(turns ...[]Message) string {
+	for _, turn := range turns {
+		if len(turn) > 0 && isTurnStart(turn[0]) {
+			return turn[0].Text
+		}
+	}
+	return ""
+}
+
+func turnToolCalls(messages []Message) []ToolIntent {
+	var calls []ToolIntent
+	for _, msg := range messages {
+		if msg.ToolIntent != nil {
+			calls = append(calls, *msg.ToolIntent)
+		}
+	}
+	return calls
+}
+
+func toolNames(calls []ToolIntent) string {
+	names := make([]string, len(calls))
+	for i, call := range calls {
+		names[i] = call.Name
+	}
+	return strings.Join(names, " ")
+}
+
+func finalAnswer(messages []Message) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].isText() && messages[i].Text != "" {
+			return messages[i].Text
+		}
+	}
+	return ""
+}
+
+// ReplayReport is what ReplayHistory found.
+type ReplayReport struct {
+	Turns       int        `json:"turns"` // user turns replayed
+	Divergences []TurnDiff `json:"divergences,omitempty"`
+}
+
+// Diverged reports whether any turn was answered differently than recorded.
+func (report *ReplayReport) Diverged() bool {
+	return len(report.Divergences) > 0
+}
+
+// ReplayHistory answers every user turn of a recorded history again with agent, e.g. one built for a new
+// model, and reports the turns where the replies diverge: other tool calls, other arguments or
+// another final answer. Each turn is asked with the recorded conversation before it, so a divergence
+// doesn't carry over into the turns after it. The agent runs its tools, register the same ones.
+// A turn that fails is reported as a divergence; ReplayHistory only returns an error when ctx is done.
+func ReplayHistory(ctx context.Context, agent Agent, history []Message) (*ReplayReport, error) {
+	report := &ReplayReport{}
+	var recorded []Message
+	for i, turn := range Turns(history) {
+		if turn[0].Role != "user" {
+			recorded = append(recorded, turn...)
+			continue
+		}
+		report.Turns++
+		result, err := agent.RunContext(ctx, "", append(append([]Message(nil), recorded...), turn[0]))
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return report, ctxErr
+		}
+		diff := TurnDiff{Turn: i, Prompt: turn[0].Text, Before: turn[1:]}
+		if result != nil {
+			diff.After = result.NewMessages
+		}
+		if err != nil {
+			diff.Changes = []string{fmt.Sprintf("run failed: %v", err)}
+		} else {
+			diff.Changes = diffReplies(diff.Before, diff.After)
+		}
+		if len(diff.Changes) > 0 {
+			report.Divergences = append(report.Divergences, diff)
+		}
+		recorded = append(recorded, turn...)
+	}
+	return report, nil
+}
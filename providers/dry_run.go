@@ -0,0 +1,58 @@
+package provider
+
+import "encoding/json"
+
+// DryRunRequest is the provider request a dry run would have sent. Headers are left out
+// so api keys never end up in test output.
+type DryRunRequest struct {
+	Provider             string          `json:"provider"`
+	Endpoint             string          `json:"endpoint"`
+	Body                 json.RawMessage `json:"body"`
+	EstimatedInputTokens int             `json:"estimated_input_tokens"`
+}
+
+// WithDryRun makes Run build the provider request and return it instead of sending it.
+// The result's Text is the indented request body and DryRun holds the details.
+// Tools are not executed and no api key is needed.
+func WithDryRun() AgentOption {
+	return func(a *AgentConfig) {
+		a.DryRun = true
+		if a.ApiKey == "" {
+			a.ApiKey = "dry-run"
+		}
+	}
+}
+
+func (config *AgentConfig) dryRunResult(providerName string, endpoint string, payload any, prompt string, messageHistory [][]Message) (*AgentResult, error) {
+	if len(config.RequestMutators) > 0 {
+		mutated, err := config.mutateRequest(providerName, payload)
+		if err != nil {
+			return nil, err
+		}
+		payload = mutated
+	}
+	body, err := json.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	config.logf("Dry run, %s request not sent\n", providerName)
+	var msgHistory []Message
+	if len(messageHistory) > 0 {
+		msgHistory = messageHistory[0]
+	}
+	var newMessages []Message
+	if prompt != "" {
+		newMessages = append(newMessages, Message{Role: "user", Text: prompt})
+	}
+	return &AgentResult{
+		AllMessages: append(msgHistory, newMessages...),
+		NewMessages: newMessages,
+		Text:        string(body),
+		DryRun: &DryRunRequest{
+			Provider:             providerName,
+			Endpoint:             endpoint,
+			Body:                 body,
+			EstimatedInputTokens: EstimateTokens(string(body)),
+		},
+	}, nil
+}
@@ -0,0 +1,80 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+)
+
+const OpenaiEmbeddingsEndpoint = "https://api.openai.com/v1/embeddings"
+
+// Embedder turns text into an embedding vector.
+type Embedder interface {
+	Embed(text string) ([]float32, error)
+}
+
+type OpenaiEmbedder struct {
+	AgentConfig
+}
+
+type OpenaiEmbeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type OpenaiEmbeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+	Model string      `json:"model"`
+	Usage OpenaiUsage `json:"usage"`
+}
+
+// NewOpenaiEmbedder creates an embedder for an OpenAI embedding model such as "text-embedding-3-small".
+func NewOpenaiEmbedder(model string, opts ...AgentOption) (*OpenaiEmbedder, error) {
+	apiKey, keyFound := os.LookupEnv("OPENAI_API_KEY")
+	if !keyFound {
+		return nil, fmt.Errorf("api key not found")
+	}
+	config := AgentConfig{ModelName: model, ApiKey: apiKey}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	config.client = config.newHTTPClient()
+	return &OpenaiEmbedder{config}, nil
+}
+
+func (embedder *OpenaiEmbedder) Embed(text string) ([]float32, error) {
+	headers := map[string]string{
+		"Authorization": fmt.Sprintf("Bearer %s", embedder.ApiKey),
+		"Content-Type":  "application/json",
+	}
+	reqBody := OpenaiEmbeddingRequest{Model: embedder.ModelName, Input: []string{text}}
+	var response OpenaiEmbeddingResponse
+	if _, err := embedder.post(context.Background(), "openai", OpenaiEmbeddingsEndpoint, headers, reqBody, &response); err != nil {
+		return nil, err
+	}
+	if len(response.Data) == 0 {
+		return nil, fmt.Errorf("(embeddings.go, Embed) no embedding returned")
+	}
+	return response.Data[0].Embedding, nil
+}
+
+// CosineSimilarity returns the cosine of the angle between a and b, or 0 when they are not comparable.
+func CosineSimilarity(a []float32, b []float32) float32 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return float32(dot / (math.Sqrt(normA) * math.Sqrt(normB)))
+}
@@ -0,0 +1,109 @@
+package provider
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+)
+
+// KeyProvider hands out the AES keys of an EncryptedSessionStore, 16, 24 or 32 bytes long.
+// Keys have ids, so they can be rotated: states are encrypted with the current key and
+// decrypted with the key they were encrypted with.
+type KeyProvider interface {
+	CurrentKey() (id string, key []byte, err error)
+	Key(id string) ([]byte, error)
+}
+
+// StaticKey is a KeyProvider with a single key.
+func StaticKey(key []byte) KeyProvider {
+	return staticKey(key)
+}
+
+type staticKey []byte
+
+func (key staticKey) CurrentKey() (string, []byte, error) {
+	return "static", key, nil
+}
+
+func (key staticKey) Key(id string) ([]byte, error) {
+	if id != "static" {
+		return nil, fmt.Errorf("unknown key %s", id)
+	}
+	return key, nil
+}
+
+// EncryptedState is a SessionState encrypted with AES-GCM, as EncryptedSessionStore saves it.
+type EncryptedState struct {
+	KeyID      string `json:"key_id"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// EncryptedSessionStore encrypts sessions before they reach Store, which only ever sees
+// states holding an EncryptedState, so any store keeps conversations encrypted at rest.
+// States saved before encryption was turned on are still loaded.
+type EncryptedSessionStore struct {
+	Store SessionStore
+	Keys  KeyProvider
+}
+
+func NewEncryptedSessionStore(store SessionStore, keys KeyProvider) *EncryptedSessionStore {
+	return &EncryptedSessionStore{Store: store, Keys: keys}
+}
+
+func (store *EncryptedSessionStore) Load(id string) (*SessionState, error) {
+	stored, err := store.Store.Load(id)
+	if err != nil || stored == nil || stored.Encrypted == nil {
+		return stored, err
+	}
+	key, err := store.Keys.Key(stored.Encrypted.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	// Open panics on a nonce of the wrong size, which only a corrupted or forged state has
+	if len(stored.Encrypted.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("decrypt session %s: nonce of %d bytes, want %d", id, len(stored.Encrypted.Nonce), aead.NonceSize())
+	}
+	// the session id is authenticated, a state copied to another session does not decrypt
+	plaintext, err := aead.Open(nil, stored.Encrypted.Nonce, stored.Encrypted.Ciphertext, []byte(id))
+	if err != nil {
+		return nil, fmt.Errorf("decrypt session %s: %w", id, err)
+	}
+	var state SessionState
+	return &state, json.Unmarshal(plaintext, &state)
+}
+
+func (store *EncryptedSessionStore) Save(id string, state *SessionState) error {
+	keyID, key, err := store.Keys.CurrentKey()
+	if err != nil {
+		return err
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+	plaintext, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	encrypted := &EncryptedState{KeyID: keyID, Nonce: nonce, Ciphertext: aead.Seal(nil, nonce, plaintext, []byte(id))}
+	return store.Store.Save(id, &SessionState{Encrypted: encrypted})
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,65 @@
+package provider
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestEncryptedSessionStore(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	state := &SessionState{Messages: []Message{{Role: "user", Text: "my account number is 1234"}}, UserID: "alice"}
+	tests := []struct {
+		name   string
+		keys   KeyProvider
+		tamper func(encrypted *EncryptedState)
+		loadID string
+		err    string
+	}{
+		{name: "round trip", keys: StaticKey(key)},
+		{name: "wrong key", keys: StaticKey(bytes.Repeat([]byte{8}, 32)), err: "decrypt session"},
+		{name: "other session", keys: StaticKey(key), loadID: "other", err: "decrypt session"},
+		{name: "tampered ciphertext", keys: StaticKey(key), tamper: func(encrypted *EncryptedState) { encrypted.Ciphertext[0] ^= 1 }, err: "decrypt session"},
+		{name: "short nonce", keys: StaticKey(key), tamper: func(encrypted *EncryptedState) { encrypted.Nonce = encrypted.Nonce[:4] }, err: "nonce of 4 bytes"},
+		{name: "missing nonce", keys: StaticKey(key), tamper: func(encrypted *EncryptedState) { encrypted.Nonce = nil }, err: "nonce of 0 bytes"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			backend := NewMemorySessionStore()
+			if err := NewEncryptedSessionStore(backend, StaticKey(key)).Save("session", state); err != nil {
+				t.Fatal(err)
+			}
+			stored, err := backend.Load("session")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.Encrypted == nil || len(stored.Messages) > 0 || stored.UserID != "" || bytes.Contains(stored.Encrypted.Ciphertext, []byte("1234")) {
+				t.Fatalf("backend holds %+v, want only the encrypted state", stored)
+			}
+			if test.tamper != nil {
+				test.tamper(stored.Encrypted)
+			}
+			loadID := "session"
+			if test.loadID != "" {
+				loadID = test.loadID
+			}
+			if err := backend.Save(loadID, stored); err != nil {
+				t.Fatal(err)
+			}
+
+			loaded, err := NewEncryptedSessionStore(backend, test.keys).Load(loadID)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got %v, want an error mentioning %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if loaded.UserID != "alice" || len(loaded.Messages) != 1 || loaded.Messages[0].Text != state.Messages[0].Text {
+				t.Errorf("loaded %+v, want the saved state", loaded)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package provider
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"go.bgeen.com/gossip/pricing"
+)
+
+// NewAgentFromEnv configures an agent from environment variables sharing a prefix:
+//
+//	GOSSIP_MODEL             provider:model, required
+//	GOSSIP_API_KEY           defaults to <PROVIDER>_API_KEY
+//	GOSSIP_SYSTEM_PROMPT
+//	GOSSIP_TEMPERATURE
+//	GOSSIP_MAX_TOKENS
+//	GOSSIP_REASONING_EFFORT
+//	GOSSIP_CHEAPER_MODEL
+//	GOSSIP_PRICING_FILE      prices overriding pricing.Default, see pricing.Load
+//
+// for the prefix "GOSSIP". Explicit opts are applied after, and so override, the environment.
+func NewAgentFromEnv(prefix string, opts ...AgentOption) (Agent, error) {
+	prefix = strings.TrimSuffix(prefix, "_") + "_"
+	definition := AgentDefinition{
+		Model:           os.Getenv(prefix + "MODEL"),
+		SystemPrompt:    os.Getenv(prefix + "SYSTEM_PROMPT"),
+		ReasoningEffort: os.Getenv(prefix + "REASONING_EFFORT"),
+		CheaperModel:    os.Getenv(prefix + "CHEAPER_MODEL"),
+	}
+	if definition.Model == "" {
+		return nil, fmt.Errorf("%sMODEL not set", prefix)
+	}
+	if value, found := os.LookupEnv(prefix + "TEMPERATURE"); found {
+		temperature, err := strconv.ParseFloat(value, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %sTEMPERATURE: %w", prefix, err)
+		}
+		definition.Temperature = float32(temperature)
+	}
+	if value, found := os.LookupEnv(prefix + "MAX_TOKENS"); found {
+		maxTokens, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %sMAX_TOKENS: %w", prefix, err)
+		}
+		definition.MaxTokens = maxTokens
+	}
+
+	var envOpts []AgentOption
+	if apiKey := os.Getenv(prefix + "API_KEY"); apiKey != "" {
+		envOpts = append(envOpts, WithApiKey(apiKey))
+	}
+	if path := os.Getenv(prefix + "PRICING_FILE"); path != "" {
+		table, err := pricing.Load(path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %sPRICING_FILE: %w", prefix, err)
+		}
+		envOpts = append(envOpts, WithPricing(pricing.Default.Merge(table)))
+	}
+	return NewAgentFromDefinition(definition, nil, append(envOpts, opts...)...)
+}
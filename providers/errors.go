@@ -0,0 +1,244 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// APIError is returned when a provider answers with a non-2xx status code.
+type APIError struct {
+	Provider   string
+	StatusCode int
+	Type       string // error type, e.g. "invalid_request_error"
+	Code       string // machine readable code, e.g. "context_length_exceeded"
+	Param      string // offending request parameter, when reported
+	Message    string
+	RequestID  string // quote this to the provider's support
+	Body       []byte
+	// RetryAfter is how long the provider asked to wait before retrying, from Retry-After or its
+	// rate limit headers, 0 when it didn't say.
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	details := []string{fmt.Sprintf("status %d", e.StatusCode)}
+	for _, detail := range []string{e.Type, e.Code} {
+		if detail != "" {
+			details = append(details, detail)
+		}
+	}
+	if e.Param != "" {
+		details = append(details, "param "+e.Param)
+	}
+	if e.RequestID != "" {
+		details = append(details, "request "+e.RequestID)
+	}
+	return fmt.Sprintf("%s api error (%s): %s", e.Provider, strings.Join(details, ", "), e.Message)
+}
+
+// apiError builds the typed error for an error response, see classifyAPIError.
+func (config *AgentConfig) apiError(providerName string, resp *http.Response, body []byte) error {
+	now := config.now()
+	return classifyAPIError(newAPIError(providerName, resp, body, now), now)
+}
+
+// newAPIError builds an APIError from an error response received at now, parsing the provider's error body.
+func newAPIError(providerName string, resp *http.Response, body []byte, now time.Time) *APIError {
+	apiErr := &APIError{
+		Provider:   providerName,
+		StatusCode: resp.StatusCode,
+		RequestID:  requestID(resp.Header),
+		Body:       body,
+		RetryAfter: retryAfter(resp.Header, now),
+	}
+	switch providerName {
+	case "anthropic":
+		parseAnthropicError(apiErr, body)
+	case "ollama":
+		parseOllamaError(apiErr, body)
+	case "bedrock":
+		parseBedrockError(apiErr, resp, body)
+	default: // openai, groq and other openai compatible apis
+		parseOpenaiError(apiErr, body)
+	}
+	if apiErr.Message == "" {
+		apiErr.Message = strings.TrimSpace(string(body))
+	}
+	if apiErr.Message == "" {
+		apiErr.Message = http.StatusText(resp.StatusCode)
+	}
+	return apiErr
+}
+
+func requestID(header http.Header) string {
+	if id := header.Get("x-request-id"); id != "" {
+		return id
+	}
+	if id := header.Get("x-amzn-requestid"); id != "" {
+		return id // bedrock
+	}
+	return header.Get("request-id")
+}
+
+// rateLimitHeaders pairs the remaining and reset headers of the limits providers report: Anthropic's
+// reset times are timestamps, those of OpenAI and Groq durations such as "6m0s".
+var rateLimitHeaders = [][2]string{
+	{"anthropic-ratelimit-requests-remaining", "anthropic-ratelimit-requests-reset"},
+	{"anthropic-ratelimit-tokens-remaining", "anthropic-ratelimit-tokens-reset"},
+	{"anthropic-ratelimit-input-tokens-remaining", "anthropic-ratelimit-input-tokens-reset"},
+	{"anthropic-ratelimit-output-tokens-remaining", "anthropic-ratelimit-output-tokens-reset"},
+	{"x-ratelimit-remaining-requests", "x-ratelimit-reset-requests"},
+	{"x-ratelimit-remaining-tokens", "x-ratelimit-reset-tokens"},
+}
+
+// retryAfter reads how long to wait before retrying from the headers of an error response:
+// Retry-After (seconds or a date), OpenAI's retry-after-ms, or else the latest reset of an exhausted rate limit.
+func retryAfter(header http.Header, now time.Time) time.Duration {
+	if ms, err := strconv.ParseFloat(header.Get("retry-after-ms"), 64); err == nil && ms > 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+	if value := header.Get("Retry-After"); value != "" {
+		if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+			return time.Duration(seconds * float64(time.Second))
+		}
+		if date, err := http.ParseTime(value); err == nil && date.After(now) {
+			return date.Sub(now)
+		}
+	}
+	var wait time.Duration
+	for _, limit := range rateLimitHeaders {
+		if header.Get(limit[0]) != "0" {
+			continue
+		}
+		reset := header.Get(limit[1])
+		var until time.Duration
+		if at, err := time.Parse(time.RFC3339, reset); err == nil {
+			until = at.Sub(now)
+		} else if duration, err := time.ParseDuration(reset); err == nil {
+			until = duration
+		}
+		wait = max(wait, until)
+	}
+	return wait
+}
+
+// RateLimitError is returned when the provider throttles the request (HTTP 429).
+type RateLimitError struct {
+	*APIError
+	Reset time.Time // when the request may be retried, zero when the provider didn't say
+}
+
+// AuthError is returned when the api key is missing, invalid or lacks permission (HTTP 401/403).
+type AuthError struct{ *APIError }
+
+// ContextLengthError is returned when the request exceeds the model's context window.
+type ContextLengthError struct{ *APIError }
+
+// ContentFilterError is returned when the provider refuses the request on safety/content policy grounds.
+type ContentFilterError struct{ *APIError }
+
+func (e *RateLimitError) Unwrap() error     { return e.APIError }
+func (e *AuthError) Unwrap() error          { return e.APIError }
+func (e *ContextLengthError) Unwrap() error { return e.APIError }
+func (e *ContentFilterError) Unwrap() error { return e.APIError }
+
+// The sentinels of the typed errors above, for branching on the kind of failure with errors.Is
+// where errors.As would fetch details like the status code or RateLimitError.Reset:
+//
+//	if errors.Is(err, provider.ErrRateLimited) { ... }
+var (
+	ErrAuth          = errors.New("authentication failed")
+	ErrRateLimited   = errors.New("rate limited")
+	ErrContextLength = errors.New("context length exceeded")
+	ErrContentFilter = errors.New("blocked by content filter")
+)
+
+func (e *RateLimitError) Is(target error) bool     { return target == ErrRateLimited }
+func (e *AuthError) Is(target error) bool          { return target == ErrAuth }
+func (e *ContextLengthError) Is(target error) bool { return target == ErrContextLength }
+func (e *ContentFilterError) Is(target error) bool { return target == ErrContentFilter }
+
+var contextLengthMarkers = []string{"context length", "context_length", "context window", "prompt is too long", "too many tokens", "reduce the length", "input is too long"}
+
+var contentFilterMarkers = []string{"content_filter", "content_policy", "content policy", "content management policy", "safety system"}
+
+// classifyAPIError maps a provider error received at now onto the typed errors above, falling back
+// to the APIError itself.
+func classifyAPIError(apiErr *APIError, now time.Time) error {
+	code := strings.ToLower(apiErr.Code + " " + apiErr.Type)
+	message := strings.ToLower(apiErr.Message)
+	switch {
+	case apiErr.StatusCode == 401 || apiErr.StatusCode == 403:
+		return &AuthError{apiErr}
+	case apiErr.StatusCode == 429:
+		rateLimitErr := &RateLimitError{APIError: apiErr}
+		if apiErr.RetryAfter > 0 {
+			rateLimitErr.Reset = now.Add(apiErr.RetryAfter)
+		}
+		return rateLimitErr
+	case apiErr.Code == "context_length_exceeded" || containsAny(message, contextLengthMarkers):
+		return &ContextLengthError{apiErr}
+	case containsAny(code, contentFilterMarkers) || containsAny(message, contentFilterMarkers):
+		return &ContentFilterError{apiErr}
+	}
+	return apiErr
+}
+
+func containsAny(s string, markers []string) bool {
+	for _, marker := range markers {
+		if strings.Contains(s, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsContextLengthError reports whether err is a provider rejecting a request for exceeding the model's context window.
+func IsContextLengthError(err error) bool {
+	return errors.Is(err, ErrContextLength)
+}
+
+// IsRetryable reports whether a failed request may succeed when sent again unchanged:
+// rate limits, server errors and overloads (5xx, 529), request timeouts, stalled streams and network failures.
+// Client errors such as bad requests, auth failures and context length errors are not retryable, nor is
+// an exhausted quota (OpenAI's 429 insufficient_quota), which only a payment lifts. A request cut by
+// the deadline of its context reads like a timeout: callers check their context before retrying, as
+// the retry policy and failover do.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		switch {
+		case IsContextLengthError(err), apiErr.Code == "insufficient_quota", apiErr.Type == "insufficient_quota":
+			return false
+		case apiErr.StatusCode == http.StatusTooManyRequests,
+			apiErr.StatusCode == http.StatusRequestTimeout,
+			apiErr.StatusCode == http.StatusConflict, // openai: concurrent request conflicts
+			apiErr.StatusCode >= 500:
+			return true
+		}
+		return false
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, ErrStreamStalled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
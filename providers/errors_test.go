@@ -0,0 +1,39 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "rate limit", err: classifyAPIError(&APIError{StatusCode: http.StatusTooManyRequests, Code: "rate_limit_exceeded"}, time.Time{}), want: true},
+		{name: "exhausted quota", err: classifyAPIError(&APIError{StatusCode: http.StatusTooManyRequests, Type: "insufficient_quota", Code: "insufficient_quota"}, time.Time{})},
+		{name: "overloaded", err: &APIError{StatusCode: 529}, want: true},
+		{name: "server error", err: fmt.Errorf("round trip: %w", &APIError{StatusCode: http.StatusBadGateway}), want: true},
+		{name: "bad request", err: &APIError{StatusCode: http.StatusBadRequest}},
+		{name: "auth", err: classifyAPIError(&APIError{StatusCode: http.StatusUnauthorized}, time.Time{})},
+		{name: "context length", err: classifyAPIError(&APIError{StatusCode: http.StatusBadRequest, Code: "context_length_exceeded"}, time.Time{})},
+		{name: "stalled stream", err: ErrStreamStalled, want: true},
+		{name: "cut connection", err: io.ErrUnexpectedEOF, want: true},
+		{name: "canceled", err: context.Canceled},
+		{name: "other", err: errors.New("tool failed")},
+		{name: "none"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := IsRetryable(test.err); got != test.want {
+				t.Errorf("IsRetryable(%v) = %v, want %v", test.err, got, test.want)
+			}
+		})
+	}
+}
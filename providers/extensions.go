@@ -0,0 +1,75 @@
+package provider
+
+// The extensions of a round trip are what the provider reported beyond the answer and the token
+// counts, kept on AgentResult.Extensions under the provider's own field names. Empty fields are left out.
+
+func compactExtensions(extensions map[string]any) map[string]any {
+	for key, value := range extensions {
+		if value == nil || value == "" {
+			delete(extensions, key)
+		}
+	}
+	return extensions
+}
+
+func (response AnthropicResponse) extensions() map[string]any {
+	return compactExtensions(map[string]any{
+		"model":                       response.Model,
+		"stop_reason":                 response.StopReason,
+		"stop_sequence":               response.StopSequence,
+		"service_tier":                response.Usage.ServiceTier,
+		"cache_creation_input_tokens": response.Usage.CacheCreationInputTokens,
+		"cache_read_input_tokens":     response.Usage.CacheReadInputTokens,
+		"web_search_requests":         response.Usage.ServerToolUse.WebSearchRequests,
+	})
+}
+
+func (response OpenaiResponse) extensions() map[string]any {
+	extensions := map[string]any{
+		"model":         response.Model,
+		"status":        response.Status,
+		"service_tier":  response.ServiceTier,
+		"cached_tokens": response.Usage.InputTokensDetails.CachedTokens,
+	}
+	if response.IncompleteDetails != nil {
+		extensions["incomplete_reason"] = response.IncompleteDetails.Reason
+	}
+	return compactExtensions(extensions)
+}
+
+// extensions of chat completions, with what Groq, OpenRouter and OpenAI add to them; times in seconds.
+func (response GroqResponse) extensions(providerName string) map[string]any {
+	extensions := map[string]any{
+		"model":              response.Model,
+		"system_fingerprint": response.SystemFingerprint,
+		"service_tier":       response.ServiceTier,
+	}
+	if len(response.Choices) > 0 {
+		extensions["finish_reason"] = response.Choices[0].FinishReason
+	}
+	switch providerName {
+	case "groq":
+		extensions["queue_time"] = response.Usage.QueueTime
+		extensions["prompt_time"] = response.Usage.PromptTime
+		extensions["completion_time"] = response.Usage.CompletionTime
+		extensions["total_time"] = response.Usage.TotalTime
+	case "openrouter":
+		extensions["upstream_provider"] = response.Provider
+	case "openai":
+		extensions["accepted_prediction_tokens"] = response.Usage.CompletionTokensDetails.AcceptedPredictionTokens
+		extensions["rejected_prediction_tokens"] = response.Usage.CompletionTokensDetails.RejectedPredictionTokens
+	}
+	return compactExtensions(extensions)
+}
+
+// extensions of Ollama, durations in nanoseconds.
+func (response OllamaResponse) extensions() map[string]any {
+	return compactExtensions(map[string]any{
+		"model":                response.Model,
+		"done_reason":          response.DoneReason,
+		"total_duration":       response.TotalDuration,
+		"load_duration":        response.LoadDuration,
+		"prompt_eval_duration": response.PromptEvalDuration,
+		"eval_duration":        response.EvalDuration,
+	})
+}
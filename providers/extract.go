@@ -0,0 +1,130 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+)
+
+// Extraction is a value Extract found in a document.
+type Extraction[T any] struct {
+	Value T
+	Quote string // the passage of the document the value was taken from
+	Start int    // byte offsets of Quote in the document, -1 when the model did not quote it verbatim
+	End   int
+}
+
+// extractChunkBytes is the size of the pieces long documents are extracted from, about 3000 tokens,
+// and extractOverlap how much consecutive pieces share so values on a boundary are not cut in two.
+const (
+	extractChunkBytes = 12000
+	extractOverlap    = 500
+)
+
+const extractPrompt = `Extract every item described by the JSON schema below from the text. Use null for
+fields the text does not give; never guess. Quote for each item the shortest passage of the text it comes from,
+copied exactly.
+
+Respond with JSON only, in this shape:
+{"items": [{"value": <item matching the schema>, "quote": "<passage>"}]}
+
+Schema:
+%s
+
+<text>
+%s
+</text>`
+
+// Extract has agent pull every value of T, a struct described with json and description tags, out of
+// document. Long documents are extracted piece by piece; values found twice, e.g. in the overlap of two
+// pieces, are returned once, in document order. Each value comes with the passage it was taken from.
+func Extract[T any](ctx context.Context, agent Agent, document string) ([]Extraction[T], error) {
+	var zero T
+	if t := reflect.TypeOf(zero); t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("extract: %T is not a struct", zero)
+	}
+	properties, required := ConvertToProperties(zero)
+	schema, err := json.Marshal(Parameters{Type: "object", Required: required, Properties: properties})
+	if err != nil {
+		return nil, err
+	}
+
+	var extractions []Extraction[T]
+	seen := make(map[string]bool)
+	for _, chunk := range chunkText(document, extractChunkBytes, extractOverlap) {
+		result, err := agent.RunContext(ctx, fmt.Sprintf(extractPrompt, schema, chunk.text))
+		if err != nil {
+			return extractions, fmt.Errorf("extract, bytes %d-%d: %w", chunk.offset, chunk.offset+len(chunk.text), err)
+		}
+		var answer struct {
+			Items []struct {
+				Value json.RawMessage `json:"value"`
+				Quote string          `json:"quote"`
+			} `json:"items"`
+		}
+		if err := json.Unmarshal([]byte(stripCodeFence(result.Text)), &answer); err != nil {
+			return extractions, fmt.Errorf("extract: model returned invalid json: %w", err)
+		}
+		for _, item := range answer.Items {
+			var extraction Extraction[T]
+			if err := json.Unmarshal(item.Value, &extraction.Value); err != nil {
+				return extractions, fmt.Errorf("extract: %w", err)
+			}
+			extraction.Quote = item.Quote
+			extraction.Start, extraction.End = -1, -1
+			if at := strings.Index(chunk.text, item.Quote); item.Quote != "" && at >= 0 {
+				extraction.Start = chunk.offset + at
+				extraction.End = extraction.Start + len(item.Quote)
+			}
+			key := canonicalJSON(string(item.Value))
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			extractions = append(extractions, extraction)
+		}
+	}
+	return extractions, nil
+}
+
+// textChunk is a piece of a document starting offset bytes into it.
+type textChunk struct {
+	offset int
+	text   string
+}
+
+// chunkText cuts text into pieces of at most size bytes sharing overlap bytes, preferring to cut
+// between paragraphs, then lines, then sentences, then words.
+func chunkText(text string, size int, overlap int) []textChunk {
+	var chunks []textChunk
+	start := 0
+	for {
+		if len(text)-start <= size {
+			return append(chunks, textChunk{start, text[start:]})
+		}
+		end := start + size
+		for end > start && !utf8.RuneStart(text[end]) {
+			end--
+		}
+		window := text[start:end]
+		for _, separator := range []string{"\n\n", "\n", ". ", " "} {
+			// only cut in the second half, so pieces don't shrink to nothing
+			if at := strings.LastIndex(window, separator); at > len(window)/2 {
+				end = start + at + len(separator)
+				break
+			}
+		}
+		chunks = append(chunks, textChunk{start, text[start:end]})
+		next := end - overlap
+		if next <= start {
+			next = end
+		}
+		for next < end && !utf8.RuneStart(text[next]) {
+			next++
+		}
+		start = next
+	}
+}
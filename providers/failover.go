@@ -0,0 +1,179 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FailoverEndpoint is a secondary endpoint of the agent's model, e.g. another region, another
+// key or an Azure mirror of an OpenAI model, see WithFailover.
+type FailoverEndpoint struct {
+	Name       string            // shown in logs, the base url by default
+	BaseURL    string            // e.g. "https://example.openai.azure.com/openai/v1", empty keeps the provider's
+	ApiKey     string            // empty keeps the agent's key
+	AuthHeader string            // header carrying the key as is, e.g. Azure's "api-key", instead of the provider's
+	Model      string            // the model under another name, e.g. an Azure deployment
+	Headers    map[string]string // sent on top of the agent's headers
+}
+
+// FailoverCooldown is how long an endpoint that failed is passed over before it is tried first again.
+const FailoverCooldown = 30 * time.Second
+
+// WithFailover sends requests to endpoints, in order, when the agent's endpoint fails with a
+// retryable error (see IsRetryable), e.g. during a regional outage. Requests are translated as
+// for the agent's own endpoint, which all of them must serve: Anthropic's messages API or
+// OpenAI's responses and chat completions APIs. A failed endpoint is skipped for FailoverCooldown.
+// Streams fail over until their first event only.
+//
+//	provider.NewAgent("openai:gpt-4o", provider.WithFailover(provider.FailoverEndpoint{
+//		BaseURL:    "https://example.openai.azure.com/openai/v1",
+//		ApiKey:     os.Getenv("AZURE_OPENAI_API_KEY"),
+//		AuthHeader: "api-key",
+//	}))
+func WithFailover(endpoints ...FailoverEndpoint) AgentOption {
+	return func(a *AgentConfig) {
+		a.Failover = append(a.Failover, endpoints...)
+	}
+}
+
+// failoverBases are the base urls FailoverEndpoint.BaseURL replaces.
+var failoverBases = map[string]string{
+	"anthropic": "https://api.anthropic.com/v1",
+	"openai":    "https://api.openai.com/v1",
+}
+
+// failoverHealth remembers until when the endpoints of an agent are passed over,
+// index 0 being the agent's own endpoint.
+type failoverHealth struct {
+	mu        sync.Mutex
+	downUntil map[int]time.Time
+}
+
+// order returns the endpoint indexes to try, those not cooling down first.
+func (health *failoverHealth) order(count int, now time.Time) []int {
+	var up, down []int
+	health.mu.Lock()
+	defer health.mu.Unlock()
+	for i := 0; i < count; i++ {
+		if now.Before(health.downUntil[i]) {
+			down = append(down, i)
+		} else {
+			up = append(up, i)
+		}
+	}
+	return append(up, down...)
+}
+
+func (health *failoverHealth) mark(i int, failed bool, now time.Time) {
+	health.mu.Lock()
+	defer health.mu.Unlock()
+	if failed {
+		health.downUntil[i] = now.Add(FailoverCooldown)
+	} else {
+		delete(health.downUntil, i)
+	}
+}
+
+// failOver sends a request with send to the agent's endpoint and its failover endpoints until one
+// answers. send reports whether the answer had started, after which the request isn't sent again.
+func (config *AgentConfig) failOver(ctx context.Context, endpoint string, headers map[string]string, payload any, send func(endpoint string, headers map[string]string, payload any) (responseMeta, bool, error)) (responseMeta, bool, error) {
+	if len(config.Failover) == 0 {
+		return send(endpoint, headers, payload)
+	}
+	health := config.failoverHealth
+	if health == nil {
+		health = &failoverHealth{downUntil: make(map[int]time.Time)}
+	}
+	var meta responseMeta
+	var started bool
+	var err error
+	for attempt, i := range health.order(len(config.Failover)+1, config.now()) {
+		if attempt > 0 {
+			config.logf("%v, failing over to %s\n", err, config.failoverName(i, endpoint))
+		}
+		if i == 0 {
+			meta, started, err = send(endpoint, headers, payload)
+		} else {
+			target := config.Failover[i-1]
+			meta, started, err = send(config.failoverURL(target, endpoint), config.failoverHeaders(target, headers), modelPayload{payload, target.Model})
+		}
+		// the endpoint isn't to blame for the caller's deadline
+		failed := IsRetryable(err) && ctx.Err() == nil
+		health.mark(i, failed, config.now())
+		if !failed || started || ctx.Err() != nil {
+			return meta, started, err
+		}
+	}
+	return meta, started, err
+}
+
+func (config *AgentConfig) failoverName(i int, endpoint string) string {
+	if i == 0 {
+		return endpoint
+	}
+	target := config.Failover[i-1]
+	switch {
+	case target.Name != "":
+		return target.Name
+	case target.BaseURL != "":
+		return target.BaseURL
+	}
+	return "another key"
+}
+
+func (config *AgentConfig) failoverURL(target FailoverEndpoint, endpoint string) string {
+	if target.BaseURL == "" {
+		return endpoint
+	}
+	return strings.TrimSuffix(target.BaseURL, "/") + strings.TrimPrefix(endpoint, failoverBases[config.provider])
+}
+
+func (config *AgentConfig) failoverHeaders(target FailoverEndpoint, headers map[string]string) map[string]string {
+	failover := make(map[string]string, len(headers)+len(target.Headers)+1)
+	for key, value := range headers {
+		failover[key] = value
+	}
+	authHeader, bearer := "x-api-key", ""
+	if config.provider != "anthropic" {
+		authHeader, bearer = "Authorization", "Bearer "
+	}
+	key := strings.TrimPrefix(failover[authHeader], bearer)
+	if target.ApiKey != "" {
+		key = target.ApiKey
+	}
+	if target.AuthHeader != "" {
+		delete(failover, authHeader)
+		failover[target.AuthHeader] = key
+	} else {
+		failover[authHeader] = bearer + key
+	}
+	for key, value := range target.Headers {
+		failover[key] = value
+	}
+	return failover
+}
+
+// modelPayload is a request payload with its model renamed, when model is set.
+type modelPayload struct {
+	payload any
+	model   string
+}
+
+func (payload modelPayload) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(payload.payload)
+	if err != nil || payload.model == "" {
+		return data, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var body map[string]any
+	if err := decoder.Decode(&body); err != nil {
+		return nil, err
+	}
+	body["model"] = payload.model
+	return json.Marshal(body)
+}
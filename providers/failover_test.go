@@ -0,0 +1,73 @@
+package provider
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// downTransport answers every request to host with a 503, passing the others on.
+type downTransport struct {
+	host  string
+	calls atomic.Int32
+}
+
+func (transport *downTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != transport.host {
+		return http.DefaultTransport.RoundTrip(req)
+	}
+	transport.calls.Add(1)
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	return &http.Response{
+		StatusCode: http.StatusServiceUnavailable,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(`{"error":{"message":"upstream unavailable"}}`)),
+		Request:    req,
+	}, nil
+}
+
+func TestFailoverPastDownEndpoint(t *testing.T) {
+	server := newChatServer(t, textReply("Paris"), textReply("Paris again"), textReply("Still Paris"))
+	down := &downTransport{host: "api.openai.com"}
+	clock := NewManualClock(time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC))
+	agent, err := NewAgent("openai:gpt-4o", WithApiKey("sk-primary"), WithClock(clock),
+		WithStopSequences([]string{"END"}), // answered through chat completions, which the fake server speaks
+		WithHTTPClient(&http.Client{Transport: down}),
+		WithFailover(FailoverEndpoint{BaseURL: server.URL, ApiKey: "sk-secondary", Model: "gpt-4o-mirror"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := agent.Run("capital of France?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Text != "Paris" || down.calls.Load() != 1 {
+		t.Errorf("answered %q after %d calls to the down endpoint, want the failover's answer", result.Text, down.calls.Load())
+	}
+	if requests := server.received(); len(requests) != 1 || requests[0].Model != "gpt-4o-mirror" {
+		t.Errorf("failover got %+v, want the request for its model", requests)
+	}
+
+	// the down endpoint is passed over while it cools down
+	if _, err := agent.Run("capital of France?"); err != nil {
+		t.Fatal(err)
+	}
+	if down.calls.Load() != 1 {
+		t.Errorf("%d calls to the down endpoint during its cooldown, want none", down.calls.Load()-1)
+	}
+
+	// and tried first again after it
+	clock.Advance(FailoverCooldown + time.Second)
+	if _, err := agent.Run("capital of France?"); err != nil {
+		t.Fatal(err)
+	}
+	if down.calls.Load() != 2 || len(server.received()) != 3 {
+		t.Errorf("%d calls to the down endpoint and %d to the failover after the cooldown", down.calls.Load(), len(server.received()))
+	}
+}
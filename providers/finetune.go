@@ -0,0 +1,182 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"time"
+)
+
+const (
+	OpenaiFilesEndpoint      = "https://api.openai.com/v1/files"
+	OpenaiFineTuningEndpoint = "https://api.openai.com/v1/fine_tuning/jobs"
+)
+
+// WriteFineTuningJSONL writes conversations as OpenAI chat fine-tuning examples, one JSON line
+// each, with systemPrompt (when set) as their first message. Conversations without an assistant
+// answer are skipped; the number of examples written is returned.
+func WriteFineTuningJSONL(w io.Writer, systemPrompt string, conversations ...[]Message) (int, error) {
+	encoder := json.NewEncoder(w)
+	written := 0
+	for _, conversation := range conversations {
+		answered := false
+		for _, msg := range conversation {
+			answered = answered || (msg.Role == "assistant" && msg.Text != "")
+		}
+		if !answered {
+			continue
+		}
+		messages := Groq{}.FormatMessages(conversation) // the chat completions format
+		for i := range messages {
+			if messages[i].Role == "developer" {
+				messages[i].Role = "system"
+			}
+		}
+		if systemPrompt != "" {
+			messages = append([]GroqMessage{{Role: "system", Content: systemPrompt}}, messages...)
+		}
+		if err := encoder.Encode(struct {
+			Messages []GroqMessage `json:"messages"`
+		}{messages}); err != nil {
+			return written, err
+		}
+		written++
+	}
+	return written, nil
+}
+
+// OpenaiFineTuner uploads training files and runs fine-tuning jobs.
+type OpenaiFineTuner struct {
+	AgentConfig
+}
+
+// FineTuneRequest configures a fine-tuning job.
+type FineTuneRequest struct {
+	Model          string `json:"model"` // base model, e.g. "gpt-4o-mini-2024-07-18"
+	TrainingFile   string `json:"training_file"`
+	ValidationFile string `json:"validation_file,omitempty"`
+	Suffix         string `json:"suffix,omitempty"` // added to the fine-tuned model's name
+}
+
+// FineTuneJob is the state of a fine-tuning job.
+type FineTuneJob struct {
+	ID             string `json:"id"`
+	Model          string `json:"model"`
+	Status         string `json:"status"` // validating_files | queued | running | succeeded | failed | cancelled
+	FineTunedModel string `json:"fine_tuned_model"`
+	TrainedTokens  int    `json:"trained_tokens"`
+	CreatedAt      int64  `json:"created_at"`
+	FinishedAt     int64  `json:"finished_at"`
+	Error          *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Done reports whether the job stopped, successfully or not.
+func (job *FineTuneJob) Done() bool {
+	return job.Status == "succeeded" || job.Status == "failed" || job.Status == "cancelled"
+}
+
+func NewOpenaiFineTuner(opts ...AgentOption) (*OpenaiFineTuner, error) {
+	apiKey, keyFound := os.LookupEnv("OPENAI_API_KEY")
+	if !keyFound {
+		return nil, fmt.Errorf("api key not found")
+	}
+	config := AgentConfig{ApiKey: apiKey}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	config.client = config.newHTTPClient()
+	return &OpenaiFineTuner{config}, nil
+}
+
+// UploadTrainingFile uploads JSONL training data, e.g. written by WriteFineTuningJSONL, and returns the file id.
+func (tuner *OpenaiFineTuner) UploadTrainingFile(ctx context.Context, name string, data io.Reader) (string, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("purpose", "fine-tune")
+	part, err := form.CreateFormFile("file", name)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(part, data); err != nil {
+		return "", err
+	}
+	if err := form.Close(); err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", OpenaiFilesEndpoint, &body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+tuner.ApiKey)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	var file struct {
+		ID string `json:"id"`
+	}
+	if err := tuner.send(req, "openai", &file); err != nil {
+		return "", err
+	}
+	return file.ID, nil
+}
+
+// CreateJob starts a fine-tuning job.
+func (tuner *OpenaiFineTuner) CreateJob(ctx context.Context, request FineTuneRequest) (*FineTuneJob, error) {
+	headers := map[string]string{
+		"Authorization": "Bearer " + tuner.ApiKey,
+		"Content-Type":  "application/json",
+	}
+	var job FineTuneJob
+	if _, err := tuner.post(ctx, "openai", OpenaiFineTuningEndpoint, headers, request, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Job returns the current state of a fine-tuning job.
+func (tuner *OpenaiFineTuner) Job(ctx context.Context, id string) (*FineTuneJob, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", OpenaiFineTuningEndpoint+"/"+id, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+tuner.ApiKey)
+	var job FineTuneJob
+	if err := tuner.send(req, "openai", &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Wait polls a job every interval until it stops. A succeeded job's model is registered
+// with RegisterModel as "openai:<fine-tuned model>", ready for NewAgent.
+func (tuner *OpenaiFineTuner) Wait(ctx context.Context, id string, interval time.Duration) (*FineTuneJob, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		job, err := tuner.Job(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case job.Status == "succeeded":
+			RegisterModel("openai:" + job.FineTunedModel)
+			return job, nil
+		case job.Done():
+			if job.Error != nil && job.Error.Message != "" {
+				return job, fmt.Errorf("fine-tuning job %s %s: %s", id, job.Status, job.Error.Message)
+			}
+			return job, fmt.Errorf("fine-tuning job %s %s", id, job.Status)
+		}
+		select {
+		case <-ctx.Done():
+			return job, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
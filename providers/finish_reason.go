@@ -0,0 +1,88 @@
+package provider
+
+// FinishReason tells why the model stopped generating, the same way for every provider.
+// Extensions keep the reason as the provider gave it.
+type FinishReason string
+
+const (
+	FinishStop          FinishReason = "stop"           // the answer is complete, or hit a stop sequence
+	FinishLength        FinishReason = "length"         // cut short by the token limit, see Continue
+	FinishToolCalls     FinishReason = "tool_calls"     // the model called a tool
+	FinishContentFilter FinishReason = "content_filter" // withheld or cut short by the provider's safety system
+	FinishRefusal       FinishReason = "refusal"        // the model declined to answer, see AgentResult.Refusal
+	FinishInterrupted   FinishReason = "interrupted"    // see ContextWithInterrupt
+	FinishOther         FinishReason = "other"          // a reason gossip doesn't know yet
+)
+
+// finishReasons maps the reasons providers give to FinishReason.
+var finishReasons = map[string]FinishReason{
+	"stop":              FinishStop,
+	"end_turn":          FinishStop,
+	"stop_sequence":     FinishStop,
+	"completed":         FinishStop,
+	"length":            FinishLength,
+	"max_tokens":        FinishLength,
+	"max_output_tokens": FinishLength,
+	"pause_turn":        FinishLength, // anthropic paused a long server tool turn, continued like a cut answer
+	"tool_calls":        FinishToolCalls,
+	"tool_use":          FinishToolCalls,
+	"function_call":     FinishToolCalls,
+	"content_filter":    FinishContentFilter,
+	"refusal":           FinishRefusal,
+	stopInterrupted:     FinishInterrupted,
+}
+
+// normalizeFinishReason converts the finish reason of a provider, "" when it gave none.
+func normalizeFinishReason(reason string) FinishReason {
+	if reason == "" {
+		return ""
+	}
+	if normalized, ok := finishReasons[reason]; ok {
+		return normalized
+	}
+	return FinishOther
+}
+
+func (response OpenaiResponse) finishReason() FinishReason {
+	if response.Status == "incomplete" {
+		if response.IncompleteDetails == nil || response.IncompleteDetails.Reason == "" {
+			return FinishLength
+		}
+		return normalizeFinishReason(response.IncompleteDetails.Reason)
+	}
+	for _, output := range response.Output {
+		if output.Type == "function_call" {
+			return FinishToolCalls
+		}
+		for _, content := range output.Content {
+			if content.Type == "refusal" {
+				return FinishRefusal
+			}
+		}
+	}
+	return normalizeFinishReason(response.Status)
+}
+
+func (response GroqResponse) finishReason() FinishReason {
+	if len(response.Choices) == 0 {
+		return ""
+	}
+	choice := response.Choices[len(response.Choices)-1]
+	if choice.Message.Refusal != "" {
+		return FinishRefusal // openai, whose finish reason stays stop
+	}
+	return normalizeFinishReason(choice.FinishReason)
+}
+
+// Refused reports whether the run ended without an answer because the model refused to give one
+// or the provider's safety system withheld it. Text holds what the model said instead, if anything.
+func (result *AgentResult) Refused() bool {
+	return result.FinishReason == FinishRefusal || result.FinishReason == FinishContentFilter
+}
+
+func (response OllamaResponse) finishReason() FinishReason {
+	if len(response.Message.ToolCalls) > 0 && response.DoneReason == "stop" {
+		return FinishToolCalls // ollama gives no reason of its own
+	}
+	return normalizeFinishReason(response.DoneReason)
+}
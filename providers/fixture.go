@@ -0,0 +1,238 @@
+package provider
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Fixture is a recorded agent run: the provider exchanges it made and what it did with them.
+type Fixture struct {
+	Prompt    string            `json:"prompt"`
+	History   []Message         `json:"history,omitempty"`
+	Exchanges []FixtureExchange `json:"exchanges"`
+	ToolCalls []ToolIntent      `json:"tool_calls"`
+	FinalText string            `json:"final_text"`
+}
+
+// FixtureExchange is one provider round trip.
+type FixtureExchange struct {
+	Endpoint   string          `json:"endpoint"`
+	Request    json.RawMessage `json:"request"`
+	StatusCode int             `json:"status_code"`
+	Response   json.RawMessage `json:"response"`
+}
+
+func LoadFixture(path string) (*Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var fixture Fixture
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &fixture, nil
+}
+
+// Recorder captures the provider exchanges of an agent configured WithRecorder.
+type Recorder struct {
+	mu        sync.Mutex
+	exchanges []FixtureExchange
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// WithRecorder records every provider exchange of the agent into recorder.
+func WithRecorder(recorder *Recorder) AgentOption {
+	return func(a *AgentConfig) {
+		a.wrapTransport = func(next http.RoundTripper) http.RoundTripper {
+			return &recordingTransport{recorder: recorder, next: next}
+		}
+	}
+}
+
+// Fixture assembles the recorded exchanges and the run's outcome into a fixture.
+func (recorder *Recorder) Fixture(prompt string, history []Message, result *AgentResult) *Fixture {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	return &Fixture{
+		Prompt:    prompt,
+		History:   history,
+		Exchanges: append([]FixtureExchange(nil), recorder.exchanges...),
+		ToolCalls: toolCalls(result),
+		FinalText: result.Text,
+	}
+}
+
+// Save writes the fixture of a finished run to path.
+func (recorder *Recorder) Save(path string, prompt string, history []Message, result *AgentResult) error {
+	data, err := json.MarshalIndent(recorder.Fixture(prompt, history, result), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+type recordingTransport struct {
+	recorder *Recorder
+	next     http.RoundTripper
+}
+
+func (transport *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	requestBody, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := transport.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	responseBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(responseBody))
+
+	exchange := FixtureExchange{Endpoint: req.URL.String(), StatusCode: resp.StatusCode, Request: requestBody}
+	if json.Valid(responseBody) {
+		exchange.Response = responseBody
+	} else {
+		exchange.Response, _ = json.Marshal(string(responseBody))
+	}
+	transport.recorder.mu.Lock()
+	transport.recorder.exchanges = append(transport.recorder.exchanges, exchange)
+	transport.recorder.mu.Unlock()
+	return resp, nil
+}
+
+// readRequestBody returns the JSON request body and leaves an equivalent body on req.
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	if req.Header.Get("Content-Encoding") != "gzip" {
+		return body, nil
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(reader)
+}
+
+// Replayer serves a fixture's recorded responses to an agent configured WithReplay,
+// so the agent loop (including its tools) runs again without reaching the provider.
+type Replayer struct {
+	fixture *Fixture
+
+	mu    sync.Mutex
+	next  int
+	drift []string
+}
+
+func NewReplayer(fixture *Fixture) *Replayer {
+	return &Replayer{fixture: fixture}
+}
+
+// WithReplay answers the agent's provider requests from replayer. No api key is needed.
+func WithReplay(replayer *Replayer) AgentOption {
+	return func(a *AgentConfig) {
+		if a.ApiKey == "" {
+			a.ApiKey = "replay"
+		}
+		a.wrapTransport = func(http.RoundTripper) http.RoundTripper {
+			return replayer
+		}
+	}
+}
+
+func (replayer *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	requestBody, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	replayer.mu.Lock()
+	defer replayer.mu.Unlock()
+	if replayer.next >= len(replayer.fixture.Exchanges) {
+		replayer.drift = append(replayer.drift, fmt.Sprintf("request %d was not recorded", replayer.next+1))
+		return nil, fmt.Errorf("fixture exhausted after %d requests", len(replayer.fixture.Exchanges))
+	}
+	exchange := replayer.fixture.Exchanges[replayer.next]
+	replayer.next++
+	if !jsonEqual(requestBody, exchange.Request) {
+		replayer.drift = append(replayer.drift, fmt.Sprintf("request %d differs from the recording", replayer.next))
+	}
+	return &http.Response{
+		StatusCode: exchange.StatusCode,
+		Status:     fmt.Sprintf("%d %s", exchange.StatusCode, http.StatusText(exchange.StatusCode)),
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader(exchange.Response)),
+		Request:    req,
+	}, nil
+}
+
+// Verify reports how the replayed run drifted from the recording: differing requests,
+// unused or missing exchanges, a different tool call sequence or a different final output.
+func (replayer *Replayer) Verify(result *AgentResult) error {
+	replayer.mu.Lock()
+	defer replayer.mu.Unlock()
+	drift := append([]string(nil), replayer.drift...)
+	if replayer.next < len(replayer.fixture.Exchanges) {
+		drift = append(drift, fmt.Sprintf("only %d of %d recorded requests were made", replayer.next, len(replayer.fixture.Exchanges)))
+	}
+
+	recorded := replayer.fixture.ToolCalls
+	replayed := toolCalls(result)
+	if len(recorded) != len(replayed) {
+		drift = append(drift, fmt.Sprintf("%d tool calls, recorded %d", len(replayed), len(recorded)))
+	}
+	for i := 0; i < len(recorded) && i < len(replayed); i++ {
+		if recorded[i].Name != replayed[i].Name || !jsonEqual([]byte(recorded[i].Arguments), []byte(replayed[i].Arguments)) {
+			drift = append(drift, fmt.Sprintf("tool call %d is %s(%s), recorded %s(%s)", i+1, replayed[i].Name, replayed[i].Arguments, recorded[i].Name, recorded[i].Arguments))
+		}
+	}
+	if !jsonEqual([]byte(result.Text), []byte(replayer.fixture.FinalText)) {
+		drift = append(drift, fmt.Sprintf("final output %q, recorded %q", result.Text, replayer.fixture.FinalText))
+	}
+
+	if len(drift) > 0 {
+		return fmt.Errorf("replay drifted from fixture: %s", strings.Join(drift, "; "))
+	}
+	return nil
+}
+
+func toolCalls(result *AgentResult) []ToolIntent {
+	var calls []ToolIntent
+	for _, msg := range result.NewMessages {
+		if msg.ToolIntent != nil {
+			calls = append(calls, ToolIntent{Name: msg.ToolIntent.Name, Arguments: msg.ToolIntent.Arguments})
+		}
+	}
+	return calls
+}
+
+// jsonEqual compares two values as parsed JSON when both parse, and byte for byte otherwise.
+func jsonEqual(a []byte, b []byte) bool {
+	var parsedA, parsedB any
+	if json.Unmarshal(a, &parsedA) == nil && json.Unmarshal(b, &parsedB) == nil {
+		return reflect.DeepEqual(parsedA, parsedB)
+	}
+	return bytes.Equal(a, b)
+}
@@ -1,13 +1,11 @@
 package provider
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"log"
-	"net/http"
-	"reflect"
+	"strings"
 )
 
 const GroqEndpoint = "https://api.groq.com/openai/v1/chat/completions"
@@ -18,10 +16,35 @@ type Groq struct {
 }
 
 type GroqMessage struct { // or InputItem
-	Role       string         `json:"role,omitempty"` // developer | user | assistant | tool
-	Content    string         `json:"content,omitempty"`
-	ToolCalls  []GroqToolCall `json:"tool_calls,omitempty"`
-	ToolCallId string         `json:"tool_call_id,omitempty"`
+	Role       string            `json:"role,omitempty"` // developer | user | assistant | tool
+	Content    string            `json:"content,omitempty"`
+	Parts      []GroqContentPart `json:"-"` // sent as content instead of Content when set (vision)
+	ToolCalls  []GroqToolCall    `json:"tool_calls,omitempty"`
+	ToolCallId string            `json:"tool_call_id,omitempty"`
+
+	ReasoningContent string `json:"reasoning_content,omitempty"` // received from deepseek-reasoner, never sent back
+	Refusal          string `json:"refusal,omitempty"`           // received from openai, never sent back
+}
+
+type GroqContentPart struct {
+	Type     string        `json:"type"` // text | image_url
+	Text     string        `json:"text,omitempty"`
+	ImageUrl *GroqImageUrl `json:"image_url,omitempty"`
+}
+
+type GroqImageUrl struct {
+	Url string `json:"url"`
+}
+
+func (msg GroqMessage) MarshalJSON() ([]byte, error) {
+	type groqMessage GroqMessage
+	if len(msg.Parts) == 0 {
+		return json.Marshal(groqMessage(msg))
+	}
+	return json.Marshal(struct {
+		groqMessage
+		Content []GroqContentPart `json:"content"`
+	}{groqMessage(msg), msg.Parts})
 }
 
 type GroqRequest struct {
@@ -30,6 +53,19 @@ type GroqRequest struct {
 	ReasoningEffort string        `json:"reasoning_effort,omitempty"`
 	Temperature     float32       `json:"temperature,omitempty"`
 	Tools           []GroqTool    `json:"tools,omitempty"`
+	Stream          bool          `json:"stream,omitempty"`
+	StreamOptions   *struct {
+		IncludeUsage bool `json:"include_usage"`
+	} `json:"stream_options,omitempty"` // openai, which only reports the usage of streams when asked
+	Prediction     *ChatPrediction     `json:"prediction,omitempty"` // openai
+	LogitBias      map[int]int         `json:"logit_bias,omitempty"`
+	Models         []string            `json:"models,omitempty"`   // openrouter fallbacks
+	Routing        *OpenRouterRouting  `json:"provider,omitempty"` // openrouter
+	ResponseFormat *ChatResponseFormat `json:"response_format,omitempty"`
+	// max_completion_tokens, which max_tokens is deprecated for, is not known to every compatible api
+	MaxTokens           int      `json:"max_tokens,omitempty"`
+	MaxCompletionTokens int      `json:"max_completion_tokens,omitempty"` // groq, openai
+	Stop                []string `json:"stop,omitempty"`
 }
 
 type GroqTool struct {
@@ -41,26 +77,56 @@ type GroqFunction struct {
 	Name        string     `json:"name"`
 	Description string     `json:"description"`
 	Parameters  Parameters `json:"parameters"`
-	Strict      bool       `json:"strict"`
+	Strict      bool       `json:"strict,omitempty"`
 }
 
 type GroqResponse struct {
-	ID      string       `json:"id"`
-	Choices []GroqChoice `json:"choices"`
-	Usage   GroqUsage    `json:"usage"`
+	ID                string       `json:"id"`
+	Choices           []GroqChoice `json:"choices"`
+	Usage             GroqUsage    `json:"usage"`
+	ServiceTier       string       `json:"service_tier"` // on_demand | flex | auto
+	SystemFingerprint string       `json:"system_fingerprint"`
+	Model             string       `json:"model"`
+	Provider          string       `json:"provider"` // openrouter, the upstream provider that answered
 }
 
 type GroqChoice struct {
-	Index        int         `json:"index"`
-	Message      GroqMessage `json:"message"`
-	FinishReason string      `json:"finish_reason"`
+	Index        int             `json:"index"`
+	Message      GroqMessage     `json:"message"`
+	FinishReason string          `json:"finish_reason"`
+	Raw          json.RawMessage `json:"-"` // the choice as received
+}
+
+func (choice *GroqChoice) UnmarshalJSON(data []byte) error {
+	type groqChoice GroqChoice
+	if err := json.Unmarshal(data, (*groqChoice)(choice)); err != nil {
+		return err
+	}
+	choice.Raw = append(json.RawMessage(nil), data...)
+	return nil
 }
 
 type GroqUsage struct {
 	PromptTokens     int     `json:"prompt_tokens"`
 	CompletionTokens int     `json:"completion_tokens"`
 	TotalTokens      int     `json:"total_tokens"`
+	QueueTime        float64 `json:"queue_time"` // groq, in seconds
+	PromptTime       float64 `json:"prompt_time"`
+	CompletionTime   float64 `json:"completion_time"`
 	TotalTime        float64 `json:"total_time"`
+
+	PromptTokensDetails  PromptTokensDetails `json:"prompt_tokens_details"`
+	PromptCacheHitTokens int                 `json:"prompt_cache_hit_tokens"` // deepseek
+
+	CompletionTokensDetails struct {
+		ReasoningTokens          int `json:"reasoning_tokens"`
+		AcceptedPredictionTokens int `json:"accepted_prediction_tokens"` // openai
+		RejectedPredictionTokens int `json:"rejected_prediction_tokens"`
+	} `json:"completion_tokens_details"`
+}
+
+func (usage GroqUsage) cachedTokens() int {
+	return usage.PromptTokensDetails.CachedTokens + usage.PromptCacheHitTokens
 }
 
 type GroqToolCall struct {
@@ -75,9 +141,12 @@ type GroqFunctionResp struct {
 }
 
 func (provider Groq) FormatMessages(messages []Message) []GroqMessage {
-	var groqMessages []GroqMessage
+	groqMessages := make([]GroqMessage, 0, len(messages))
 
 	for _, msg := range messages {
+		if msg.local() {
+			continue
+		}
 		var groqMsg GroqMessage
 
 		if msg.ToolIntent != nil {
@@ -96,8 +165,22 @@ func (provider Groq) FormatMessages(messages []Message) []GroqMessage {
 			groqMsg.ToolCallId = msg.ToolResult.Id
 			groqMsg.Content = msg.ToolResult.Output
 
+		} else if len(msg.Images) > 0 {
+			groqMsg.Role = "user"
+			if msg.Text != "" {
+				groqMsg.Parts = append(groqMsg.Parts, GroqContentPart{Type: "text", Text: msg.Text})
+			}
+			for _, image := range msg.Images {
+				groqMsg.Parts = append(groqMsg.Parts, GroqContentPart{
+					Type:     "image_url",
+					ImageUrl: &GroqImageUrl{Url: image.DataURL()},
+				})
+			}
 		} else {
 			groqMsg.Role = msg.Role
+			if msg.Role == "developer" {
+				groqMsg.Role = provider.systemRole()
+			}
 			groqMsg.Content = msg.Text
 		}
 		groqMessages = append(groqMessages, groqMsg)
@@ -106,8 +189,45 @@ func (provider Groq) FormatMessages(messages []Message) []GroqMessage {
 }
 
 func (provider Groq) Run(prompt string, messageHistory ...[]Message) (*AgentResult, error) {
+	return provider.RunContext(context.Background(), prompt, messageHistory...)
+}
+
+// RunStream runs prompt like RunContext, streaming the response: the returned channel carries
+// the pieces of the answer as they are generated and closes with a StreamDone event holding the result.
+func (provider Groq) RunStream(ctx context.Context, prompt string, messageHistory ...[]Message) <-chan StreamEvent {
+	return runStream(ctx, &provider.AgentConfig, func(ctx context.Context) (*AgentResult, error) {
+		return provider.RunContext(ctx, prompt, messageHistory...)
+	})
+}
+
+// RunContext is Run with a context that bounds the provider requests and is passed to tool policies.
+func (provider Groq) RunContext(ctx context.Context, prompt string, messageHistory ...[]Message) (*AgentResult, error) {
 
-	log.Println("provider groq called")
+	providerName := provider.providerName()
+	provider.logf("Provider %s called\n", providerName)
+	ctx, endRun, err := provider.beginRun(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer endRun()
+	ctx, err = provider.beginBudget(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ctx, checkpointed := provider.beginCheckpoint(ctx)
+	ctx, logged := provider.beginConversationLog(ctx)
+	ctx, guarded := provider.beginGuardrails(ctx)
+	messageHistory = ownHistory(messageHistory)
+	cached, promptEmbedding := provider.semanticLookup(ctx, providerName, prompt, messageHistory)
+	if cached != nil {
+		if checkpointed {
+			provider.completeCheckpoint(ctx, cached)
+		}
+		if logged {
+			provider.logConversation(ctx, cached)
+		}
+		return cached, nil
+	}
 	apiKey := provider.ApiKey
 
 	var groqMessages []GroqMessage
@@ -124,28 +244,35 @@ func (provider Groq) Run(prompt string, messageHistory ...[]Message) (*AgentResu
 	}
 	if provider.SystemPrompt != "" {
 		systemPrompt := GroqMessage{
-			Role:    "developer",
+			Role:    provider.systemRole(),
 			Content: provider.SystemPrompt,
 		}
 		groqMessages = append(groqMessages, systemPrompt)
 	}
 
+	model, route := provider.routeModel(ctx, prompt, messageHistory)
 	reqBody := GroqRequest{
-		Model:    provider.ModelName,
+		Model:    model,
 		Messages: groqMessages,
 	}
-	if provider.ReasoningEffort != "" {
+	if provider.ReasoningEffort != "" && providerName != "deepseek" {
 		reqBody.ReasoningEffort = provider.ReasoningEffort
 	}
 	if provider.Temperature != 0 {
 		reqBody.Temperature = provider.Temperature
 	}
+	if providerName == "groq" || providerName == "openai" {
+		reqBody.MaxCompletionTokens = provider.MaxTokens
+	} else {
+		reqBody.MaxTokens = provider.MaxTokens
+	}
+	reqBody.Stop = provider.StopSequences
 
 	var tools []GroqTool
 	if len(provider.ToolStore.functions) > 0 {
-		for fn, _ := range provider.ToolStore.functions {
+		for _, fn := range provider.exposedTools(prompt, messageHistory) {
 			fnName := fn
-			properties, required := ConvertToProperties(reflect.New(provider.ToolStore.paramTypes[fnName]).Interface())
+			properties, required := schemaFor(provider.ToolStore.paramTypes[fnName])
 			tool := GroqTool{
 				Type: "function",
 				Function: GroqFunction{
@@ -157,50 +284,62 @@ func (provider Groq) Run(prompt string, messageHistory ...[]Message) (*AgentResu
 						Properties:           properties,
 						AdditionalProperties: false,
 					},
-					Strict: true,
+					Strict: providerName == "groq" && strictSchema(properties, required), // deepseek only takes strict schemas on its beta endpoint
 				},
 			}
 			tools = append(tools, tool)
 		}
 		reqBody.Tools = tools
 	}
-
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return nil, err
+	reqBody.LogitBias = provider.LogitBias
+	if providerName == "openrouter" && provider.OpenRouter != nil {
+		reqBody.Models = provider.OpenRouter.Models
+		reqBody.Routing = provider.OpenRouter
 	}
-	fmt.Print("request\n", string(jsonData), "\n")
-
-	// Create HTTP request
-	req, err := http.NewRequest("POST", GroqEndpoint, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return nil, err
+	if format := provider.responseFormat(ctx); format != nil {
+		reqBody.ResponseFormat = format.chatFormat(providerName)
 	}
-
-	// headers
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", apiKey))
-	req.Header.Set("Content-Type", "application/json")
-
-	// Send request
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
+	reqBody.Stream = provider.Stream != nil
+	if providerName == "openai" {
+		if provider.Prediction != "" {
+			reqBody.Prediction = &ChatPrediction{Type: "content", Content: provider.Prediction}
+		}
+		if reqBody.Stream {
+			reqBody.StreamOptions = &struct {
+				IncludeUsage bool `json:"include_usage"`
+			}{true}
+		}
 	}
-	defer resp.Body.Close()
 
-	// Read response
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
+	if err := provider.checkCapabilities(reqBody.Model, messageHistory); err != nil {
 		return nil, err
 	}
+	if provider.DryRun {
+		return provider.dryRunResult(providerName, provider.endpoint(), reqBody, prompt, messageHistory)
+	}
 
-	fmt.Print("response\n", string(body), "\n")
-
-	// Parse JSON response
+	headers := map[string]string{
+		"Authorization": fmt.Sprintf("Bearer %s", apiKey),
+		"Content-Type":  "application/json",
+	}
+	if apiKey == "" {
+		delete(headers, "Authorization") // custom servers without authentication
+	}
 	var response GroqResponse
-	err = json.Unmarshal(body, &response)
+	var meta responseMeta
+	if reqBody.Stream {
+		meta, err = provider.stream(ctx, headers, reqBody, &response)
+	} else {
+		meta, err = provider.post(ctx, providerName, provider.endpoint(), headers, reqBody, &response)
+	}
 	if err != nil {
+		provider.observeFailedRoundTrip(providerName, reqBody.Model, route, meta, err)
+		if ctx, trimmed, retry := provider.recoverContext(ctx, err, messageHistory); retry {
+			return provider.RunContext(ctx, prompt, trimmed)
+		}
+		if provider.offlineFallback(err) {
+			return provider.answerOffline(ctx, prompt, messageHistory)
+		}
 		return nil, err
 	}
 
@@ -208,6 +347,11 @@ func (provider Groq) Run(prompt string, messageHistory ...[]Message) (*AgentResu
 	var newMessages []Message
 	var finalText string
 	var toolIntent ToolIntent
+	var requestIDs []string
+	if meta.RequestID != "" {
+		requestIDs = append(requestIDs, meta.RequestID)
+	}
+	roundTrips := []RoundTripStats{provider.observeRoundTrip(providerName, reqBody.Model, route, meta, response.Usage.PromptTokens, response.Usage.CompletionTokens, response.Usage.CompletionTokensDetails.ReasoningTokens, response.Usage.cachedTokens())}
 
 	if len(messageHistory) > 0 {
 		msgHistory = messageHistory[0]
@@ -215,20 +359,34 @@ func (provider Groq) Run(prompt string, messageHistory ...[]Message) (*AgentResu
 	if prompt != "" {
 		newMessages = append(newMessages, Message{Role: "user", Text: prompt})
 	}
+	extensions := response.extensions(providerName)
+	finishReason := response.finishReason()
+	var refusal string
+	var incomplete bool
+	var reasoning []string
 	for _, choice := range response.Choices {
 		msg := choice.Message
-
-		if msg.Content != "" {
+		if msg.ReasoningContent != "" {
+			reasoning = append(reasoning, msg.ReasoningContent)
+		}
+		incomplete = choice.FinishReason == "length" || choice.FinishReason == stopInterrupted
+
+		if msg.Refusal != "" && msg.Content == "" {
+			// kept as an answer, so the conversation can go on
+			newMessages = append(newMessages, Message{Role: "assistant", Text: msg.Refusal})
+			finalText = msg.Refusal
+			refusal = msg.Refusal
+		} else if msg.Content != "" {
 			responseMessage := Message{
 				Role: "assistant",
 				Text: msg.Content,
 			}
 			newMessages = append(newMessages, responseMessage)
 			finalText = msg.Content
-		} else if len(msg.ToolCalls) > 0 {
+		} else if len(msg.ToolCalls) > 0 && !incomplete {
 			toolCall := msg.ToolCalls[0]
 			toolIntent = ToolIntent{
-				Id:        toolCall.Id,
+				Id:        provider.toolCallID(toolCall.Id),
 				Name:      toolCall.Function.Name,
 				Arguments: toolCall.Function.Arguments,
 			}
@@ -236,41 +394,228 @@ func (provider Groq) Run(prompt string, messageHistory ...[]Message) (*AgentResu
 				Type:       "tool_intent",
 				ToolIntent: &toolIntent,
 			})
-		} else {
-			return nil, fmt.Errorf("(groq.go, Run) unexpected response")
+		} else if !incomplete {
+			unknown, err := provider.unknownItem(providerName, "empty message", choice.Raw)
+			if err != nil {
+				return partialResult(msgHistory, newMessages, toolIntent, requestIDs, roundTrips, nil), err
+			}
+			newMessages = append(newMessages, unknown)
 		}
 	}
+	if incomplete {
+		markIncomplete(newMessages)
+	}
 
+	overBudget := provider.spend(ctx, roundTrips[0])
+	provider.checkpoint(ctx, msgHistory, newMessages, toolIntent, &roundTrips[0])
 	if toolIntent.Id != "" {
-		tempAgentResult := &AgentResult{
-			AllMessages:   append(msgHistory, newMessages...),
-			NewMessages:   newMessages,
-			Text:          finalText,
-			ToolArguments: toolIntent.Arguments,
-			ToolIntent:    &toolIntent,
+		if overBudget != nil {
+			return partialResult(msgHistory, newMessages, toolIntent, requestIDs, roundTrips, nil), overBudget
 		}
-		toolResult, err := provider.ExecuteToolIntent(toolIntent)
+		toolResult, err := provider.executeTool(ctx, append(msgHistory, newMessages...), toolIntent)
 		if err != nil {
-			return tempAgentResult, err
+			return partialResult(msgHistory, newMessages, toolIntent, requestIDs, roundTrips, nil), err
 		}
 		newMessages = append(newMessages, Message{ToolResult: toolResult})
-		internalAgentResult, err := provider.Run("", append(msgHistory, newMessages...))
+		provider.checkpoint(ctx, msgHistory, newMessages, ToolIntent{}, nil)
+		internalAgentResult, err := provider.RunContext(ctx, "", append(msgHistory, newMessages...))
 		if err != nil {
-			return tempAgentResult, err
+			return partialResult(msgHistory, newMessages, toolIntent, requestIDs, roundTrips, internalAgentResult), err
 		}
 		newMessages = append(newMessages, internalAgentResult.NewMessages...)
+		requestIDs = append(requestIDs, internalAgentResult.RequestIDs...)
+		roundTrips = append(roundTrips, internalAgentResult.RoundTrips...)
+		incomplete = internalAgentResult.Incomplete
+		if internalAgentResult.Reasoning != "" {
+			reasoning = append(reasoning, internalAgentResult.Reasoning)
+		}
+		extensions = internalAgentResult.Extensions
+		finishReason = internalAgentResult.FinishReason
+		refusal = internalAgentResult.Refusal
 	}
 
-	return &AgentResult{
+	result := &AgentResult{
 		AllMessages:   append(msgHistory, newMessages...),
 		NewMessages:   newMessages,
 		Text:          finalText,
 		ToolIntent:    &toolIntent,
 		ToolArguments: toolIntent.Arguments,
-	}, nil
+		RequestIDs:    requestIDs,
+		RoundTrips:    roundTrips,
+		Incomplete:    incomplete,
+		Reasoning:     strings.Join(reasoning, "\n\n"),
+		Extensions:    extensions,
+		FinishReason:  finishReason,
+		Refusal:       refusal,
+	}
+	if guarded {
+		var err error
+		result, err = provider.enforceOutput(ctx, result, func(ctx context.Context, history []Message) (*AgentResult, error) {
+			return provider.RunContext(ctx, "", history)
+		})
+		if err != nil {
+			return result, err
+		}
+	}
+	if checkpointed {
+		provider.completeCheckpoint(ctx, result)
+	}
+	if logged {
+		provider.logConversation(ctx, result)
+	}
+	provider.semanticStore(ctx, providerName, promptEmbedding, result)
+	return result, nil
+}
+
+// groqStreamChunk is a chunk of a streamed chat completion.
+type groqStreamChunk struct {
+	ID                string `json:"id"`
+	ServiceTier       string `json:"service_tier"`
+	SystemFingerprint string `json:"system_fingerprint"`
+	Model             string `json:"model"`
+	Provider          string `json:"provider"`
+	Choices           []struct {
+		Delta struct {
+			Role             string `json:"role"`
+			Content          string `json:"content"`
+			ReasoningContent string `json:"reasoning_content"` // deepseek
+			Refusal          string `json:"refusal"`           // openai
+			ToolCalls        []struct {
+				Index int `json:"index"`
+				GroqToolCall
+			} `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *GroqUsage `json:"usage"`
+	XGroq struct {
+		Usage *GroqUsage `json:"usage"` // sent with the last chunk
+	} `json:"x_groq"`
+	Error *struct{} `json:"error"`
+}
+
+// stream sends reqBody as a streamed request and assembles the chunks into response.
+// A stalled stream is sent again from scratch.
+func (provider Groq) stream(ctx context.Context, headers map[string]string, reqBody GroqRequest, response *GroqResponse) (responseMeta, error) {
+	emitter := provider.newStreamEmitter()
+	defer emitter.close(ctx)
+	for attempt := 0; ; attempt++ {
+		*response = GroqResponse{Choices: []GroqChoice{{Message: GroqMessage{Role: "assistant"}}}}
+		choice := &response.Choices[0]
+		done := false
+		meta, err := provider.postStream(ctx, provider.providerName(), provider.endpoint(), headers, reqBody, func(sse serverEvent) error {
+			if string(sse.Data) == "[DONE]" {
+				done = true
+				return nil
+			}
+			var chunk groqStreamChunk
+			if err := json.Unmarshal(sse.Data, &chunk); err != nil {
+				return err
+			}
+			if chunk.Error != nil {
+				return streamError(provider.providerName(), sse.Data)
+			}
+			response.ID = chunk.ID
+			if chunk.ServiceTier != "" {
+				response.ServiceTier = chunk.ServiceTier
+			}
+			if chunk.SystemFingerprint != "" {
+				response.SystemFingerprint = chunk.SystemFingerprint
+			}
+			if chunk.Model != "" {
+				response.Model, response.Provider = chunk.Model, chunk.Provider
+			}
+			if chunk.Usage != nil {
+				response.Usage = *chunk.Usage
+			} else if chunk.XGroq.Usage != nil {
+				response.Usage = *chunk.XGroq.Usage
+			}
+			for _, delta := range chunk.Choices {
+				if delta.FinishReason != "" {
+					choice.FinishReason = delta.FinishReason
+				}
+				choice.Message.ReasoningContent += delta.Delta.ReasoningContent
+				choice.Message.Refusal += delta.Delta.Refusal
+				if delta.Delta.Content != "" {
+					choice.Message.Content += delta.Delta.Content
+					emitter.emit(StreamEvent{Type: StreamText, Text: delta.Delta.Content})
+				}
+				for _, call := range delta.Delta.ToolCalls {
+					calls := &choice.Message.ToolCalls
+					for len(*calls) <= call.Index {
+						*calls = append(*calls, GroqToolCall{})
+					}
+					toolCall := &(*calls)[call.Index]
+					if call.Id != "" {
+						toolCall.Id = call.Id
+						toolCall.Type = call.Type
+						toolCall.Function.Name = call.Function.Name
+						emitter.emit(StreamEvent{Type: StreamToolCallStart, ToolCall: &ToolIntent{Id: call.Id, Name: call.Function.Name}})
+					}
+					if call.Function.Arguments != "" {
+						toolCall.Function.Arguments += call.Function.Arguments
+						emitter.emit(StreamEvent{Type: StreamToolCallDelta, ToolCall: &ToolIntent{Id: toolCall.Id, Arguments: call.Function.Arguments}})
+					}
+				}
+			}
+			return nil
+		})
+		if errors.Is(err, ErrInterrupted) {
+			choice.FinishReason = stopInterrupted
+			choice.Message.ToolCalls = nil // a tool call cut short cannot be made
+			err = nil
+		} else if err == nil && !done {
+			err = errStreamIncomplete
+		}
+		if errors.Is(err, ErrStreamStalled) && attempt < maxStallRetries {
+			provider.logf("Stream stalled, requesting it again\n")
+			emitter.restart()
+			continue
+		}
+		if err != nil {
+			return meta, err
+		}
+		return emitter.finish(meta), nil
+	}
+}
+
+// providerName tells Groq agents from the agents sharing its chat completions api:
+// DeepSeek, OpenRouter and custom agents, and OpenAI agents needing the chat completions api.
+func (provider Groq) providerName() string {
+	switch provider.provider {
+	case "deepseek", "openrouter", "openai", "custom":
+		return provider.provider
+	}
+	return "groq"
+}
+
+func (provider Groq) endpoint() string {
+	switch provider.provider {
+	case "deepseek":
+		return DeepSeekEndpoint
+	case "openrouter":
+		return OpenRouterEndpoint
+	case "custom":
+		return provider.customEndpoint()
+	case "openai":
+		return OpenaiChatEndpoint
+	}
+	return GroqEndpoint
+}
+
+// systemRole is the role of system prompts, which only Groq and OpenAI know as developer messages.
+func (provider Groq) systemRole() string {
+	switch provider.providerName() {
+	case "groq", "openai":
+		return "developer"
+	}
+	return "system"
 }
 
 func (provider *Groq) RegisterTool(fn any, paramType any, desctiption string) error {
-	provider.AgentConfig.RegisterTool(fn, paramType, desctiption)
-	return nil
+	return provider.AgentConfig.RegisterTool(fn, paramType, desctiption)
+}
+
+func (provider *Groq) AddTool(tool Tool) error {
+	return provider.AgentConfig.AddTool(tool)
 }
@@ -0,0 +1,84 @@
+package provider
+
+import (
+	"strings"
+	"testing"
+)
+
+type searchParams struct {
+	Query string `json:"query" validate:"required"`
+}
+
+func TestChatCompletionsToolLoop(t *testing.T) {
+	tests := []struct {
+		name       string
+		replies    []GroqMessage
+		searches   []string
+		toolOutput string // what the model is told the tool returned, "" without a tool call
+		text       string
+	}{
+		{
+			name:    "answer",
+			replies: []GroqMessage{textReply("Hello!")},
+			text:    "Hello!",
+		},
+		{
+			name:       "tool call",
+			replies:    []GroqMessage{toolReply("call_1", "Search", `{"query":"gossip"}`), textReply("gossip is a go library")},
+			searches:   []string{"gossip"},
+			toolOutput: "a go library",
+			text:       "gossip is a go library",
+		},
+		{
+			name:       "invalid arguments",
+			replies:    []GroqMessage{toolReply("call_1", "Search", `{"query":""}`), textReply("What should I search for?")},
+			toolOutput: "query is required",
+			text:       "What should I search for?",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newChatServer(t, test.replies...)
+			agent := server.agent(t)
+			var searches []string
+			search := NewTool("Search", "search the web", func(params searchParams) string {
+				searches = append(searches, params.Query)
+				return "a go library"
+			})
+			if err := agent.AddTool(search); err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := agent.Run("what is gossip?")
+			if err != nil {
+				t.Fatal(err)
+			}
+			requests := server.received()
+			if len(requests) != len(test.replies) || len(result.RoundTrips) != len(test.replies) {
+				t.Fatalf("%d requests and %d round trips, want %d", len(requests), len(result.RoundTrips), len(test.replies))
+			}
+			if len(requests[0].Tools) != 1 || requests[0].Tools[0].Function.Name != "Search" {
+				t.Errorf("tools sent %+v, want Search", requests[0].Tools)
+			}
+			if strings.Join(searches, ",") != strings.Join(test.searches, ",") {
+				t.Errorf("searched %q, want %q", searches, test.searches)
+			}
+			if test.toolOutput != "" {
+				sent := requests[1].Messages
+				call, output := sent[len(sent)-2], sent[len(sent)-1]
+				if len(call.ToolCalls) != 1 || call.ToolCalls[0].Id != "call_1" {
+					t.Errorf("sent the tool call as %+v", call)
+				}
+				if output.Role != "tool" || output.ToolCallId != "call_1" || !strings.Contains(output.Content, test.toolOutput) {
+					t.Errorf("sent the tool result as %+v, want it to tell %q", output, test.toolOutput)
+				}
+			}
+			if last := result.NewMessages[len(result.NewMessages)-1]; last.Role != "assistant" || last.Text != test.text {
+				t.Errorf("answered %+v, want %q", last, test.text)
+			}
+			if usage := result.Usage(); usage.InputTokens != 100*len(test.replies) || usage.OutputTokens != 20*len(test.replies) {
+				t.Errorf("usage %+v, want every round trip added up", usage)
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ErrOutputRejected is returned when answers keep failing the output guardrails after the model was asked to fix them.
+var ErrOutputRejected = errors.New("output rejected by guardrail")
+
+// OutputValidator checks the answer of a run. The error it returns is shown to the model,
+// which is asked to answer again, so it should say what to change.
+type OutputValidator func(text string) error
+
+// guardrailRetries bounds how often the model is asked to fix an answer.
+const guardrailRetries = 2
+
+// WithOutputGuardrails checks the answer of every run with validators. An answer failing one of
+// them is sent back to the model with the violation, and the run returns the corrected answer;
+// the exchange stays in the history. Incomplete answers and runs ending in a tool call are not checked.
+func WithOutputGuardrails(validators ...OutputValidator) AgentOption {
+	return func(a *AgentConfig) {
+		a.OutputValidators = append(a.OutputValidators, validators...)
+	}
+}
+
+// LengthBetween requires answers of at least min and at most max characters, max 0 for no upper bound.
+func LengthBetween(min int, max int) OutputValidator {
+	return func(text string) error {
+		length := utf8.RuneCountInString(strings.TrimSpace(text))
+		if length < min {
+			return fmt.Errorf("your answer is %d characters long, it must be at least %d characters", length, min)
+		}
+		if max > 0 && length > max {
+			return fmt.Errorf("your answer is %d characters long, it must be at most %d characters", length, max)
+		}
+		return nil
+	}
+}
+
+// InLanguage requires answers in the language with the ISO 639-1 code, e.g. "de". The language is
+// recognized from common words or the script, for the languages listed in LanguageNames.
+func InLanguage(code string) OutputValidator {
+	name := LanguageNames[code]
+	if name == "" {
+		name = code
+	}
+	return func(text string) error {
+		if detected := DetectLanguage(text); detected != "" && detected != code {
+			return fmt.Errorf("your answer is in %s, it must be in %s", LanguageNames[detected], name)
+		}
+		return nil
+	}
+}
+
+// LanguageNames are the languages DetectLanguage tells apart, by ISO 639-1 code.
+var LanguageNames = map[string]string{
+	"en": "English", "de": "German", "fr": "French", "es": "Spanish", "it": "Italian", "pt": "Portuguese",
+	"nl": "Dutch", "ru": "Russian", "el": "Greek", "ar": "Arabic", "he": "Hebrew", "zh": "Chinese",
+	"ja": "Japanese", "ko": "Korean",
+}
+
+// stopwords are frequent words of the languages written in the latin script. Many are shared,
+// like "que" or "de", it is the sum over a text that tells the languages apart.
+var stopwords = map[string][]string{
+	"en": {"the", "and", "is", "of", "to", "in", "that", "it", "you", "for", "with", "this", "are", "was", "not", "be", "have", "on", "will", "can"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "ein", "eine", "ich", "sie", "mit", "den", "zu", "auf", "für", "es", "auch", "sich", "dem", "wir"},
+	"fr": {"le", "la", "les", "et", "est", "un", "une", "des", "pas", "que", "vous", "pour", "dans", "qui", "sur", "de", "du", "au", "je", "nous"},
+	"es": {"el", "la", "los", "las", "y", "es", "un", "una", "que", "de", "no", "para", "por", "con", "está", "del", "lo", "se", "pero", "muy"},
+	"it": {"il", "lo", "la", "gli", "e", "è", "un", "una", "che", "di", "non", "per", "con", "sono", "del", "della", "le", "si", "ma", "questo"},
+	"pt": {"o", "a", "os", "as", "e", "é", "um", "uma", "que", "não", "para", "com", "do", "da", "você", "de", "em", "no", "na", "está"},
+	"nl": {"de", "het", "een", "en", "is", "niet", "van", "dat", "ik", "je", "met", "voor", "zijn", "op", "te", "ook", "maar", "wij", "er", "naar"},
+}
+
+// marks are letters only some of the latin languages use, each word with one counts like a stopword.
+var marks = map[string]string{
+	"de": "ßäöü",
+	"es": "ñ",
+	"pt": "ãõ",
+}
+
+// scripts tell apart languages by their alphabet.
+var scripts = []struct {
+	code  string
+	table *unicode.RangeTable
+}{
+	{"ja", unicode.Hiragana}, {"ja", unicode.Katakana}, {"ko", unicode.Hangul}, {"zh", unicode.Han},
+	{"ru", unicode.Cyrillic}, {"el", unicode.Greek}, {"ar", unicode.Arabic}, {"he", unicode.Hebrew},
+}
+
+// DetectLanguage returns the ISO 639-1 code of the language text is written in, or "" when it can't tell,
+// e.g. for short texts or when two languages score about the same.
+func DetectLanguage(text string) string {
+	counts := make(map[string]int)
+	letters := 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		for _, script := range scripts {
+			if unicode.Is(script.table, r) {
+				counts[script.code]++
+				break
+			}
+		}
+	}
+	if letters == 0 {
+		return ""
+	}
+	// kana marks Japanese even among kanji, which Chinese shares
+	if counts["ja"] > 0 && counts["ja"]+counts["zh"] > letters/2 {
+		return "ja"
+	}
+	for _, script := range scripts {
+		if counts[script.code] > letters/2 {
+			return script.code
+		}
+	}
+
+	lower := strings.ToLower(text)
+	words := strings.FieldsFunc(lower, func(r rune) bool { return !unicode.IsLetter(r) })
+	best, bestScore, secondScore := "", 0, 0
+	for code, list := range stopwords {
+		score := 0
+		for _, word := range words {
+			for _, stopword := range list {
+				if word == stopword {
+					score++
+					break
+				}
+			}
+			if marks[code] != "" && strings.ContainsAny(word, marks[code]) {
+				score++
+			}
+		}
+		switch {
+		case score > bestScore:
+			best, bestScore, secondScore = code, score, bestScore
+		case score > secondScore:
+			secondScore = score
+		}
+	}
+	// too few common words to be sure, e.g. a name or a number
+	if bestScore < 2 {
+		return ""
+	}
+	// languages sharing most of their common words, like Spanish and Portuguese, need a clear lead:
+	// guessing wrong has InLanguage reject a good answer
+	if bestScore-secondScore < 2 && bestScore < 2*secondScore {
+		return ""
+	}
+	return best
+}
+
+// guardrailKey marks the runs of an agent as guarded, agents run by its tools check their own answers.
+type guardrailKey struct{ agent *agentID }
+
+// beginGuardrails marks ctx as guarded. It reports true for the call that starts the run,
+// which is the one that checks the answer.
+func (config *AgentConfig) beginGuardrails(ctx context.Context) (context.Context, bool) {
+	if len(config.OutputValidators) == 0 || ctx.Value(guardrailKey{config.id}) != nil {
+		return ctx, false
+	}
+	return context.WithValue(ctx, guardrailKey{config.id}, true), true
+}
+
+// enforceOutput checks the answer of result and has rerun, which continues a history, fix it when it fails a guardrail.
+func (config *AgentConfig) enforceOutput(ctx context.Context, result *AgentResult, rerun func(context.Context, []Message) (*AgentResult, error)) (*AgentResult, error) {
+	for attempt := 0; ; attempt++ {
+		if result.Incomplete || result.Refused() || result.Text == "" || !lastIsText(result.NewMessages) {
+			return result, nil
+		}
+		var violation error
+		for _, validate := range config.OutputValidators {
+			if violation = validate(result.Text); violation != nil {
+				break
+			}
+		}
+		if violation == nil {
+			return result, nil
+		}
+		if attempt == guardrailRetries {
+			return result, fmt.Errorf("%w: %v", ErrOutputRejected, violation)
+		}
+		config.logf("Answer rejected by guardrail: %v\n", violation)
+		correction := Message{Role: "user", Text: fmt.Sprintf("Rewrite your answer: %v.", violation)}.WithMetadata("guardrail", violation.Error())
+		next, err := rerun(ctx, append(append([]Message(nil), result.AllMessages...), correction))
+		if err != nil {
+			return result, err
+		}
+		merged := *next
+		merged.AllMessages = next.AllMessages
+		merged.NewMessages = append(append(append([]Message(nil), result.NewMessages...), correction), next.NewMessages...)
+		merged.RequestIDs = append(append([]string(nil), result.RequestIDs...), next.RequestIDs...)
+		merged.RoundTrips = append(append([]RoundTripStats(nil), result.RoundTrips...), next.RoundTrips...)
+		result = &merged
+	}
+}
+
+func lastIsText(messages []Message) bool {
+	return len(messages) > 0 && messages[len(messages)-1].isText()
+}
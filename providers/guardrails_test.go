@@ -0,0 +1,83 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestGuardrailsNestedAgent(t *testing.T) {
+	childServer := newChatServer(t, textReply("no"), textReply("ok then"))
+	child := childServer.agent(t, WithOutputGuardrails(func(text string) error {
+		if !strings.HasPrefix(text, "ok") {
+			return errors.New("start with ok")
+		}
+		return nil
+	}))
+	server := newChatServer(t, toolReply("call_1", "Ask", `{"query":"q"}`), textReply("parent done"))
+	parent := server.agent(t, WithOutputGuardrails(LengthBetween(1, 0)))
+	var childText string
+	ask := NewTool("Ask", "ask the child agent", func(ctx context.Context, params lookupParams) (string, error) {
+		result, err := child.RunContext(ctx, params.Query)
+		if err != nil {
+			return "", err
+		}
+		childText = result.Text
+		return result.Text, nil
+	})
+	if err := parent.AddTool(ask); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parent.RunContext(context.Background(), "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if childText != "ok then" || len(childServer.received()) != 2 {
+		t.Errorf("child answered %q after %d requests, want its guardrail applied", childText, len(childServer.received()))
+	}
+}
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"The meeting room is free tomorrow, and I think that it will be quiet.", "en"},
+		{"Der Besprechungsraum ist morgen frei, und ich glaube, dass es ruhig sein wird.", "de"},
+		{"La salle de réunion est libre demain et je pense que nous serons tranquilles.", "fr"},
+		{"La sala de reuniones está libre mañana y creo que no habrá mucho ruido.", "es"},
+		{"Per la riunione di domani, penso che la sala conferenze sia libera e non ci sia nessuno.", "it"},
+		{"Para a reunião de amanhã, acho que a sala de conferências está livre.", "pt"},
+		{"Você pode enviar o relatório até amanhã? Não tenho a versão final.", "pt"},
+		{"De vergaderruimte is morgen vrij en ik denk dat het er rustig is.", "nl"},
+		{"Переговорная комната завтра свободна.", "ru"},
+		{"会議室は明日空いています。", "ja"},
+		{"会议室明天有空。", "zh"},
+		{"회의실은 내일 비어 있습니다.", "ko"},
+		{"Η αίθουσα συσκέψεων είναι ελεύθερη αύριο.", "el"},
+		// too short or shared by several languages: no guess
+		{"Paris", ""},
+		{"42", ""},
+		{"", ""},
+		{"la casa de la familia", ""},
+		{"para que", ""},
+	}
+	for _, test := range tests {
+		if got := DetectLanguage(test.text); got != test.want {
+			t.Errorf("DetectLanguage(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestInLanguage(t *testing.T) {
+	portuguese := InLanguage("pt")
+	if err := portuguese("Para a reunião de amanhã, acho que a sala de conferências está livre."); err != nil {
+		t.Errorf("Portuguese answer rejected: %v", err)
+	}
+	if err := portuguese("The meeting room is free tomorrow, and I think that it will be quiet."); err == nil {
+		t.Error("English answer accepted as Portuguese")
+	}
+	if err := InLanguage("es")("para que"); err != nil {
+		t.Errorf("ambiguous answer rejected: %v", err)
+	}
+}
@@ -0,0 +1,217 @@
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+)
+
+// The helpers below edit histories without breaking what providers require of them: every tool
+// result follows the tool call it answers. They never modify their input and return a new slice.
+
+// ownHistory copies the history given to a run, so appending to it never writes into the
+// caller's backing array, which concurrent runs sharing a history would race on.
+func ownHistory(messageHistory [][]Message) [][]Message {
+	if len(messageHistory) == 0 {
+		return nil
+	}
+	return [][]Message{append([]Message(nil), messageHistory[0]...)}
+}
+
+// isTurnStart reports whether msg opens a turn: a user message that is not part of a tool exchange.
+func isTurnStart(msg Message) bool {
+	return msg.ToolIntent == nil && msg.ToolResult == nil && msg.Role != "assistant"
+}
+
+// Turns splits history into turns, each starting with a user message and holding
+// everything up to the next one. Messages before the first user message form turn 0.
+func Turns(history []Message) [][]Message {
+	var turns [][]Message
+	start := 0
+	for i := 1; i <= len(history); i++ {
+		if i == len(history) || isTurnStart(history[i]) {
+			turns = append(turns, history[start:i:i])
+			start = i
+		}
+	}
+	return turns
+}
+
+// DeleteTurn removes turn index (as numbered by Turns) and all its replies and tool exchanges.
+func DeleteTurn(history []Message, index int) ([]Message, error) {
+	turns := Turns(history)
+	if index < 0 || index >= len(turns) {
+		return nil, fmt.Errorf("turn %d out of range, history has %d turns", index, len(turns))
+	}
+	edited := make([]Message, 0, len(history)-len(turns[index]))
+	for i, turn := range turns {
+		if i != index {
+			edited = append(edited, turn...)
+		}
+	}
+	return edited, nil
+}
+
+// RedactText replaces every match of pattern in message texts, tool arguments and tool outputs,
+// citations, raw response items and the string values of metadata. Tool arguments and raw
+// items stay valid JSON: only their string values are redacted.
+func RedactText(history []Message, pattern *regexp.Regexp, replacement string) []Message {
+	edited := make([]Message, len(history))
+	for i, msg := range history {
+		msg.Text = pattern.ReplaceAllString(msg.Text, replacement)
+		if msg.ToolIntent != nil {
+			intent := *msg.ToolIntent
+			intent.Arguments = redactJSON(intent.Arguments, pattern, replacement)
+			msg.ToolIntent = &intent
+		}
+		if msg.ToolResult != nil {
+			result := *msg.ToolResult
+			result.Output = pattern.ReplaceAllString(result.Output, replacement)
+			if result.Data != nil {
+				result.Data = json.RawMessage(redactJSON(string(result.Data), pattern, replacement))
+			}
+			result.Value = nil // cannot be redacted
+			msg.ToolResult = &result
+		}
+		if msg.Citations != nil {
+			citations := make([]Citation, len(msg.Citations))
+			for j, citation := range msg.Citations {
+				citation.URL = pattern.ReplaceAllString(citation.URL, replacement)
+				citation.Title = pattern.ReplaceAllString(citation.Title, replacement)
+				citation.CitedText = pattern.ReplaceAllString(citation.CitedText, replacement)
+				citations[j] = citation
+			}
+			msg.Citations = citations
+		}
+		if msg.SearchResults != nil {
+			results := make([]SearchResult, len(msg.SearchResults))
+			for j, result := range msg.SearchResults {
+				result.URL = pattern.ReplaceAllString(result.URL, replacement)
+				result.Title = pattern.ReplaceAllString(result.Title, replacement)
+				results[j] = result
+			}
+			msg.SearchResults = results
+		}
+		if msg.Raw != nil {
+			msg.Raw = json.RawMessage(redactJSON(string(msg.Raw), pattern, replacement))
+		}
+		if msg.Metadata != nil {
+			msg.Metadata = redactCopy(msg.Metadata, pattern, replacement).(map[string]any)
+		}
+		edited[i] = msg
+	}
+	return edited
+}
+
+func redactJSON(document string, pattern *regexp.Regexp, replacement string) string {
+	var value any
+	if err := json.Unmarshal([]byte(document), &value); err != nil {
+		return pattern.ReplaceAllString(document, replacement)
+	}
+	redacted, err := json.Marshal(redactValue(value, pattern, replacement))
+	if err != nil {
+		return document
+	}
+	return string(redacted)
+}
+
+func redactValue(value any, pattern *regexp.Regexp, replacement string) any {
+	switch v := value.(type) {
+	case string:
+		return pattern.ReplaceAllString(v, replacement)
+	case []any:
+		for i := range v {
+			v[i] = redactValue(v[i], pattern, replacement)
+		}
+	case map[string]any:
+		for key := range v {
+			v[key] = redactValue(v[key], pattern, replacement)
+		}
+	}
+	return value
+}
+
+// redactCopy is redactValue for values the caller still holds: maps and slices are copied.
+// Values of other types are kept as they are.
+func redactCopy(value any, pattern *regexp.Regexp, replacement string) any {
+	switch v := value.(type) {
+	case string:
+		return pattern.ReplaceAllString(v, replacement)
+	case []any:
+		copied := make([]any, len(v))
+		for i := range v {
+			copied[i] = redactCopy(v[i], pattern, replacement)
+		}
+		return copied
+	case []string:
+		copied := make([]string, len(v))
+		for i := range v {
+			copied[i] = pattern.ReplaceAllString(v[i], replacement)
+		}
+		return copied
+	case map[string]any:
+		copied := make(map[string]any, len(v))
+		for key := range v {
+			copied[key] = redactCopy(v[key], pattern, replacement)
+		}
+		return copied
+	case map[string]string:
+		copied := make(map[string]string, len(v))
+		for key := range v {
+			copied[key] = pattern.ReplaceAllString(v[key], replacement)
+		}
+		return copied
+	}
+	return value
+}
+
+// CollapseToolExchange replaces the tool call with id toolCallId and its result with a single
+// assistant message holding summary, e.g. to drop a bulky tool output from the history.
+func CollapseToolExchange(history []Message, toolCallId string, summary string) ([]Message, error) {
+	intentAt, resultAt := -1, -1
+	for i, msg := range history {
+		if msg.ToolIntent != nil && msg.ToolIntent.Id == toolCallId {
+			intentAt = i
+		}
+		if msg.ToolResult != nil && msg.ToolResult.Id == toolCallId {
+			resultAt = i
+		}
+	}
+	if intentAt < 0 {
+		return nil, fmt.Errorf("tool call %s not found", toolCallId)
+	}
+	edited := make([]Message, 0, len(history))
+	for i, msg := range history {
+		switch i {
+		case intentAt:
+			edited = append(edited, Message{Role: "assistant", Text: summary})
+		case resultAt:
+		default:
+			edited = append(edited, msg)
+		}
+	}
+	return edited, nil
+}
+
+// ValidateHistory checks that every tool result answers an earlier tool call and that
+// every tool call but a trailing, still pending one has a result.
+func ValidateHistory(history []Message) error {
+	pending := make(map[string]int) // tool call id -> index
+	for i, msg := range history {
+		if msg.ToolIntent != nil {
+			pending[msg.ToolIntent.Id] = i
+		}
+		if msg.ToolResult != nil {
+			if _, exists := pending[msg.ToolResult.Id]; !exists {
+				return fmt.Errorf("message %d: tool result %s does not follow its tool call", i, msg.ToolResult.Id)
+			}
+			delete(pending, msg.ToolResult.Id)
+		}
+	}
+	for id, i := range pending {
+		if i != len(history)-1 {
+			return fmt.Errorf("message %d: tool call %s has no result", i, id)
+		}
+	}
+	return nil
+}
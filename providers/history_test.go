@@ -0,0 +1,48 @@
+package provider
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRedactText(t *testing.T) {
+	secret := regexp.MustCompile(`sk-[a-z0-9]+`)
+	history := []Message{
+		{Role: "user", Text: "my key is sk-abc123"},
+		{Type: "tool_intent", ToolIntent: &ToolIntent{Id: "call_1", Name: "Store", Arguments: `{"key":"sk-abc123","n":1}`}},
+		{ToolResult: &ToolResult{Id: "call_1", Output: "stored sk-abc123", Data: json.RawMessage(`"stored sk-abc123"`), Value: "stored sk-abc123"}},
+		{
+			Role:      "assistant",
+			Text:      "done",
+			Citations: []Citation{{URL: "https://example.com/?token=sk-abc123", CitedText: "sk-abc123 leaked"}},
+			Raw:       json.RawMessage(`{"type":"custom","payload":{"key":"sk-abc123"}}`),
+			Metadata:  map[string]any{"author": "sk-abc123", "thread": map[string]any{"keys": []any{"sk-abc123"}}, "count": 3},
+		},
+	}
+	redacted := RedactText(history, secret, "[REDACTED]")
+
+	encoded, err := json.Marshal(redacted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(encoded), "sk-abc123") {
+		t.Errorf("redacted history still holds the secret: %s", encoded)
+	}
+	if redacted[2].ToolResult.Value != nil {
+		t.Errorf("tool result value kept: %v", redacted[2].ToolResult.Value)
+	}
+	if !json.Valid(redacted[3].Raw) || !json.Valid([]byte(redacted[1].ToolIntent.Arguments)) {
+		t.Errorf("redaction broke JSON: %s, %s", redacted[3].Raw, redacted[1].ToolIntent.Arguments)
+	}
+	if redacted[3].Metadata["count"] != 3 {
+		t.Errorf("metadata count = %v, want 3", redacted[3].Metadata["count"])
+	}
+
+	// the history passed in is left as it was
+	if history[0].Text != "my key is sk-abc123" || history[3].Metadata["author"] != "sk-abc123" ||
+		history[3].Citations[0].CitedText != "sk-abc123 leaked" || history[3].Metadata["thread"].(map[string]any)["keys"].([]any)[0] != "sk-abc123" {
+		t.Error("RedactText changed the history passed in")
+	}
+}
@@ -0,0 +1,400 @@
+package provider
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WithTLSConfig sets the TLS configuration used to reach the provider, e.g. to trust
+// the internal CA of a TLS-intercepting proxy or private gateway.
+func WithTLSConfig(tlsConfig *tls.Config) AgentOption {
+	return func(a *AgentConfig) {
+		a.TLSConfig = tlsConfig
+	}
+}
+
+// WithHTTPClient sends the agent's requests with client, for its timeouts, proxy, transport and
+// connection pool; one client can serve many agents. client.Timeout also bounds streamed answers,
+// see WithStallTimeout for a limit on silence instead. Agents share a pooled client otherwise.
+func WithHTTPClient(client *http.Client) AgentOption {
+	return func(a *AgentConfig) {
+		a.HTTPClient = client
+	}
+}
+
+// TLSConfigWithCABundle returns a TLS configuration trusting the system roots plus
+// the PEM encoded certificates in caBundlePath.
+func TLSConfigWithCABundle(caBundlePath string) (*tls.Config, error) {
+	pemData, err := os.ReadFile(caBundlePath)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pemData) {
+		return nil, fmt.Errorf("no certificates found in %s", caBundlePath)
+	}
+	return &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}, nil
+}
+
+// WithRequestCompression gzips request bodies of at least minBytes, which pays off for agents
+// resending long histories or large tool outputs every turn. The endpoint must accept
+// Content-Encoding: gzip, which is typical for proxies and gateways.
+func WithRequestCompression(minBytes int) AgentOption {
+	return func(a *AgentConfig) {
+		a.CompressRequestsAbove = minBytes
+	}
+}
+
+// WithDefaultHeaders adds headers to every request the agent sends, e.g. the auth token of a gateway or
+// the headers of an observability proxy like Helicone or LiteLLM. Headers the provider needs, like
+// its api key and version, are kept. Can be given several times, later values win.
+func WithDefaultHeaders(headers map[string]string) AgentOption {
+	return WithProviderHeaders("", headers)
+}
+
+// WithProviderHeaders is WithDefaultHeaders for the agents of one provider, named as in model names
+// like "openai", so options shared by agents of different providers can carry each one's headers.
+// They are sent on top of the default headers.
+func WithProviderHeaders(providerName string, headers map[string]string) AgentOption {
+	return func(a *AgentConfig) {
+		if a.Headers == nil {
+			a.Headers = make(map[string]map[string]string)
+		}
+		if a.Headers[providerName] == nil {
+			a.Headers[providerName] = make(map[string]string)
+		}
+		for key, value := range headers {
+			a.Headers[providerName][key] = value
+		}
+	}
+}
+
+// addHeaders adds the headers configured for providerName to a request, leaving those it already has.
+func (config *AgentConfig) addHeaders(req *http.Request, providerName string) {
+	for _, headers := range []map[string]string{config.Headers[providerName], config.Headers[""]} {
+		for key, value := range headers {
+			if req.Header.Get(key) == "" {
+				req.Header.Set(key, value)
+			}
+		}
+	}
+}
+
+// sharedTransport is used by every agent without custom TLS settings so they share one connection pool.
+var sharedTransport = newTransport(nil)
+
+func newTransport(tlsConfig *tls.Config) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ForceAttemptHTTP2 = true
+	transport.MaxIdleConns = 100
+	transport.MaxIdleConnsPerHost = 16
+	transport.IdleConnTimeout = 90 * time.Second
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+	return transport
+}
+
+func (config *AgentConfig) newHTTPClient() *http.Client {
+	if client := config.HTTPClient; client != nil {
+		if config.wrapTransport == nil {
+			return client
+		}
+		// a copy, the client may be shared with other agents
+		wrapped := *client
+		wrapped.Transport = client.Transport
+		if wrapped.Transport == nil {
+			wrapped.Transport = http.DefaultTransport
+		}
+		wrapped.Transport = config.wrapTransport(wrapped.Transport)
+		return &wrapped
+	}
+	var transport http.RoundTripper = sharedTransport
+	if config.TLSConfig != nil {
+		transport = newTransport(config.TLSConfig)
+	}
+	if config.wrapTransport != nil {
+		transport = config.wrapTransport(transport)
+	}
+	return &http.Client{Transport: transport}
+}
+
+func gzipBody(data []byte) (*bytes.Buffer, error) {
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return &compressed, nil
+}
+
+// responseMeta carries what post learns about a response besides its body.
+type responseMeta struct {
+	RequestID string // empty for cached responses
+	Latency   time.Duration
+	Cached    bool
+	Raw       json.RawMessage // the response body, not for streamed responses
+
+	TimeToFirstToken time.Duration // streamed responses only
+}
+
+// post sends payload as JSON to a provider endpoint and decodes the JSON answer into response.
+// Identical requests are answered from the configured cache when one is set. Failed requests are
+// retried as WithRetryPolicy says and fail over to the endpoints of WithFailover.
+func (config *AgentConfig) post(ctx context.Context, providerName string, endpoint string, headers map[string]string, payload any, response any) (responseMeta, error) {
+	return config.retry(ctx, func() (responseMeta, bool, error) {
+		return config.failOver(ctx, endpoint, headers, payload, func(endpoint string, headers map[string]string, payload any) (responseMeta, bool, error) {
+			meta, err := config.postTo(ctx, providerName, endpoint, headers, payload, response)
+			return meta, false, err
+		})
+	})
+}
+
+func (config *AgentConfig) postTo(ctx context.Context, providerName string, endpoint string, headers map[string]string, payload any, response any) (responseMeta, error) {
+	var meta responseMeta
+	if config.ApiKey == "" && !keylessProviders[config.provider] {
+		return meta, errNoApiKey
+	}
+	buffer, err := config.encodeRequest(providerName, payload)
+	if err != nil {
+		return meta, err
+	}
+	jsonData := buffer.Bytes()
+
+	var cacheKey string
+	if config.Cache != nil {
+		cacheKey = config.cacheKey(providerName, jsonData)
+		if body, hit := config.Cache.Get(cacheKey); hit {
+			releaseBuffer(buffer)
+			meta.Cached = true
+			meta.Raw = body
+			return meta, json.Unmarshal(body, response)
+		}
+	}
+
+	ctx, cancel := interruptible(ctx)
+	defer cancel(nil)
+	req, release, err := config.newPostRequest(ctx, providerName, endpoint, headers, buffer)
+	if err != nil {
+		return meta, err
+	}
+
+	// Send request
+	client := config.client
+	if client == nil {
+		client = config.newHTTPClient()
+	}
+	start := config.now()
+	resp, err := client.Do(req)
+	release()
+	if err != nil {
+		return meta, interruption(ctx, err)
+	}
+	defer resp.Body.Close()
+	meta.RequestID = requestID(resp.Header)
+
+	maxBytes := config.MaxResponseBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxResponseBytes
+	}
+	var reader io.Reader = &limitedReader{reader: resp.Body, remaining: maxBytes}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, err := io.ReadAll(reader)
+		if err != nil {
+			return meta, err
+		}
+		return meta, config.apiError(providerName, resp, body)
+	}
+
+	// Decode the response as it streams in, keeping a copy for RawResponse and the cache
+	var body bytes.Buffer
+	reader = io.TeeReader(reader, &body)
+	if err := json.NewDecoder(reader).Decode(response); err != nil {
+		return meta, interruption(ctx, err)
+	}
+	meta.Latency = config.since(start)
+	meta.Raw = json.RawMessage(body.Bytes())
+	if config.Cache != nil {
+		config.Cache.Set(cacheKey, body.Bytes(), config.CacheTTL)
+	}
+	return meta, nil
+}
+
+// newPostRequest builds the POST request carrying the JSON in buffer, gzipped when it is large enough.
+// The caller calls release once client.Do returned, the buffer goes back to the pool when the
+// transport has closed every body it read too.
+func (config *AgentConfig) newPostRequest(ctx context.Context, providerName string, endpoint string, headers map[string]string, buffer *bytes.Buffer) (req *http.Request, release func(), err error) {
+	pooled := &pooledBuffer{buffer: buffer}
+	pooled.refs.Store(1)
+	release = pooled.release
+	body := buffer.Bytes()
+	getBody := func() (io.ReadCloser, error) { return pooled.body(), nil }
+	compressed := config.CompressRequestsAbove > 0 && len(body) >= config.CompressRequestsAbove
+	if compressed {
+		gzipped, err := gzipBody(body)
+		release()
+		if err != nil {
+			return nil, nil, err
+		}
+		body = gzipped.Bytes()
+		release = func() {}
+		getBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+	}
+
+	requestBody, _ := getBody()
+	req, err = http.NewRequestWithContext(ctx, "POST", endpoint, requestBody)
+	if err != nil {
+		requestBody.Close()
+		release()
+		return nil, nil, err
+	}
+	// redirects and retried HTTP/2 requests read the body again
+	req.GetBody = getBody
+	req.ContentLength = int64(len(body))
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	config.addHeaders(req, providerName)
+	if compressed {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if config.provider == "bedrock" {
+		signAWS(req, body, config.AWS, "bedrock", time.Now())
+	}
+	return req, release, nil
+}
+
+// send performs a request to a provider api other than the model endpoints, like files or
+// admin apis, and decodes the JSON answer into response.
+func (config *AgentConfig) send(req *http.Request, providerName string, response any) error {
+	config.addHeaders(req, providerName)
+	client := config.client
+	if client == nil {
+		client = config.newHTTPClient()
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	maxBytes := config.MaxResponseBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxResponseBytes
+	}
+	reader := &limitedReader{reader: resp.Body, remaining: maxBytes}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, err := io.ReadAll(reader)
+		if err != nil {
+			return err
+		}
+		return config.apiError(providerName, resp, body)
+	}
+	return json.NewDecoder(reader).Decode(response)
+}
+
+var bufferPool = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// maxPooledBuffer keeps outsized request buffers from being held by the pool.
+const maxPooledBuffer = 1 << 20
+
+// encodeJSON marshals payload into a pooled buffer, without json.Encoder's trailing newline.
+func encodeJSON(payload any) (*bytes.Buffer, error) {
+	buffer := bufferPool.Get().(*bytes.Buffer)
+	buffer.Reset()
+	if err := json.NewEncoder(buffer).Encode(payload); err != nil {
+		releaseBuffer(buffer)
+		return nil, err
+	}
+	buffer.Truncate(buffer.Len() - 1)
+	return buffer, nil
+}
+
+func releaseBuffer(buffer *bytes.Buffer) {
+	if buffer.Cap() <= maxPooledBuffer {
+		bufferPool.Put(buffer)
+	}
+}
+
+// pooledBuffer returns a request buffer to the pool once nothing reads it anymore: the request
+// was sent and the transport closed every body it got. Transports may close bodies after
+// client.Do returned, and read another one through GetBody before.
+type pooledBuffer struct {
+	buffer *bytes.Buffer
+	refs   atomic.Int32
+}
+
+func (pooled *pooledBuffer) body() io.ReadCloser {
+	pooled.refs.Add(1)
+	return &pooledBody{Reader: bytes.NewReader(pooled.buffer.Bytes()), pooled: pooled}
+}
+
+func (pooled *pooledBuffer) release() {
+	if pooled.refs.Add(-1) == 0 {
+		releaseBuffer(pooled.buffer)
+	}
+}
+
+// pooledBody is a request body reading a pooledBuffer.
+type pooledBody struct {
+	*bytes.Reader
+	pooled *pooledBuffer
+	once   sync.Once
+}
+
+func (body *pooledBody) Close() error {
+	body.once.Do(body.pooled.release)
+	return nil
+}
+
+// DefaultMaxResponseBytes bounds provider responses when no WithMaxResponseBytes is given.
+const DefaultMaxResponseBytes = 32 << 20
+
+var ErrResponseTooLarge = errors.New("provider response exceeds the maximum size")
+
+// WithMaxResponseBytes bounds how much of a provider response is read before giving up with ErrResponseTooLarge.
+func WithMaxResponseBytes(maxBytes int64) AgentOption {
+	return func(a *AgentConfig) {
+		a.MaxResponseBytes = maxBytes
+	}
+}
+
+// limitedReader is io.LimitReader that fails with ErrResponseTooLarge instead of silently truncating.
+type limitedReader struct {
+	reader    io.Reader
+	remaining int64
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	if r.remaining <= 0 {
+		var probe [1]byte
+		if n, err := r.reader.Read(probe[:]); n == 0 {
+			return 0, err
+		}
+		return 0, ErrResponseTooLarge
+	}
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n, err := r.reader.Read(p)
+	r.remaining -= int64(n)
+	return n, err
+}
@@ -0,0 +1,63 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPostFollowsRedirects(t *testing.T) {
+	server := newChatServer(t, textReply("Paris"))
+	front := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, server.URL+r.URL.Path, http.StatusTemporaryRedirect)
+	}))
+	defer front.Close()
+	agent, err := NewAgent("custom:test-model", WithBaseURL(front.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := agent.Run("capital of France?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests := server.received()
+	if len(requests) != 1 || requests[0].Messages[len(requests[0].Messages)-1].Content != "capital of France?" {
+		t.Errorf("redirected requests %+v, want the prompt sent again", requests)
+	}
+	if last := result.NewMessages[len(result.NewMessages)-1]; last.Text != "Paris" {
+		t.Errorf("answered %q", last.Text)
+	}
+}
+
+func TestPooledBufferOutlivesBodies(t *testing.T) {
+	config := &AgentConfig{}
+	buffer := bytes.NewBufferString(`{"prompt":"hello"}`)
+	req, release, err := config.newPostRequest(context.Background(), "custom", "http://localhost/", nil, buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := req.GetBody()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pooled := again.(*pooledBody).pooled
+
+	// client.Do returned, but the transport still reads a body
+	release()
+	req.Body.Close()
+	if pooled.refs.Load() == 0 {
+		t.Fatal("buffer released while a body was open")
+	}
+	sent, err := io.ReadAll(again)
+	if err != nil || string(sent) != `{"prompt":"hello"}` {
+		t.Errorf("read %q, %v from GetBody", sent, err)
+	}
+	again.Close()
+	again.Close()
+	if refs := pooled.refs.Load(); refs != 0 {
+		t.Errorf("%d references left once every body is closed", refs)
+	}
+}
@@ -0,0 +1,63 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+)
+
+// Identity is the caller a run acts on behalf of. Attach it with ContextWithIdentity and pass
+// the context to RunContext; tools taking a context.Context read it back with IdentityFromContext.
+type Identity struct {
+	Subject string         // user or service id
+	Roles   []string       // e.g. "admin", "support"
+	Claims  map[string]any // free-form attributes, e.g. "tenant" or "region"
+}
+
+func (identity *Identity) HasRole(role string) bool {
+	for _, r := range identity.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+type identityKey struct{}
+
+func ContextWithIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+func IdentityFromContext(ctx context.Context) (*Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(*Identity)
+	return identity, ok && identity != nil
+}
+
+// IdentityPolicy scopes tool calls to the run's identity. Runs without an identity are denied.
+func IdentityPolicy(allow func(identity *Identity, toolName string, arguments string) (bool, string)) Policy {
+	return PolicyFunc(func(ctx context.Context, toolName string, arguments string) (bool, string) {
+		identity, ok := IdentityFromContext(ctx)
+		if !ok {
+			return false, fmt.Sprintf("tool %s requires an identity", toolName)
+		}
+		return allow(identity, toolName, arguments)
+	})
+}
+
+// RequireRole lets only identities with role call the named tools. Other tools are not affected.
+func RequireRole(role string, toolNames ...string) Policy {
+	scoped := make(map[string]bool, len(toolNames))
+	for _, name := range toolNames {
+		scoped[name] = true
+	}
+	return PolicyFunc(func(ctx context.Context, toolName string, arguments string) (bool, string) {
+		if !scoped[toolName] {
+			return true, ""
+		}
+		identity, ok := IdentityFromContext(ctx)
+		if !ok || !identity.HasRole(role) {
+			return false, fmt.Sprintf("tool %s requires role %s", toolName, role)
+		}
+		return true, ""
+	})
+}
@@ -0,0 +1,36 @@
+package provider
+
+import "fmt"
+
+// WithLogitBias makes tokens more or less likely in answers of OpenAI compatible providers: bias maps
+// token ids of the model's tokenizer to a value from -100, which bans the token, to 100, which forces it,
+// e.g. to ban the tokens of markdown code fences from code-only answers. OpenAI agents call the chat
+// completions api for it, as the responses api has no logit bias. Groq rejects requests with a bias.
+func WithLogitBias(bias map[int]int) AgentOption {
+	return func(a *AgentConfig) {
+		if a.LogitBias == nil {
+			a.LogitBias = make(map[int]int, len(bias))
+		}
+		for token, value := range bias {
+			a.LogitBias[token] = value
+		}
+	}
+}
+
+// checkLogitBias validates the bias of an agent of provider.
+func checkLogitBias(bias map[int]int, provider string) error {
+	if len(bias) == 0 {
+		return nil
+	}
+	switch provider {
+	case "openai", "groq", "deepseek", "openrouter", "custom":
+	default:
+		return fmt.Errorf("logit bias is only supported by openai compatible providers")
+	}
+	for token, value := range bias {
+		if value < -100 || value > 100 {
+			return fmt.Errorf("logit bias of token %d is %d, it must be between -100 and 100", token, value)
+		}
+	}
+	return nil
+}
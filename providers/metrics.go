@@ -0,0 +1,144 @@
+package provider
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// RoundTripStats describes one provider request made during a run.
+type RoundTripStats struct {
+	Agent        string // see WithName
+	Provider     string
+	Model        string
+	Route        string // why the model was picked, empty for the agent's own model (see WithRoutes)
+	RequestID    string
+	Latency      time.Duration // from sending the request to decoding the full response
+	Cached       bool          // answered from the response cache
+	InputTokens  int
+	OutputTokens int
+	// CachedTokens is the part of InputTokens read from the provider's prompt cache.
+	CachedTokens int
+	// CostUSD is what the round trip cost as priced by the agent's pricing table, 0 for cached
+	// responses and models the table doesn't know.
+	CostUSD float64
+	// ReasoningTokens is the part of OutputTokens the model spent thinking, estimated for Anthropic.
+	ReasoningTokens int
+
+	// TimeToFirstToken is only measured for streamed responses.
+	TimeToFirstToken time.Duration
+
+	// Err is set for failed round trips, which hooks receive too so error rates can be tracked.
+	Err error `json:"-"`
+	// Raw is the response body, see AgentResult.RawResponse.
+	Raw json.RawMessage `json:"-"`
+}
+
+// TokensPerSecond is the output throughput of the round trip, 0 when unknown.
+func (stats RoundTripStats) TokensPerSecond() float64 {
+	if stats.Cached || stats.Latency <= 0 {
+		return 0
+	}
+	return float64(stats.OutputTokens) / stats.Latency.Seconds()
+}
+
+// MetricsHook is called after every provider round trip, e.g. to export latency histograms.
+type MetricsHook func(stats RoundTripStats)
+
+// WithMetricsHook calls hook after every provider round trip. Hooks run synchronously on the calling goroutine.
+func WithMetricsHook(hook MetricsHook) AgentOption {
+	return func(a *AgentConfig) {
+		a.MetricsHooks = append(a.MetricsHooks, hook)
+	}
+}
+
+// observeRoundTrip builds the stats of a finished round trip and reports them to the metrics hooks.
+func (config *AgentConfig) observeRoundTrip(providerName string, model string, route string, meta responseMeta, inputTokens int, outputTokens int, reasoningTokens int, cachedTokens int) RoundTripStats {
+	stats := RoundTripStats{
+		Agent:        config.Name,
+		Provider:     providerName,
+		Model:        model,
+		Route:        route,
+		RequestID:    meta.RequestID,
+		Latency:      meta.Latency,
+		Cached:       meta.Cached,
+		InputTokens:  inputTokens,
+		OutputTokens: outputTokens,
+		CachedTokens: cachedTokens,
+
+		ReasoningTokens:  reasoningTokens,
+		TimeToFirstToken: meta.TimeToFirstToken,
+		Raw:              meta.Raw,
+	}
+	if !stats.Cached {
+		stats.CostUSD = config.cost(providerName, model, inputTokens, cachedTokens, outputTokens)
+	}
+	config.reportUsage(stats)
+	for _, hook := range config.MetricsHooks {
+		hook(stats)
+	}
+	if config.Stream != nil {
+		usage := stats
+		config.Stream(StreamEvent{Type: StreamUsage, Usage: &usage})
+	}
+	return stats
+}
+
+// observeFailedRoundTrip reports a round trip that ended in err to the metrics hooks.
+func (config *AgentConfig) observeFailedRoundTrip(providerName string, model string, route string, meta responseMeta, err error) {
+	stats := RoundTripStats{Agent: config.Name, Provider: providerName, Model: model, Route: route, RequestID: meta.RequestID, Err: err}
+	for _, hook := range config.MetricsHooks {
+		hook(stats)
+	}
+}
+
+// Latency is the summed latency of every round trip of the run.
+func (result *AgentResult) Latency() time.Duration {
+	var total time.Duration
+	for _, stats := range result.RoundTrips {
+		total += stats.Latency
+	}
+	return total
+}
+
+// TokenUsage counts the tokens of a run, see AgentResult.Usage.
+type TokenUsage struct {
+	InputTokens     int `json:"input_tokens"`
+	OutputTokens    int `json:"output_tokens"`
+	TotalTokens     int `json:"total_tokens"`
+	CachedTokens    int `json:"cached_tokens"`    // part of InputTokens, read from the provider's prompt cache
+	ReasoningTokens int `json:"reasoning_tokens"` // part of OutputTokens
+}
+
+// Usage adds up the tokens of every round trip of the run, tool loop included, to meter what it
+// consumed. Round trips answered from the response cache (see WithCache) consumed nothing.
+func (result *AgentResult) Usage() TokenUsage {
+	var usage TokenUsage
+	for _, stats := range result.RoundTrips {
+		if stats.Cached {
+			continue
+		}
+		usage.InputTokens += stats.InputTokens
+		usage.OutputTokens += stats.OutputTokens
+		usage.CachedTokens += stats.CachedTokens
+		usage.ReasoningTokens += stats.ReasoningTokens
+	}
+	usage.TotalTokens = usage.InputTokens + usage.OutputTokens
+	return usage
+}
+
+// TokensPerSecond is the output throughput over the run's uncached round trips, 0 when unknown.
+func (result *AgentResult) TokensPerSecond() float64 {
+	var tokens int
+	var latency time.Duration
+	for _, stats := range result.RoundTrips {
+		if stats.Cached {
+			continue
+		}
+		tokens += stats.OutputTokens
+		latency += stats.Latency
+	}
+	if latency <= 0 {
+		return 0
+	}
+	return float64(tokens) / latency.Seconds()
+}
@@ -1,10 +1,125 @@
 package provider
 
+import (
+	"fmt"
+	"strings"
+)
+
 var AvailableModels = map[string]bool{
-	"openai:gpt-4o":                      true,
-	"openai:gpt-4o-mini":                 true,
-	"openai:o1-mini":                     true,
-	"anthropic:claude-3-5-sonnet-latest": true,
-	"anthropic:claude-3-7-sonnet-latest": true,
-	"groq:llama-3.3-70b-versatile":       true,
+	"openai:gpt-4o":                                     true,
+	"openai:gpt-4o-mini":                                true,
+	"openai:o1-mini":                                    true,
+	"anthropic:claude-3-5-sonnet-latest":                true,
+	"anthropic:claude-3-7-sonnet-latest":                true,
+	"groq:llama-3.3-70b-versatile":                      true,
+	"groq:llama-3.2-11b-vision-preview":                 true,
+	"groq:llama-3.2-90b-vision-preview":                 true,
+	"groq:meta-llama/llama-4-scout-17b-16e-instruct":    true,
+	"bedrock:anthropic.claude-3-5-sonnet-20241022-v2:0": true,
+	"bedrock:anthropic.claude-3-7-sonnet-20250219-v1:0": true,
+	"deepseek:deepseek-chat":                            true,
+	"deepseek:deepseek-reasoner":                        true,
+}
+
+// RegisterModel makes a model, e.g. a fine-tuned one, available to NewAgent under a name
+// like "openai:ft:gpt-4o-mini-2024-07-18:acme::abc123". Register models before creating agents concurrently.
+func RegisterModel(modelName string) {
+	AvailableModels[modelName] = true
+}
+
+// keylessProviders need no api key: ollama runs models locally, bedrock signs requests with AWS credentials
+// and custom servers often go without authentication.
+var keylessProviders = map[string]bool{"ollama": true, "bedrock": true, "custom": true}
+
+// ModelAvailable reports whether NewAgent accepts modelName: models in AvailableModels,
+// any model of Ollama, which serves whatever was pulled into it, and any model of OpenRouter and custom servers.
+func ModelAvailable(modelName string) bool {
+	for _, prefix := range []string{"ollama:", "openrouter:", "custom:"} {
+		if strings.HasPrefix(modelName, prefix) {
+			return true
+		}
+	}
+	return AvailableModels[modelName]
+}
+
+// ModelCapabilities describes what a model accepts.
+type ModelCapabilities struct {
+	Tools  bool
+	Vision bool // image inputs
+}
+
+// Capabilities lists what the available models support. Agents on models missing from it,
+// like registered fine-tunes, are not checked.
+var Capabilities = map[string]ModelCapabilities{
+	"openai:gpt-4o":                                     {Tools: true, Vision: true},
+	"openai:gpt-4o-mini":                                {Tools: true, Vision: true},
+	"openai:o1-mini":                                    {},
+	"anthropic:claude-3-5-sonnet-latest":                {Tools: true, Vision: true},
+	"anthropic:claude-3-7-sonnet-latest":                {Tools: true, Vision: true},
+	"groq:llama-3.3-70b-versatile":                      {Tools: true},
+	"groq:llama-3.2-11b-vision-preview":                 {Tools: true, Vision: true},
+	"groq:llama-3.2-90b-vision-preview":                 {Tools: true, Vision: true},
+	"groq:meta-llama/llama-4-scout-17b-16e-instruct":    {Tools: true, Vision: true},
+	"bedrock:anthropic.claude-3-5-sonnet-20241022-v2:0": {Tools: true, Vision: true},
+	"bedrock:anthropic.claude-3-7-sonnet-20250219-v1:0": {Tools: true, Vision: true},
+	"deepseek:deepseek-chat":                            {Tools: true},
+	"deepseek:deepseek-reasoner":                        {},
+}
+
+// CapabilityError is returned when an agent needs something its model does not support,
+// before any request is sent.
+type CapabilityError struct {
+	Model      string
+	Capability string // "tools" or "vision"
+}
+
+func (e *CapabilityError) Error() string {
+	return fmt.Sprintf("model %s does not support %s", e.Model, e.Capability)
+}
+
+// WithCapabilityWarnings logs capability mismatches instead of failing with a CapabilityError,
+// e.g. when the Capabilities entry of a model is out of date.
+func WithCapabilityWarnings() AgentOption {
+	return func(a *AgentConfig) {
+		a.CapabilityWarnings = true
+	}
+}
+
+// checkCapabilities verifies that model supports the registered tools and the images of messageHistory.
+func (config *AgentConfig) checkCapabilities(model string, messageHistory [][]Message) error {
+	if len(config.ToolStore.functions) > 0 {
+		if err := config.requireCapability(model, "tools"); err != nil {
+			return err
+		}
+	}
+	if len(messageHistory) > 0 {
+		for _, msg := range messageHistory[0] {
+			if len(msg.Images) > 0 {
+				return config.requireCapability(model, "vision")
+			}
+		}
+	}
+	return nil
+}
+
+// requireCapability fails, or warns with WithCapabilityWarnings, when model is known to lack capability.
+func (config *AgentConfig) requireCapability(model string, capability string) error {
+	name := config.provider + ":" + model
+	capabilities, known := Capabilities[name]
+	if !known {
+		return nil
+	}
+	supported := capabilities.Tools
+	if capability == "vision" {
+		supported = capabilities.Vision
+	}
+	if supported {
+		return nil
+	}
+	err := &CapabilityError{Model: name, Capability: capability}
+	if config.CapabilityWarnings {
+		config.logf("%v\n", err)
+		return nil
+	}
+	return err
 }
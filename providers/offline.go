@@ -0,0 +1,89 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+)
+
+// CannedResponse answers prompts matching a regular expression while offline.
+type CannedResponse struct {
+	Match string // regular expression matched against the prompt, empty matches every prompt
+	Text  string
+}
+
+// OfflineMode answers runs when the provider can't be used, see WithOffline.
+type OfflineMode struct {
+	Responses []CannedResponse
+	Local     Agent // asked when no canned response matches, e.g. a model on a local server
+}
+
+// errNoApiKey is returned by post when an offline agent was created without an api key.
+var errNoApiKey = fmt.Errorf("%w: no api key configured", ErrAuth)
+
+// WithOffline lets the agent work without network or api keys, for demos and air-gapped tests.
+// When no api key is configured or the provider is unreachable, runs are answered by the first
+// matching canned response, or by local when none matches. local may be nil.
+func WithOffline(responses []CannedResponse, local Agent) AgentOption {
+	return func(a *AgentConfig) {
+		a.Offline = &OfflineMode{Responses: responses, Local: local}
+	}
+}
+
+// offlineFallback reports whether a failed request should be answered offline.
+func (config *AgentConfig) offlineFallback(err error) bool {
+	if config.Offline == nil {
+		return false
+	}
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	return errors.Is(err, errNoApiKey) || errors.As(err, &opErr) || errors.As(err, &dnsErr)
+}
+
+func (config *AgentConfig) answerOffline(ctx context.Context, prompt string, messageHistory [][]Message) (*AgentResult, error) {
+	var msgHistory []Message
+	if len(messageHistory) > 0 {
+		msgHistory = messageHistory[0]
+	}
+	text := lastUserText(prompt, msgHistory)
+	for _, canned := range config.Offline.Responses {
+		matched, err := regexp.MatchString(canned.Match, text)
+		if err != nil {
+			return nil, fmt.Errorf("offline: invalid match %q: %w", canned.Match, err)
+		}
+		if !matched {
+			continue
+		}
+		config.logf("Offline, answering from canned responses\n")
+		var newMessages []Message
+		if prompt != "" {
+			newMessages = append(newMessages, Message{Role: "user", Text: prompt})
+		}
+		newMessages = append(newMessages, Message{Role: "assistant", Text: canned.Text})
+		return &AgentResult{
+			AllMessages: append(msgHistory, newMessages...),
+			NewMessages: newMessages,
+			Text:        canned.Text,
+		}, nil
+	}
+	if config.Offline.Local != nil {
+		config.logf("Offline, asking the local agent\n")
+		return config.Offline.Local.RunContext(ctx, prompt, messageHistory...)
+	}
+	return nil, fmt.Errorf("offline: no canned response matches %q", text)
+}
+
+// lastUserText is the prompt, or the latest user message when a tool loop continues without one.
+func lastUserText(prompt string, history []Message) string {
+	if prompt != "" {
+		return prompt
+	}
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Role == "user" && history[i].ToolResult == nil {
+			return history[i].Text
+		}
+	}
+	return ""
+}
@@ -0,0 +1,448 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// DefaultOllamaHost is where agents find the Ollama server when neither WithOllamaHost nor OLLAMA_HOST say otherwise.
+const DefaultOllamaHost = "http://localhost:11434"
+
+// Ollama runs agents on models served by a local Ollama server. Any model pulled into the server
+// can be used, e.g. NewAgent("ollama:llama3.2"); no api key is needed.
+type Ollama struct {
+	AgentConfig
+	Tools []OllamaTool
+}
+
+// WithOllamaHost sets the address of the Ollama server, e.g. "http://gpu-box:11434".
+func WithOllamaHost(host string) AgentOption {
+	return func(a *AgentConfig) {
+		a.BaseURL = host
+	}
+}
+
+// ollamaEndpoint returns the chat endpoint of the configured server.
+func (provider Ollama) ollamaEndpoint() string {
+	host := provider.BaseURL
+	if host == "" {
+		host = os.Getenv("OLLAMA_HOST")
+	}
+	if host == "" {
+		host = DefaultOllamaHost
+	}
+	if !strings.Contains(host, "://") {
+		host = "http://" + host
+	}
+	return strings.TrimSuffix(host, "/") + "/api/chat"
+}
+
+type OllamaMessage struct {
+	Role      string           `json:"role"` // system | user | assistant | tool
+	Content   string           `json:"content"`
+	Images    []string         `json:"images,omitempty"` // base64 encoded
+	ToolCalls []OllamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"` // of tool messages
+}
+
+type OllamaToolCall struct {
+	Function OllamaFunctionCall `json:"function"`
+}
+
+type OllamaFunctionCall struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"` // an object, not a string
+}
+
+type OllamaRequest struct {
+	Model    string          `json:"model"`
+	Messages []OllamaMessage `json:"messages"`
+	Tools    []OllamaTool    `json:"tools,omitempty"`
+	Stream   bool            `json:"stream"` // Ollama streams unless told otherwise
+	Options  *OllamaOptions  `json:"options,omitempty"`
+	Format   json.RawMessage `json:"format,omitempty"` // "json" or a JSON schema
+}
+
+type OllamaOptions struct {
+	Temperature float32  `json:"temperature,omitempty"`
+	NumPredict  int      `json:"num_predict,omitempty"` // max tokens
+	Stop        []string `json:"stop,omitempty"`
+}
+
+type OllamaTool struct {
+	Type     string         `json:"type"` // type = "function"
+	Function OllamaFunction `json:"function"`
+}
+
+type OllamaFunction struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Parameters  Parameters `json:"parameters"`
+}
+
+type OllamaResponse struct {
+	Model           string        `json:"model"`
+	Message         OllamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	DoneReason      string        `json:"done_reason"` // stop | length
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+	// in nanoseconds
+	TotalDuration      int64           `json:"total_duration"`
+	LoadDuration       int64           `json:"load_duration"`
+	PromptEvalDuration int64           `json:"prompt_eval_duration"`
+	EvalDuration       int64           `json:"eval_duration"`
+	Error              string          `json:"error"` // in streams
+	Raw                json.RawMessage `json:"-"`     // the response as received
+}
+
+func (response *OllamaResponse) UnmarshalJSON(data []byte) error {
+	type ollamaResponse OllamaResponse
+	if err := json.Unmarshal(data, (*ollamaResponse)(response)); err != nil {
+		return err
+	}
+	response.Raw = append(json.RawMessage(nil), data...)
+	return nil
+}
+
+func parseOllamaError(apiErr *APIError, body []byte) {
+	var response struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &response); err == nil {
+		apiErr.Message = response.Error
+	}
+}
+
+func (provider Ollama) FormatMessages(messages []Message) ([]OllamaMessage, error) {
+	ollamaMessages := make([]OllamaMessage, 0, len(messages))
+	toolNames := make(map[string]string) // tool call id -> tool name, as tool messages name their tool
+
+	for _, msg := range messages {
+		if msg.local() {
+			continue
+		}
+		var ollamaMsg OllamaMessage
+
+		if msg.ToolIntent != nil {
+			ollamaMsg.Role = "assistant"
+			arguments := msg.ToolIntent.Arguments
+			if arguments == "" {
+				arguments = "{}"
+			}
+			ollamaMsg.ToolCalls = []OllamaToolCall{{Function: OllamaFunctionCall{
+				Name:      msg.ToolIntent.Name,
+				Arguments: json.RawMessage(arguments),
+			}}}
+			toolNames[msg.ToolIntent.Id] = msg.ToolIntent.Name
+		} else if msg.ToolResult != nil {
+			ollamaMsg.Role = "tool"
+			ollamaMsg.ToolName = toolNames[msg.ToolResult.Id]
+			ollamaMsg.Content = msg.ToolResult.Output
+		} else {
+			ollamaMsg.Role = msg.Role
+			if ollamaMsg.Role == "developer" {
+				ollamaMsg.Role = "system"
+			}
+			ollamaMsg.Content = msg.Text
+			for _, image := range msg.Images {
+				if image.Data == "" {
+					return nil, fmt.Errorf("ollama only accepts images given as data, not by url")
+				}
+				ollamaMsg.Images = append(ollamaMsg.Images, image.Data)
+			}
+		}
+		ollamaMessages = append(ollamaMessages, ollamaMsg)
+	}
+	return ollamaMessages, nil
+}
+
+func (provider Ollama) Run(prompt string, messageHistory ...[]Message) (*AgentResult, error) {
+	return provider.RunContext(context.Background(), prompt, messageHistory...)
+}
+
+// RunStream runs prompt like RunContext, streaming the response: the returned channel carries
+// the pieces of the answer as they are generated and closes with a StreamDone event holding the result.
+func (provider Ollama) RunStream(ctx context.Context, prompt string, messageHistory ...[]Message) <-chan StreamEvent {
+	return runStream(ctx, &provider.AgentConfig, func(ctx context.Context) (*AgentResult, error) {
+		return provider.RunContext(ctx, prompt, messageHistory...)
+	})
+}
+
+// RunContext is Run with a context that bounds the provider requests and is passed to tool policies.
+func (provider Ollama) RunContext(ctx context.Context, prompt string, messageHistory ...[]Message) (*AgentResult, error) {
+
+	provider.logf("Provider ollama called\n")
+	ctx, endRun, err := provider.beginRun(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer endRun()
+	ctx, err = provider.beginBudget(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ctx, checkpointed := provider.beginCheckpoint(ctx)
+	ctx, logged := provider.beginConversationLog(ctx)
+	ctx, guarded := provider.beginGuardrails(ctx)
+	messageHistory = ownHistory(messageHistory)
+	cached, promptEmbedding := provider.semanticLookup(ctx, "ollama", prompt, messageHistory)
+	if cached != nil {
+		if checkpointed {
+			provider.completeCheckpoint(ctx, cached)
+		}
+		if logged {
+			provider.logConversation(ctx, cached)
+		}
+		return cached, nil
+	}
+
+	var ollamaMessages []OllamaMessage
+	if provider.SystemPrompt != "" {
+		ollamaMessages = append(ollamaMessages, OllamaMessage{Role: "system", Content: provider.SystemPrompt})
+	}
+	if len(messageHistory) > 0 {
+		formatted, err := provider.FormatMessages(messageHistory[0])
+		if err != nil {
+			return nil, err
+		}
+		ollamaMessages = append(ollamaMessages, formatted...)
+	}
+	if prompt != "" {
+		ollamaMessages = append(ollamaMessages, OllamaMessage{Role: "user", Content: prompt})
+	}
+
+	model, route := provider.routeModel(ctx, prompt, messageHistory)
+	reqBody := OllamaRequest{
+		Model:    model,
+		Messages: ollamaMessages,
+	}
+	if provider.Temperature != 0 || provider.MaxTokens > 0 || len(provider.StopSequences) > 0 {
+		reqBody.Options = &OllamaOptions{Temperature: provider.Temperature, NumPredict: provider.MaxTokens, Stop: provider.StopSequences}
+	}
+
+	var tools []OllamaTool
+	for _, fnName := range provider.exposedTools(prompt, messageHistory) {
+		properties, required := schemaFor(provider.ToolStore.paramTypes[fnName])
+		tools = append(tools, OllamaTool{
+			Type: "function",
+			Function: OllamaFunction{
+				Name:        fnName,
+				Description: provider.ToolStore.descriptions[fnName],
+				Parameters: Parameters{
+					Type:       "object",
+					Required:   required,
+					Properties: properties,
+				},
+			},
+		})
+	}
+	reqBody.Tools = tools
+	if format := provider.responseFormat(ctx); format != nil {
+		reqBody.Format = format.ollamaFormat()
+	}
+	reqBody.Stream = provider.Stream != nil
+	if err := provider.checkCapabilities(reqBody.Model, messageHistory); err != nil {
+		return nil, err
+	}
+	endpoint := provider.ollamaEndpoint()
+	if provider.DryRun {
+		return provider.dryRunResult("ollama", endpoint, reqBody, prompt, messageHistory)
+	}
+
+	headers := map[string]string{
+		"Content-Type": "application/json",
+	}
+	if provider.ApiKey != "" {
+		// for servers behind an authenticating proxy
+		headers["Authorization"] = "Bearer " + provider.ApiKey
+	}
+	var response OllamaResponse
+	var meta responseMeta
+	if reqBody.Stream {
+		meta, err = provider.stream(ctx, endpoint, headers, reqBody, &response)
+	} else {
+		meta, err = provider.post(ctx, "ollama", endpoint, headers, reqBody, &response)
+	}
+	if err != nil {
+		provider.observeFailedRoundTrip("ollama", reqBody.Model, route, meta, err)
+		if ctx, trimmed, retry := provider.recoverContext(ctx, err, messageHistory); retry {
+			return provider.RunContext(ctx, prompt, trimmed)
+		}
+		if provider.offlineFallback(err) {
+			return provider.answerOffline(ctx, prompt, messageHistory)
+		}
+		return nil, err
+	}
+
+	var msgHistory []Message
+	var newMessages []Message
+	var finalText string
+	var toolIntent ToolIntent
+	var requestIDs []string
+	if meta.RequestID != "" {
+		requestIDs = append(requestIDs, meta.RequestID)
+	}
+	roundTrips := []RoundTripStats{provider.observeRoundTrip("ollama", reqBody.Model, route, meta, response.PromptEvalCount, response.EvalCount, 0, 0)}
+	extensions := response.extensions()
+	finishReason := response.finishReason()
+
+	if len(messageHistory) > 0 {
+		msgHistory = messageHistory[0]
+	}
+	if prompt != "" {
+		newMessages = append(newMessages, Message{Role: "user", Text: prompt})
+	}
+	incomplete := response.DoneReason == "length" || response.DoneReason == stopInterrupted
+	msg := response.Message
+	if msg.Content != "" {
+		newMessages = append(newMessages, Message{Role: "assistant", Text: msg.Content})
+		finalText = msg.Content
+	}
+	if len(msg.ToolCalls) > 0 && !incomplete {
+		toolCall := msg.ToolCalls[0]
+		// Ollama does not identify tool calls, the position in the conversation does
+		toolIntent = ToolIntent{
+			Id:        provider.toolCallID(fmt.Sprintf("call_%d", len(msgHistory)+len(newMessages))),
+			Name:      toolCall.Function.Name,
+			Arguments: string(toolCall.Function.Arguments),
+		}
+		newMessages = append(newMessages, Message{
+			Type:       "tool_intent",
+			ToolIntent: &toolIntent,
+		})
+	} else if msg.Content == "" && !incomplete {
+		unknown, err := provider.unknownItem("ollama", "empty message", response.Raw)
+		if err != nil {
+			return partialResult(msgHistory, newMessages, toolIntent, requestIDs, roundTrips, nil), err
+		}
+		newMessages = append(newMessages, unknown)
+	}
+	if incomplete {
+		markIncomplete(newMessages)
+	}
+
+	overBudget := provider.spend(ctx, roundTrips[0])
+	provider.checkpoint(ctx, msgHistory, newMessages, toolIntent, &roundTrips[0])
+	if toolIntent.Id != "" {
+		if overBudget != nil {
+			return partialResult(msgHistory, newMessages, toolIntent, requestIDs, roundTrips, nil), overBudget
+		}
+		toolResult, err := provider.executeTool(ctx, append(msgHistory, newMessages...), toolIntent)
+		if err != nil {
+			return partialResult(msgHistory, newMessages, toolIntent, requestIDs, roundTrips, nil), err
+		}
+		newMessages = append(newMessages, Message{ToolResult: toolResult})
+		provider.checkpoint(ctx, msgHistory, newMessages, ToolIntent{}, nil)
+		internalAgentResult, err := provider.RunContext(ctx, "", append(msgHistory, newMessages...))
+		if err != nil {
+			return partialResult(msgHistory, newMessages, toolIntent, requestIDs, roundTrips, internalAgentResult), err
+		}
+		newMessages = append(newMessages, internalAgentResult.NewMessages...)
+		requestIDs = append(requestIDs, internalAgentResult.RequestIDs...)
+		roundTrips = append(roundTrips, internalAgentResult.RoundTrips...)
+		incomplete = internalAgentResult.Incomplete
+		extensions = internalAgentResult.Extensions
+		finishReason = internalAgentResult.FinishReason
+	}
+
+	result := &AgentResult{
+		AllMessages:   append(msgHistory, newMessages...),
+		NewMessages:   newMessages,
+		Text:          finalText,
+		ToolIntent:    &toolIntent,
+		ToolArguments: toolIntent.Arguments,
+		RequestIDs:    requestIDs,
+		RoundTrips:    roundTrips,
+		Incomplete:    incomplete,
+		Extensions:    extensions,
+		FinishReason:  finishReason,
+	}
+	if guarded {
+		var err error
+		result, err = provider.enforceOutput(ctx, result, func(ctx context.Context, history []Message) (*AgentResult, error) {
+			return provider.RunContext(ctx, "", history)
+		})
+		if err != nil {
+			return result, err
+		}
+	}
+	if checkpointed {
+		provider.completeCheckpoint(ctx, result)
+	}
+	if logged {
+		provider.logConversation(ctx, result)
+	}
+	provider.semanticStore(ctx, "ollama", promptEmbedding, result)
+	return result, nil
+}
+
+// stream sends reqBody as a streamed request and assembles the chunks, one JSON object per line,
+// into response. A stalled stream is sent again from scratch.
+func (provider Ollama) stream(ctx context.Context, endpoint string, headers map[string]string, reqBody OllamaRequest, response *OllamaResponse) (responseMeta, error) {
+	emitter := provider.newStreamEmitter()
+	defer emitter.close(ctx)
+	for attempt := 0; ; attempt++ {
+		*response = OllamaResponse{Message: OllamaMessage{Role: "assistant"}}
+		var content strings.Builder
+		meta, err := provider.postStream(ctx, "ollama", endpoint, headers, reqBody, func(sse serverEvent) error {
+			var chunk OllamaResponse
+			if err := json.Unmarshal(sse.Data, &chunk); err != nil {
+				return err
+			}
+			if chunk.Error != "" {
+				return classifyStreamError(&APIError{Provider: "ollama", Message: chunk.Error, Body: sse.Data})
+			}
+			if chunk.Message.Content != "" {
+				content.WriteString(chunk.Message.Content)
+				emitter.emit(StreamEvent{Type: StreamText, Text: chunk.Message.Content})
+			}
+			for _, call := range chunk.Message.ToolCalls {
+				// tool calls arrive whole
+				intent := &ToolIntent{Name: call.Function.Name, Arguments: string(call.Function.Arguments)}
+				emitter.emit(StreamEvent{Type: StreamToolCallStart, ToolCall: &ToolIntent{Name: intent.Name}})
+				emitter.emit(StreamEvent{Type: StreamToolCallDelta, ToolCall: intent})
+				response.Message.ToolCalls = append(response.Message.ToolCalls, call)
+			}
+			if chunk.Done {
+				response.Model = chunk.Model
+				response.Done = true
+				response.DoneReason = chunk.DoneReason
+				response.PromptEvalCount = chunk.PromptEvalCount
+				response.EvalCount = chunk.EvalCount
+				response.TotalDuration, response.LoadDuration = chunk.TotalDuration, chunk.LoadDuration
+				response.PromptEvalDuration, response.EvalDuration = chunk.PromptEvalDuration, chunk.EvalDuration
+			}
+			return nil
+		})
+		response.Message.Content = content.String()
+		if errors.Is(err, ErrInterrupted) {
+			response.DoneReason = stopInterrupted
+			response.Message.ToolCalls = nil
+			err = nil
+		} else if err == nil && !response.Done {
+			err = errStreamIncomplete
+		}
+		if errors.Is(err, ErrStreamStalled) && attempt < maxStallRetries {
+			provider.logf("Stream stalled, requesting it again\n")
+			emitter.restart()
+			continue
+		}
+		if err != nil {
+			return meta, err
+		}
+		return emitter.finish(meta), nil
+	}
+}
+
+func (provider *Ollama) RegisterTool(fn any, paramType any, desctiption string) error {
+	return provider.AgentConfig.RegisterTool(fn, paramType, desctiption)
+}
+
+func (provider *Ollama) AddTool(tool Tool) error {
+	return provider.AgentConfig.AddTool(tool)
+}
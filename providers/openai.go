@@ -1,13 +1,11 @@
 package provider
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"log"
-	"net/http"
-	"reflect"
+	"strings"
 )
 
 const OpenaiEndpoint = "https://api.openai.com/v1/responses"
@@ -37,16 +35,20 @@ type OpenaiTool struct {
 }
 
 type OpenaiRequest struct {
-	Model           string          `json:"model"`
-	Input           []OpenaiMessage `json:"input"`
-	ReasoningEffort string          `json:"reasoning_effort,omitempty"`
-	Temperature     float32         `json:"temperature,omitempty"`
-	Tools           []OpenaiTool    `json:"tools,omitempty"`
+	Model           string            `json:"model"`
+	Input           []OpenaiMessage   `json:"input"`
+	ReasoningEffort string            `json:"reasoning_effort,omitempty"`
+	Temperature     float32           `json:"temperature,omitempty"`
+	Tools           []OpenaiTool      `json:"tools,omitempty"`
+	Stream          bool              `json:"stream,omitempty"`
+	Text            *OpenaiTextFormat `json:"text,omitempty"`
+	MaxOutputTokens int               `json:"max_output_tokens,omitempty"`
 }
 
 type OpenaiContent struct {
-	Type string `json:"type,omitempty"`
-	Text string `json:"text,omitempty"`
+	Type    string `json:"type,omitempty"` // output_text | refusal
+	Text    string `json:"text,omitempty"`
+	Refusal string `json:"refusal,omitempty"`
 }
 
 type OpenaiOutputItem struct {
@@ -58,15 +60,34 @@ type OpenaiOutputItem struct {
 	CallId    string          `json:"call_id,omitempty"`   // tool use
 	Name      string          `json:"name,omitempty"`      // tool use
 	Arguments string          `json:"arguments,omitempty"` // tool use
+	Result    string          `json:"result,omitempty"`    // image generation, base64 encoded
+	Format    string          `json:"output_format,omitempty"`
+	Raw       json.RawMessage `json:"-"` // the item as received
 }
+
+func (item *OpenaiOutputItem) UnmarshalJSON(data []byte) error {
+	type openaiOutputItem OpenaiOutputItem
+	if err := json.Unmarshal(data, (*openaiOutputItem)(item)); err != nil {
+		return err
+	}
+	item.Raw = append(json.RawMessage(nil), data...)
+	return nil
+}
+
 type PromptTokensDetails struct {
 	CachedTokens int `json:"cached_tokens"`
 }
 type OpenaiUsage struct {
+	InputTokens         int                 `json:"input_tokens"`  // responses api
+	OutputTokens        int                 `json:"output_tokens"` // responses api
 	PromptTokens        int                 `json:"prompt_tokens"`
 	CompletionTokens    int                 `json:"completion_tokens"`
 	TotalTokens         int                 `json:"total_tokens"`
 	PromptTokensDetails PromptTokensDetails `json:"prompt_tokens_details"`
+	InputTokensDetails  PromptTokensDetails `json:"input_tokens_details"` // responses api
+	OutputTokensDetails struct {
+		ReasoningTokens int `json:"reasoning_tokens"`
+	} `json:"output_tokens_details"` // responses api
 }
 
 type OpenaiResponse struct {
@@ -78,12 +99,44 @@ type OpenaiResponse struct {
 	Model       string             `json:"model"`
 	Output      []OpenaiOutputItem `json:"output"`
 	Usage       OpenaiUsage        `json:"usage"`
+	ServiceTier string             `json:"service_tier"`
+	// why the response is incomplete, e.g. max_output_tokens or content_filter
+	IncompleteDetails *struct {
+		Reason string `json:"reason"`
+	} `json:"incomplete_details"`
+}
+
+type OpenaiErrorResponse struct {
+	Error struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+		Param   any    `json:"param"`
+		Code    any    `json:"code"` // string, occasionally a number
+	} `json:"error"`
+}
+
+func parseOpenaiError(apiErr *APIError, body []byte) {
+	var response OpenaiErrorResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return
+	}
+	apiErr.Message = response.Error.Message
+	apiErr.Type = response.Error.Type
+	if response.Error.Param != nil {
+		apiErr.Param = fmt.Sprintf("%v", response.Error.Param)
+	}
+	if response.Error.Code != nil {
+		apiErr.Code = fmt.Sprintf("%v", response.Error.Code)
+	}
 }
 
 func (provider Openai) FormatMessages(messages []Message) []OpenaiMessage {
-	var openaiMessages []OpenaiMessage
+	openaiMessages := make([]OpenaiMessage, 0, len(messages))
 
 	for _, msg := range messages {
+		if msg.local() {
+			continue
+		}
 		var openaiMsg OpenaiMessage
 
 		if msg.ToolIntent != nil {
@@ -98,17 +151,69 @@ func (provider Openai) FormatMessages(messages []Message) []OpenaiMessage {
 			openaiMsg.CallId = msg.ToolResult.Id
 			openaiMsg.Output = msg.ToolResult.Output
 
+		} else if msg.Incomplete {
+			openaiMsg.Role = "assistant"
+			openaiMsg.Content = msg.Text
 		} else {
 			openaiMsg.Role = "user"
 			openaiMsg.Content = msg.Text
 		}
 		openaiMessages = append(openaiMessages, openaiMsg)
 	}
+	if last := len(messages) - 1; last >= 0 && messages[last].Incomplete {
+		// assistant messages cannot be resumed, ask for the rest instead (see Continue)
+		openaiMessages = append(openaiMessages, OpenaiMessage{Role: "user", Content: continueInstruction})
+	}
 	return openaiMessages
 }
 
 func (provider Openai) Run(prompt string, messageHistory ...[]Message) (*AgentResult, error) {
-	log.Println("Provider openai called")
+	return provider.RunContext(context.Background(), prompt, messageHistory...)
+}
+
+// RunStream runs prompt like RunContext, streaming the response: the returned channel carries
+// the pieces of the answer as they are generated and closes with a StreamDone event holding the result.
+func (provider Openai) RunStream(ctx context.Context, prompt string, messageHistory ...[]Message) <-chan StreamEvent {
+	return runStream(ctx, &provider.AgentConfig, func(ctx context.Context) (*AgentResult, error) {
+		return provider.RunContext(ctx, prompt, messageHistory...)
+	})
+}
+
+// usesChatCompletions reports whether an OpenAI agent needs what only the chat completions api offers.
+func (provider Openai) usesChatCompletions() bool {
+	return provider.Prediction != "" || len(provider.LogitBias) > 0 || len(provider.StopSequences) > 0
+}
+
+// RunContext is Run with a context that bounds the provider requests and is passed to tool policies.
+func (provider Openai) RunContext(ctx context.Context, prompt string, messageHistory ...[]Message) (*AgentResult, error) {
+	if provider.usesChatCompletions() {
+		// predicted outputs, logit bias and stop sequences are only offered by the chat completions api
+		return Groq{provider.AgentConfig, nil}.RunContext(ctx, prompt, messageHistory...)
+	}
+	provider.logf("Provider openai called\n")
+	ctx, endRun, err := provider.beginRun(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer endRun()
+	ctx, err = provider.beginBudget(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ctx, checkpointed := provider.beginCheckpoint(ctx)
+	ctx, logged := provider.beginConversationLog(ctx)
+	ctx, guarded := provider.beginGuardrails(ctx)
+	messageHistory = ownHistory(messageHistory)
+	cached, promptEmbedding := provider.semanticLookup(ctx, "openai", prompt, messageHistory)
+	if cached != nil {
+		if checkpointed {
+			provider.completeCheckpoint(ctx, cached)
+		}
+		if logged {
+			provider.logConversation(ctx, cached)
+		}
+		return cached, nil
+	}
 	apiKey := provider.ApiKey
 
 	var requestInput []OpenaiMessage
@@ -131,8 +236,9 @@ func (provider Openai) Run(prompt string, messageHistory ...[]Message) (*AgentRe
 		requestInput = append(requestInput, systemPrompt)
 	}
 
+	model, route := provider.routeModel(ctx, prompt, messageHistory)
 	reqBody := OpenaiRequest{
-		Model: provider.ModelName,
+		Model: model,
 		Input: requestInput,
 	}
 	if provider.ReasoningEffort != "" {
@@ -141,12 +247,13 @@ func (provider Openai) Run(prompt string, messageHistory ...[]Message) (*AgentRe
 	if provider.Temperature != 0 {
 		reqBody.Temperature = provider.Temperature
 	}
+	reqBody.MaxOutputTokens = provider.MaxTokens
 
 	var tools []OpenaiTool
 	if len(provider.ToolStore.functions) > 0 {
-		for fn, _ := range provider.ToolStore.functions {
+		for _, fn := range provider.exposedTools(prompt, messageHistory) {
 			fnName := fn
-			properties, required := ConvertToProperties(reflect.New(provider.ToolStore.paramTypes[fnName]).Interface())
+			properties, required := schemaFor(provider.ToolStore.paramTypes[fnName])
 			tool := OpenaiTool{
 				Type:        "function",
 				Name:        fnName,
@@ -157,46 +264,46 @@ func (provider Openai) Run(prompt string, messageHistory ...[]Message) (*AgentRe
 					Properties:           properties,
 					AdditionalProperties: false,
 				},
-				Strict: true,
+				Strict: strictSchema(properties, required),
 			}
 			tools = append(tools, tool)
 		}
 		reqBody.Tools = tools
 	}
-
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return nil, err
+	if provider.ImageGeneration {
+		reqBody.Tools = append(reqBody.Tools, OpenaiTool{Type: "image_generation"})
 	}
-
-	// Create HTTP request
-	req, err := http.NewRequest("POST", OpenaiEndpoint, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return nil, err
+	if format := provider.responseFormat(ctx); format != nil {
+		reqBody.Text = format.openaiText()
 	}
+	reqBody.Stream = provider.Stream != nil
 
-	// headers
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", apiKey))
-	req.Header.Set("Content-Type", "application/json")
-
-	// Send request
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
+	if err := provider.checkCapabilities(reqBody.Model, messageHistory); err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	// Read response
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+	if provider.DryRun {
+		return provider.dryRunResult("openai", OpenaiEndpoint, reqBody, prompt, messageHistory)
 	}
 
-	// Parse JSON response
+	headers := map[string]string{
+		"Authorization": fmt.Sprintf("Bearer %s", apiKey),
+		"Content-Type":  "application/json",
+	}
 	var response OpenaiResponse
-	err = json.Unmarshal(body, &response)
+	var meta responseMeta
+	if reqBody.Stream {
+		meta, err = provider.stream(ctx, headers, reqBody, &response)
+	} else {
+		meta, err = provider.post(ctx, "openai", OpenaiEndpoint, headers, reqBody, &response)
+	}
 	if err != nil {
+		provider.observeFailedRoundTrip("openai", reqBody.Model, route, meta, err)
+		if ctx, trimmed, retry := provider.recoverContext(ctx, err, messageHistory); retry {
+			return provider.RunContext(ctx, prompt, trimmed)
+		}
+		if provider.offlineFallback(err) {
+			return provider.answerOffline(ctx, prompt, messageHistory)
+		}
 		return nil, err
 	}
 
@@ -204,6 +311,14 @@ func (provider Openai) Run(prompt string, messageHistory ...[]Message) (*AgentRe
 	var newMessages []Message
 	var finalText string
 	var toolIntent ToolIntent
+	var requestIDs []string
+	if meta.RequestID != "" {
+		requestIDs = append(requestIDs, meta.RequestID)
+	}
+	roundTrips := []RoundTripStats{provider.observeRoundTrip("openai", reqBody.Model, route, meta, response.Usage.InputTokens, response.Usage.OutputTokens, response.Usage.OutputTokensDetails.ReasoningTokens, response.Usage.InputTokensDetails.CachedTokens)}
+	extensions := response.extensions()
+	finishReason := response.finishReason()
+	var refusal string
 
 	if len(messageHistory) > 0 {
 		msgHistory = messageHistory[0]
@@ -211,6 +326,7 @@ func (provider Openai) Run(prompt string, messageHistory ...[]Message) (*AgentRe
 	if prompt != "" {
 		newMessages = append(newMessages, Message{Role: "user", Text: prompt})
 	}
+	incomplete := response.Status == "incomplete"
 	for _, output := range response.Output {
 		switch output.Type {
 		case "message":
@@ -223,10 +339,19 @@ func (provider Openai) Run(prompt string, messageHistory ...[]Message) (*AgentRe
 					newMessages = append(newMessages, responseMessage)
 					finalText = content.Text
 				}
+				if content.Type == "refusal" {
+					// kept as an answer, so the conversation can go on
+					newMessages = append(newMessages, Message{Role: output.Role, Text: content.Refusal})
+					finalText = content.Refusal
+					refusal = content.Refusal
+				}
 			}
 		case "function_call":
+			if incomplete {
+				continue // its arguments may be cut short
+			}
 			toolIntent = ToolIntent{
-				Id:        output.CallId,
+				Id:        provider.toolCallID(output.CallId),
 				Name:      output.Name,
 				Arguments: output.Arguments,
 			}
@@ -234,34 +359,195 @@ func (provider Openai) Run(prompt string, messageHistory ...[]Message) (*AgentRe
 				Type:       "tool_intent",
 				ToolIntent: &toolIntent,
 			})
+		case "image_generation_call":
+			if output.Result == "" {
+				continue // failed or cut short
+			}
+			format := output.Format
+			if format == "" {
+				format = "png"
+			}
+			newMessages = append(newMessages, Message{
+				Role:   "assistant",
+				Images: []Image{{Data: output.Result, MediaType: "image/" + format}},
+			})
 		default:
-			return nil, fmt.Errorf("(openai.go, Run) unexpected message type")
+			unknown, err := provider.unknownItem("openai", output.Type, output.Raw)
+			if err != nil {
+				return partialResult(msgHistory, newMessages, toolIntent, requestIDs, roundTrips, nil), err
+			}
+			newMessages = append(newMessages, unknown)
 		}
 	}
+	if incomplete {
+		markIncomplete(newMessages)
+	}
 
+	overBudget := provider.spend(ctx, roundTrips[0])
+	provider.checkpoint(ctx, msgHistory, newMessages, toolIntent, &roundTrips[0])
 	if toolIntent.Id != "" {
-		toolResult, err := provider.ExecuteToolIntent(toolIntent)
+		if overBudget != nil {
+			return partialResult(msgHistory, newMessages, toolIntent, requestIDs, roundTrips, nil), overBudget
+		}
+		toolResult, err := provider.executeTool(ctx, append(msgHistory, newMessages...), toolIntent)
 		if err != nil {
-			return nil, err
+			return partialResult(msgHistory, newMessages, toolIntent, requestIDs, roundTrips, nil), err
 		}
 		newMessages = append(newMessages, Message{ToolResult: toolResult})
-		internalAgentResult, err := provider.Run("", append(msgHistory, newMessages...))
+		provider.checkpoint(ctx, msgHistory, newMessages, ToolIntent{}, nil)
+		internalAgentResult, err := provider.RunContext(ctx, "", append(msgHistory, newMessages...))
 		if err != nil {
-			return nil, err
+			return partialResult(msgHistory, newMessages, toolIntent, requestIDs, roundTrips, internalAgentResult), err
 		}
 		newMessages = append(newMessages, internalAgentResult.NewMessages...)
+		requestIDs = append(requestIDs, internalAgentResult.RequestIDs...)
+		roundTrips = append(roundTrips, internalAgentResult.RoundTrips...)
+		incomplete = internalAgentResult.Incomplete
+		extensions = internalAgentResult.Extensions
+		finishReason = internalAgentResult.FinishReason
+		refusal = internalAgentResult.Refusal
 	}
 
-	return &AgentResult{
+	result := &AgentResult{
 		AllMessages:   append(msgHistory, newMessages...),
 		NewMessages:   newMessages,
 		ToolIntent:    &toolIntent,
 		Text:          finalText,
 		ToolArguments: toolIntent.Arguments,
-	}, nil
+		RequestIDs:    requestIDs,
+		RoundTrips:    roundTrips,
+		Incomplete:    incomplete,
+		Extensions:    extensions,
+		FinishReason:  finishReason,
+		Refusal:       refusal,
+	}
+	if guarded {
+		var err error
+		result, err = provider.enforceOutput(ctx, result, func(ctx context.Context, history []Message) (*AgentResult, error) {
+			return provider.RunContext(ctx, "", history)
+		})
+		if err != nil {
+			return result, err
+		}
+	}
+	if checkpointed {
+		provider.completeCheckpoint(ctx, result)
+	}
+	if logged {
+		provider.logConversation(ctx, result)
+	}
+	provider.semanticStore(ctx, "openai", promptEmbedding, result)
+	return result, nil
+}
+
+// openaiStreamEvent is any of the events of a streamed response.
+type openaiStreamEvent struct {
+	Type     string           `json:"type"`
+	ItemId   string           `json:"item_id"`
+	Item     OpenaiOutputItem `json:"item"`     // response.output_item.added
+	Delta    string           `json:"delta"`    // response.output_text.delta, response.function_call_arguments.delta
+	Response json.RawMessage  `json:"response"` // response.completed, response.incomplete, response.failed
+	Code     any              `json:"code"`     // error
+	Message  string           `json:"message"`  // error
+	Param    any              `json:"param"`    // error
+}
+
+// stream sends reqBody as a streamed request and decodes the final response into response.
+// A stalled stream is sent again from scratch.
+func (provider Openai) stream(ctx context.Context, headers map[string]string, reqBody OpenaiRequest, response *OpenaiResponse) (responseMeta, error) {
+	emitter := provider.newStreamEmitter()
+	defer emitter.close(ctx)
+	for attempt := 0; ; attempt++ {
+		callIds := make(map[string]string) // item id to call id
+		var text strings.Builder           // kept in case the stream is interrupted
+		done := false
+		meta, err := provider.postStream(ctx, "openai", OpenaiEndpoint, headers, reqBody, func(sse serverEvent) error {
+			var event openaiStreamEvent
+			if err := json.Unmarshal(sse.Data, &event); err != nil {
+				return err
+			}
+			switch event.Type {
+			case "response.output_item.added":
+				if event.Item.Type == "function_call" {
+					callIds[event.Item.Id] = event.Item.CallId
+					emitter.emit(StreamEvent{Type: StreamToolCallStart, ToolCall: &ToolIntent{Id: event.Item.CallId, Name: event.Item.Name}})
+				}
+			case "response.output_text.delta":
+				text.WriteString(event.Delta)
+				emitter.emit(StreamEvent{Type: StreamText, Text: event.Delta})
+			case "response.function_call_arguments.delta":
+				emitter.emit(StreamEvent{Type: StreamToolCallDelta, ToolCall: &ToolIntent{Id: callIds[event.ItemId], Arguments: event.Delta}})
+			case "response.completed", "response.incomplete":
+				done = true
+				return json.Unmarshal(event.Response, response)
+			case "response.failed":
+				var failed struct {
+					Error openaiStreamEvent `json:"error"` // code and message
+				}
+				if err := json.Unmarshal(event.Response, &failed); err != nil {
+					return err
+				}
+				event = failed.Error
+				fallthrough
+			case "error":
+				apiErr := &APIError{Provider: "openai", Message: event.Message, Body: sse.Data}
+				if event.Code != nil {
+					apiErr.Code = fmt.Sprintf("%v", event.Code)
+				}
+				if event.Param != nil {
+					apiErr.Param = fmt.Sprintf("%v", event.Param)
+				}
+				return classifyStreamError(apiErr)
+			}
+			return nil
+		})
+		if errors.Is(err, ErrInterrupted) {
+			*response = OpenaiResponse{Status: "incomplete"}
+			response.IncompleteDetails = &struct {
+				Reason string `json:"reason"`
+			}{stopInterrupted}
+			if text.Len() > 0 {
+				response.Output = []OpenaiOutputItem{{Type: "message", Role: "assistant", Content: []OpenaiContent{{Type: "output_text", Text: text.String()}}}}
+			}
+			err = nil
+		} else if err == nil && !done {
+			err = errStreamIncomplete
+		}
+		if errors.Is(err, ErrStreamStalled) && attempt < maxStallRetries {
+			provider.logf("Stream stalled, requesting it again\n")
+			emitter.restart()
+			continue
+		}
+		if err != nil {
+			return meta, err
+		}
+		return emitter.finish(meta), nil
+	}
+}
+
+// WithImageGeneration lets the model generate images while answering, returned by AgentResult.Images.
+// OpenAI only.
+func WithImageGeneration() AgentOption {
+	return func(a *AgentConfig) {
+		a.ImageGeneration = true
+	}
+}
+
+// MarshalJSON sends hosted tools, like image_generation, with nothing but their type.
+func (tool OpenaiTool) MarshalJSON() ([]byte, error) {
+	type openaiTool OpenaiTool
+	if tool.Type != "function" {
+		return json.Marshal(struct {
+			Type string `json:"type"`
+		}{tool.Type})
+	}
+	return json.Marshal(openaiTool(tool))
 }
 
 func (provider *Openai) RegisterTool(fn any, paramType any, desctiption string) error {
-	provider.AgentConfig.RegisterTool(fn, paramType, desctiption)
-	return nil
+	return provider.AgentConfig.RegisterTool(fn, paramType, desctiption)
+}
+
+func (provider *Openai) AddTool(tool Tool) error {
+	return provider.AgentConfig.AddTool(tool)
 }
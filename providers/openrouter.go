@@ -0,0 +1,28 @@
+package provider
+
+// OpenRouterEndpoint is the chat completions api of OpenRouter.
+//
+// OpenRouter agents reach the models of many providers with one key, from OPENROUTER_API_KEY,
+// e.g. NewAgent("openrouter:anthropic/claude-3.5-sonnet"); any model OpenRouter lists can be used.
+// They behave like Groq agents. Extensions tell the "model" and "upstream_provider" that answered.
+const OpenRouterEndpoint = "https://openrouter.ai/api/v1/chat/completions"
+
+// OpenRouterRouting tells OpenRouter which models and upstream providers may serve a request, see WithOpenRouterRouting.
+type OpenRouterRouting struct {
+	Models            []string `json:"-"`                            // models tried in order after the agent's model fails
+	Order             []string `json:"order,omitempty"`              // providers tried first, in order, e.g. "Anthropic"
+	Only              []string `json:"only,omitempty"`               // the only providers allowed
+	Ignore            []string `json:"ignore,omitempty"`             // providers never used
+	AllowFallbacks    *bool    `json:"allow_fallbacks,omitempty"`    // providers beyond Order may be used, true when nil
+	RequireParameters bool     `json:"require_parameters,omitempty"` // only providers supporting every parameter of the request
+	DataCollection    string   `json:"data_collection,omitempty"`    // "deny" excludes providers storing prompts
+	Sort              string   `json:"sort,omitempty"`               // price | throughput | latency
+	Quantizations     []string `json:"quantizations,omitempty"`      // e.g. "fp8"
+}
+
+// WithOpenRouterRouting sets the provider preferences and fallback models of OpenRouter agents.
+func WithOpenRouterRouting(routing OpenRouterRouting) AgentOption {
+	return func(a *AgentConfig) {
+		a.OpenRouter = &routing
+	}
+}
@@ -0,0 +1,205 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Policy decides whether a tool call may execute. It is evaluated before every tool
+// execution; a denied call is not executed and the reason is returned to the model as the tool output.
+type Policy interface {
+	Allow(ctx context.Context, toolName string, arguments string) (bool, string)
+}
+
+// PolicyFunc adapts a function to the Policy interface.
+type PolicyFunc func(ctx context.Context, toolName string, arguments string) (bool, string)
+
+func (fn PolicyFunc) Allow(ctx context.Context, toolName string, arguments string) (bool, string) {
+	return fn(ctx, toolName, arguments)
+}
+
+// WithToolPolicy evaluates policy before every tool call. Multiple policies must all allow a call.
+func WithToolPolicy(policy Policy) AgentOption {
+	return func(a *AgentConfig) {
+		if a.ToolPolicy == nil {
+			a.ToolPolicy = policy
+			return
+		}
+		a.ToolPolicy = AllOf(a.ToolPolicy, policy)
+	}
+}
+
+// AllOf allows a call only when every policy allows it, reporting the first denial.
+func AllOf(policies ...Policy) Policy {
+	return PolicyFunc(func(ctx context.Context, toolName string, arguments string) (bool, string) {
+		for _, policy := range policies {
+			if allowed, reason := policy.Allow(ctx, toolName, arguments); !allowed {
+				return false, reason
+			}
+		}
+		return true, ""
+	})
+}
+
+// AllowTools allows only the named tools.
+func AllowTools(names ...string) Policy {
+	allowed := make(map[string]bool, len(names))
+	for _, name := range names {
+		allowed[name] = true
+	}
+	return PolicyFunc(func(ctx context.Context, toolName string, arguments string) (bool, string) {
+		if !allowed[toolName] {
+			return false, fmt.Sprintf("tool %s is not allowed", toolName)
+		}
+		return true, ""
+	})
+}
+
+// DenyTools denies the named tools.
+func DenyTools(names ...string) Policy {
+	denied := make(map[string]bool, len(names))
+	for _, name := range names {
+		denied[name] = true
+	}
+	return PolicyFunc(func(ctx context.Context, toolName string, arguments string) (bool, string) {
+		if denied[toolName] {
+			return false, fmt.Sprintf("tool %s is denied", toolName)
+		}
+		return true, ""
+	})
+}
+
+// ConstrainArguments checks the decoded arguments of every call to toolName with check,
+// denying the call with the returned error as reason. Other tools are not affected.
+func ConstrainArguments(toolName string, check func(arguments map[string]any) error) Policy {
+	return PolicyFunc(func(ctx context.Context, name string, arguments string) (bool, string) {
+		if name != toolName {
+			return true, ""
+		}
+		var decoded map[string]any
+		if err := json.Unmarshal([]byte(arguments), &decoded); err != nil {
+			return false, fmt.Sprintf("invalid arguments for %s: %v", toolName, err)
+		}
+		if err := check(decoded); err != nil {
+			return false, err.Error()
+		}
+		return true, ""
+	})
+}
+
+// RateLimitTool allows at most limit calls of toolName in any window of length per,
+// counted across every agent sharing the policy.
+func RateLimitTool(toolName string, limit int, per time.Duration) Policy {
+	var mu sync.Mutex
+	var calls []time.Time
+	return PolicyFunc(func(ctx context.Context, name string, arguments string) (bool, string) {
+		if name != toolName {
+			return true, ""
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		now := clockNow(ctx)
+		recent := calls[:0]
+		for _, call := range calls {
+			if now.Sub(call) < per {
+				recent = append(recent, call)
+			}
+		}
+		calls = recent
+		if len(calls) >= limit {
+			return false, fmt.Sprintf("tool %s is rate limited to %d calls per %s", toolName, limit, per)
+		}
+		calls = append(calls, now)
+		return true, ""
+	})
+}
+
+// WithToolApprover asks approver before running tools added WithApprovalRequired, e.g. a person
+// clicking a button. Unlike a tool policy it is not consulted for the other tools.
+func WithToolApprover(approver Policy) AgentOption {
+	return func(a *AgentConfig) {
+		a.ToolApprover = approver
+	}
+}
+
+// executeTool runs a tool call unless it repeats earlier calls of history too often, the tool policy
+// denies it or it awaits a confirmation or an approval that is not given.
+func (config *AgentConfig) executeTool(ctx context.Context, history []Message, toolIntent ToolIntent) (result *ToolResult, err error) {
+	start := config.now()
+	defer func() {
+		if result != nil {
+			result.Duration = config.since(start)
+		}
+	}()
+	ctx = contextWithResponseFormat(ctx, nil) // agents run by the tool answer as they are configured to
+	output, err := config.checkRepeat(history, toolIntent)
+	if err != nil {
+		return nil, err
+	}
+	if output != "" {
+		return failedToolResult(toolIntent.Id, output), nil
+	}
+	if config.ToolPolicy != nil {
+		if allowed, reason := config.ToolPolicy.Allow(context.WithValue(ctx, clockKey{}, config.Clock), toolIntent.Name, toolIntent.Arguments); !allowed {
+			config.logf("Tool %s denied: %s\n", toolIntent.Name, reason)
+			return failedToolResult(toolIntent.Id, "tool call denied: "+reason), nil
+		}
+	}
+	if toolName, isProposal := config.ToolStore.proposals[toolIntent.Name]; isProposal {
+		return config.confirm(ctx, toolIntent, toolName), nil
+	}
+	tool := config.ToolStore.tools[toolIntent.Name]
+	if tool.confirmationRequired && !config.confirmedTools(history)[tool.Name] {
+		config.logf("Tool %s called without a confirmed proposal\n", toolIntent.Name)
+		return failedToolResult(toolIntent.Id, fmt.Sprintf("tool call not confirmed: propose the action with %s first", proposalName(tool.Name))), nil
+	}
+	if tool.approvalRequired {
+		allowed, reason := false, fmt.Sprintf("tool %s requires an approval and there is no approver", toolIntent.Name)
+		if config.ToolApprover != nil {
+			allowed, reason = config.ToolApprover.Allow(ctx, toolIntent.Name, toolIntent.Arguments)
+		}
+		if !allowed {
+			config.logf("Tool %s not approved: %s\n", toolIntent.Name, reason)
+			return failedToolResult(toolIntent.Id, "tool call not approved: "+reason), nil
+		}
+	}
+	release, err := tool.acquire(ctx, config.now)
+	if err != nil {
+		return nil, err
+	}
+	if tool.timeout > 0 {
+		return config.executeWithTimeout(ctx, toolIntent, tool.timeout, release)
+	}
+	defer release()
+	return config.executeToolIntent(ctx, toolIntent)
+}
+
+// executeWithTimeout runs a tool call, telling the model when it takes longer than timeout.
+// release is called once the tool returned, which may be after the timeout.
+func (config *AgentConfig) executeWithTimeout(ctx context.Context, toolIntent ToolIntent, timeout time.Duration, release func()) (*ToolResult, error) {
+	toolCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	type outcome struct {
+		result *ToolResult
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		defer release()
+		result, err := config.executeToolIntent(toolCtx, toolIntent)
+		done <- outcome{result, err}
+	}()
+	select {
+	case out := <-done:
+		return out.result, out.err
+	case <-toolCtx.Done():
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		config.logf("Tool %s timed out after %s\n", toolIntent.Name, timeout)
+		return failedToolResult(toolIntent.Id, fmt.Sprintf("tool call timed out after %s", timeout)), nil
+	}
+}
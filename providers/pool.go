@@ -0,0 +1,160 @@
+package provider
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Tenant holds what is specific to one customer of an AgentPool.
+type Tenant struct {
+	ID      string
+	Model   string   // overrides the pool model when set
+	ApiKey  string   // overrides the pool api key when set
+	Tools   []string // subset of the pool tools; nil exposes all of them
+	Options []AgentOption
+
+	Budget    *RunBudget // limits each run, see WithBudget; nil keeps the pool's budget
+	MaxTokens int        // caps the output tokens of each response, see WithMaxTokens; 0 keeps the pool's cap
+}
+
+// TenantResolver looks up a tenant, typically from a database or config service.
+type TenantResolver func(tenantID string) (Tenant, error)
+
+// AgentPool materializes one agent per tenant, each with its own key, options and tool subset,
+// and caches them so repeated requests for a tenant reuse the same agent.
+type AgentPool struct {
+	modelName string
+	opts      []AgentOption
+	resolve   TenantResolver
+
+	mu       sync.Mutex
+	tools    map[string]ToolDefinition
+	agents   map[string]Agent
+	building map[string]*poolBuild
+}
+
+// poolBuild is a tenant agent being built, shared by the Get calls waiting for it.
+type poolBuild struct {
+	done  chan struct{}
+	agent Agent
+	err   error
+}
+
+func NewAgentPool(modelName string, resolve TenantResolver, opts ...AgentOption) *AgentPool {
+	return &AgentPool{
+		modelName: modelName,
+		opts:      opts,
+		resolve:   resolve,
+		tools:     make(map[string]ToolDefinition),
+		agents:    make(map[string]Agent),
+		building:  make(map[string]*poolBuild),
+	}
+}
+
+// AddTool makes a tool available to the pool's tenants. Agents built earlier are not affected.
+func (pool *AgentPool) AddTool(tool ToolDefinition) error {
+	name, err := getToolName(tool.Function)
+	if err != nil {
+		return err
+	}
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	pool.tools[name] = tool
+	return nil
+}
+
+// Get returns the tenant's agent, building it on first use. The tenant is resolved without
+// holding up Get calls for other tenants, and concurrent calls for the same tenant share one build.
+func (pool *AgentPool) Get(tenantID string) (Agent, error) {
+	pool.mu.Lock()
+	if agent, exists := pool.agents[tenantID]; exists {
+		pool.mu.Unlock()
+		return agent, nil
+	}
+	if build, exists := pool.building[tenantID]; exists {
+		pool.mu.Unlock()
+		<-build.done
+		return build.agent, build.err
+	}
+	build := &poolBuild{done: make(chan struct{})}
+	pool.building[tenantID] = build
+	tools := make(map[string]ToolDefinition, len(pool.tools))
+	for name, tool := range pool.tools {
+		tools[name] = tool
+	}
+	pool.mu.Unlock()
+
+	build.agent, build.err = pool.build(tenantID, tools)
+
+	pool.mu.Lock()
+	// an Evict during the build dropped it, so the agent may predate e.g. a key rotation
+	if pool.building[tenantID] == build {
+		delete(pool.building, tenantID)
+		if build.err == nil {
+			pool.agents[tenantID] = build.agent
+		}
+	}
+	pool.mu.Unlock()
+	close(build.done)
+	return build.agent, build.err
+}
+
+// Evict drops a cached tenant agent so the next Get rebuilds it, e.g. after a key rotation.
+func (pool *AgentPool) Evict(tenantID string) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	delete(pool.agents, tenantID)
+	delete(pool.building, tenantID)
+}
+
+func (pool *AgentPool) build(tenantID string, tools map[string]ToolDefinition) (Agent, error) {
+	tenant, err := pool.resolve(tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("resolving tenant %s: %w", tenantID, err)
+	}
+	agent, err := pool.newAgent(tenant, tools)
+	if err != nil {
+		return nil, fmt.Errorf("building agent for tenant %s: %w", tenantID, err)
+	}
+	return agent, nil
+}
+
+func (pool *AgentPool) newAgent(tenant Tenant, tools map[string]ToolDefinition) (Agent, error) {
+	modelName := pool.modelName
+	if tenant.Model != "" {
+		modelName = tenant.Model
+	}
+	opts := append([]AgentOption(nil), pool.opts...)
+	if tenant.ApiKey != "" {
+		opts = append(opts, WithApiKey(tenant.ApiKey))
+	}
+	if tenant.Budget != nil {
+		opts = append(opts, WithBudget(tenant.Budget.MaxTokens, tenant.Budget.MaxCostUSD))
+	}
+	if tenant.MaxTokens != 0 {
+		opts = append(opts, WithMaxTokens(tenant.MaxTokens))
+	}
+	opts = append(opts, tenant.Options...)
+
+	agent, err := NewAgent(modelName, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	toolNames := tenant.Tools
+	if toolNames == nil {
+		for name := range tools {
+			toolNames = append(toolNames, name)
+		}
+	}
+	for _, name := range toolNames {
+		tool, exists := tools[name]
+		if !exists {
+			return nil, fmt.Errorf("tool %s not available in pool", name)
+		}
+		if err := agent.RegisterTool(tool.Function, tool.Params, tool.Description); err != nil {
+			return nil, err
+		}
+	}
+	return agent, nil
+}
@@ -0,0 +1,72 @@
+package provider
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAgentPool(t *testing.T) {
+	var resolves atomic.Int32
+	release := make(chan struct{})
+	pool := NewAgentPool("ollama:llama3", func(tenantID string) (Tenant, error) {
+		resolves.Add(1)
+		if tenantID == "slow" {
+			<-release
+		}
+		return Tenant{ID: tenantID, Budget: &RunBudget{MaxTokens: 1000}, MaxTokens: 200}, nil
+	})
+
+	var wg sync.WaitGroup
+	agents := make([]Agent, 4)
+	for i := range agents {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			agent, err := pool.Get("slow")
+			if err != nil {
+				t.Error(err)
+			}
+			agents[i] = agent
+		}()
+	}
+
+	// a tenant being resolved doesn't hold up the others
+	done := make(chan error)
+	go func() {
+		_, err := pool.Get("fast")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Get of a tenant waited for the resolution of another")
+	}
+
+	close(release)
+	wg.Wait()
+	if resolves.Load() != 2 {
+		t.Errorf("tenants resolved %d times, want once each", resolves.Load())
+	}
+	for _, agent := range agents[1:] {
+		if agent != agents[0] {
+			t.Fatal("concurrent Gets built different agents")
+		}
+	}
+	config := agents[0].(configured).agentConfig()
+	if config.Budget == nil || config.Budget.MaxTokens != 1000 || config.MaxTokens != 200 {
+		t.Errorf("got budget %+v and max tokens %d, want the tenant's", config.Budget, config.MaxTokens)
+	}
+
+	pool.Evict("slow")
+	if _, err := pool.Get("slow"); err != nil {
+		t.Fatal(err)
+	}
+	if resolves.Load() != 3 {
+		t.Errorf("evicted tenant resolved %d times in all, want it resolved again", resolves.Load())
+	}
+}
@@ -0,0 +1,23 @@
+package provider
+
+// OpenaiChatEndpoint is the chat completions api of OpenAI, which agents with a prediction call.
+const OpenaiChatEndpoint = "https://api.openai.com/v1/chat/completions"
+
+// ChatPrediction is the prediction of a chat completions request.
+type ChatPrediction struct {
+	Type    string `json:"type"` // content
+	Content string `json:"content"`
+}
+
+// WithPrediction passes content, text most of the answer is expected to repeat like a file
+// being edited, as the predicted output of OpenAI requests. The answer is generated faster,
+// tokens of the prediction that were not used are billed as output tokens. Extensions
+// report "accepted_prediction_tokens" and "rejected_prediction_tokens".
+//
+// OpenAI offers predictions on the chat completions api only, which the agent then calls instead of
+// the responses api. Predictions can't be combined with tools.
+func WithPrediction(content string) AgentOption {
+	return func(a *AgentConfig) {
+		a.Prediction = content
+	}
+}
@@ -0,0 +1,42 @@
+package provider
+
+import "go.bgeen.com/gossip/pricing"
+
+// WithPricing prices the agent's round trips with table instead of pricing.Default, e.g. to
+// correct prices from a pricing file:
+//
+//	table, err := pricing.Load("prices.json")
+//	agent, err := provider.NewAgent("openai:gpt-4o", provider.WithPricing(pricing.Default.Merge(table)))
+func WithPricing(table pricing.Table) AgentOption {
+	return func(a *AgentConfig) {
+		a.Pricing = table
+	}
+}
+
+func (config *AgentConfig) pricingTable() pricing.Table {
+	if config.Pricing == nil {
+		return pricing.Default
+	}
+	return config.Pricing
+}
+
+func (config *AgentConfig) cost(providerName string, model string, inputTokens int, cachedTokens int, outputTokens int) float64 {
+	cost, _ := config.pricingTable().Cost(providerName+":"+model, inputTokens, cachedTokens, outputTokens)
+	return cost
+}
+
+// priced reports whether the pricing table knows the price of model.
+func (config *AgentConfig) priced(providerName string, model string) bool {
+	_, found := config.pricingTable().Lookup(providerName + ":" + model)
+	return found
+}
+
+// Cost is what the run cost in USD, as priced by the agent's pricing table (see WithPricing).
+// Responses from the response cache cost nothing, models missing from the table are counted as free.
+func (result *AgentResult) Cost() float64 {
+	var total float64
+	for _, stats := range result.RoundTrips {
+		total += stats.CostUSD
+	}
+	return total
+}
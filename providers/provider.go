@@ -1,27 +1,100 @@
 package provider
 
 import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"log"
+	"net/http"
 	"os"
 	"reflect"
 	"strings"
+	"time"
+
+	"go.bgeen.com/gossip/pricing"
 )
 
+// Agent runs prompts on a model. The optional history passed to Run is never modified:
+// runs copy it on entry, so one history can be shared by concurrent runs.
+// A run failing in its tool loop returns what it got done so far along with the error.
 type Agent interface {
 	Run(string, ...[]Message) (*AgentResult, error)
+	RunContext(context.Context, string, ...[]Message) (*AgentResult, error)
+	RunStream(context.Context, string, ...[]Message) <-chan StreamEvent
 	RegisterTool(any, any, string) error
+	AddTool(Tool) error
 }
 
 type AgentConfig struct {
+	Name            string   // agent name for logs, metrics and usage reports
+	Tags            []string // usage report labels
 	ModelName       string
 	ApiKey          string
 	SystemPrompt    string
 	ReasoningEffort string
 	Temperature     float32
+	Cache           Cache
+	CacheTTL        time.Duration
+	CacheKey        CacheKeyFunc
+	SemanticCache   *SemanticCache
+	ContextPolicy   ContextPolicy
+	Routing         *ModelRouting
+	Routes          []Route
+	TLSConfig       *tls.Config
+	HTTPClient      *http.Client                 // see WithHTTPClient
+	Failover        []FailoverEndpoint           // see WithFailover
+	RetryPolicy     *RetryPolicy                 // see WithRetryPolicy
+	Clock           Clock                        // the system clock when nil, see WithClock
+	IDs             IDGenerator                  // see WithIDGenerator
+	Pricing         pricing.Table                // pricing.Default when nil, see WithPricing
+	BaseURL         string                       // address of self-hosted providers, see WithBaseURL
+	AWS             *AWSCredentials              // bedrock only
+	Headers         map[string]map[string]string // extra request headers by provider name, "" for all providers
+	// gzip request bodies of at least this many bytes, 0 disables compression
+	CompressRequestsAbove int
+	MaxResponseBytes      int64
+	Stream                StreamHandler
+	StallTimeout          time.Duration
+	StreamPacing          *StreamPacing
+	MetricsHooks          []MetricsHook
+	ToolPolicy            Policy
+	ToolApprover          Policy
+	ToolConfirmer         Policy
+	RepeatLimit           *RepeatedToolCallLimit
+	WebSearch             *WebSearch
+	ImageGeneration       bool
+	MaxTokens             int
+	StopSequences         []string
+	Prediction            string
+	LogitBias             map[int]int
+	OpenRouter            *OpenRouterRouting
+	ResponseFormat        *ResponseFormat
+	RequestMutators       []func(provider string, body map[string]any)
+	DryRun                bool
+	Offline               *OfflineMode
+	Checkpoints           CheckpointStore
+	ConversationLog       ConversationLog
+	Redactor              *Redactor
+	CapabilityWarnings    bool
+	StrictResponses       bool
+	OutputValidators      []OutputValidator
+	ToolRetrieval         *ToolRetrieval
+	Budget                *RunBudget
 	ToolStore
+
+	provider       string // "anthropic", "openai", "groq", "ollama", "bedrock", "deepseek", "openrouter" or "custom"
+	client         *http.Client
+	wrapTransport  func(http.RoundTripper) http.RoundTripper
+	failoverHealth *failoverHealth
+	id             *agentID
 }
 
+// agentID tells an agent apart in the ctx values of its runs from the agents its tools run.
+// Copies of a config share it.
+type agentID struct{ model string }
+
 type AgentResult struct {
 	AllMessages   []Message
 	NewMessages   []Message
@@ -29,14 +102,154 @@ type AgentResult struct {
 	ToolArguments string
 	ToolIntent    *ToolIntent
 	ToolResult    ToolResult
+	RequestIDs    []string         // provider request id of every round trip, for support escalations
+	RoundTrips    []RoundTripStats // latency and token counts of every round trip
+	DryRun        *DryRunRequest   // the unsent request, set by WithDryRun
+	Incomplete    bool             // the answer was cut short by the token limit or an interrupt, see Continue
+	FinishReason  FinishReason     // why the model stopped, normalized across providers
+	Refusal       string           // the model's explanation when it refused to answer, see Refused
+	Reasoning     string           // the chain of thought of reasoning models that return it, deepseek-reasoner
+	// what the provider reported about the last round trip beyond the answer and token counts, under
+	// its field names, e.g. "stop_reason", "system_fingerprint", "service_tier" or Groq's "total_time"
+	Extensions map[string]any
+}
+
+// ToolResults returns the results of the tools called during the run, in call order.
+func (result *AgentResult) ToolResults() []ToolResult {
+	var results []ToolResult
+	for _, msg := range result.NewMessages {
+		if msg.ToolResult != nil {
+			results = append(results, *msg.ToolResult)
+		}
+	}
+	return results
 }
 
 type Message struct {
 	Role       string      `json:"role,omitempty"` // developer | user | assistant
 	Text       string      `json:"text,omitempty"`
 	Type       string      `json:"type,omitempty"`
+	Images     []Image     `json:"images,omitempty"`
 	ToolIntent *ToolIntent `json:"tool_intent,omitempty"`
 	ToolResult *ToolResult `json:"tool_result,omitempty"`
+	Incomplete bool        `json:"incomplete,omitempty"` // an answer cut short, see Continue
+
+	Citations     []Citation     `json:"citations,omitempty"`      // sources quoted by the answer, see WithWebSearch
+	SearchResults []SearchResult `json:"search_results,omitempty"` // pages found by the model's web searches
+
+	Raw json.RawMessage `json:"raw,omitempty"` // the response item of Type "unknown", see WithStrictResponses
+
+	// Metadata is the application's own data about the message, like its author or channel. It is kept
+	// with the message by sessions, checkpoints and logs but never sent to the provider.
+	Metadata map[string]any `json:"metadata,omitempty"`
+}
+
+// WithMetadata returns a copy of msg with key set to value in its Metadata, leaving msg untouched.
+// Pass the message in the history of a run with an empty prompt to annotate the user's turn:
+//
+//	msg := provider.Message{Role: "user", Text: text}.WithMetadata("author", userID)
+//	result, err := agent.Run("", append(history, msg))
+func (msg Message) WithMetadata(key string, value any) Message {
+	metadata := make(map[string]any, len(msg.Metadata)+1)
+	for k, v := range msg.Metadata {
+		metadata[k] = v
+	}
+	metadata[key] = value
+	msg.Metadata = metadata
+	return msg
+}
+
+// Image is an image attached to a user message or generated by the model, either by URL or as base64 encoded data.
+type Image struct {
+	URL       string `json:"url,omitempty"`
+	Data      string `json:"data,omitempty"` // base64 encoded
+	MediaType string `json:"media_type,omitempty"`
+}
+
+// NewImage builds an inline Image from raw bytes, detecting the media type.
+func NewImage(data []byte) Image {
+	return Image{
+		Data:      base64.StdEncoding.EncodeToString(data),
+		MediaType: http.DetectContentType(data),
+	}
+}
+
+// DataURL returns the image URL, or a data: URL when the image is inline.
+func (image Image) DataURL() string {
+	if image.Data == "" {
+		return image.URL
+	}
+	return fmt.Sprintf("data:%s;base64,%s", image.MediaType, image.Data)
+}
+
+// Bytes decodes an inline image. Images given by URL have to be downloaded instead.
+func (image Image) Bytes() ([]byte, error) {
+	if image.Data == "" {
+		return nil, fmt.Errorf("image %s is not inline", image.URL)
+	}
+	return base64.StdEncoding.DecodeString(image.Data)
+}
+
+// Images returns the images the model generated during the run, see WithImageGeneration.
+func (result *AgentResult) Images() []Image {
+	var images []Image
+	for _, msg := range result.NewMessages {
+		if msg.Role == "assistant" {
+			images = append(images, msg.Images...)
+		}
+	}
+	return images
+}
+
+// partialResult is returned along with the error of a run failing after its first round trip, so the
+// messages, request ids and round trips of the iterations that went through are not lost and the run
+// can be resumed from AllMessages. next is what the failed nested run returned, if anything.
+func partialResult(history []Message, newMessages []Message, toolIntent ToolIntent, requestIDs []string, roundTrips []RoundTripStats, next *AgentResult) *AgentResult {
+	result := &AgentResult{
+		NewMessages:   newMessages,
+		ToolIntent:    &toolIntent,
+		ToolArguments: toolIntent.Arguments,
+		RequestIDs:    requestIDs,
+		RoundTrips:    roundTrips,
+	}
+	if next != nil {
+		result.NewMessages = append(append([]Message(nil), newMessages...), next.NewMessages...)
+		result.RequestIDs = append(append([]string(nil), requestIDs...), next.RequestIDs...)
+		result.RoundTrips = append(append([]RoundTripStats(nil), roundTrips...), next.RoundTrips...)
+		if next.ToolIntent != nil && next.ToolIntent.Id != "" {
+			result.ToolIntent = next.ToolIntent
+			result.ToolArguments = next.ToolIntent.Arguments
+		}
+	}
+	for _, msg := range result.NewMessages {
+		if msg.isText() && msg.Text != "" {
+			result.Text = msg.Text
+		}
+	}
+	result.AllMessages = append(append([]Message(nil), history...), result.NewMessages...)
+	return result
+}
+
+// local reports whether msg stays out of provider requests: unknown items and images generated by the model.
+func (msg Message) local() bool {
+	return msg.Type == "unknown" || (msg.isText() && msg.Text == "" && len(msg.Images) > 0)
+}
+
+// unknownItem surfaces a response item of a type this package does not know, unless responses are strict.
+func (config *AgentConfig) unknownItem(providerName string, itemType string, raw json.RawMessage) (Message, error) {
+	if config.StrictResponses {
+		return Message{}, fmt.Errorf("(%s.go, Run) unexpected message type %q", providerName, itemType)
+	}
+	config.logf("Skipping unknown %s response item %q\n", providerName, itemType)
+	return Message{Role: "assistant", Type: "unknown", Raw: raw}, nil
+}
+
+// WithStrictResponses fails runs on response items of unknown types instead of keeping them
+// as Message{Type: "unknown"} with their raw JSON.
+func WithStrictResponses() AgentOption {
+	return func(a *AgentConfig) {
+		a.StrictResponses = true
+	}
 }
 
 type AgentOption func(*AgentConfig)
@@ -53,14 +266,65 @@ func WithReasoningEffort(reasoningEffort string) AgentOption {
 	}
 }
 
+// WithApiKey sets the api key instead of reading it from <PROVIDER>_API_KEY.
+func WithApiKey(apiKey string) AgentOption {
+	return func(a *AgentConfig) {
+		a.ApiKey = apiKey
+	}
+}
+
 func WithTemperature(temperature float32) AgentOption {
 	return func(a *AgentConfig) {
 		a.Temperature = temperature
 	}
 }
 
+// WithStopSequences ends answers where the model generates one of sequences, which is left out of the
+// answer. OpenAI agents call the chat completions api for it, as the responses api has no stop sequences.
+// OpenAI and Groq take at most 4 sequences.
+func WithStopSequences(sequences []string) AgentOption {
+	return func(a *AgentConfig) {
+		a.StopSequences = append([]string(nil), sequences...)
+	}
+}
+
+// DefaultAnthropicMaxTokens caps the answers of Anthropic agents without WithMaxTokens, as Anthropic
+// requires a cap. The other providers default to the model's limit.
+const DefaultAnthropicMaxTokens = 1024
+
+// WithMaxTokens caps the tokens of each answer: max_tokens for Anthropic, DeepSeek, OpenRouter and
+// custom servers, max_output_tokens for OpenAI, max_completion_tokens for Groq and num_predict for Ollama.
+// Answers cut short are marked Incomplete, see Continue. Reasoning models count their thinking against it.
+func WithMaxTokens(maxTokens int) AgentOption {
+	return func(a *AgentConfig) {
+		a.MaxTokens = maxTokens
+	}
+}
+
+// WithName names the agent in logs, metrics and usage reports, e.g. "support-triage".
+func WithName(name string) AgentOption {
+	return func(a *AgentConfig) {
+		a.Name = name
+	}
+}
+
+// WithTags labels the agent's usage, e.g. by feature or customer tier.
+func WithTags(tags ...string) AgentOption {
+	return func(a *AgentConfig) {
+		a.Tags = append(a.Tags, tags...)
+	}
+}
+
+// logf logs a message about the agent, prefixed with its name when it has one.
+func (config *AgentConfig) logf(format string, args ...any) {
+	if config.Name != "" {
+		format = "[" + config.Name + "] " + format
+	}
+	log.Printf(format, args...)
+}
+
 func NewAgent(modelName string, opts ...AgentOption) (Agent, error) {
-	if _, exists := AvailableModels[modelName]; !exists {
+	if !ModelAvailable(modelName) {
 		return nil, fmt.Errorf("model not available")
 	}
 	provider, model, found := strings.Cut(modelName, ":")
@@ -68,20 +332,73 @@ func NewAgent(modelName string, opts ...AgentOption) (Agent, error) {
 		return nil, fmt.Errorf("seperator not found in model name")
 	}
 	keyName := strings.ToUpper(provider) + "_API_KEY"
-	apiKey, keyFound := os.LookupEnv(keyName)
-	if !keyFound {
-		return nil, fmt.Errorf("api key not found")
-	}
+	apiKey, _ := os.LookupEnv(keyName)
 	toolStore := ToolStore{
 		functions:    make(map[string]any),
 		paramTypes:   make(map[string]reflect.Type),
 		descriptions: make(map[string]string),
+		dispatchers:  make(map[string]ToolDispatcher),
 	}
 	config := AgentConfig{ModelName: model, ApiKey: apiKey, ToolStore: toolStore}
 
 	for _, opt := range opts {
 		opt(&config)
 	}
+	if config.ApiKey == "" && config.Offline == nil && !keylessProviders[provider] {
+		return nil, fmt.Errorf("api key not found")
+	}
+	if provider == "bedrock" {
+		config.AWS = awsCredentialsFromEnv(config.AWS)
+		if (config.AWS.AccessKeyID == "" || config.AWS.SecretAccessKey == "" || config.AWS.Region == "") && config.Offline == nil {
+			return nil, fmt.Errorf("aws credentials or region not found")
+		}
+	}
+
+	if config.Routing != nil {
+		if !ModelAvailable(config.Routing.CheapModel) {
+			return nil, fmt.Errorf("cheaper model not available")
+		}
+		cheapProvider, cheapModel, _ := strings.Cut(config.Routing.CheapModel, ":")
+		if cheapProvider != provider {
+			return nil, fmt.Errorf("cheaper model must use the same provider as the agent")
+		}
+		config.Routing.CheapModel = cheapModel
+	}
+	if config.WebSearch != nil && provider != "anthropic" {
+		return nil, fmt.Errorf("web search is only supported by anthropic")
+	}
+	if config.ImageGeneration && provider != "openai" {
+		return nil, fmt.Errorf("image generation is only supported by openai")
+	}
+	if config.Prediction != "" && provider != "openai" {
+		return nil, fmt.Errorf("predicted outputs are only supported by openai")
+	}
+	if err := checkLogitBias(config.LogitBias, provider); err != nil {
+		return nil, err
+	}
+	if provider == "custom" && config.BaseURL == "" {
+		return nil, fmt.Errorf("custom agents need a base url")
+	}
+	if config.OpenRouter != nil && provider != "openrouter" {
+		return nil, fmt.Errorf("routing preferences are only supported by openrouter")
+	}
+	if len(config.Failover) > 0 && failoverBases[provider] == "" {
+		return nil, fmt.Errorf("failover endpoints are only supported by anthropic and openai")
+	}
+	if config.Budget != nil && config.Budget.MaxCostUSD > 0 && !config.priced(provider, model) {
+		return nil, fmt.Errorf("a cost budget needs the price of %s, see WithPricing", modelName)
+	}
+	if config.HTTPClient != nil && config.TLSConfig != nil {
+		return nil, fmt.Errorf("tls settings go to the transport of the http client")
+	}
+	config.Routes = append([]Route(nil), config.Routes...)
+	if err := resolveRoutes(config.Routes, provider); err != nil {
+		return nil, err
+	}
+	config.client = config.newHTTPClient()
+	config.provider = provider
+	config.failoverHealth = &failoverHealth{downUntil: make(map[int]time.Time)}
+	config.id = &agentID{model: modelName}
 
 	switch provider {
 	case "anthropic":
@@ -90,6 +407,12 @@ func NewAgent(modelName string, opts ...AgentOption) (Agent, error) {
 		return &Openai{config, nil}, nil
 	case "groq":
 		return &Groq{config, nil}, nil
+	case "ollama":
+		return &Ollama{config, nil}, nil
+	case "bedrock":
+		return &Anthropic{config, nil}, nil
+	case "deepseek", "openrouter", "custom":
+		return &Groq{config, nil}, nil
 	default:
 		return nil, fmt.Errorf("unknown provider!")
 	}
@@ -0,0 +1,53 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// WithRequestMutator lets mutate edit the JSON body of every request before it is sent, e.g. to set
+// parameters gossip doesn't model yet. It gets the provider name, as in RoundTripStats, and the body
+// decoded into maps, slices and json.Number values. Mutators run in the order they were added.
+func WithRequestMutator(mutate func(provider string, body map[string]any)) AgentOption {
+	return func(a *AgentConfig) {
+		a.RequestMutators = append(a.RequestMutators, mutate)
+	}
+}
+
+// encodeRequest marshals the payload of a request to providerName, as edited by the request mutators.
+func (config *AgentConfig) encodeRequest(providerName string, payload any) (*bytes.Buffer, error) {
+	if len(config.RequestMutators) == 0 {
+		return encodeJSON(payload)
+	}
+	body, err := config.mutateRequest(providerName, payload)
+	if err != nil {
+		return nil, err
+	}
+	return encodeJSON(body)
+}
+
+func (config *AgentConfig) mutateRequest(providerName string, payload any) (map[string]any, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber() // token ids and seeds stay exact
+	var body map[string]any
+	if err := decoder.Decode(&body); err != nil {
+		return nil, err
+	}
+	for _, mutate := range config.RequestMutators {
+		mutate(providerName, body)
+	}
+	return body, nil
+}
+
+// RawResponse returns the JSON the provider answered the last round trip of the run with, to read
+// fields gossip doesn't model yet. It is nil for streamed responses, which arrive in pieces.
+func (result *AgentResult) RawResponse() json.RawMessage {
+	if len(result.RoundTrips) == 0 {
+		return nil
+	}
+	return result.RoundTrips[len(result.RoundTrips)-1].Raw
+}
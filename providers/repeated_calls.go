@@ -0,0 +1,77 @@
+package provider
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrRepeatedToolCall is returned when a run stops on a tool called over and over with the same arguments.
+var ErrRepeatedToolCall = errors.New("repeated tool call")
+
+// RepeatAction is what happens to a tool call repeated beyond the limit.
+type RepeatAction int
+
+const (
+	// RepeatWarn skips the call and tells the model it already has the result.
+	RepeatWarn RepeatAction = iota
+	// RepeatStop fails the run with ErrRepeatedToolCall.
+	RepeatStop
+)
+
+// RepeatedToolCallLimit is set by WithRepeatedToolCallLimit.
+type RepeatedToolCallLimit struct {
+	Limit  int
+	Action RepeatAction
+}
+
+// WithRepeatedToolCallLimit guards against models stuck calling the same tool with identical
+// arguments: once such a call was made limit times within a turn, the next ones get action, e.g.
+//
+//	provider.WithRepeatedToolCallLimit(2, provider.RepeatWarn)
+func WithRepeatedToolCallLimit(limit int, action RepeatAction) AgentOption {
+	return func(a *AgentConfig) {
+		a.RepeatLimit = &RepeatedToolCallLimit{Limit: limit, Action: action}
+	}
+}
+
+// checkRepeat looks for earlier calls identical to intent in the current turn of history, which
+// ends with intent. It returns the output replacing a skipped call, or an error stopping the run.
+func (config *AgentConfig) checkRepeat(history []Message, intent ToolIntent) (string, error) {
+	if config.RepeatLimit == nil {
+		return "", nil
+	}
+	arguments := canonicalJSON(intent.Arguments)
+	calls := 0
+	for i := len(history) - 1; i >= 0; i-- {
+		msg := history[i]
+		if isTurnStart(msg) {
+			break
+		}
+		if msg.ToolIntent != nil && msg.ToolIntent.Name == intent.Name && canonicalJSON(msg.ToolIntent.Arguments) == arguments {
+			calls++
+		}
+	}
+	if calls <= config.RepeatLimit.Limit {
+		return "", nil
+	}
+	config.logf("Tool %s called %d times with the same arguments\n", intent.Name, calls)
+	if config.RepeatLimit.Action == RepeatStop {
+		return "", fmt.Errorf("%w: %s called %d times with %s", ErrRepeatedToolCall, intent.Name, calls, intent.Arguments)
+	}
+	return fmt.Sprintf("not executed: %s was already called %d times with these arguments and the result will not change. "+
+		"Use the earlier results, try different arguments or answer with what you have.", intent.Name, calls-1), nil
+}
+
+// canonicalJSON renders a JSON document with sorted keys and no whitespace, so equal arguments compare equal.
+func canonicalJSON(document string) string {
+	var value any
+	if err := json.Unmarshal([]byte(document), &value); err != nil {
+		return document
+	}
+	canonical, err := json.Marshal(value)
+	if err != nil {
+		return document
+	}
+	return string(canonical)
+}
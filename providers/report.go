@@ -0,0 +1,186 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"time"
+)
+
+// RunReport is a run told turn by turn, see AgentResult.Report. It marshals to JSON as is,
+// HTML renders it as a standalone page.
+type RunReport struct {
+	Text         string       `json:"text"`
+	FinishReason FinishReason `json:"finish_reason,omitempty"`
+	Incomplete   bool         `json:"incomplete,omitempty"`
+	Refused      bool         `json:"refused,omitempty"`
+	LatencyMs    int64        `json:"latency_ms"` // spent waiting for the provider, tools not included
+	ToolMs       int64        `json:"tool_ms"`    // spent running tools
+	Usage        UsageTotals  `json:"usage"`      // cached round trips not counted
+	Turns        []ReportTurn `json:"turns"`
+	Errors       []string     `json:"errors,omitempty"` // tool calls that didn't run, guardrail rejections, refusals
+}
+
+// ReportTurn is a round trip to the provider and the tool calls it asked for.
+type ReportTurn struct {
+	Provider         string           `json:"provider,omitempty"`
+	Model            string           `json:"model,omitempty"`
+	Route            string           `json:"route,omitempty"`
+	RequestID        string           `json:"request_id,omitempty"`
+	Cached           bool             `json:"cached,omitempty"`
+	LatencyMs        int64            `json:"latency_ms"`
+	TimeToFirstToken int64            `json:"time_to_first_token_ms,omitempty"`
+	InputTokens      int              `json:"input_tokens"`
+	OutputTokens     int              `json:"output_tokens"`
+	ReasoningTokens  int              `json:"reasoning_tokens,omitempty"`
+	CostUSD          float64          `json:"cost_usd,omitempty"`
+	Prompt           string           `json:"prompt,omitempty"` // the user message the turn answers, if any
+	Text             string           `json:"text,omitempty"`
+	ToolCalls        []ReportToolCall `json:"tool_calls,omitempty"`
+}
+
+type ReportToolCall struct {
+	Name       string `json:"name"`
+	Arguments  string `json:"arguments,omitempty"`
+	Output     string `json:"output,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Report builds the report of the run, e.g. for a debugging dashboard or a support ticket.
+// Costs are priced with the PriceFunc given to EnableUsageReport, if any, as the agent priced them otherwise.
+func (result *AgentResult) Report() *RunReport {
+	report := &RunReport{
+		Text:         result.Text,
+		FinishReason: result.FinishReason,
+		Incomplete:   result.Incomplete,
+		Refused:      result.Refused(),
+		LatencyMs:    result.Latency().Milliseconds(),
+	}
+	usageReport.Lock()
+	price := usageReport.price
+	usageReport.Unlock()
+
+	var turn *ReportTurn
+	var prompt string
+	calls := make(map[string]int) // tool call index by id within the turn
+	for _, msg := range result.NewMessages {
+		switch {
+		case msg.Role == "user":
+			prompt, turn = msg.Text, nil
+			if reason, ok := msg.Metadata["guardrail"].(string); ok {
+				report.Errors = append(report.Errors, "answer rejected by guardrail: "+reason)
+			}
+		case msg.ToolResult != nil:
+			turn = nil
+			if i, ok := calls[msg.ToolResult.Id]; ok {
+				last := &report.Turns[len(report.Turns)-1]
+				last.ToolCalls[i].Output = msg.ToolResult.Output
+				last.ToolCalls[i].DurationMs = msg.ToolResult.Duration.Milliseconds()
+				last.ToolCalls[i].Error = msg.ToolResult.Error
+				if msg.ToolResult.Error != "" {
+					report.Errors = append(report.Errors, last.ToolCalls[i].Name+": "+msg.ToolResult.Error)
+				}
+			}
+			report.ToolMs += msg.ToolResult.Duration.Milliseconds()
+		case msg.isText() || msg.ToolIntent != nil:
+			if turn == nil {
+				report.Turns = append(report.Turns, newReportTurn(result.RoundTrips, len(report.Turns), price))
+				turn = &report.Turns[len(report.Turns)-1]
+				turn.Prompt, prompt = prompt, ""
+				calls = make(map[string]int)
+			}
+			if msg.ToolIntent != nil {
+				calls[msg.ToolIntent.Id] = len(turn.ToolCalls)
+				turn.ToolCalls = append(turn.ToolCalls, ReportToolCall{Name: msg.ToolIntent.Name, Arguments: msg.ToolIntent.Arguments})
+			} else if msg.Text != "" {
+				turn.Text = msg.Text
+			}
+		}
+	}
+	for _, stats := range result.RoundTrips {
+		if !stats.Cached {
+			report.Usage.add(stats, priceRoundTrip(price, stats))
+		}
+	}
+	if result.Refusal != "" {
+		report.Errors = append(report.Errors, "refused: "+result.Refusal)
+	}
+	return report
+}
+
+// newReportTurn starts the report of round trip i, which failed runs may lack.
+func newReportTurn(roundTrips []RoundTripStats, i int, price PriceFunc) ReportTurn {
+	if i >= len(roundTrips) {
+		return ReportTurn{}
+	}
+	stats := roundTrips[i]
+	turn := ReportTurn{
+		Provider:         stats.Provider,
+		Model:            stats.Model,
+		Route:            stats.Route,
+		RequestID:        stats.RequestID,
+		Cached:           stats.Cached,
+		LatencyMs:        stats.Latency.Milliseconds(),
+		TimeToFirstToken: stats.TimeToFirstToken.Milliseconds(),
+		InputTokens:      stats.InputTokens,
+		OutputTokens:     stats.OutputTokens,
+		ReasoningTokens:  stats.ReasoningTokens,
+	}
+	if !stats.Cached {
+		turn.CostUSD = priceRoundTrip(price, stats).total
+	}
+	return turn
+}
+
+// JSON returns the report as indented JSON.
+func (report *RunReport) JSON() ([]byte, error) {
+	return json.MarshalIndent(report, "", "  ")
+}
+
+// HTML renders the report as a standalone HTML page.
+func (report *RunReport) HTML() ([]byte, error) {
+	var page bytes.Buffer
+	err := reportTemplate.Execute(&page, report)
+	return page.Bytes(), err
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"duration": func(ms int64) string { return (time.Duration(ms) * time.Millisecond).String() },
+	"inc":      func(i int) int { return i + 1 },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Run report</title>
+<style>
+body { font-family: sans-serif; max-width: 60em; margin: 2em auto; color: #222; }
+section { border-left: 3px solid #ccc; padding-left: 1em; margin: 1em 0; }
+pre { background: #f5f5f5; padding: .5em; white-space: pre-wrap; }
+.meta { color: #666; font-size: .9em; }
+.error { color: #b00; }
+</style>
+</head>
+<body>
+<h1>Run report</h1>
+<p class="meta">
+{{.Usage.Requests}} requests, {{.Usage.InputTokens}} input and {{.Usage.OutputTokens}} output tokens{{if .Usage.ReasoningTokens}} ({{.Usage.ReasoningTokens}} reasoning){{end}},
+${{printf "%.4f" .Usage.CostUSD}}, {{duration .LatencyMs}} waiting for the provider, {{duration .ToolMs}} running tools.
+{{if .FinishReason}}Finished: {{.FinishReason}}.{{end}}{{if .Incomplete}} Incomplete.{{end}}{{if .Refused}} Refused.{{end}}
+</p>
+{{if .Errors}}<h2>Errors</h2>
+<ul>{{range .Errors}}<li class="error">{{.}}</li>{{end}}</ul>{{end}}
+<h2>Turns</h2>
+{{range $i, $turn := .Turns}}<section>
+<h3>Turn {{inc $i}}{{if .Model}}: {{.Provider}}:{{.Model}}{{end}}</h3>
+<p class="meta">{{duration .LatencyMs}}{{if .TimeToFirstToken}}, first token after {{duration .TimeToFirstToken}}{{end}}, {{.InputTokens}} input and {{.OutputTokens}} output tokens{{if .CostUSD}}, ${{printf "%.4f" .CostUSD}}{{end}}{{if .Cached}}, cached{{end}}{{if .Route}}, routed: {{.Route}}{{end}}{{if .RequestID}}, request {{.RequestID}}{{end}}</p>
+{{if .Prompt}}<p><b>User</b></p><pre>{{.Prompt}}</pre>{{end}}
+{{if .Text}}<p><b>Assistant</b></p><pre>{{.Text}}</pre>{{end}}
+{{range .ToolCalls}}<p><b>Tool {{.Name}}</b> <span class="meta">{{duration .DurationMs}}</span>{{if .Error}} <span class="error">{{.Error}}</span>{{end}}</p>
+<pre>{{.Arguments}}</pre>
+{{if .Output}}<pre>{{.Output}}</pre>{{end}}{{end}}
+</section>
+{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,134 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// ResponseFormat asks for answers in JSON: any JSON object, or one matching Schema.
+type ResponseFormat struct {
+	Type   string      // json_object | json_schema
+	Name   string      // json_schema, the name of the schema, "response" when empty
+	Schema *Parameters // json_schema
+}
+
+// WithResponseFormat makes the agent answer in JSON. OpenAI and Groq compatible providers and Ollama
+// enforce the format; Groq and DeepSeek are only asked for a JSON object, whatever the schema. Anthropic
+// has no JSON mode: the format is described in the system prompt and, unless the agent has tools or
+// streams, the answer is started with "{" for Claude to carry on. OpenAI requires the word JSON in
+// the prompt of json_object requests.
+func WithResponseFormat(format ResponseFormat) AgentOption {
+	return func(a *AgentConfig) {
+		a.ResponseFormat = &format
+	}
+}
+
+type responseFormatKey struct{}
+
+// contextWithResponseFormat asks the runs of ctx to answer in format.
+func contextWithResponseFormat(ctx context.Context, format *ResponseFormat) context.Context {
+	return context.WithValue(ctx, responseFormatKey{}, format)
+}
+
+// responseFormat returns the format answers of the run of ctx must have, nil for free text.
+// A format of the run, see RunAs, takes precedence over the agent's.
+func (config *AgentConfig) responseFormat(ctx context.Context) *ResponseFormat {
+	if format, _ := ctx.Value(responseFormatKey{}).(*ResponseFormat); format != nil {
+		return format
+	}
+	return config.ResponseFormat
+}
+
+// instruction describes format to models without a JSON mode.
+func (format *ResponseFormat) instruction() string {
+	if format.Type == "json_schema" && format.Schema != nil {
+		if schema, err := json.Marshal(format.Schema); err == nil {
+			return "Respond with JSON only, matching this JSON schema:\n" + string(schema)
+		}
+	}
+	return "Respond with a JSON object only."
+}
+
+// jsonPrefill is how answers of Anthropic in JSON are started.
+const jsonPrefill = "{"
+
+// prefillJSON starts the answer of reqBody with jsonPrefill. It reports false when it can't:
+// tool calls can't follow a started answer, and streams resume answers themselves.
+func (reqBody *AnthropicRequest) prefillJSON() bool {
+	last := len(reqBody.Messages) - 1
+	if len(reqBody.Tools) > 0 || reqBody.Stream || last < 0 || reqBody.Messages[last].Role != "user" {
+		return false
+	}
+	prefill := AnthropicMessage{Role: "assistant", Content: []AnthropicContent{{Type: "text", Text: jsonPrefill}}}
+	reqBody.Messages = append(reqBody.Messages[:last+1:last+1], prefill)
+	return true
+}
+
+// completePrefill puts the prefill back in front of the answer, which carries on from it.
+func (response *AnthropicResponse) completePrefill() {
+	for i, block := range response.Content {
+		if block.Type == "text" {
+			response.Content[i].Text = jsonPrefill + block.Text
+			return
+		}
+	}
+}
+
+func (format *ResponseFormat) name() string {
+	if format.Name == "" {
+		return "response"
+	}
+	return format.Name
+}
+
+// OpenaiTextFormat is the output format of a responses api request.
+type OpenaiTextFormat struct {
+	Format struct {
+		Type   string      `json:"type"` // json_object | json_schema
+		Name   string      `json:"name,omitempty"`
+		Schema *Parameters `json:"schema,omitempty"`
+	} `json:"format"`
+}
+
+func (format *ResponseFormat) openaiText() *OpenaiTextFormat {
+	var text OpenaiTextFormat
+	text.Format.Type = format.Type
+	if format.Type == "json_schema" {
+		text.Format.Name = format.name()
+		text.Format.Schema = format.Schema
+	}
+	return &text
+}
+
+// ChatResponseFormat is the response format of a chat completions request.
+type ChatResponseFormat struct {
+	Type       string `json:"type"` // json_object | json_schema
+	JSONSchema *struct {
+		Name   string      `json:"name"`
+		Schema *Parameters `json:"schema"`
+	} `json:"json_schema,omitempty"`
+}
+
+// chatFormat converts format for providerName. Groq and DeepSeek, which only take schemas for
+// some models or none, are asked for a JSON object instead; the schema is in the prompt anyway.
+func (format *ResponseFormat) chatFormat(providerName string) *ChatResponseFormat {
+	if format.Type != "json_schema" || providerName == "groq" || providerName == "deepseek" {
+		return &ChatResponseFormat{Type: "json_object"}
+	}
+	chat := &ChatResponseFormat{Type: "json_schema"}
+	chat.JSONSchema = &struct {
+		Name   string      `json:"name"`
+		Schema *Parameters `json:"schema"`
+	}{format.name(), format.Schema}
+	return chat
+}
+
+// ollamaFormat is "json" or the schema answers must match.
+func (format *ResponseFormat) ollamaFormat() json.RawMessage {
+	if format.Type == "json_schema" && format.Schema != nil {
+		if schema, err := json.Marshal(format.Schema); err == nil {
+			return schema
+		}
+	}
+	return json.RawMessage(`"json"`)
+}
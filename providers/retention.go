@@ -0,0 +1,262 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ManagedSessionStore is a SessionStore that can list and delete its sessions, which
+// DeleteSession, DeleteUserData and retention need. The stores of this package all are.
+type ManagedSessionStore interface {
+	SessionStore
+	IDs() ([]string, error)
+	Delete(id string) error // deleting an unknown session is not an error
+}
+
+// WithSessionUser records userID as taking part in the session, so DeleteUserData finds it.
+// Sessions shared by several users, like a channel thread, record each of them: pass the
+// option for the author of every message. Sessions run with an Identity record its Subject too.
+func WithSessionUser(userID string) SessionOption {
+	return func(session *Session) {
+		session.state.addUser(userID)
+	}
+}
+
+func (state *SessionState) addUser(userID string) {
+	if userID == "" {
+		return
+	}
+	if state.UserID == "" {
+		state.UserID = userID
+	}
+	if !slices.Contains(state.Users, userID) {
+		state.Users = append(state.Users, userID)
+	}
+}
+
+// ManagedCheckpointStore is a CheckpointStore that can list its runs, which
+// DeleteUserCheckpoints needs. The stores of this package all are.
+type ManagedCheckpointStore interface {
+	CheckpointStore
+	RunIDs() ([]string, error)
+}
+
+func managed(store SessionStore) (ManagedSessionStore, error) {
+	if managed, ok := store.(ManagedSessionStore); ok {
+		return managed, nil
+	}
+	return nil, fmt.Errorf("session store %T can't list and delete sessions", store)
+}
+
+// DeleteSession deletes the session id from store.
+func DeleteSession(store SessionStore, id string) error {
+	managed, err := managed(store)
+	if err != nil {
+		return err
+	}
+	return managed.Delete(id)
+}
+
+// DeleteUserData deletes every session userID took part in from store, e.g. to honor a deletion
+// request, and returns how many it deleted. Sessions are loaded to find their users, see
+// WithSessionUser; a session shared with other users is deleted as a whole.
+//
+// Sessions are not the only place conversations are kept:
+//   - checkpoints (WithCheckpoints) stay after their run completes, DeleteUserCheckpoints deletes them
+//   - conversation logs (WithConversationLog) carry the user in Transcript.UserID, for the log's
+//     owner to delete
+//   - the response and semantic caches (WithCache, WithSemanticCache) keep answers until they
+//     expire, so give them a TTL within the retention period. Semantic cache entries are scoped
+//     to the Identity of the run and only ever served to it.
+func DeleteUserData(store SessionStore, userID string) (int, error) {
+	return deleteSessions(store, func(state *SessionState) bool {
+		return state.UserID == userID || slices.Contains(state.Users, userID)
+	})
+}
+
+// DeleteUserCheckpoints deletes the checkpoints of the runs made with the Identity of userID
+// from store and returns how many it deleted.
+func DeleteUserCheckpoints(store CheckpointStore, userID string) (int, error) {
+	managed, ok := store.(ManagedCheckpointStore)
+	if !ok {
+		return 0, fmt.Errorf("checkpoint store %T can't list runs", store)
+	}
+	runIDs, err := managed.RunIDs()
+	if err != nil {
+		return 0, err
+	}
+	deleted := 0
+	var errs []error
+	for _, runID := range runIDs {
+		checkpoint, err := managed.Load(runID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("load checkpoint %s: %w", runID, err))
+			continue
+		}
+		if checkpoint == nil || checkpoint.UserID != userID {
+			continue
+		}
+		if err := managed.Delete(runID); err != nil {
+			errs = append(errs, fmt.Errorf("delete checkpoint %s: %w", runID, err))
+			continue
+		}
+		deleted++
+	}
+	return deleted, errors.Join(errs...)
+}
+
+// SweepSessions deletes the sessions of store last updated more than maxAge ago by the system
+// clock and returns how many it deleted. Sessions stamped by a clock of their own (WithClock,
+// WithSessionClock) are swept with SweepSessionsBefore and a cutoff read from that clock.
+func SweepSessions(store SessionStore, maxAge time.Duration) (int, error) {
+	return SweepSessionsBefore(store, time.Now().Add(-maxAge))
+}
+
+// SweepSessionsBefore deletes the sessions of store last updated before cutoff and returns how
+// many it deleted. Sessions saved before they carried an update time are kept.
+func SweepSessionsBefore(store SessionStore, cutoff time.Time) (int, error) {
+	return deleteSessions(store, func(state *SessionState) bool {
+		return !state.UpdatedAt.IsZero() && state.UpdatedAt.Before(cutoff)
+	})
+}
+
+func deleteSessions(store SessionStore, match func(*SessionState) bool) (int, error) {
+	managed, err := managed(store)
+	if err != nil {
+		return 0, err
+	}
+	ids, err := managed.IDs()
+	if err != nil {
+		return 0, err
+	}
+	deleted := 0
+	var errs []error
+	for _, id := range ids {
+		state, err := managed.Load(id)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("load session %s: %w", id, err))
+			continue
+		}
+		if state == nil || !match(state) {
+			continue
+		}
+		if err := managed.Delete(id); err != nil {
+			errs = append(errs, fmt.Errorf("delete session %s: %w", id, err))
+			continue
+		}
+		deleted++
+	}
+	return deleted, errors.Join(errs...)
+}
+
+// StartRetention sweeps store every interval in the background, deleting sessions older than maxAge
+// (see SweepSessions), until ctx is done. Sweep errors are logged.
+func StartRetention(ctx context.Context, store SessionStore, maxAge time.Duration, interval time.Duration) error {
+	if _, err := managed(store); err != nil {
+		return err
+	}
+	if maxAge <= 0 || interval <= 0 {
+		return fmt.Errorf("retention needs a positive age and interval")
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if deleted, err := SweepSessions(store, maxAge); err != nil {
+					log.Printf("Session retention: %v\n", err)
+				} else if deleted > 0 {
+					log.Printf("Session retention deleted %d sessions\n", deleted)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+func (store *MemorySessionStore) IDs() ([]string, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	ids := make([]string, 0, len(store.sessions))
+	for id := range store.sessions {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func (store *MemorySessionStore) Delete(id string) error {
+	store.mu.Lock()
+	delete(store.sessions, id)
+	store.mu.Unlock()
+	return nil
+}
+
+func (store *FileSessionStore) IDs() ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(store.Dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(paths))
+	for _, path := range paths {
+		ids = append(ids, strings.TrimSuffix(filepath.Base(path), ".json"))
+	}
+	return ids, nil
+}
+
+func (store *FileSessionStore) Delete(id string) error {
+	path, err := jsonFilePath(store.Dir, id)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (store *MemoryCheckpointStore) RunIDs() ([]string, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	runIDs := make([]string, 0, len(store.checkpoints))
+	for runID := range store.checkpoints {
+		runIDs = append(runIDs, runID)
+	}
+	sort.Strings(runIDs)
+	return runIDs, nil
+}
+
+func (store *FileCheckpointStore) RunIDs() ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(store.Dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	runIDs := make([]string, 0, len(paths))
+	for _, path := range paths {
+		runIDs = append(runIDs, strings.TrimSuffix(filepath.Base(path), ".json"))
+	}
+	return runIDs, nil
+}
+
+func (store *EncryptedSessionStore) IDs() ([]string, error) {
+	managed, err := managed(store.Store)
+	if err != nil {
+		return nil, err
+	}
+	return managed.IDs()
+}
+
+func (store *EncryptedSessionStore) Delete(id string) error {
+	return DeleteSession(store.Store, id)
+}
@@ -0,0 +1,81 @@
+package provider
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDeleteUserData(t *testing.T) {
+	server := newChatServer(t, textReply("hi Alice"), textReply("hi Bob"), textReply("hi Carol"))
+	var transcripts []*Transcript
+	checkpoints := NewMemoryCheckpointStore()
+	agent := server.agent(t, WithCheckpoints(checkpoints), WithConversationLog(ConversationLogFunc(func(transcript *Transcript) error {
+		transcripts = append(transcripts, transcript)
+		return nil
+	}), nil))
+	store := NewMemorySessionStore()
+
+	// a channel thread both alice and bob write in
+	for _, user := range []string{"alice", "bob"} {
+		session, err := NewSession("thread", agent, store, WithSessionUser(user))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := session.Run("hello"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a conversation of carol's, known from her identity
+	session, err := NewSession("direct", agent, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := ContextWithRunID(ContextWithIdentity(context.Background(), &Identity{Subject: "carol"}), "run-1")
+	if _, err := session.RunContext(ctx, "hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := store.Load("thread")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.UserID != "alice" || len(state.Users) != 2 {
+		t.Errorf("thread has user %q and users %q, want alice first of both", state.UserID, state.Users)
+	}
+	if len(transcripts) != 3 || transcripts[2].UserID != "carol" {
+		t.Errorf("got %d transcripts, want the last one of carol", len(transcripts))
+	}
+
+	tests := []struct {
+		userID  string
+		deleted int
+		kept    []string
+	}{
+		{userID: "dave", deleted: 0, kept: []string{"direct", "thread"}},
+		{userID: "bob", deleted: 1, kept: []string{"direct"}},
+		{userID: "carol", deleted: 1, kept: []string{}},
+	}
+	for _, test := range tests {
+		deleted, err := DeleteUserData(store, test.userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids, _ := store.IDs()
+		if deleted != test.deleted || len(ids) != len(test.kept) {
+			t.Errorf("deleting %s deleted %d sessions and kept %q, want %d deleted and %q kept", test.userID, deleted, ids, test.deleted, test.kept)
+		}
+	}
+
+	for userID, want := range map[string]int{"alice": 0, "carol": 1} {
+		deleted, err := DeleteUserCheckpoints(checkpoints, userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if deleted != want {
+			t.Errorf("deleted %d checkpoints of %s, want %d", deleted, userID, want)
+		}
+	}
+	if checkpoint, _ := checkpoints.Load("run-1"); checkpoint != nil {
+		t.Error("checkpoint of carol's run kept")
+	}
+}
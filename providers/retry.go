@@ -0,0 +1,88 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy says how requests failing with a transient error are sent again, see WithRetryPolicy.
+type RetryPolicy struct {
+	MaxAttempts  int              // including the first one, 1 disables retries
+	InitialDelay time.Duration    // before the first retry, doubled for each one after
+	MaxDelay     time.Duration    // caps the delay, 0 for no cap
+	Jitter       float64          // share of each delay picked at random, 0 to 1, so clients retrying together spread out
+	Retryable    func(error) bool // IsRetryable by default
+}
+
+// DefaultRetryPolicy retries a request up to three times, waiting 0.5s, 1s and 2s give or take 20%.
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 4, InitialDelay: 500 * time.Millisecond, MaxDelay: 10 * time.Second, Jitter: 0.2}
+
+// WithRetryPolicy retries requests failing with a transient error, network errors, rate limits and
+// server errors by default, with exponential backoff, e.g. WithRetryPolicy(DefaultRetryPolicy).
+// When the provider says how long to wait, in Retry-After or its rate limit headers, the retry waits
+// that long instead; if that is longer than MaxDelay, the error (see RateLimitError.Reset) is returned
+// for the caller to schedule the request. Streams are retried until their first event only.
+// Requests are not retried otherwise.
+func WithRetryPolicy(policy RetryPolicy) AgentOption {
+	return func(a *AgentConfig) {
+		a.RetryPolicy = &policy
+	}
+}
+
+// delay returns how long to wait before retry number retry, counting from 1.
+func (policy RetryPolicy) delay(retry int) time.Duration {
+	delay := policy.InitialDelay
+	for i := 1; i < retry && (policy.MaxDelay <= 0 || delay < policy.MaxDelay); i++ {
+		delay *= 2
+	}
+	if policy.MaxDelay > 0 && delay > policy.MaxDelay {
+		delay = policy.MaxDelay
+	}
+	if policy.Jitter > 0 {
+		spread := float64(delay) * policy.Jitter
+		delay += time.Duration(spread * (2*rand.Float64() - 1))
+	}
+	return delay
+}
+
+// retry calls send until it succeeds, fails for good or the attempts of the retry policy run out.
+// send reports whether the answer had started, after which the request isn't sent again.
+func (config *AgentConfig) retry(ctx context.Context, send func() (responseMeta, bool, error)) (responseMeta, error) {
+	policy := config.RetryPolicy
+	if policy == nil {
+		meta, _, err := send()
+		return meta, err
+	}
+	retryable := policy.Retryable
+	if retryable == nil {
+		retryable = IsRetryable
+	}
+	for attempt := 1; ; attempt++ {
+		meta, started, err := send()
+		// the caller's deadline passing fails the request like a timeout, but a retry won't make it
+		if err == nil || started || attempt >= policy.MaxAttempts || !retryable(err) || ctx.Err() != nil {
+			return meta, err
+		}
+		delay := policy.delay(attempt)
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+			if policy.MaxDelay > 0 && apiErr.RetryAfter > policy.MaxDelay {
+				return meta, err
+			}
+			delay = apiErr.RetryAfter
+		}
+		config.logf("%v, retrying in %s\n", err, delay.Round(time.Millisecond))
+		waitCtx, cancel := interruptible(ctx)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+			cancel(nil)
+		case <-waitCtx.Done():
+			timer.Stop()
+			cancel(nil)
+			return meta, interruption(waitCtx, ctx.Err())
+		}
+	}
+}
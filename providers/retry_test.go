@@ -0,0 +1,81 @@
+package provider
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryByErrorClass(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		header map[string]string
+		retry  bool
+	}{
+		{name: "server error", status: http.StatusBadGateway, body: `{"error":{"message":"bad gateway"}}`, retry: true},
+		{name: "overloaded", status: http.StatusServiceUnavailable, body: `{"error":{"message":"overloaded"}}`, retry: true},
+		{name: "rate limit", status: http.StatusTooManyRequests, body: `{"error":{"message":"slow down","code":"rate_limit_exceeded"}}`, header: map[string]string{"Retry-After": "0"}, retry: true},
+		{name: "exhausted quota", status: http.StatusTooManyRequests, body: `{"error":{"message":"no credit","type":"insufficient_quota","code":"insufficient_quota"}}`},
+		{name: "bad request", status: http.StatusBadRequest, body: `{"error":{"message":"invalid model"}}`},
+		{name: "auth", status: http.StatusUnauthorized, body: `{"error":{"message":"invalid key"}}`},
+		{name: "context length", status: http.StatusBadRequest, body: `{"error":{"message":"too long","code":"context_length_exceeded"}}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if requests.Add(1) == 1 {
+					for key, value := range test.header {
+						w.Header().Set(key, value)
+					}
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(test.status)
+					w.Write([]byte(test.body))
+					return
+				}
+				json.NewEncoder(w).Encode(map[string]any{
+					"choices": []map[string]any{{"message": textReply("Paris"), "finish_reason": "stop"}},
+				})
+			}))
+			defer server.Close()
+			agent, err := NewAgent("custom:test-model", WithBaseURL(server.URL),
+				WithRetryPolicy(RetryPolicy{MaxAttempts: 3, InitialDelay: time.Millisecond}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := agent.Run("capital of France?")
+			if test.retry {
+				if err != nil || result.Text != "Paris" || requests.Load() != 2 {
+					t.Errorf("got %v after %d requests, want the answer of the retry", err, requests.Load())
+				}
+				return
+			}
+			if err == nil || IsRetryable(err) || requests.Load() != 1 {
+				t.Errorf("got %v after %d requests, want the error without a retry", err, requests.Load())
+			}
+		})
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.Error(w, `{"error":{"message":"overloaded"}}`, http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	agent, err := NewAgent("custom:test-model", WithBaseURL(server.URL),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 3, InitialDelay: time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := agent.Run("capital of France?"); !IsRetryable(err) || requests.Load() != 3 {
+		t.Errorf("got %v after %d requests, want the last error after every attempt", err, requests.Load())
+	}
+}
@@ -0,0 +1,195 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// RoutingRequest describes a single provider request for routing rules.
+type RoutingRequest struct {
+	Prompt          string
+	Messages        []Message
+	EstimatedTokens int
+	ToolLoop        bool         // the request continues a tool call round trip
+	Images          bool         // the messages carry images
+	Tools           []string     // registered tools
+	Latency         LatencyClass // see ContextWithLatencyClass
+}
+
+// LatencyClass tells routes how long the caller can wait for an answer.
+type LatencyClass string
+
+const (
+	LatencyInteractive LatencyClass = "interactive" // a user is waiting
+	LatencyBatch       LatencyClass = "batch"       // background work, throughput over speed
+)
+
+type latencyClassKey struct{}
+
+// ContextWithLatencyClass marks the runs made with ctx for routes matching on latency.
+func ContextWithLatencyClass(ctx context.Context, class LatencyClass) context.Context {
+	return context.WithValue(ctx, latencyClassKey{}, class)
+}
+
+// Route sends the requests it matches to Model. Routes skip models that Capabilities lists
+// without the vision or tool support a request needs.
+type Route struct {
+	Model  string // "provider:model", must share the agent's provider
+	Reason string // recorded as RoundTripStats.Route
+	Match  func(request RoutingRequest) bool
+}
+
+// WithRoutes picks the model of every request from routes, the first matching one winning.
+// Requests no route matches use the agent's model (or WithCheaperModel's routing), e.g.
+//
+//	provider.NewAgent("openai:gpt-4o-mini", provider.WithRoutes(
+//		provider.RouteImages("openai:gpt-4o"),
+//		provider.RouteAboveTokens("openai:gpt-4o", 8000)))
+func WithRoutes(routes ...Route) AgentOption {
+	return func(a *AgentConfig) {
+		a.Routes = append(a.Routes, routes...)
+	}
+}
+
+// RouteImages routes requests carrying images.
+func RouteImages(model string) Route {
+	return Route{Model: model, Reason: "images", Match: func(request RoutingRequest) bool {
+		return request.Images
+	}}
+}
+
+// RouteAboveTokens routes requests whose estimated size exceeds maxTokens.
+func RouteAboveTokens(model string, maxTokens int) Route {
+	return Route{Model: model, Reason: fmt.Sprintf("above %d tokens", maxTokens), Match: func(request RoutingRequest) bool {
+		return request.EstimatedTokens > maxTokens
+	}}
+}
+
+// RouteTools routes the requests of agents with registered tools.
+func RouteTools(model string) Route {
+	return Route{Model: model, Reason: "tools", Match: func(request RoutingRequest) bool {
+		return len(request.Tools) > 0
+	}}
+}
+
+// RouteLatency routes the requests of runs marked with class.
+func RouteLatency(model string, class LatencyClass) Route {
+	return Route{Model: model, Reason: string(class) + " latency", Match: func(request RoutingRequest) bool {
+		return request.Latency == class
+	}}
+}
+
+// RoutingRule reports whether a request needs the agent's primary model.
+type RoutingRule func(request RoutingRequest) bool
+
+type ModelRouting struct {
+	CheapModel string // "provider:model", must share the agent's provider
+	Rules      []RoutingRule
+}
+
+// WithCheaperModel sends requests to cheapModel unless one of the rules escalates
+// them to the agent's primary model, e.g.
+//
+//	provider.NewAgent("openai:gpt-4o", provider.WithCheaperModel("openai:gpt-4o-mini",
+//		provider.EscalateAboveTokens(2000), provider.EscalateOnToolLoop()))
+func WithCheaperModel(cheapModel string, rules ...RoutingRule) AgentOption {
+	return func(a *AgentConfig) {
+		a.Routing = &ModelRouting{CheapModel: cheapModel, Rules: rules}
+	}
+}
+
+// EscalateAboveTokens uses the primary model once the estimated request size exceeds maxTokens.
+func EscalateAboveTokens(maxTokens int) RoutingRule {
+	return func(request RoutingRequest) bool {
+		return request.EstimatedTokens > maxTokens
+	}
+}
+
+// EscalateOnToolLoop uses the primary model for every request after the first tool call.
+func EscalateOnToolLoop() RoutingRule {
+	return func(request RoutingRequest) bool {
+		return request.ToolLoop
+	}
+}
+
+// EstimateTokens approximates the token count of text at four characters per token.
+func EstimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
+
+func EstimateMessagesTokens(messages []Message) int {
+	total := 0
+	for _, msg := range messages {
+		total += EstimateTokens(msg.Text)
+		if msg.ToolIntent != nil {
+			total += EstimateTokens(msg.ToolIntent.Name) + EstimateTokens(msg.ToolIntent.Arguments)
+		}
+		if msg.ToolResult != nil {
+			total += EstimateTokens(msg.ToolResult.Output)
+		}
+	}
+	return total
+}
+
+// routeModel returns the model name to use for a request and the reason it was picked,
+// empty for the agent's own model.
+func (config *AgentConfig) routeModel(ctx context.Context, prompt string, messageHistory [][]Message) (string, string) {
+	if config.Routing == nil && len(config.Routes) == 0 {
+		return config.ModelName, ""
+	}
+	var history []Message
+	if len(messageHistory) > 0 {
+		history = messageHistory[0]
+	}
+	request := RoutingRequest{
+		Prompt:          prompt,
+		Messages:        history,
+		EstimatedTokens: EstimateTokens(config.SystemPrompt) + EstimateTokens(prompt) + EstimateMessagesTokens(history),
+		ToolLoop:        len(history) > 0 && history[len(history)-1].ToolResult != nil,
+		Tools:           config.ToolStore.names(),
+	}
+	request.Latency, _ = ctx.Value(latencyClassKey{}).(LatencyClass)
+	for _, msg := range history {
+		request.Images = request.Images || len(msg.Images) > 0
+	}
+
+	for _, route := range config.Routes {
+		if !route.Match(request) {
+			continue
+		}
+		capabilities, known := Capabilities[config.provider+":"+route.Model]
+		if known && ((request.Images && !capabilities.Vision) || (len(request.Tools) > 0 && !capabilities.Tools)) {
+			continue
+		}
+		config.logf("routing request to %s (%s)\n", route.Model, route.Reason)
+		return route.Model, route.Reason
+	}
+
+	if config.Routing == nil {
+		return config.ModelName, ""
+	}
+	for _, rule := range config.Routing.Rules {
+		if rule(request) {
+			return config.ModelName, ""
+		}
+	}
+	config.logf("routing request to cheaper model %s\n", config.Routing.CheapModel)
+	return config.Routing.CheapModel, "cheaper model"
+}
+
+// resolveRoutes checks that the route models are available on provider and strips the provider prefix.
+func resolveRoutes(routes []Route, provider string) error {
+	for i := range routes {
+		if !ModelAvailable(routes[i].Model) {
+			return fmt.Errorf("route model %s not available", routes[i].Model)
+		}
+		routeProvider, model, _ := strings.Cut(routes[i].Model, ":")
+		if routeProvider != provider {
+			return fmt.Errorf("route models must use the same provider as the agent")
+		}
+		routes[i].Model = model
+	}
+	return nil
+}
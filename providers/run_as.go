@@ -0,0 +1,50 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// runAsAttempts bounds how often the model is asked again after answering with invalid JSON.
+const runAsAttempts = 3
+
+// RunAs runs prompt on agent and decodes the answer into T, a struct described with json and
+// description tags. The model is given T's JSON schema and asked for JSON, natively where the
+// provider offers it; answers that don't decode are sent back to the model to be fixed.
+func RunAs[T any](a Agent, prompt string, history ...[]Message) (T, *AgentResult, error) {
+	return RunAsContext[T](context.Background(), a, prompt, history...)
+}
+
+// RunAsContext is RunAs with a context.
+func RunAsContext[T any](ctx context.Context, a Agent, prompt string, history ...[]Message) (T, *AgentResult, error) {
+	var value T
+	if t := reflect.TypeOf(value); t == nil || t.Kind() != reflect.Struct {
+		return value, nil, fmt.Errorf("run as: %T is not a struct", value)
+	}
+	properties, required := ConvertToProperties(value)
+	schema := &Parameters{Type: "object", Required: required, Properties: properties}
+	encoded, err := json.Marshal(schema)
+	if err != nil {
+		return value, nil, err
+	}
+	ctx = contextWithResponseFormat(ctx, &ResponseFormat{Type: "json_schema", Name: reflect.TypeOf(value).Name(), Schema: schema})
+	prompt = fmt.Sprintf("%s\n\nRespond with JSON only, matching this JSON schema:\n%s", prompt, encoded)
+
+	for attempt := 1; ; attempt++ {
+		result, err := a.RunContext(ctx, prompt, history...)
+		if err != nil {
+			return value, result, fmt.Errorf("run as: %w", err)
+		}
+		err = json.Unmarshal([]byte(stripCodeFence(result.Text)), &value)
+		if err == nil {
+			return value, result, nil
+		}
+		if attempt == runAsAttempts {
+			return value, result, fmt.Errorf("run as: model returned invalid json: %w", err)
+		}
+		history = [][]Message{result.AllMessages}
+		prompt = fmt.Sprintf("Your answer is not valid: %v. Respond again with JSON only, matching the schema.", err)
+	}
+}
@@ -0,0 +1,216 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// SemanticCache answers a prompt from a stored result when a previously seen prompt
+// is similar enough, measured by cosine similarity of their embeddings.
+// Only single prompts without message history are cached, and only answers given without
+// calling tools: those depend on more than the prompt, like the data of the user asking.
+// Entries are scoped to the agent's model, settings and tools, the run's response format and
+// the run's Identity, runs without an identity share theirs. Hits failing the agent's output
+// guardrails are misses.
+type SemanticCache struct {
+	Embedder   Embedder
+	Threshold  float32       // minimum cosine similarity for a hit, e.g. 0.95
+	TTL        time.Duration // zero keeps entries forever
+	MaxEntries int           // zero means unbounded; oldest entries are evicted first
+
+	mu      sync.Mutex
+	entries []semanticCacheEntry
+	hits    int
+	misses  int
+}
+
+type semanticCacheEntry struct {
+	scope     string
+	embedding []float32
+	result    AgentResult
+	expiresAt time.Time
+}
+
+type SemanticCacheStats struct {
+	Hits    int
+	Misses  int
+	Entries int
+}
+
+func NewSemanticCache(embedder Embedder, threshold float32) *SemanticCache {
+	return &SemanticCache{Embedder: embedder, Threshold: threshold}
+}
+
+func WithSemanticCache(cache *SemanticCache) AgentOption {
+	return func(a *AgentConfig) {
+		a.SemanticCache = cache
+	}
+}
+
+func (cache *SemanticCache) Stats() SemanticCacheStats {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	return SemanticCacheStats{Hits: cache.hits, Misses: cache.misses, Entries: len(cache.entries)}
+}
+
+// Lookup returns the best cached result for prompt within scope, along with the prompt embedding
+// so a miss can be stored without embedding the prompt twice.
+func (cache *SemanticCache) Lookup(scope string, prompt string) (*AgentResult, []float32, error) {
+	return cache.lookup(scope, prompt, time.Now())
+}
+
+// lookup is Lookup at time now, the time of the agent's clock.
+func (cache *SemanticCache) lookup(scope string, prompt string, now time.Time) (*AgentResult, []float32, error) {
+	embedding, err := cache.Embedder.Embed(prompt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	var best *semanticCacheEntry
+	var bestScore float32
+	live := cache.entries[:0]
+	for i := range cache.entries {
+		entry := cache.entries[i]
+		if !entry.expiresAt.IsZero() && now.After(entry.expiresAt) {
+			continue
+		}
+		live = append(live, entry)
+		if entry.scope != scope {
+			continue
+		}
+		if score := CosineSimilarity(embedding, entry.embedding); score >= cache.Threshold && score > bestScore {
+			best = &live[len(live)-1]
+			bestScore = score
+		}
+	}
+	cache.entries = live
+
+	if best == nil {
+		cache.misses++
+		return nil, embedding, nil
+	}
+	cache.hits++
+	result := best.result
+	result.AllMessages = cloneMessages(result.AllMessages)
+	result.NewMessages = cloneMessages(result.NewMessages)
+	return &result, embedding, nil
+}
+
+// countAsMiss turns the last hit into a miss, for a hit the run can't use.
+func (cache *SemanticCache) countAsMiss() {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.hits--
+	cache.misses++
+}
+
+func (cache *SemanticCache) Store(scope string, embedding []float32, result *AgentResult) {
+	cache.store(scope, embedding, result, time.Now())
+}
+
+// store is Store at time now, the time of the agent's clock.
+func (cache *SemanticCache) store(scope string, embedding []float32, result *AgentResult, now time.Time) {
+	entry := semanticCacheEntry{scope: scope, embedding: embedding, result: *result}
+	entry.result.AllMessages = cloneMessages(result.AllMessages)
+	entry.result.NewMessages = cloneMessages(result.NewMessages)
+	if cache.TTL > 0 {
+		entry.expiresAt = now.Add(cache.TTL)
+	}
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.entries = append(cache.entries, entry)
+	if cache.MaxEntries > 0 && len(cache.entries) > cache.MaxEntries {
+		cache.entries = cache.entries[len(cache.entries)-cache.MaxEntries:]
+	}
+}
+
+// semanticScope is what a cached answer must share with the run it answers: every setting that
+// shapes answers, with the response format of the run, and the run's identity. Output guardrails
+// are functions, semanticLookup checks hits against them instead.
+func (config *AgentConfig) semanticScope(ctx context.Context, providerName string) string {
+	var subject string
+	if identity, ok := IdentityFromContext(ctx); ok {
+		subject = identity.Subject
+	}
+	var fallbackModels []string
+	if config.OpenRouter != nil {
+		fallbackModels = config.OpenRouter.Models
+	}
+	scope, _ := json.Marshal([]any{
+		providerName, config.ModelName, config.SystemPrompt, config.Temperature, config.ReasoningEffort,
+		config.MaxTokens, config.StopSequences, config.LogitBias, config.responseFormat(ctx),
+		config.WebSearch, config.ImageGeneration, config.OpenRouter, fallbackModels,
+		config.ToolStore.names(), subject,
+	})
+	return string(scope)
+}
+
+// cloneMessages copies messages deeply, so results handed out by a cache don't share them.
+func cloneMessages(messages []Message) []Message {
+	if messages == nil {
+		return nil
+	}
+	data, err := json.Marshal(messages)
+	if err != nil {
+		return append([]Message(nil), messages...)
+	}
+	var clone []Message
+	if err := json.Unmarshal(data, &clone); err != nil {
+		return append([]Message(nil), messages...)
+	}
+	return clone
+}
+
+// semanticLookup consults the semantic cache for a fresh prompt. Embedding failures are logged and treated as misses.
+// A hit is the cached answer to prompt: the user message is prompt, not the similar prompt that was cached.
+func (config *AgentConfig) semanticLookup(ctx context.Context, providerName string, prompt string, messageHistory [][]Message) (*AgentResult, []float32) {
+	if config.SemanticCache == nil || config.DryRun || prompt == "" || len(messageHistory) > 0 {
+		return nil, nil
+	}
+	result, embedding, err := config.SemanticCache.lookup(config.semanticScope(ctx, providerName), prompt, config.now())
+	if err != nil {
+		config.logf("semantic cache lookup failed: %v\n", err)
+		return nil, nil
+	}
+	if result == nil {
+		return nil, embedding
+	}
+	for _, validate := range config.OutputValidators {
+		if violation := validate(result.Text); violation != nil {
+			config.logf("semantic cache hit rejected by guardrail: %v\n", violation)
+			config.SemanticCache.countAsMiss()
+			return nil, embedding
+		}
+	}
+	newMessages := []Message{{Role: "user", Text: prompt}}
+	for _, msg := range result.NewMessages {
+		if !isTurnStart(msg) {
+			newMessages = append(newMessages, msg)
+		}
+	}
+	result.NewMessages = newMessages
+	result.AllMessages = append([]Message(nil), newMessages...)
+	result.RoundTrips = append([]RoundTripStats(nil), result.RoundTrips...)
+	for i := range result.RoundTrips {
+		result.RoundTrips[i].Cached = true
+		result.RoundTrips[i].CostUSD = 0
+	}
+	return result, embedding
+}
+
+// semanticStore caches the answer of a run, if it is complete and was given without tools.
+func (config *AgentConfig) semanticStore(ctx context.Context, providerName string, embedding []float32, result *AgentResult) {
+	if config.SemanticCache == nil || embedding == nil || result.Text == "" || result.Incomplete || result.Refused() {
+		return
+	}
+	for _, msg := range result.NewMessages {
+		if msg.ToolIntent != nil || msg.ToolResult != nil {
+			return
+		}
+	}
+	config.SemanticCache.store(config.semanticScope(ctx, providerName), embedding, result, config.now())
+}
@@ -0,0 +1,136 @@
+package provider
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// wordEmbedder embeds a text as the counts of a few words, so prompts sharing them are similar.
+type wordEmbedder struct{}
+
+func (wordEmbedder) Embed(text string) ([]float32, error) {
+	vector := make([]float32, 4)
+	for _, word := range strings.Fields(strings.ToLower(text)) {
+		switch strings.Trim(word, "?.!,") {
+		case "balance":
+			vector[0]++
+		case "weather":
+			vector[1]++
+		case "capital":
+			vector[2]++
+		default:
+			vector[3] += 0.1
+		}
+	}
+	return vector, nil
+}
+
+func TestSemanticCache(t *testing.T) {
+	cache := NewSemanticCache(wordEmbedder{}, 0.9)
+	var transcripts []*Transcript
+	log := ConversationLogFunc(func(transcript *Transcript) error {
+		transcripts = append(transcripts, transcript)
+		return nil
+	})
+	server := newChatServer(t, textReply("Paris"), textReply("Paris again"), textReply("Rome"))
+	agent := server.agent(t, WithSemanticCache(cache), WithConversationLog(log, nil))
+	alice := ContextWithIdentity(context.Background(), &Identity{Subject: "alice"})
+	bob := ContextWithIdentity(context.Background(), &Identity{Subject: "bob"})
+
+	first, err := agent.RunContext(alice, "What is the capital of France?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hit, err := agent.RunContext(alice, "capital of France?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(server.received()) != 1 || hit.Text != "Paris" {
+		t.Fatalf("similar prompt: %d requests, text %q, want a hit", len(server.received()), hit.Text)
+	}
+	if hit.NewMessages[0].Text != "capital of France?" || hit.AllMessages[0].Text != "capital of France?" {
+		t.Errorf("hit answers %q, want the prompt asked", hit.NewMessages[0].Text)
+	}
+	if !hit.RoundTrips[0].Cached || hit.Cost() != 0 || hit.Usage().TotalTokens != 0 {
+		t.Errorf("hit round trips %+v, want them cached and free", hit.RoundTrips)
+	}
+	if len(transcripts) != 2 || transcripts[1].Messages[0].Text != "capital of France?" {
+		t.Errorf("%d transcripts, want the hit logged too", len(transcripts))
+	}
+
+	// results handed out don't share messages with the cache
+	hit.NewMessages[1].Text = "changed"
+	first.NewMessages[1].Text = "changed"
+	again, _ := agent.RunContext(alice, "the capital of France?")
+	if again.Text != "Paris" || again.NewMessages[1].Text != "Paris" {
+		t.Errorf("cached answer changed to %q", again.NewMessages[1].Text)
+	}
+
+	// another user doesn't get alice's answers
+	other, err := agent.RunContext(bob, "What is the capital of France?")
+	if err != nil || other.Text != "Paris again" {
+		t.Errorf("another identity: %v, %q, want a miss", err, other.Text)
+	}
+	if stats := cache.Stats(); stats.Hits != 2 || stats.Entries != 2 {
+		t.Errorf("stats %+v, want 2 hits and 2 entries", stats)
+	}
+}
+
+func TestSemanticCacheSkipsToolAnswers(t *testing.T) {
+	cache := NewSemanticCache(wordEmbedder{}, 0.9)
+	server := newChatServer(t,
+		toolReply("call_1", "Balance", `{"query":"alice"}`), textReply("You have $10"),
+		textReply("I can't tell"))
+	agent := server.agent(t, WithSemanticCache(cache))
+	balance := NewTool("Balance", "the user's balance", func(params lookupParams) string { return "$10" })
+	if err := agent.AddTool(balance); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := agent.RunContext(context.Background(), "what's my balance"); err != nil {
+		t.Fatal(err)
+	}
+	result, err := agent.RunContext(context.Background(), "what's my balance?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.NewMessages[len(result.NewMessages)-1].Text != "I can't tell" || cache.Stats().Entries != 1 {
+		t.Errorf("answer %q with %d entries, want the tool answer not cached", result.Text, cache.Stats().Entries)
+	}
+}
+
+func TestSemanticCacheScope(t *testing.T) {
+	cache := NewSemanticCache(wordEmbedder{}, 0.9)
+	server := newChatServer(t, textReply("Paris"), textReply("Paris."), textReply(`{"city":"Paris"}`), textReply("Paris, France"))
+	agent := server.agent(t, WithSemanticCache(cache))
+	if _, err := agent.Run("What is the capital of France?"); err != nil {
+		t.Fatal(err)
+	}
+
+	runs := []struct {
+		name  string
+		agent Agent
+		ctx   context.Context
+		text  string
+	}{
+		{"max tokens", server.agent(t, WithSemanticCache(cache), WithMaxTokens(5)), context.Background(), "Paris."},
+		{"response format of the run", agent, contextWithResponseFormat(context.Background(), &ResponseFormat{Type: "json_object"}), `{"city":"Paris"}`},
+		{"guardrail failing the hit", server.agent(t, WithSemanticCache(cache), WithOutputGuardrails(LengthBetween(10, 0))), context.Background(), "Paris, France"},
+	}
+	for i, run := range runs {
+		result, err := run.agent.RunContext(run.ctx, "capital of France?")
+		if err != nil {
+			t.Fatalf("%s: %v", run.name, err)
+		}
+		if result.Text != run.text || len(server.received()) != i+2 {
+			t.Errorf("%s: answered %q after %d requests, want a miss", run.name, result.Text, len(server.received()))
+		}
+	}
+
+	if _, err := agent.Run("capital of France?"); err != nil || len(server.received()) != 4 {
+		t.Errorf("same settings: %v after %d requests, want a hit", err, len(server.received()))
+	}
+	if stats := cache.Stats(); stats.Hits != 1 || stats.Misses != 4 {
+		t.Errorf("stats %+v, want 1 hit and 4 misses", stats)
+	}
+}
@@ -0,0 +1,299 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+var ErrSessionBudgetExceeded = errors.New("session token budget exceeded")
+
+// SessionState is what a SessionStore persists for a conversation.
+type SessionState struct {
+	Messages  []Message       `json:"messages"`
+	Budget    *TokenBudget    `json:"budget,omitempty"`
+	Encrypted *EncryptedState `json:"encrypted,omitempty"` // the state itself, see EncryptedSessionStore
+	UserID    string          `json:"user_id,omitempty"`   // the first user of the session, see WithSessionUser
+	Users     []string        `json:"users,omitempty"`     // every user who took part, see WithSessionUser
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// TokenBudget caps the tokens (input and output) a whole conversation may consume.
+type TokenBudget struct {
+	MaxTokens  int `json:"max_tokens"`
+	UsedTokens int `json:"used_tokens"`
+}
+
+// Remaining returns the tokens left in the budget, never below 0.
+func (budget *TokenBudget) Remaining() int {
+	if budget.UsedTokens >= budget.MaxTokens {
+		return 0
+	}
+	return budget.MaxTokens - budget.UsedTokens
+}
+
+// SessionStore persists sessions by id. Load returns nil, nil for unknown sessions.
+type SessionStore interface {
+	Load(id string) (*SessionState, error)
+	Save(id string, state *SessionState) error
+}
+
+// Session is a persisted multi-turn conversation with an agent.
+type Session struct {
+	ID    string
+	agent Agent
+	store SessionStore
+
+	mu        sync.Mutex
+	state     *SessionState
+	toolState []func(context.Context) context.Context // see WithToolState
+	clock     Clock                                   // see WithSessionClock
+}
+
+type SessionOption func(*Session)
+
+// WithSessionClock stamps the session's updates with the time of clock instead of the clock of
+// the agent, which is the system clock unless set WithClock.
+func WithSessionClock(clock Clock) SessionOption {
+	return func(session *Session) {
+		session.clock = clock
+	}
+}
+
+// WithSessionBudget limits the tokens the conversation may consume over all its runs.
+// A budget already persisted for the session takes precedence. The check happens before each run,
+// so the run that crosses the limit completes and later runs fail with ErrSessionBudgetExceeded.
+// Runs are charged like AgentResult.Usage counts, failed runs too for the round trips they made.
+func WithSessionBudget(maxTokens int) SessionOption {
+	return func(session *Session) {
+		if session.state.Budget == nil {
+			session.state.Budget = &TokenBudget{MaxTokens: maxTokens}
+		}
+	}
+}
+
+// NewSession loads the session id from store, or starts it when it does not exist yet.
+func NewSession(id string, agent Agent, store SessionStore, opts ...SessionOption) (*Session, error) {
+	state, err := store.Load(id)
+	if err != nil {
+		return nil, fmt.Errorf("load session %s: %w", id, err)
+	}
+	if state == nil {
+		state = &SessionState{}
+	}
+	session := &Session{ID: id, agent: agent, store: store, state: state, clock: systemClock{}}
+	if c, ok := agent.(configured); ok && c.agentConfig().Clock != nil {
+		session.clock = c.agentConfig().Clock
+	}
+	for _, opt := range opts {
+		opt(session)
+	}
+	return session, nil
+}
+
+// Run sends prompt with the session's history and persists the updated conversation.
+func (session *Session) Run(prompt string) (*AgentResult, error) {
+	return session.RunContext(context.Background(), prompt)
+}
+
+// RunContext is Run with a context, e.g. one carrying the user's Identity.
+func (session *Session) RunContext(ctx context.Context, prompt string) (*AgentResult, error) {
+	return session.RunWithMessages(ctx, prompt, nil)
+}
+
+// RunWithMessages is RunContext with messages added to the conversation before prompt,
+// like a user message carrying images. They are persisted with the rest of the history.
+func (session *Session) RunWithMessages(ctx context.Context, prompt string, messages []Message) (*AgentResult, error) {
+	return session.run(ctx, prompt, messages, session.agent.RunContext)
+}
+
+// RunStream is RunContext streaming the answer like Agent.RunStream does. The conversation is
+// persisted before the StreamDone event, which carries the error of saving it if any.
+func (session *Session) RunStream(ctx context.Context, prompt string) <-chan StreamEvent {
+	events := make(chan StreamEvent, 64)
+	send := func(event StreamEvent) {
+		select {
+		case events <- event:
+		case <-ctx.Done():
+		}
+	}
+	go func() {
+		defer close(events)
+		result, err := session.run(ctx, prompt, nil, func(ctx context.Context, prompt string, history ...[]Message) (*AgentResult, error) {
+			var result *AgentResult
+			var err error
+			for event := range session.agent.RunStream(ctx, prompt, history...) {
+				if event.Type == StreamDone {
+					result, err = event.Result, event.Err
+					continue
+				}
+				send(event)
+			}
+			return result, err
+		})
+		send(StreamEvent{Type: StreamDone, Result: result, Err: err})
+	}()
+	return events
+}
+
+func (session *Session) run(ctx context.Context, prompt string, messages []Message, runAgent func(context.Context, string, ...[]Message) (*AgentResult, error)) (*AgentResult, error) {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	budget := session.state.Budget
+	if budget != nil && budget.Remaining() == 0 {
+		return nil, fmt.Errorf("session %s: %w (%d of %d tokens used)", session.ID, ErrSessionBudgetExceeded, budget.UsedTokens, budget.MaxTokens)
+	}
+
+	var history [][]Message
+	if len(session.state.Messages) > 0 || len(messages) > 0 {
+		history = append(history, append(append([]Message(nil), session.state.Messages...), messages...))
+	}
+	for _, bind := range session.toolState {
+		ctx = bind(ctx)
+	}
+	result, err := runAgent(ctx, prompt, history...)
+	// a failed run is charged for the round trips it made, or failing runs would get around the budget
+	if budget != nil && result != nil {
+		budget.UsedTokens += result.Usage().TotalTokens
+	}
+	if err != nil {
+		if budget != nil && result != nil {
+			if saveErr := session.store.Save(session.ID, session.state); saveErr != nil {
+				err = errors.Join(err, fmt.Errorf("save session %s: %w", session.ID, saveErr))
+			}
+		}
+		return result, err
+	}
+
+	session.state.Messages = result.AllMessages
+	session.state.UpdatedAt = session.clock.Now()
+	if identity, ok := IdentityFromContext(ctx); ok && identity.Subject != "" {
+		session.state.addUser(identity.Subject)
+	}
+	if err := session.store.Save(session.ID, session.state); err != nil {
+		return result, fmt.Errorf("save session %s: %w", session.ID, err)
+	}
+	return result, nil
+}
+
+// Messages returns the conversation so far.
+func (session *Session) Messages() []Message {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	return append([]Message(nil), session.state.Messages...)
+}
+
+// Budget returns a copy of the session's budget, or nil when it has none.
+func (session *Session) Budget() *TokenBudget {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if session.state.Budget == nil {
+		return nil
+	}
+	budget := *session.state.Budget
+	return &budget
+}
+
+// MemorySessionStore keeps sessions in process memory.
+type MemorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[string][]byte
+}
+
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: make(map[string][]byte)}
+}
+
+func (store *MemorySessionStore) Load(id string) (*SessionState, error) {
+	store.mu.Lock()
+	data, exists := store.sessions[id]
+	store.mu.Unlock()
+	if !exists {
+		return nil, nil
+	}
+	var state SessionState
+	return &state, json.Unmarshal(data, &state)
+}
+
+func (store *MemorySessionStore) Save(id string, state *SessionState) error {
+	data, err := json.Marshal(state) // stored encoded so callers can't mutate it
+	if err != nil {
+		return err
+	}
+	store.mu.Lock()
+	store.sessions[id] = data
+	store.mu.Unlock()
+	return nil
+}
+
+// FileSessionStore keeps one JSON file per session in a directory.
+type FileSessionStore struct {
+	Dir string
+}
+
+func NewFileSessionStore(dir string) (*FileSessionStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &FileSessionStore{Dir: dir}, nil
+}
+
+func (store *FileSessionStore) Load(id string) (*SessionState, error) {
+	var state SessionState
+	found, err := readJSONFile(store.Dir, id, &state)
+	if !found || err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func (store *FileSessionStore) Save(id string, state *SessionState) error {
+	return writeJSONFile(store.Dir, id, state)
+}
+
+// readJSONFile decodes the file of id in dir into v. It reports false when the file does not exist.
+func readJSONFile(dir string, id string, v any) (bool, error) {
+	path, err := jsonFilePath(dir, id)
+	if err != nil {
+		return false, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(data, v)
+}
+
+// writeJSONFile writes v as the file of id in dir atomically, so a crash never leaves a truncated file.
+func writeJSONFile(dir string, id string, v any) error {
+	path, err := jsonFilePath(dir, id)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, id+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
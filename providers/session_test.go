@@ -0,0 +1,61 @@
+package provider
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSessionBudget(t *testing.T) {
+	cache := NewSemanticCache(wordEmbedder{}, 0.9)
+	server := newChatServer(t, textReply("Paris"), toolReply("call_1", "Lookup", `{"query":"weather"}`), textReply("You're welcome"))
+	store := NewMemorySessionStore()
+
+	newSession := func(opts ...AgentOption) *Session {
+		agent := server.agent(t, append([]AgentOption{WithSemanticCache(cache)}, opts...)...)
+		if err := agent.AddTool(NewTool("Lookup", "look something up", func(params lookupParams) string { return "sunny" })); err != nil {
+			t.Fatal(err)
+		}
+		session, err := NewSession("budgeted", agent, store, WithSessionBudget(1000))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return session
+	}
+	used := func() int {
+		state, err := store.Load("budgeted")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return state.Budget.UsedTokens
+	}
+
+	// warm the semantic cache outside the session
+	warm := server.agent(t, WithSemanticCache(cache))
+	if err := warm.AddTool(NewTool("Lookup", "look something up", func(params lookupParams) string { return "sunny" })); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := warm.Run("What is the capital of France?"); err != nil {
+		t.Fatal(err)
+	}
+
+	// answered by the semantic cache, for free
+	if _, err := newSession().Run("capital of France?"); err != nil {
+		t.Fatal(err)
+	}
+	if used() != 0 {
+		t.Errorf("used %d tokens after a cached run, want it free", used())
+	}
+	// the run fails on its own budget after a round trip, which the session still pays for
+	if _, err := newSession(WithBudget(10, 0)).Run("how is the weather?"); !errors.Is(err, ErrBudgetExceeded) {
+		t.Fatalf("got %v, want the run to fail on its budget", err)
+	}
+	if used() != 120 {
+		t.Errorf("used %d tokens after a failed run, want its round trip charged", used())
+	}
+	if _, err := newSession().Run("thanks"); err != nil {
+		t.Fatal(err)
+	}
+	if used() != 240 {
+		t.Errorf("used %d tokens after another run, want 240", used())
+	}
+}
@@ -0,0 +1,94 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrShuttingDown is returned by runs started after Shutdown was called.
+var ErrShuttingDown = errors.New("gossip is shutting down")
+
+// inFlight tracks the runs of the process for Shutdown.
+var inFlight = struct {
+	sync.Mutex
+	closing bool
+	runs    sync.WaitGroup
+	hooks   []func(context.Context) error
+	// interrupt is canceled when Shutdown gives up waiting, interrupting the runs still going
+	interrupt context.Context
+	cancel    context.CancelFunc
+}{}
+
+func init() {
+	inFlight.interrupt, inFlight.cancel = context.WithCancel(context.Background())
+}
+
+type inFlightKey struct{}
+
+// OnShutdown has Shutdown call hook once the runs finished, e.g. to close a FileConversationLog or
+// flush a metrics exporter. Hooks are called in the order they were added.
+func OnShutdown(hook func(ctx context.Context) error) {
+	inFlight.Lock()
+	defer inFlight.Unlock()
+	inFlight.hooks = append(inFlight.hooks, hook)
+}
+
+// Shutdown stops the process from starting runs, which fail with ErrShuttingDown from then on,
+// and waits for the runs in flight to finish, tool calls and nested agent runs included. When ctx
+// is done first, the runs still going are interrupted (see ContextWithInterrupt): they return what
+// they have and, with WithCheckpoints, leave a checkpoint to resume from. Shutdown then calls the
+// OnShutdown hooks and returns ctx's error, if it ended the wait, together with theirs.
+func Shutdown(ctx context.Context) error {
+	inFlight.Lock()
+	inFlight.closing = true
+	hooks := append([]func(context.Context) error(nil), inFlight.hooks...)
+	inFlight.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		inFlight.runs.Wait()
+		close(drained)
+	}()
+	var errs []error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		errs = append(errs, ctx.Err())
+		inFlight.cancel()
+		<-drained
+	}
+	for _, hook := range hooks {
+		errs = append(errs, hook(ctx))
+	}
+	return errors.Join(errs...)
+}
+
+// beginRun counts the run of ctx as in flight until end is called. Calls made within a run,
+// by its tool loop or its tools, belong to it and are let through during a shutdown.
+func (config *AgentConfig) beginRun(ctx context.Context) (context.Context, func(), error) {
+	if ctx.Value(inFlightKey{}) != nil {
+		return ctx, func() {}, nil
+	}
+	inFlight.Lock()
+	defer inFlight.Unlock()
+	if inFlight.closing {
+		return ctx, nil, ErrShuttingDown
+	}
+	inFlight.runs.Add(1)
+
+	// the run is interrupted by the caller's interrupt or by a shutdown running out of time
+	interrupt, stop := context.WithCancel(context.Background())
+	stopOnShutdown := context.AfterFunc(inFlight.interrupt, stop)
+	stopOnInterrupt := func() bool { return false }
+	if callerInterrupt, ok := ctx.Value(interruptKey{}).(context.Context); ok {
+		stopOnInterrupt = context.AfterFunc(callerInterrupt, stop)
+	}
+	ctx = context.WithValue(context.WithValue(ctx, interruptKey{}, interrupt), inFlightKey{}, true)
+	return ctx, func() {
+		stopOnShutdown()
+		stopOnInterrupt()
+		stop()
+		inFlight.runs.Done()
+	}, nil
+}
@@ -0,0 +1,353 @@
+package provider
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// StreamEventType tells what a StreamEvent carries.
+type StreamEventType int
+
+const (
+	// StreamText carries a piece of the answer in Text.
+	StreamText StreamEventType = iota
+	// StreamToolCallStart announces a tool call, ToolCall holds its Id and Name.
+	StreamToolCallStart
+	// StreamToolCallDelta carries a piece of the arguments of the tool call ToolCall.Id in ToolCall.Arguments.
+	StreamToolCallDelta
+	// StreamRestart is sent when a stalled stream is requested again from scratch:
+	// whatever the current round trip streamed so far must be discarded.
+	StreamRestart
+	// StreamUsage closes every round trip of the run with its token counts in Usage.
+	StreamUsage
+	// StreamDone is the last event of RunStream, with the result of the run or the error it failed with.
+	StreamDone
+)
+
+// StreamEvent is a piece of a streamed response.
+type StreamEvent struct {
+	Type     StreamEventType
+	Text     string
+	ToolCall *ToolIntent
+	Usage    *RoundTripStats
+
+	Result *AgentResult // StreamDone only
+	Err    error        // StreamDone only
+}
+
+// StreamHandler receives the events of streamed responses, in order, on the goroutine running the agent
+// (with WithStreamPacing on a goroutine of their own, one event at a time).
+type StreamHandler func(event StreamEvent)
+
+// DefaultStallTimeout is how long a stream may go without receiving a byte when no WithStallTimeout is given.
+// Providers send keep-alive pings well within it while the model is busy.
+const DefaultStallTimeout = 60 * time.Second
+
+// maxStallRetries bounds how often a stalled stream is requested again before the run fails with ErrStreamStalled.
+const maxStallRetries = 2
+
+// ErrStreamStalled is returned when a streamed response stops sending data, e.g. over a half-dead connection.
+var ErrStreamStalled = errors.New("stream stalled")
+
+// WithStreaming streams provider responses and hands their pieces to handler as they arrive,
+// so answers can be shown while they are generated. Run still returns the complete result.
+// Streamed requests bypass the response cache.
+func WithStreaming(handler StreamHandler) AgentOption {
+	return func(a *AgentConfig) {
+		a.Stream = handler
+	}
+}
+
+// WithStallTimeout aborts streams that receive nothing for timeout and requests them again. Anthropic
+// resumes from the text streamed so far, the other providers start over (see StreamRestart).
+func WithStallTimeout(timeout time.Duration) AgentOption {
+	return func(a *AgentConfig) {
+		a.StallTimeout = timeout
+	}
+}
+
+// runStream runs a streamed run on its own goroutine and sends its events on the returned channel,
+// which is closed after the StreamDone event. A handler set WithStreaming gets the events as well.
+// Events are dropped once ctx is done, so a consumer that stops reading must cancel ctx.
+func runStream(ctx context.Context, config *AgentConfig, run func(context.Context) (*AgentResult, error)) <-chan StreamEvent {
+	events := make(chan StreamEvent, 64)
+	send := func(event StreamEvent) {
+		select {
+		case events <- event:
+		case <-ctx.Done():
+		}
+	}
+	handler := config.Stream
+	config.Stream = func(event StreamEvent) {
+		if handler != nil {
+			handler(event)
+		}
+		send(event)
+	}
+	go func() {
+		defer close(events)
+		result, err := run(ctx)
+		send(StreamEvent{Type: StreamDone, Result: result, Err: err})
+	}()
+	return events
+}
+
+// streamEmitter hands events to the stream handler and measures the time to the first one.
+type streamEmitter struct {
+	handler    StreamHandler
+	pacer      *streamPacer // WithStreamPacing only
+	clock      func() time.Time
+	start      time.Time
+	firstToken time.Duration
+	emitted    bool // since the last restart
+}
+
+// newStreamEmitter returns the emitter of a streamed request, which must be closed once the request is done.
+func (config *AgentConfig) newStreamEmitter() *streamEmitter {
+	emitter := &streamEmitter{handler: config.Stream, clock: config.now, start: config.now()}
+	if pacing := config.StreamPacing; pacing != nil && pacing.Chars > 0 && pacing.Interval > 0 {
+		emitter.pacer = newStreamPacer(config.Stream, *pacing)
+		emitter.handler = emitter.pacer.push
+	}
+	return emitter
+}
+
+// close waits for paced events to reach the handler.
+func (emitter *streamEmitter) close(ctx context.Context) {
+	if emitter.pacer != nil {
+		emitter.pacer.close(ctx)
+	}
+}
+
+func (emitter *streamEmitter) emit(event StreamEvent) {
+	if emitter.firstToken == 0 {
+		emitter.firstToken = emitter.clock().Sub(emitter.start)
+	}
+	emitter.emitted = true
+	emitter.handler(event)
+}
+
+// restart tells the handler to discard the events of a stalled attempt before it is sent again.
+func (emitter *streamEmitter) restart() {
+	if emitter.emitted {
+		emitter.handler(StreamEvent{Type: StreamRestart})
+		emitter.emitted = false
+	}
+}
+
+// finish completes the meta of the last attempt with the figures of the whole stream.
+func (emitter *streamEmitter) finish(meta responseMeta) responseMeta {
+	meta.Latency = emitter.clock().Sub(emitter.start)
+	meta.TimeToFirstToken = emitter.firstToken
+	return meta
+}
+
+// serverEvent is an event of a server-sent events stream.
+type serverEvent struct {
+	Event string // empty for unnamed events
+	Data  []byte
+}
+
+// postStream sends payload as JSON to a provider endpoint and passes the server-sent events of
+// the answer to handle. The stream fails with ErrStreamStalled when no byte arrives for the stall timeout.
+// It is retried and fails over like post until the first event arrives.
+func (config *AgentConfig) postStream(ctx context.Context, providerName string, endpoint string, headers map[string]string, payload any, handle func(serverEvent) error) (responseMeta, error) {
+	return config.retry(ctx, func() (responseMeta, bool, error) {
+		return config.failOver(ctx, endpoint, headers, payload, func(endpoint string, headers map[string]string, payload any) (responseMeta, bool, error) {
+			started := false
+			meta, err := config.postStreamTo(ctx, providerName, endpoint, headers, payload, func(event serverEvent) error {
+				started = true
+				return handle(event)
+			})
+			return meta, started, err
+		})
+	})
+}
+
+func (config *AgentConfig) postStreamTo(ctx context.Context, providerName string, endpoint string, headers map[string]string, payload any, handle func(serverEvent) error) (responseMeta, error) {
+	var meta responseMeta
+	if config.ApiKey == "" && !keylessProviders[config.provider] {
+		return meta, errNoApiKey
+	}
+	buffer, err := config.encodeRequest(providerName, payload)
+	if err != nil {
+		return meta, err
+	}
+	ctx, cancel := interruptible(ctx)
+	defer cancel(nil)
+	req, release, err := config.newPostRequest(ctx, providerName, endpoint, headers, buffer)
+	if err != nil {
+		return meta, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	timeout := config.StallTimeout
+	if timeout <= 0 {
+		timeout = DefaultStallTimeout
+	}
+	// the timer covers waiting for the response headers as well as the silences between events
+	stall := time.AfterFunc(timeout, func() { cancel(ErrStreamStalled) })
+	defer stall.Stop()
+	stalled := func(err error) error {
+		if errors.Is(context.Cause(ctx), ErrStreamStalled) {
+			return fmt.Errorf("%s: %w after %s without data", providerName, ErrStreamStalled, timeout)
+		}
+		return interruption(ctx, err)
+	}
+
+	client := config.client
+	if client == nil {
+		client = config.newHTTPClient()
+	}
+	start := config.now()
+	resp, err := client.Do(req)
+	release()
+	if err != nil {
+		return meta, stalled(err)
+	}
+	defer resp.Body.Close()
+	meta.RequestID = requestID(resp.Header)
+
+	maxBytes := config.MaxResponseBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxResponseBytes
+	}
+	reader := &stallReader{reader: &limitedReader{reader: resp.Body, remaining: maxBytes}, timer: stall, timeout: timeout}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, err := io.ReadAll(reader)
+		if err != nil {
+			return meta, stalled(err)
+		}
+		return meta, config.apiError(providerName, resp, body)
+	}
+
+	read := readServerEvents
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/x-ndjson") {
+		read = readJSONLines // Ollama
+	}
+	if err := read(reader, handle); err != nil {
+		return meta, stalled(err)
+	}
+	meta.Latency = config.since(start)
+	return meta, nil
+}
+
+// stallReader pushes the stall timer back whenever data arrives.
+type stallReader struct {
+	reader  io.Reader
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+func (r *stallReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.timer.Reset(r.timeout)
+	}
+	return n, err
+}
+
+// readServerEvents parses a text/event-stream body. Comments, which providers use as keep-alives, are skipped.
+func readServerEvents(reader io.Reader, handle func(serverEvent) error) error {
+	lines := bufio.NewReader(reader)
+	var event serverEvent
+	var data bytes.Buffer
+	for {
+		line, err := lines.ReadBytes('\n')
+		if err != nil && (err != io.EOF || len(line) == 0) {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		line = bytes.TrimRight(line, "\r\n")
+		if len(line) == 0 {
+			if data.Len() > 0 {
+				event.Data = bytes.TrimSuffix(data.Bytes(), []byte("\n"))
+				if err := handle(event); err != nil {
+					return err
+				}
+			}
+			event = serverEvent{}
+			data.Reset()
+			continue
+		}
+		if line[0] == ':' {
+			continue
+		}
+		field, value, _ := bytes.Cut(line, []byte(":"))
+		value = bytes.TrimPrefix(value, []byte(" "))
+		switch string(field) {
+		case "event":
+			event.Event = string(value)
+		case "data":
+			data.Write(value)
+			data.WriteByte('\n')
+		}
+	}
+}
+
+// readJSONLines parses a stream of JSON objects, one per line, handing each to handle as the data of an event.
+func readJSONLines(reader io.Reader, handle func(serverEvent) error) error {
+	lines := bufio.NewReader(reader)
+	for {
+		line, err := lines.ReadBytes('\n')
+		if err != nil && (err != io.EOF || len(line) == 0) {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			if err := handle(serverEvent{Data: line}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// streamStatus gives errors reported inside a stream the status code the same error gets as a response,
+// so IsRetryable and the typed errors treat them alike.
+var streamStatus = map[string]int{
+	"rate_limit_error":    429,
+	"rate_limit_exceeded": 429,
+	"api_error":           500,
+	"server_error":        500,
+	"overloaded_error":    529,
+}
+
+// streamError builds the error for an error event of a stream.
+func streamError(providerName string, data []byte) error {
+	apiErr := &APIError{Provider: providerName, Body: data}
+	switch providerName {
+	case "anthropic":
+		parseAnthropicError(apiErr, data)
+	default:
+		parseOpenaiError(apiErr, data)
+	}
+	return classifyStreamError(apiErr)
+}
+
+func classifyStreamError(apiErr *APIError) error {
+	if apiErr.StatusCode == 0 {
+		apiErr.StatusCode = streamStatus[apiErr.Type]
+	}
+	if apiErr.StatusCode == 0 {
+		apiErr.StatusCode = streamStatus[apiErr.Code]
+	}
+	if apiErr.Message == "" {
+		apiErr.Message = string(apiErr.Body)
+	}
+	// stream errors come without a Retry-After, so the time never sets a reset
+	return classifyAPIError(apiErr, time.Time{})
+}
+
+// errStreamIncomplete is returned when a stream ends before the provider marked the response complete.
+var errStreamIncomplete = fmt.Errorf("stream ended before the response was complete: %w", io.ErrUnexpectedEOF)
@@ -0,0 +1,164 @@
+package provider
+
+import (
+	"context"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// StreamPacing limits how fast streamed text reaches the handler, see WithStreamPacing.
+type StreamPacing struct {
+	Chars    int           // characters handed out per interval
+	Interval time.Duration // e.g. 50ms
+}
+
+// WithStreamPacing hands streamed text to the handler at most chars characters per interval, e.g.
+// WithStreamPacing(40, 50*time.Millisecond), so UIs render evenly when a provider sends large chunks
+// at once. Longer pieces are split, shorter ones are combined into the allowance of an interval.
+// The response is read at full speed meanwhile; a run returns once the handler has had all its text.
+func WithStreamPacing(chars int, interval time.Duration) AgentOption {
+	return func(a *AgentConfig) {
+		a.StreamPacing = &StreamPacing{Chars: chars, Interval: interval}
+	}
+}
+
+// streamPacer queues stream events and hands them to the handler on its own goroutine, text at
+// the paced rate. Events keep their order.
+type streamPacer struct {
+	handler StreamHandler
+	pacing  StreamPacing
+
+	mu      sync.Mutex
+	queue   []StreamEvent
+	closed  bool
+	dropped bool
+	wake    chan struct{}
+	done    chan struct{}
+}
+
+func newStreamPacer(handler StreamHandler, pacing StreamPacing) *streamPacer {
+	pacer := &streamPacer{handler: handler, pacing: pacing, wake: make(chan struct{}, 1), done: make(chan struct{})}
+	go pacer.run()
+	return pacer
+}
+
+// push queues event. A restart discards the text still queued, which the handler would drop anyway.
+func (pacer *streamPacer) push(event StreamEvent) {
+	pacer.mu.Lock()
+	if event.Type == StreamRestart {
+		pacer.queue = pacer.queue[:0]
+	}
+	pacer.queue = append(pacer.queue, event)
+	pacer.mu.Unlock()
+	pacer.signal()
+}
+
+func (pacer *streamPacer) signal() {
+	select {
+	case pacer.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next takes the first queued event, waiting for one. It reports false once the pacer is closed and drained.
+func (pacer *streamPacer) next() (StreamEvent, bool) {
+	for {
+		pacer.mu.Lock()
+		if pacer.dropped {
+			pacer.queue = nil
+		}
+		if len(pacer.queue) > 0 {
+			event := pacer.queue[0]
+			pacer.queue = pacer.queue[1:]
+			pacer.mu.Unlock()
+			return event, true
+		}
+		closed := pacer.closed
+		pacer.mu.Unlock()
+		if closed {
+			return StreamEvent{}, false
+		}
+		<-pacer.wake
+	}
+}
+
+func (pacer *streamPacer) run() {
+	defer close(pacer.done)
+	ticker := time.NewTicker(pacer.pacing.Interval)
+	defer ticker.Stop()
+	allowance := pacer.pacing.Chars
+	for {
+		event, ok := pacer.next()
+		if !ok {
+			return
+		}
+		if event.Type != StreamText {
+			pacer.handler(event)
+			continue
+		}
+		text := event.Text
+		for text != "" && !pacer.isDropped() {
+			select {
+			case <-ticker.C:
+				allowance = pacer.pacing.Chars
+			default:
+			}
+			if allowance == 0 {
+				select {
+				case <-ticker.C:
+					allowance = pacer.pacing.Chars
+				case <-pacer.wake:
+					// the queue is checked again by next, only a drop matters here
+					continue
+				}
+			}
+			piece := cutRunes(text, allowance)
+			allowance -= utf8.RuneCountInString(piece)
+			text = text[len(piece):]
+			pacer.handler(StreamEvent{Type: StreamText, Text: piece})
+		}
+	}
+}
+
+func (pacer *streamPacer) isDropped() bool {
+	pacer.mu.Lock()
+	defer pacer.mu.Unlock()
+	return pacer.dropped
+}
+
+// close waits until the queued events have been handed out. When ctx is done or the run
+// was interrupted, text still queued is dropped instead.
+func (pacer *streamPacer) close(ctx context.Context) {
+	pacer.mu.Lock()
+	pacer.closed = true
+	pacer.dropped = ctx.Err() != nil || interrupted(ctx)
+	pacer.mu.Unlock()
+	pacer.signal()
+	select {
+	case <-pacer.done:
+	case <-ctx.Done():
+		pacer.mu.Lock()
+		pacer.dropped = true
+		pacer.mu.Unlock()
+		pacer.signal()
+		<-pacer.done
+	}
+}
+
+// interrupted reports whether the run of ctx was interrupted, see ContextWithInterrupt.
+func interrupted(ctx context.Context) bool {
+	interrupt, ok := ctx.Value(interruptKey{}).(context.Context)
+	return ok && interrupt.Err() != nil
+}
+
+// cutRunes returns the first n runes of text.
+func cutRunes(text string, n int) string {
+	for i := range text {
+		if n == 0 {
+			return text[:i]
+		}
+		n--
+	}
+	return text
+}
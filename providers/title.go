@@ -0,0 +1,73 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ConversationTitle names a conversation, e.g. for the sidebar of a chat app.
+type ConversationTitle struct {
+	Title  string   `json:"title"`  // a few words
+	Topics []string `json:"topics"` // lowercase tags
+}
+
+// titleTranscriptBytes bounds how much of the conversation is sent: its start is what it is about.
+const titleTranscriptBytes = 8000
+
+const titlePrompt = `Give the conversation below a title of at most six words and up to five topic tags,
+lowercase and one or two words each. Write the title in the language of the conversation, without quotes
+or a trailing period.
+
+Respond with JSON only, in this shape:
+{"title": "<title>", "topics": ["<tag>"]}
+
+<conversation>
+%s
+</conversation>`
+
+// GenerateTitle names the conversation in history with one request to modelName, best a small and
+// cheap model. opts configure the agent making it, e.g. WithApiKey.
+func GenerateTitle(ctx context.Context, modelName string, history []Message, opts ...AgentOption) (*ConversationTitle, error) {
+	var transcript strings.Builder
+	for _, msg := range history {
+		if msg.Text == "" || (msg.Role != "user" && !msg.isText()) {
+			continue
+		}
+		fmt.Fprintf(&transcript, "%s: %s\n", msg.Role, msg.Text)
+		if transcript.Len() >= titleTranscriptBytes {
+			break
+		}
+	}
+	if transcript.Len() == 0 {
+		return nil, fmt.Errorf("title: the conversation has no text")
+	}
+	text := transcript.String()
+	if len(text) > titleTranscriptBytes {
+		text = strings.ToValidUTF8(text[:titleTranscriptBytes], "")
+	}
+
+	agent, err := NewAgent(modelName, append([]AgentOption{WithName("titler"), WithTemperature(0.2)}, opts...)...)
+	if err != nil {
+		return nil, fmt.Errorf("title: %w", err)
+	}
+	result, err := agent.RunContext(ctx, fmt.Sprintf(titlePrompt, text))
+	if err != nil {
+		return nil, fmt.Errorf("title: %w", err)
+	}
+	var title ConversationTitle
+	if err := json.Unmarshal([]byte(stripCodeFence(result.Text)), &title); err != nil {
+		return nil, fmt.Errorf("title: model returned invalid json: %w", err)
+	}
+	title.Title = strings.Trim(strings.TrimSpace(title.Title), `"'.`)
+	for i, topic := range title.Topics {
+		title.Topics[i] = strings.ToLower(strings.TrimSpace(topic))
+	}
+	return &title, nil
+}
+
+// Title names the session's conversation so far, see GenerateTitle.
+func (session *Session) Title(ctx context.Context, modelName string, opts ...AgentOption) (*ConversationTitle, error) {
+	return GenerateTitle(ctx, modelName, session.Messages(), opts...)
+}
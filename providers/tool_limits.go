@@ -0,0 +1,74 @@
+package provider
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// WithConcurrency lets at most n calls of the tool run at once, counted across every run of every
+// agent the tool is added to, e.g. to spare a site a scraping tool visits. Further calls wait their turn.
+func (tool Tool) WithConcurrency(n int) Tool {
+	tool.slots = make(chan struct{}, n)
+	return tool
+}
+
+// WithRateLimit lets at most perMinute calls of the tool start in any minute, counted like WithConcurrency.
+// Further calls wait until they fit in the limit.
+func (tool Tool) WithRateLimit(perMinute int) Tool {
+	tool.rate = &rateLimiter{limit: perMinute, per: time.Minute}
+	return tool
+}
+
+// acquire waits until the limits of the tool allow another call, as timed by now, and returns the
+// function ending it.
+func (tool Tool) acquire(ctx context.Context, now func() time.Time) (func(), error) {
+	if tool.rate != nil {
+		if err := tool.rate.wait(ctx, now); err != nil {
+			return nil, err
+		}
+	}
+	if tool.slots == nil {
+		return func() {}, nil
+	}
+	select {
+	case tool.slots <- struct{}{}:
+		return func() { <-tool.slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// rateLimiter admits limit calls in any window of length per.
+type rateLimiter struct {
+	limit int
+	per   time.Duration
+
+	mu    sync.Mutex
+	calls []time.Time // starts of the calls in the current window, oldest first
+}
+
+func (limiter *rateLimiter) wait(ctx context.Context, clock func() time.Time) error {
+	for {
+		limiter.mu.Lock()
+		now := clock()
+		for len(limiter.calls) > 0 && now.Sub(limiter.calls[0]) >= limiter.per {
+			limiter.calls = limiter.calls[1:]
+		}
+		if len(limiter.calls) < limiter.limit {
+			limiter.calls = append(limiter.calls, now)
+			limiter.mu.Unlock()
+			return nil
+		}
+		delay := limiter.per - now.Sub(limiter.calls[0])
+		limiter.mu.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
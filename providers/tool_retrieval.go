@@ -0,0 +1,118 @@
+package provider
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ToolRetrieval exposes only the tools relevant to the conversation, see WithToolRetrieval.
+type ToolRetrieval struct {
+	Embedder Embedder
+	TopK     int
+	Always   []string // tools exposed every turn
+
+	mu      sync.Mutex
+	vectors map[string][]float32 // by the text embedded for a tool
+}
+
+// WithToolRetrieval exposes the topK tools whose name and description are closest to the user's
+// latest message, as embedded by embedder, instead of all registered tools. With dozens of tools
+// this saves the tokens of their definitions on every request and keeps the model from picking
+// the wrong one. Tools named in always are exposed on top, as are tools called since the user's
+// message so the tool loop can go on with them. Tool embeddings are computed once; when embedding
+// fails all tools are exposed.
+func WithToolRetrieval(embedder Embedder, topK int, always ...string) AgentOption {
+	return func(a *AgentConfig) {
+		a.ToolRetrieval = &ToolRetrieval{Embedder: embedder, TopK: topK, Always: always, vectors: make(map[string][]float32)}
+	}
+}
+
+// exposedTools returns the names of the tools to offer the model for a request, sorted.
+func (config *AgentConfig) exposedTools(prompt string, messageHistory [][]Message) []string {
+	var history []Message
+	if len(messageHistory) > 0 {
+		history = messageHistory[0]
+	}
+	names := config.confirmationStage(config.ToolStore.names(), prompt, history)
+	retrieval := config.ToolRetrieval
+	if retrieval == nil || retrieval.TopK <= 0 || len(names) <= retrieval.TopK {
+		return names
+	}
+	query := prompt
+	exposed := make(map[string]bool)
+	for _, name := range retrieval.Always {
+		exposed[name] = true
+	}
+	for i := len(history) - 1; i >= 0 && query == ""; i-- {
+		if history[i].ToolIntent != nil {
+			exposed[history[i].ToolIntent.Name] = true
+		} else if history[i].Role == "user" && history[i].ToolResult == nil {
+			query = history[i].Text
+		}
+	}
+	if query == "" {
+		return names
+	}
+	top, err := retrieval.rank(query, names, config.ToolStore.descriptions)
+	if err != nil {
+		config.logf("Tool retrieval failed, exposing all tools: %v\n", err)
+		return names
+	}
+	for _, name := range top {
+		exposed[name] = true
+	}
+	var selected []string
+	for _, name := range names {
+		if exposed[name] {
+			selected = append(selected, name)
+		}
+	}
+	return selected
+}
+
+// rank returns the TopK tools closest to query.
+func (retrieval *ToolRetrieval) rank(query string, names []string, descriptions map[string]string) ([]string, error) {
+	queryVector, err := retrieval.Embedder.Embed(query)
+	if err != nil {
+		return nil, err
+	}
+	similarity := make(map[string]float32, len(names))
+	for _, name := range names {
+		vector, err := retrieval.embedTool(name, descriptions[name])
+		if err != nil {
+			return nil, err
+		}
+		similarity[name] = CosineSimilarity(queryVector, vector)
+	}
+	ranked := append([]string(nil), names...)
+	sort.SliceStable(ranked, func(i, j int) bool { return similarity[ranked[i]] > similarity[ranked[j]] })
+	return ranked[:retrieval.TopK], nil
+}
+
+func (retrieval *ToolRetrieval) embedTool(name string, description string) ([]float32, error) {
+	// camel case names read as words: GetWeather becomes "Get Weather"
+	var text strings.Builder
+	for i, r := range name {
+		if i > 0 && r >= 'A' && r <= 'Z' {
+			text.WriteByte(' ')
+		}
+		text.WriteRune(r)
+	}
+	text.WriteString(": " + description)
+
+	retrieval.mu.Lock()
+	vector, found := retrieval.vectors[text.String()]
+	retrieval.mu.Unlock()
+	if found {
+		return vector, nil
+	}
+	vector, err := retrieval.Embedder.Embed(text.String())
+	if err != nil {
+		return nil, err
+	}
+	retrieval.mu.Lock()
+	retrieval.vectors[text.String()] = vector
+	retrieval.mu.Unlock()
+	return vector, nil
+}
@@ -0,0 +1,34 @@
+package provider
+
+import "context"
+
+// toolStateKey keys the tool state of type T in a context.
+type toolStateKey[T any] struct{}
+
+// ContextWithToolState returns a context whose runs hand value to their tools, which retrieve it
+// by its type with ToolState. Tools taking a context get the dependencies of the request they
+// serve, like a database handle or the current user, without globals or per-request closures.
+func ContextWithToolState[T any](ctx context.Context, value T) context.Context {
+	return context.WithValue(ctx, toolStateKey[T]{}, value)
+}
+
+// ToolState returns the value of type T bound to ctx by ContextWithToolState or WithToolState:
+//
+//	func FindOrder(ctx context.Context, params FindOrderParams) string {
+//		db, ok := provider.ToolState[*sql.DB](ctx)
+//		...
+//	}
+func ToolState[T any](ctx context.Context) (T, bool) {
+	value, ok := ctx.Value(toolStateKey[T]{}).(T)
+	return value, ok
+}
+
+// WithToolState binds value to every run of the session, see ContextWithToolState.
+// Unlike the conversation it is not persisted: pass it again when the session is loaded.
+func WithToolState[T any](value T) SessionOption {
+	return func(session *Session) {
+		session.toolState = append(session.toolState, func(ctx context.Context) context.Context {
+			return ContextWithToolState(ctx, value)
+		})
+	}
+}
@@ -1,17 +1,22 @@
 package provider
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"reflect"
 	"runtime"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 )
 
 type Property struct {
 	Type        string              `json:"type"`
 	Description string              `json:"description,omitempty"`
+	Enum        []string            `json:"enum,omitempty"` // the only values allowed
 	Items       *Property           `json:"items,omitempty"`
 	Properties  map[string]Property `json:"properties,omitempty"` // For nested objects
 }
@@ -31,12 +36,74 @@ type ToolStore struct {
 	paramTypes map[string]reflect.Type
 	// paramTypes   map[string]any
 	descriptions map[string]string
+	dispatchers  map[string]ToolDispatcher
+	tools        map[string]Tool   // tools added with AddTool, for their settings
+	proposals    map[string]string // tools needing a confirmation by the name of their proposal, see WithConfirmation
 }
 
+// Tool is a function the model can call, built with NewTool and registered with AddTool:
+//
+//	refund := provider.NewTool("RefundOrder", "Refund an order in full", RefundOrder).
+//		WithTimeout(10 * time.Second).
+//		WithApprovalRequired()
+//	err := agent.AddTool(refund)
 type Tool struct {
 	Name        string     `json:"name"`
 	Description string     `json:"description"`
 	Parameters  Parameters `json:"parameters"`
+
+	function             any
+	timeout              time.Duration
+	approvalRequired     bool
+	confirmationRequired bool
+	slots                chan struct{} // shared by the copies of the tool, see WithConcurrency
+	rate                 *rateLimiter
+}
+
+// NewTool makes fn callable by the model as name. fn takes one struct describing its parameters,
+// optionally preceded by a context.Context, and returns the output shown to the model.
+func NewTool(name string, description string, fn any) Tool {
+	return Tool{Name: name, Description: description, function: fn}
+}
+
+// WithTimeout stops waiting for the tool after timeout and tells the model it timed out. Tools
+// taking a context see it canceled, the others are left to finish in the background.
+func (tool Tool) WithTimeout(timeout time.Duration) Tool {
+	tool.timeout = timeout
+	return tool
+}
+
+// WithApprovalRequired runs the tool only once the approver set by WithToolApprover allowed the
+// call. Without an approver its calls are denied.
+func (tool Tool) WithApprovalRequired() Tool {
+	tool.approvalRequired = true
+	return tool
+}
+
+// WithConfirmation makes the model propose an action before it gets to call the tool: the tool is
+// offered as "propose_" followed by its name, taking a summary of the action in plain words. Once the
+// confirmer set by WithToolConfirmer confirmed the summary, the tool itself is offered with its
+// parameters for one call. Without a confirmer proposals are rejected. Unlike WithApprovalRequired
+// the person confirming reads what the model means to do rather than raw arguments, the two combine.
+func (tool Tool) WithConfirmation() Tool {
+	tool.confirmationRequired = true
+	return tool
+}
+
+// paramType returns the type of the parameters fn takes.
+func (tool Tool) paramType() (reflect.Type, error) {
+	fnType := reflect.TypeOf(tool.function)
+	if fnType == nil || fnType.Kind() != reflect.Func {
+		return nil, fmt.Errorf("tool %s: not a function", tool.Name)
+	}
+	if fnType.NumIn() != 1 && !takesContext(fnType) {
+		return nil, fmt.Errorf("tool %s: function must take exactly one parameter, optionally preceded by a context.Context", tool.Name)
+	}
+	paramType := fnType.In(fnType.NumIn() - 1)
+	if paramType.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("tool %s: parameter must be a struct, got %v", tool.Name, paramType)
+	}
+	return paramType, nil
 }
 
 type ToolRequest struct {
@@ -53,8 +120,89 @@ type ToolIntent struct {
 }
 
 type ToolResult struct {
-	Id     string `json:"id,omitempty"`
-	Output string `json:"output,omitempty"`
+	Id     string          `json:"id,omitempty"`
+	Output string          `json:"output,omitempty"` // what the model is shown
+	Data   json.RawMessage `json:"data,omitempty"`   // the tool's return value as JSON, see Decode
+	Value  any             `json:"-"`                // the tool's return value, only set by the run that called it
+
+	Duration time.Duration `json:"duration,omitempty"` // how long the call took, see AgentResult.Report
+	Error    string        `json:"error,omitempty"`    // why the tool wasn't run or didn't finish, e.g. a denied call
+}
+
+// failedToolResult is the result of a call that didn't run as asked, reason telling the model why.
+func failedToolResult(id string, reason string) *ToolResult {
+	return &ToolResult{Id: id, Output: reason, Error: reason}
+}
+
+// newToolResult builds the result of a tool that returned value. Strings are shown to the model
+// as they are, other values as JSON.
+func newToolResult(id string, value any) *ToolResult {
+	result := &ToolResult{Id: id, Value: value}
+	data, err := json.Marshal(value)
+	if err != nil {
+		result.Output = fmt.Sprintf("%v", value)
+		return result
+	}
+	result.Data = data
+	if text, ok := value.(string); ok {
+		result.Output = text
+	} else {
+		result.Output = string(data)
+	}
+	return result
+}
+
+// Decode unmarshals the tool's return value into v, e.g. the struct the tool returned.
+func (result ToolResult) Decode(v any) error {
+	if result.Data == nil {
+		return fmt.Errorf("tool result %s has no data", result.Id)
+	}
+	return json.Unmarshal(result.Data, v)
+}
+
+type toolSchema struct {
+	properties Properties
+	required   []string
+}
+
+// schemaCache memoizes ConvertToProperties per parameter type, since tool schemas
+// are sent with every request of a tool loop.
+var schemaCache sync.Map // reflect.Type -> toolSchema
+
+// schemaFor returns the (shared, read-only) schema of a tool parameter type.
+func schemaFor(paramType reflect.Type) (Properties, []string) {
+	if cached, ok := schemaCache.Load(paramType); ok {
+		schema := cached.(toolSchema)
+		return schema.properties, schema.required
+	}
+	properties, required := ConvertToProperties(reflect.New(paramType).Interface())
+	schemaCache.Store(paramType, toolSchema{properties, required})
+	return properties, required
+}
+
+// RegisterSchema installs a precomputed schema for a tool parameter type, as emitted by gossipgen.
+func RegisterSchema(paramType reflect.Type, properties Properties, required []string) {
+	schemaCache.Store(paramType, toolSchema{properties, required})
+}
+
+// ToolDispatcher decodes tool arguments and calls the tool without reflection.
+// A *ValidationError is reported back to the model like any other argument violation.
+type ToolDispatcher func(arguments string) (any, error)
+
+var dispatchers sync.Map // full function name -> ToolDispatcher
+
+// RegisterDispatcher installs the typed dispatcher for a tool function, as emitted by gossipgen.
+// Agents registering fn afterwards call it through dispatch instead of reflection.
+func RegisterDispatcher(fn any, dispatch ToolDispatcher) {
+	dispatchers.Store(runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name(), dispatch)
+}
+
+func lookupDispatcher(fn any) (ToolDispatcher, bool) {
+	dispatch, ok := dispatchers.Load(runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name())
+	if !ok {
+		return nil, false
+	}
+	return dispatch.(ToolDispatcher), true
 }
 
 func ConvertToProperties(v any) (Properties, []string) {
@@ -70,22 +218,28 @@ func ConvertToProperties(v any) (Properties, []string) {
 	if t.Kind() != reflect.Struct {
 		panic("Input must be a struct or pointer to struct")
 	}
-	var fieldNames []string
+	required := make([]string, 0, t.NumField())
 	for i := range t.NumField() {
 		field := t.Field(i)
-		schemaField := processField(field)
-
 		// Use the JSON tag name if present, otherwise use the field name
-		fieldName := field.Tag.Get("json")
-		if fieldName == "" {
-			fieldName = strings.ToLower(field.Name)
+		fieldName := jsonFieldName(field)
+		if !field.IsExported() || fieldName == "-" {
+			continue
 		}
 
-		schema[fieldName] = schemaField
-		fieldNames = append(fieldNames, fieldName)
+		schema[fieldName] = processField(field)
+		if !jsonOmitEmpty(field) {
+			required = append(required, fieldName)
+		}
 	}
 
-	return schema, fieldNames
+	return schema, required
+}
+
+// strictSchema reports whether a tool schema may be sent in strict mode, which needs every
+// property required.
+func strictSchema(properties Properties, required []string) bool {
+	return len(required) == len(properties)
 }
 
 func processField(field reflect.StructField) Property {
@@ -102,9 +256,9 @@ func processField(field reflect.StructField) Property {
 		// Recursively process each field in the nested struct
 		for i := range field.Type.NumField() {
 			nestedField := field.Type.Field(i)
-			fieldName := nestedField.Tag.Get("json")
-			if fieldName == "" {
-				fieldName = strings.ToLower(nestedField.Name)
+			fieldName := jsonFieldName(nestedField)
+			if !nestedField.IsExported() || fieldName == "-" {
+				continue
 			}
 			property.Properties[fieldName] = processField(nestedField)
 		}
@@ -149,11 +303,13 @@ func getToolName(f any) (string, error) {
 	if fullName == "" {
 		return "", fmt.Errorf("function name not found")
 	}
-	// Split the module name and function name
+	// Split the module name and function name, dropping the suffix of method values
 	parts := strings.Split(fullName, ".")
-	return parts[len(parts)-1], nil
+	return strings.TrimSuffix(parts[len(parts)-1], "-fm"), nil
 }
 
+// RegisterTool makes fn callable by the model under its function name, with the parameters of paramType.
+// Use AddTool for tools with a name of their own or settings.
 func (provider *AgentConfig) RegisterTool(fn any, paramType any, desctiption string) error {
 	fnName, err := getToolName(fn)
 	if err != nil {
@@ -161,24 +317,107 @@ func (provider *AgentConfig) RegisterTool(fn any, paramType any, desctiption str
 	}
 	fnType := reflect.TypeOf(fn)
 
-	// Validate function has exactly one parameter
-	if fnType.NumIn() != 1 {
-		return fmt.Errorf("function must take exactly one parameter")
+	// Validate function has exactly one parameter, optionally preceded by a context.Context
+	if fnType.NumIn() != 1 && !takesContext(fnType) {
+		return fmt.Errorf("function must take exactly one parameter, optionally preceded by a context.Context")
+	}
+	if err := provider.requireCapability(provider.ModelName, "tools"); err != nil {
+		return err
+	}
+	if t := reflect.TypeOf(paramType); t != nil {
+		if err := checkValidateTags(t); err != nil {
+			return fmt.Errorf("tool %s: %w", fnName, err)
+		}
 	}
 	provider.ToolStore.functions[fnName] = fn
 	provider.ToolStore.paramTypes[fnName] = reflect.TypeOf(paramType)
 	provider.ToolStore.descriptions[fnName] = desctiption
+	delete(provider.ToolStore.tools, fnName)
+	if dispatch, ok := lookupDispatcher(fn); ok {
+		if provider.ToolStore.dispatchers == nil {
+			provider.ToolStore.dispatchers = make(map[string]ToolDispatcher)
+		}
+		provider.ToolStore.dispatchers[fnName] = dispatch
+	}
 	return nil
 }
 
+// AddTool registers tool, replacing a tool of the same name.
+func (provider *AgentConfig) AddTool(tool Tool) error {
+	if tool.Name == "" {
+		return fmt.Errorf("tool needs a name")
+	}
+	paramType, err := tool.paramType()
+	if err != nil {
+		return err
+	}
+	if err := provider.requireCapability(provider.ModelName, "tools"); err != nil {
+		return err
+	}
+	if err := checkValidateTags(paramType); err != nil {
+		return fmt.Errorf("tool %s: %w", tool.Name, err)
+	}
+	provider.ToolStore.functions[tool.Name] = tool.function
+	provider.ToolStore.paramTypes[tool.Name] = paramType
+	provider.ToolStore.descriptions[tool.Name] = tool.Description
+	delete(provider.ToolStore.dispatchers, tool.Name)
+	if dispatch, ok := lookupDispatcher(tool.function); ok {
+		if provider.ToolStore.dispatchers == nil {
+			provider.ToolStore.dispatchers = make(map[string]ToolDispatcher)
+		}
+		provider.ToolStore.dispatchers[tool.Name] = dispatch
+	}
+	if provider.ToolStore.tools == nil {
+		provider.ToolStore.tools = make(map[string]Tool)
+	}
+	provider.ToolStore.tools[tool.Name] = tool
+	provider.ToolStore.addProposal(tool)
+	return nil
+}
+
+// names returns the registered tool names in a stable order, so identical agents build identical requests.
+func (store ToolStore) names() []string {
+	names := make([]string, 0, len(store.functions))
+	for name := range store.functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
+// takesContext reports whether a tool function is func(context.Context, Params).
+func takesContext(fnType reflect.Type) bool {
+	return fnType.NumIn() == 2 && fnType.In(0) == contextType
+}
+
 func (provider *AgentConfig) ExecuteToolIntent(toolIntent ToolIntent) (*ToolResult, error) {
+	return provider.executeToolIntent(context.Background(), toolIntent)
+}
+
+// executeToolIntent runs a tool call, passing ctx to tools that take a context.
+func (provider *AgentConfig) executeToolIntent(ctx context.Context, toolIntent ToolIntent) (*ToolResult, error) {
 	store := provider.ToolStore
 	fnName := toolIntent.Name
-	log.Printf("Tool called: %s\n", fnName)
+	provider.logf("Tool called: %s\n", fnName)
 	fn, exists := store.functions[fnName]
 	if !exists {
 		return nil, fmt.Errorf("function %s not found", fnName)
 	}
+	if dispatch, exists := store.dispatchers[fnName]; exists {
+		output, err := dispatch(toolIntent.Arguments)
+		var validationErr *ValidationError
+		if errors.As(err, &validationErr) {
+			provider.logf("Tool %s rejected: %v\n", fnName, err)
+			return failedToolResult(toolIntent.Id, err.Error()), nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal tool call")
+		}
+		return newToolResult(toolIntent.Id, output), nil
+	}
+
 	expectedType, exists := store.paramTypes[fnName]
 	if !exists {
 		return nil, fmt.Errorf("parameter type for function %s not found", fnName)
@@ -195,15 +434,20 @@ func (provider *AgentConfig) ExecuteToolIntent(toolIntent ToolIntent) (*ToolResu
 		return nil, fmt.Errorf("invalid parameter type. expected %v, got %v", expectedType, actualType)
 	}
 
+	// report argument violations back to the model instead of calling the tool
+	if err := ValidateStruct(paramInstance); err != nil {
+		provider.logf("Tool %s rejected: %v\n", fnName, err)
+		return failedToolResult(toolIntent.Id, err.Error()), nil
+	}
+
 	fnValue := reflect.ValueOf(fn)
-	paramValue := reflect.ValueOf(paramInstance).Elem()
-	toolOutputValues := fnValue.Call([]reflect.Value{paramValue})
+	args := []reflect.Value{reflect.ValueOf(paramInstance).Elem()}
+	if takesContext(fnValue.Type()) {
+		args = append([]reflect.Value{reflect.ValueOf(&ctx).Elem()}, args...)
+	}
+	toolOutputValues := fnValue.Call(args)
 	if len(toolOutputValues) == 0 {
 		return nil, fmt.Errorf("tool call returned nothing")
 	}
-	toolResult := ToolResult{
-		Id:     toolIntent.Id,
-		Output: fmt.Sprintf("%v", toolOutputValues[0].Interface()),
-	}
-	return &toolResult, nil
+	return newToolResult(toolIntent.Id, toolOutputValues[0].Interface()), nil
 }
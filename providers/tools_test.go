@@ -0,0 +1,44 @@
+package provider
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+type schemaParams struct {
+	City     string   `json:"city" description:"the city"`
+	Country  string   `json:"country,omitempty"`
+	Days     int      `json:",omitempty"`
+	Tags     []string `json:"tags"`
+	Internal string   `json:"-"`
+	secret   string
+	Location struct {
+		Lat    float64 `json:"lat"`
+		Hidden string  `json:"-"`
+		note   string
+	} `json:"location"`
+}
+
+func TestConvertToProperties(t *testing.T) {
+	properties, required := ConvertToProperties(schemaParams{})
+	want := Properties{
+		"city":    {Type: "string", Description: "the city"},
+		"country": {Type: "string"},
+		"days":    {Type: "integer"},
+		"tags":    {Type: "array", Items: &Property{Type: "string"}},
+		"location": {Type: "object", Properties: map[string]Property{
+			"lat": {Type: "number"},
+		}},
+	}
+	if !reflect.DeepEqual(properties, want) {
+		t.Errorf("got properties %+v, want %+v", properties, want)
+	}
+	sort.Strings(required)
+	if want := []string{"city", "location", "tags"}; !reflect.DeepEqual(required, want) {
+		t.Errorf("got required %q, want %q", required, want)
+	}
+	if strictSchema(properties, required) {
+		t.Error("schema with optional fields sent as strict")
+	}
+}
@@ -0,0 +1,303 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	OpenaiUsageEndpoint    = "https://api.openai.com/v1/organization/usage/completions"
+	OpenaiCostsEndpoint    = "https://api.openai.com/v1/organization/costs"
+	AnthropicUsageEndpoint = "https://api.anthropic.com/v1/organizations/usage_report/messages"
+	AnthropicCostEndpoint  = "https://api.anthropic.com/v1/organizations/cost_report"
+)
+
+// ProviderUsage is token usage as reported by a provider for a model and a day.
+type ProviderUsage struct {
+	Provider     string    `json:"provider"`
+	Model        string    `json:"model"`
+	Start        time.Time `json:"start"`
+	End          time.Time `json:"end"`
+	Requests     int       `json:"requests"` // not reported by anthropic
+	InputTokens  int       `json:"input_tokens"`
+	OutputTokens int       `json:"output_tokens"`
+}
+
+// ProviderCost is spend as billed by a provider for a line item and a day.
+type ProviderCost struct {
+	Provider  string    `json:"provider"`
+	LineItem  string    `json:"line_item"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	AmountUSD float64   `json:"amount_usd"`
+}
+
+// UsageSource reads usage and costs from a provider's admin api, in daily buckets.
+type UsageSource interface {
+	Usage(ctx context.Context, start time.Time, end time.Time) ([]ProviderUsage, error)
+	Costs(ctx context.Context, start time.Time, end time.Time) ([]ProviderCost, error)
+}
+
+// OpenaiAdmin reads the organization usage and costs apis. It needs an admin key.
+type OpenaiAdmin struct {
+	AgentConfig
+}
+
+// NewOpenaiAdmin creates an OpenaiAdmin with the admin key in OPENAI_ADMIN_KEY.
+func NewOpenaiAdmin(opts ...AgentOption) (*OpenaiAdmin, error) {
+	config, err := newAdminConfig("OPENAI_ADMIN_KEY", opts)
+	return &OpenaiAdmin{config}, err
+}
+
+func (admin *OpenaiAdmin) Usage(ctx context.Context, start time.Time, end time.Time) ([]ProviderUsage, error) {
+	query := openaiAdminQuery(start, end)
+	query.Set("group_by", "model")
+	var usage []ProviderUsage
+	err := admin.pages(ctx, OpenaiUsageEndpoint, query, func(bucket openaiBucket) {
+		for _, result := range bucket.Results {
+			usage = append(usage, ProviderUsage{
+				Provider:     "openai",
+				Model:        result.Model,
+				Start:        time.Unix(bucket.StartTime, 0),
+				End:          time.Unix(bucket.EndTime, 0),
+				Requests:     result.NumModelRequests,
+				InputTokens:  result.InputTokens,
+				OutputTokens: result.OutputTokens,
+			})
+		}
+	})
+	return usage, err
+}
+
+func (admin *OpenaiAdmin) Costs(ctx context.Context, start time.Time, end time.Time) ([]ProviderCost, error) {
+	query := openaiAdminQuery(start, end)
+	query.Set("group_by", "line_item")
+	var costs []ProviderCost
+	err := admin.pages(ctx, OpenaiCostsEndpoint, query, func(bucket openaiBucket) {
+		for _, result := range bucket.Results {
+			costs = append(costs, ProviderCost{
+				Provider:  "openai",
+				LineItem:  result.LineItem,
+				Start:     time.Unix(bucket.StartTime, 0),
+				End:       time.Unix(bucket.EndTime, 0),
+				AmountUSD: result.Amount.Value,
+			})
+		}
+	})
+	return costs, err
+}
+
+type openaiBucket struct {
+	StartTime int64 `json:"start_time"`
+	EndTime   int64 `json:"end_time"`
+	Results   []struct {
+		Model            string `json:"model"`
+		NumModelRequests int    `json:"num_model_requests"`
+		InputTokens      int    `json:"input_tokens"`
+		OutputTokens     int    `json:"output_tokens"`
+		LineItem         string `json:"line_item"`
+		Amount           struct {
+			Value    float64 `json:"value"`
+			Currency string  `json:"currency"`
+		} `json:"amount"`
+	} `json:"results"`
+}
+
+func openaiAdminQuery(start time.Time, end time.Time) url.Values {
+	query := url.Values{}
+	query.Set("start_time", strconv.FormatInt(start.Unix(), 10))
+	query.Set("end_time", strconv.FormatInt(end.Unix(), 10))
+	query.Set("bucket_width", "1d")
+	return query
+}
+
+// pages follows next_page through every page of an admin endpoint.
+func (admin *OpenaiAdmin) pages(ctx context.Context, endpoint string, query url.Values, visit func(openaiBucket)) error {
+	for {
+		var page struct {
+			Data     []openaiBucket `json:"data"`
+			HasMore  bool           `json:"has_more"`
+			NextPage string         `json:"next_page"`
+		}
+		req, err := http.NewRequestWithContext(ctx, "GET", endpoint+"?"+query.Encode(), nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+admin.ApiKey)
+		if err := admin.send(req, "openai", &page); err != nil {
+			return err
+		}
+		for _, bucket := range page.Data {
+			visit(bucket)
+		}
+		if !page.HasMore || page.NextPage == "" {
+			return nil
+		}
+		query.Set("page", page.NextPage)
+	}
+}
+
+// AnthropicAdmin reads the organization usage and cost reports. It needs an admin key.
+type AnthropicAdmin struct {
+	AgentConfig
+}
+
+// NewAnthropicAdmin creates an AnthropicAdmin with the admin key in ANTHROPIC_ADMIN_KEY.
+func NewAnthropicAdmin(opts ...AgentOption) (*AnthropicAdmin, error) {
+	config, err := newAdminConfig("ANTHROPIC_ADMIN_KEY", opts)
+	return &AnthropicAdmin{config}, err
+}
+
+func (admin *AnthropicAdmin) Usage(ctx context.Context, start time.Time, end time.Time) ([]ProviderUsage, error) {
+	query := anthropicAdminQuery(start, end)
+	query.Set("group_by[]", "model")
+	var usage []ProviderUsage
+	err := admin.pages(ctx, AnthropicUsageEndpoint, query, func(bucket anthropicBucket) {
+		for _, result := range bucket.Results {
+			usage = append(usage, ProviderUsage{
+				Provider:     "anthropic",
+				Model:        result.Model,
+				Start:        bucket.StartingAt,
+				End:          bucket.EndingAt,
+				InputTokens:  result.UncachedInputTokens + result.CacheReadInputTokens + result.CacheCreation.Ephemeral5m + result.CacheCreation.Ephemeral1h,
+				OutputTokens: result.OutputTokens,
+			})
+		}
+	})
+	return usage, err
+}
+
+func (admin *AnthropicAdmin) Costs(ctx context.Context, start time.Time, end time.Time) ([]ProviderCost, error) {
+	query := anthropicAdminQuery(start, end)
+	query.Set("group_by[]", "description")
+	var costs []ProviderCost
+	err := admin.pages(ctx, AnthropicCostEndpoint, query, func(bucket anthropicBucket) {
+		for _, result := range bucket.Results {
+			cents, _ := strconv.ParseFloat(result.Amount, 64)
+			costs = append(costs, ProviderCost{
+				Provider:  "anthropic",
+				LineItem:  result.Description,
+				Start:     bucket.StartingAt,
+				End:       bucket.EndingAt,
+				AmountUSD: cents / 100,
+			})
+		}
+	})
+	return costs, err
+}
+
+type anthropicBucket struct {
+	StartingAt time.Time `json:"starting_at"`
+	EndingAt   time.Time `json:"ending_at"`
+	Results    []struct {
+		Model                string `json:"model"`
+		UncachedInputTokens  int    `json:"uncached_input_tokens"`
+		CacheReadInputTokens int    `json:"cache_read_input_tokens"`
+		CacheCreation        struct {
+			Ephemeral5m int `json:"ephemeral_5m_input_tokens"`
+			Ephemeral1h int `json:"ephemeral_1h_input_tokens"`
+		} `json:"cache_creation"`
+		OutputTokens int    `json:"output_tokens"`
+		Description  string `json:"description"`
+		Amount       string `json:"amount"` // decimal string, in cents
+	} `json:"results"`
+}
+
+func anthropicAdminQuery(start time.Time, end time.Time) url.Values {
+	query := url.Values{}
+	query.Set("starting_at", start.UTC().Format(time.RFC3339))
+	query.Set("ending_at", end.UTC().Format(time.RFC3339))
+	query.Set("bucket_width", "1d")
+	return query
+}
+
+func (admin *AnthropicAdmin) pages(ctx context.Context, endpoint string, query url.Values, visit func(anthropicBucket)) error {
+	for {
+		var page struct {
+			Data     []anthropicBucket `json:"data"`
+			HasMore  bool              `json:"has_more"`
+			NextPage string            `json:"next_page"`
+		}
+		req, err := http.NewRequestWithContext(ctx, "GET", endpoint+"?"+query.Encode(), nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("x-api-key", admin.ApiKey)
+		req.Header.Set("anthropic-version", "2023-06-01")
+		if err := admin.send(req, "anthropic", &page); err != nil {
+			return err
+		}
+		for _, bucket := range page.Data {
+			visit(bucket)
+		}
+		if !page.HasMore || page.NextPage == "" {
+			return nil
+		}
+		query.Set("page", page.NextPage)
+	}
+}
+
+func newAdminConfig(keyName string, opts []AgentOption) (AgentConfig, error) {
+	apiKey, keyFound := os.LookupEnv(keyName)
+	if !keyFound {
+		return AgentConfig{}, fmt.Errorf("admin key %s not found", keyName)
+	}
+	config := AgentConfig{ApiKey: apiKey}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	config.client = config.newHTTPClient()
+	return config, nil
+}
+
+// UsageDifference compares the usage a provider reported with the local usage report.
+type UsageDifference struct {
+	Provider string
+	Local    UsageTotals
+	Remote   UsageTotals
+}
+
+// CompareUsage totals local (see UsageReport) and remote usage and costs per provider. Models are not
+// compared one by one because providers report resolved versions of aliases like "-latest".
+// The local report only covers this process, so compare it to the remote usage of the same period
+// and api key, ideally a project dedicated to it.
+func CompareUsage(local Usage, remote []ProviderUsage, costs []ProviderCost) []UsageDifference {
+	byProvider := make(map[string]*UsageDifference)
+	difference := func(provider string) *UsageDifference {
+		if byProvider[provider] == nil {
+			byProvider[provider] = &UsageDifference{Provider: provider}
+		}
+		return byProvider[provider]
+	}
+	for key, totals := range local.ByModel {
+		provider, _, _ := strings.Cut(key, ":")
+		d := difference(provider)
+		d.Local.Requests += totals.Requests
+		d.Local.InputTokens += totals.InputTokens
+		d.Local.OutputTokens += totals.OutputTokens
+		d.Local.CostUSD += totals.CostUSD
+	}
+	for _, usage := range remote {
+		d := difference(usage.Provider)
+		d.Remote.Requests += usage.Requests
+		d.Remote.InputTokens += usage.InputTokens
+		d.Remote.OutputTokens += usage.OutputTokens
+	}
+	for _, cost := range costs {
+		difference(cost.Provider).Remote.CostUSD += cost.AmountUSD
+	}
+
+	differences := make([]UsageDifference, 0, len(byProvider))
+	for _, d := range byProvider {
+		differences = append(differences, *d)
+	}
+	sort.Slice(differences, func(i, j int) bool { return differences[i].Provider < differences[j].Provider })
+	return differences
+}
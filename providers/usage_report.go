@@ -0,0 +1,132 @@
+package provider
+
+import "sync"
+
+// PriceFunc returns the cost in USD of a round trip on model. Reasoning tokens are part of
+// the output tokens and priced like them.
+type PriceFunc func(model string, inputTokens int, outputTokens int) float64
+
+// UsageTotals is the accumulated usage of a model, agent or tag.
+type UsageTotals struct {
+	Requests     int     `json:"requests"`
+	InputTokens  int     `json:"input_tokens"`
+	OutputTokens int     `json:"output_tokens"`
+	CostUSD      float64 `json:"cost_usd"`
+
+	ReasoningTokens  int     `json:"reasoning_tokens"`   // included in OutputTokens
+	ReasoningCostUSD float64 `json:"reasoning_cost_usd"` // included in CostUSD
+}
+
+func (totals *UsageTotals) add(stats RoundTripStats, cost roundTripCost) {
+	totals.Requests++
+	totals.InputTokens += stats.InputTokens
+	totals.OutputTokens += stats.OutputTokens
+	totals.CostUSD += cost.total
+	totals.ReasoningTokens += stats.ReasoningTokens
+	totals.ReasoningCostUSD += cost.reasoning
+}
+
+type roundTripCost struct {
+	total     float64
+	reasoning float64
+}
+
+// Usage is a snapshot of the process wide usage, see EnableUsageReport.
+// Agents without a name are reported under "", cached responses are not counted.
+type Usage struct {
+	Total   UsageTotals            `json:"total"`
+	ByModel map[string]UsageTotals `json:"by_model"`
+	ByAgent map[string]UsageTotals `json:"by_agent"`
+	ByTag   map[string]UsageTotals `json:"by_tag"`
+}
+
+var usageReport struct {
+	sync.Mutex
+	enabled bool
+	price   PriceFunc
+	usage   Usage
+}
+
+// EnableUsageReport starts accumulating the usage of every agent in the process.
+// price may be nil, in which case the round trips are priced with the agents' pricing tables
+// (see WithPricing) and reasoning costs are reported as 0.
+func EnableUsageReport(price PriceFunc) {
+	usageReport.Lock()
+	defer usageReport.Unlock()
+	usageReport.enabled = true
+	usageReport.price = price
+	if usageReport.usage.ByModel == nil {
+		usageReport.usage = newUsage()
+	}
+}
+
+// UsageReport returns the usage accumulated since EnableUsageReport or the last ResetUsageReport,
+// e.g. to serve from a /costs endpoint.
+func UsageReport() Usage {
+	usageReport.Lock()
+	defer usageReport.Unlock()
+	snapshot := newUsage()
+	snapshot.Total = usageReport.usage.Total
+	for model, totals := range usageReport.usage.ByModel {
+		snapshot.ByModel[model] = totals
+	}
+	for agent, totals := range usageReport.usage.ByAgent {
+		snapshot.ByAgent[agent] = totals
+	}
+	for tag, totals := range usageReport.usage.ByTag {
+		snapshot.ByTag[tag] = totals
+	}
+	return snapshot
+}
+
+// ResetUsageReport clears the accumulated usage without disabling the report.
+func ResetUsageReport() {
+	usageReport.Lock()
+	defer usageReport.Unlock()
+	usageReport.usage = newUsage()
+}
+
+func newUsage() Usage {
+	return Usage{
+		ByModel: make(map[string]UsageTotals),
+		ByAgent: make(map[string]UsageTotals),
+		ByTag:   make(map[string]UsageTotals),
+	}
+}
+
+func (config *AgentConfig) reportUsage(stats RoundTripStats) {
+	if stats.Cached {
+		return
+	}
+	usageReport.Lock()
+	defer usageReport.Unlock()
+	if !usageReport.enabled {
+		return
+	}
+	cost := priceRoundTrip(usageReport.price, stats)
+	usage := &usageReport.usage
+	usage.Total.add(stats, cost)
+	addTo(usage.ByModel, stats.Provider+":"+stats.Model, stats, cost)
+	addTo(usage.ByAgent, config.Name, stats, cost)
+	for _, tag := range config.Tags {
+		addTo(usage.ByTag, tag, stats, cost)
+	}
+}
+
+// priceRoundTrip prices stats with price, or as the agent priced it when price is nil.
+func priceRoundTrip(price PriceFunc, stats RoundTripStats) roundTripCost {
+	cost := roundTripCost{total: stats.CostUSD}
+	if price != nil {
+		cost.total = price(stats.Model, stats.InputTokens, stats.OutputTokens)
+		if stats.ReasoningTokens > 0 {
+			cost.reasoning = price(stats.Model, 0, stats.ReasoningTokens)
+		}
+	}
+	return cost
+}
+
+func addTo(totals map[string]UsageTotals, key string, stats RoundTripStats, cost roundTripCost) {
+	entry := totals[key]
+	entry.add(stats, cost)
+	totals[key] = entry
+}
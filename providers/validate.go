@@ -0,0 +1,218 @@
+package provider
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ValidationError lists every `validate` tag violation found in a set of tool arguments.
+type ValidationError struct {
+	Violations []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid arguments: " + strings.Join(e.Violations, "; ")
+}
+
+// ValidateStruct checks v against its `validate` struct tags.
+// Supported rules: required, omitempty, email, url, min=N, max=N, len=N, gt=N, gte=N, lt=N, lte=N, oneof=a b c.
+// For strings, slices and maps the comparisons apply to the length, for numbers to the value.
+// omitempty skips the other rules of a field left empty. RegisterTool and AddTool reject
+// parameters with rules outside this list.
+func ValidateStruct(v any) error {
+	value := reflect.ValueOf(v)
+	for value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return nil
+	}
+	var violations []string
+	validateFields(value, "", &violations)
+	if len(violations) > 0 {
+		return &ValidationError{Violations: violations}
+	}
+	return nil
+}
+
+func validateFields(value reflect.Value, prefix string, violations *[]string) {
+	t := value.Type()
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		fieldName := jsonFieldName(field)
+		if fieldName == "-" {
+			continue
+		}
+		fieldName = prefix + fieldName
+		fieldValue := value.Field(i)
+
+		if rules := validateRules(field); len(rules) > 0 && !(fieldValue.IsZero() && slices.Contains(rules, "omitempty")) {
+			for _, rule := range rules {
+				if msg := checkRule(fieldValue, rule); msg != "" {
+					*violations = append(*violations, fmt.Sprintf("%s %s", fieldName, msg))
+				}
+			}
+		}
+		if fieldValue.Kind() == reflect.Struct {
+			validateFields(fieldValue, fieldName+".", violations)
+		}
+	}
+}
+
+// validateRules returns the rules of field's validate tag.
+func validateRules(field reflect.StructField) []string {
+	var rules []string
+	for _, rule := range strings.Split(field.Tag.Get("validate"), ",") {
+		if rule = strings.TrimSpace(rule); rule != "" {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// jsonFieldName is the name of field in JSON, "-" for fields left out of it.
+func jsonFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		name = strings.ToLower(field.Name)
+	}
+	return name
+}
+
+// jsonOmitEmpty reports whether field is tagged omitempty, which makes it optional in tool schemas.
+func jsonOmitEmpty(field reflect.StructField) bool {
+	_, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+	return slices.Contains(strings.Split(options, ","), "omitempty")
+}
+
+// checkValidateTags reports the validate rules of t and its nested structs that ValidateStruct
+// doesn't support or can't parse, which would otherwise reject every call of the tool.
+func checkValidateTags(t reflect.Type) error {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	return checkFieldTags(t, "")
+}
+
+func checkFieldTags(t reflect.Type, prefix string) error {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		fieldName := prefix + field.Name
+		for _, rule := range validateRules(field) {
+			name, arg, _ := strings.Cut(rule, "=")
+			switch name {
+			case "required", "omitempty", "email", "url", "oneof":
+			case "min", "max", "len", "gt", "gte", "lt", "lte":
+				if _, err := strconv.ParseFloat(arg, 64); err != nil {
+					return fmt.Errorf("field %s: malformed validate rule %q", fieldName, rule)
+				}
+			default:
+				return fmt.Errorf("field %s: unsupported validate rule %q", fieldName, rule)
+			}
+		}
+		if field.Type.Kind() == reflect.Struct {
+			if err := checkFieldTags(field.Type, fieldName+"."); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func checkRule(value reflect.Value, rule string) string {
+	name, arg, _ := strings.Cut(rule, "=")
+	switch name {
+	case "", "omitempty":
+		return ""
+	case "required":
+		if value.IsZero() {
+			return "is required"
+		}
+	case "email":
+		if s, ok := stringValue(value); ok && s != "" {
+			if addr, err := mail.ParseAddress(s); err != nil || addr.Address != s {
+				return "must be a valid email address"
+			}
+		}
+	case "url":
+		if s, ok := stringValue(value); ok && s != "" {
+			if u, err := url.ParseRequestURI(s); err != nil || u.Scheme == "" || u.Host == "" {
+				return "must be a valid url"
+			}
+		}
+	case "min", "max", "len", "gt", "gte", "lt", "lte":
+		limit, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return fmt.Sprintf("has malformed rule %q", rule)
+		}
+		measure, unit, ok := measureValue(value)
+		if !ok {
+			return ""
+		}
+		switch {
+		case (name == "min" || name == "gte") && measure < limit:
+			return fmt.Sprintf("must be at least %s%s", arg, unit)
+		case (name == "max" || name == "lte") && measure > limit:
+			return fmt.Sprintf("must be at most %s%s", arg, unit)
+		case name == "gt" && measure <= limit:
+			return fmt.Sprintf("must be more than %s%s", arg, unit)
+		case name == "lt" && measure >= limit:
+			return fmt.Sprintf("must be less than %s%s", arg, unit)
+		case name == "len" && measure != limit:
+			return fmt.Sprintf("must be exactly %s%s", arg, unit)
+		}
+	case "oneof":
+		options := strings.Fields(arg)
+		current := fmt.Sprintf("%v", value.Interface())
+		for _, option := range options {
+			if current == option {
+				return ""
+			}
+		}
+		return fmt.Sprintf("must be one of [%s]", strings.Join(options, ", "))
+	default:
+		return fmt.Sprintf("has unknown rule %q", name)
+	}
+	return ""
+}
+
+func stringValue(value reflect.Value) (string, bool) {
+	if value.Kind() != reflect.String {
+		return "", false
+	}
+	return value.String(), true
+}
+
+// measureValue returns the number min/max/len compare against and the unit used in messages.
+func measureValue(value reflect.Value) (float64, string, bool) {
+	switch value.Kind() {
+	case reflect.String:
+		return float64(len([]rune(value.String()))), " characters", true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(value.Len()), " items", true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), "", true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint()), "", true
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), "", true
+	}
+	return 0, "", false
+}
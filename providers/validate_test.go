@@ -0,0 +1,90 @@
+package provider
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type contactParams struct {
+	Email   string   `json:"email,omitempty" validate:"omitempty,email"`
+	Name    string   `json:"name" validate:"required,max=20"`
+	Age     int      `json:"age,omitempty" validate:"omitempty,gte=18,lt=130"`
+	Tags    []string `json:"tags" validate:"lte=2"`
+	Address struct {
+		Country string `json:"country" validate:"len=2"`
+	} `json:"address"`
+}
+
+func TestValidateStruct(t *testing.T) {
+	valid := func() contactParams {
+		params := contactParams{Name: "Ada", Tags: []string{"vip"}}
+		params.Address.Country = "GB"
+		return params
+	}
+	tests := []struct {
+		name       string
+		change     func(*contactParams)
+		violations []string
+	}{
+		{name: "valid", change: func(params *contactParams) {}},
+		{name: "omitted optional fields", change: func(params *contactParams) { params.Email, params.Age = "", 0 }},
+		{name: "optional fields set", change: func(params *contactParams) { params.Email, params.Age = "ada@example.com", 36 }},
+		{name: "bad email", change: func(params *contactParams) { params.Email = "ada" }, violations: []string{"email must be a valid email address"}},
+		{name: "missing name", change: func(params *contactParams) { params.Name = "" }, violations: []string{"name is required"}},
+		{name: "too young", change: func(params *contactParams) { params.Age = 12 }, violations: []string{"age must be at least 18"}},
+		{name: "too old", change: func(params *contactParams) { params.Age = 130 }, violations: []string{"age must be less than 130"}},
+		{name: "too many tags", change: func(params *contactParams) { params.Tags = []string{"a", "b", "c"} }, violations: []string{"tags must be at most 2 items"}},
+		{name: "nested field", change: func(params *contactParams) { params.Address.Country = "GBR" }, violations: []string{"address.country must be exactly 2 characters"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			params := valid()
+			test.change(&params)
+			err := ValidateStruct(params)
+			var violations []string
+			var validationErr *ValidationError
+			if errors.As(err, &validationErr) {
+				violations = validationErr.Violations
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(violations, test.violations) {
+				t.Errorf("got violations %q, want %q", violations, test.violations)
+			}
+		})
+	}
+}
+
+func SendInvite(params contactParams) string { return "sent" }
+
+type diveParams struct {
+	Emails []string `json:"emails" validate:"dive,email"`
+}
+
+func SendInvites(params diveParams) string { return "sent" }
+
+type malformedParams struct {
+	Inner struct {
+		Count int `json:"count" validate:"min=two"`
+	} `json:"inner"`
+}
+
+func CountThings(params malformedParams) string { return "counted" }
+
+func TestRegisterToolChecksValidateTags(t *testing.T) {
+	agent, err := NewAgent("ollama:llama3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := agent.RegisterTool(SendInvite, contactParams{}, "Sends an invite."); err != nil {
+		t.Errorf("supported rules rejected: %v", err)
+	}
+	if err := agent.RegisterTool(SendInvites, diveParams{}, "Sends invites."); err == nil || !strings.Contains(err.Error(), `"dive"`) {
+		t.Errorf("got %v, want the unsupported rule reported", err)
+	}
+	if err := agent.AddTool(NewTool("count_things", "Counts things.", CountThings)); err == nil || !strings.Contains(err.Error(), "Inner.Count") {
+		t.Errorf("got %v, want the malformed nested rule reported", err)
+	}
+}
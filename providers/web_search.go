@@ -0,0 +1,137 @@
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// WebSearch configures the web search Anthropic runs on its side, see WithWebSearch.
+type WebSearch struct {
+	MaxUses        int      // searches per request, unlimited when 0
+	AllowedDomains []string // only search these domains, e.g. "docs.python.org"
+	BlockedDomains []string // never search these domains, can't be combined with AllowedDomains
+}
+
+// WithWebSearch lets Claude search the web while answering, without a search api key of your own.
+// The answer's messages carry the pages it read (SearchResults) and the sources it quotes (Citations).
+// Anthropic only; searches are billed per use on top of the tokens.
+func WithWebSearch(search WebSearch) AgentOption {
+	return func(a *AgentConfig) {
+		a.WebSearch = &search
+	}
+}
+
+// Citation is a source backing a piece of an answer.
+type Citation struct {
+	URL       string `json:"url"`
+	Title     string `json:"title,omitempty"`
+	CitedText string `json:"cited_text,omitempty"`
+}
+
+// SearchResult is a page found by a web search the model ran.
+type SearchResult struct {
+	URL     string `json:"url"`
+	Title   string `json:"title,omitempty"`
+	PageAge string `json:"page_age,omitempty"`
+}
+
+const anthropicWebSearchTool = "web_search_20250305"
+
+func (search *WebSearch) anthropicTool() AnthropicTool {
+	return AnthropicTool{
+		Type:           anthropicWebSearchTool,
+		Name:           "web_search",
+		MaxUses:        search.MaxUses,
+		AllowedDomains: search.AllowedDomains,
+		BlockedDomains: search.BlockedDomains,
+	}
+}
+
+// MarshalJSON sends server tools, which have a type, with their settings instead of an input schema.
+func (tool AnthropicTool) MarshalJSON() ([]byte, error) {
+	if tool.Type == "" {
+		return json.Marshal(struct {
+			Name        string     `json:"name"`
+			Description string     `json:"description"`
+			Parameters  Parameters `json:"input_schema"`
+		}{tool.Name, tool.Description, tool.Parameters})
+	}
+	return json.Marshal(struct {
+		Type           string   `json:"type"`
+		Name           string   `json:"name"`
+		MaxUses        int      `json:"max_uses,omitempty"`
+		AllowedDomains []string `json:"allowed_domains,omitempty"`
+		BlockedDomains []string `json:"blocked_domains,omitempty"`
+	}{tool.Type, tool.Name, tool.MaxUses, tool.AllowedDomains, tool.BlockedDomains})
+}
+
+type AnthropicCitation struct {
+	Type           string `json:"type"` // web_search_result_location
+	URL            string `json:"url,omitempty"`
+	Title          string `json:"title,omitempty"`
+	CitedText      string `json:"cited_text,omitempty"`
+	EncryptedIndex string `json:"encrypted_index,omitempty"`
+}
+
+type AnthropicSearchResult struct {
+	Type             string `json:"type"` // web_search_result
+	URL              string `json:"url"`
+	Title            string `json:"title"`
+	PageAge          string `json:"page_age,omitempty"`
+	EncryptedContent string `json:"encrypted_content,omitempty"`
+}
+
+// UnmarshalJSON reads the content of web_search_tool_result blocks, a list of results or an
+// error, which other blocks hold as a string, and keeps the block as received in Raw.
+func (content *AnthropicContent) UnmarshalJSON(data []byte) error {
+	type anthropicContent AnthropicContent
+	var raw struct {
+		anthropicContent
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*content = AnthropicContent(raw.anthropicContent)
+	content.Raw = append(json.RawMessage(nil), data...)
+	if len(raw.Content) == 0 {
+		return nil
+	}
+	switch raw.Content[0] {
+	case '"':
+		return json.Unmarshal(raw.Content, &content.Content)
+	case '[':
+		return json.Unmarshal(raw.Content, &content.SearchResults)
+	case '{':
+		var searchErr struct {
+			ErrorCode string `json:"error_code"`
+		}
+		if err := json.Unmarshal(raw.Content, &searchErr); err != nil {
+			return err
+		}
+		content.ErrorCode = searchErr.ErrorCode
+	}
+	return nil
+}
+
+// searchResults converts the results of a web_search_tool_result block.
+func searchResults(item AnthropicContent) ([]SearchResult, error) {
+	if item.ErrorCode != "" {
+		return nil, fmt.Errorf("web search failed: %s", item.ErrorCode)
+	}
+	results := make([]SearchResult, 0, len(item.SearchResults))
+	for _, result := range item.SearchResults {
+		results = append(results, SearchResult{URL: result.URL, Title: result.Title, PageAge: result.PageAge})
+	}
+	return results, nil
+}
+
+func citations(item AnthropicContent) []Citation {
+	var cited []Citation
+	for _, citation := range item.Citations {
+		if citation.URL != "" {
+			cited = append(cited, Citation{URL: citation.URL, Title: citation.Title, CitedText: citation.CitedText})
+		}
+	}
+	return cited
+}
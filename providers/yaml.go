@@ -0,0 +1,295 @@
+package provider
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseYAML decodes the subset of YAML used by agent config files: nested block mappings
+// and sequences, flow sequences of scalars, quoted scalars and | / > block scalars.
+// Anchors, tags, multi-document streams and flow mappings are not supported.
+func parseYAML(data string) (any, error) {
+	parser := &yamlParser{lines: strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n")}
+	value, err := parser.parseNode(0)
+	if err != nil {
+		return nil, err
+	}
+	if parser.skipBlank(); parser.pos < len(parser.lines) {
+		return nil, parser.errorf("unexpected indentation")
+	}
+	return value, nil
+}
+
+type yamlParser struct {
+	lines []string
+	pos   int
+}
+
+func (p *yamlParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("yaml line %d: %s", p.pos+1, fmt.Sprintf(format, args...))
+}
+
+// skipBlank advances past empty and comment-only lines.
+func (p *yamlParser) skipBlank() {
+	for p.pos < len(p.lines) {
+		trimmed := strings.TrimSpace(p.lines[p.pos])
+		if trimmed != "" && !strings.HasPrefix(trimmed, "#") && trimmed != "---" {
+			return
+		}
+		p.pos++
+	}
+}
+
+func (p *yamlParser) current() (indent int, content string) {
+	line := p.lines[p.pos]
+	content = strings.TrimLeft(line, " ")
+	return len(line) - len(content), stripYAMLComment(content)
+}
+
+func isSequenceItem(content string) bool {
+	return content == "-" || strings.HasPrefix(content, "- ")
+}
+
+func (p *yamlParser) parseNode(minIndent int) (any, error) {
+	p.skipBlank()
+	if p.pos >= len(p.lines) {
+		return nil, nil
+	}
+	indent, content := p.current()
+	if indent < minIndent {
+		return nil, nil
+	}
+	if strings.HasPrefix(strings.TrimLeft(p.lines[p.pos], " "), "\t") {
+		return nil, p.errorf("tabs are not allowed for indentation")
+	}
+	if isSequenceItem(content) {
+		return p.parseSequence(indent)
+	}
+	if _, _, isPair := splitYAMLPair(content); isPair {
+		return p.parseMapping(indent)
+	}
+	p.pos++
+	return parseYAMLScalar(content)
+}
+
+func (p *yamlParser) parseMapping(indent int) (any, error) {
+	mapping := make(map[string]any)
+	for {
+		p.skipBlank()
+		if p.pos >= len(p.lines) {
+			return mapping, nil
+		}
+		lineIndent, content := p.current()
+		if lineIndent < indent || isSequenceItem(content) && lineIndent == indent {
+			return mapping, nil
+		}
+		if lineIndent > indent {
+			return nil, p.errorf("unexpected indentation")
+		}
+		key, rest, isPair := splitYAMLPair(content)
+		if !isPair {
+			return nil, p.errorf("expected \"key: value\"")
+		}
+		p.pos++
+
+		var value any
+		var err error
+		switch {
+		case strings.HasPrefix(rest, "|") || strings.HasPrefix(rest, ">"):
+			value = p.parseBlockScalar(indent, rest)
+		case rest == "":
+			p.skipBlank()
+			if p.pos < len(p.lines) {
+				// sequences may sit at the same indentation as their key
+				if nextIndent, next := p.current(); nextIndent == indent && isSequenceItem(next) {
+					value, err = p.parseSequence(indent)
+					break
+				}
+			}
+			value, err = p.parseNode(indent + 1)
+		default:
+			value, err = parseYAMLScalar(rest)
+		}
+		if err != nil {
+			return nil, err
+		}
+		mapping[key] = value
+	}
+}
+
+func (p *yamlParser) parseSequence(indent int) (any, error) {
+	sequence := []any{}
+	for {
+		p.skipBlank()
+		if p.pos >= len(p.lines) {
+			return sequence, nil
+		}
+		lineIndent, content := p.current()
+		if lineIndent != indent || !isSequenceItem(content) {
+			return sequence, nil
+		}
+		item := strings.TrimSpace(strings.TrimPrefix(content, "-"))
+
+		var value any
+		var err error
+		if _, _, isPair := splitYAMLPair(item); isPair || isSequenceItem(item) {
+			// "- key: value" starts a mapping indented at the item's content
+			itemIndent := indent + len(content) - len(strings.TrimLeft(content[1:], " "))
+			p.lines[p.pos] = strings.Repeat(" ", itemIndent) + item
+			value, err = p.parseNode(itemIndent)
+		} else if item == "" {
+			p.pos++
+			value, err = p.parseNode(indent + 1)
+		} else {
+			p.pos++
+			value, err = parseYAMLScalar(item)
+		}
+		if err != nil {
+			return nil, err
+		}
+		sequence = append(sequence, value)
+	}
+}
+
+// parseBlockScalar reads a | (literal) or > (folded) block under a key at keyIndent.
+func (p *yamlParser) parseBlockScalar(keyIndent int, header string) string {
+	var lines []string
+	blockIndent := -1
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" {
+			lines = append(lines, "")
+			p.pos++
+			continue
+		}
+		indent := len(line) - len(trimmed)
+		if indent <= keyIndent {
+			break
+		}
+		if blockIndent < 0 {
+			blockIndent = indent
+		}
+		if indent < blockIndent {
+			break
+		}
+		lines = append(lines, line[blockIndent:])
+		p.pos++
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	var text string
+	if strings.HasPrefix(header, ">") {
+		var folded strings.Builder
+		for i, line := range lines {
+			switch {
+			case i == 0:
+			case line == "" || lines[i-1] == "":
+				folded.WriteString("\n")
+			default:
+				folded.WriteString(" ")
+			}
+			folded.WriteString(line)
+		}
+		text = folded.String()
+	} else {
+		text = strings.Join(lines, "\n")
+	}
+	if !strings.Contains(header, "-") && text != "" {
+		text += "\n"
+	}
+	return text
+}
+
+// splitYAMLPair splits "key: value" outside of quotes.
+func splitYAMLPair(content string) (string, string, bool) {
+	if strings.HasPrefix(content, "\"") || strings.HasPrefix(content, "'") {
+		end := strings.IndexByte(content[1:], content[0])
+		if end < 0 {
+			return "", "", false
+		}
+		key := content[1 : end+1]
+		rest := content[end+2:]
+		if rest != ":" && !strings.HasPrefix(rest, ": ") {
+			return "", "", false
+		}
+		return key, strings.TrimSpace(rest[1:]), true
+	}
+	if strings.HasPrefix(content, "[") || strings.HasPrefix(content, "{") {
+		return "", "", false
+	}
+	if strings.HasSuffix(content, ":") {
+		return strings.TrimSpace(content[:len(content)-1]), "", true
+	}
+	key, rest, found := strings.Cut(content, ": ")
+	if !found {
+		return "", "", false
+	}
+	return strings.TrimSpace(key), strings.TrimSpace(rest), true
+}
+
+// stripYAMLComment removes a trailing " # comment" that is not inside quotes.
+func stripYAMLComment(content string) string {
+	var quote byte
+	for i := 0; i < len(content); i++ {
+		switch c := content[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' {
+				i++
+			}
+		case (c == '"' || c == '\'') && (i == 0 || strings.IndexByte(" :[,", content[i-1]) >= 0):
+			quote = c
+		case c == '#' && (i == 0 || content[i-1] == ' '):
+			return strings.TrimSpace(content[:i])
+		}
+	}
+	return strings.TrimSpace(content)
+}
+
+func parseYAMLScalar(value string) (any, error) {
+	value = strings.TrimSpace(value)
+	switch {
+	case strings.HasPrefix(value, "\""):
+		return strconv.Unquote(value)
+	case strings.HasPrefix(value, "'"):
+		if len(value) < 2 || !strings.HasSuffix(value, "'") {
+			return nil, fmt.Errorf("yaml: unterminated string %s", value)
+		}
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'"), nil
+	case strings.HasPrefix(value, "["):
+		if !strings.HasSuffix(value, "]") {
+			return nil, fmt.Errorf("yaml: unterminated flow sequence %s", value)
+		}
+		items := []any{}
+		inner := strings.TrimSpace(value[1 : len(value)-1])
+		if inner == "" {
+			return items, nil
+		}
+		for _, part := range strings.Split(inner, ",") {
+			item, err := parseYAMLScalar(part)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case value == "{}":
+		return map[string]any{}, nil
+	case value == "" || value == "~" || value == "null":
+		return nil, nil
+	case value == "true" || value == "false":
+		return value == "true", nil
+	}
+	if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return i, nil
+	}
+	if f, err := strconv.ParseFloat(value, 64); err == nil {
+		return f, nil
+	}
+	return value, nil
+}